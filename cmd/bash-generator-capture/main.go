@@ -0,0 +1,65 @@
+//go:build cgo
+
+// Command bash-generator-capture records from the default input device for
+// bash-generator builds without cgo. It speaks the protocol described in
+// internal/capture over stdin and stdout and isn't meant to be run by hand.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jerilseb/bash-generator/internal/capture"
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+func main() {
+	opts := record.DefaultOptions
+	flag.IntVar(&opts.Channels, "channels", opts.Channels, "number of input channels")
+	flag.IntVar(&opts.Channel, "channel", opts.Channel, "input channel to record on its own, counting from 1; 0 for all of them")
+	flag.IntVar(&opts.SampleRate, "rate", opts.SampleRate, "sample rate in Hz")
+	flag.IntVar(&opts.FramesPerChunk, "frames", opts.FramesPerChunk, "frames per chunk sent to bash-generator")
+	list := flag.Bool("list", false, "print the input devices as JSON instead of recording")
+	flag.Parse()
+
+	run := serve
+	if *list {
+		run = listDevices
+	}
+	if err := run(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "bash-generator-capture: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func serve(opts record.Options) error {
+	if err := record.Init(); err != nil {
+		capture.Fail(os.Stdout, err)
+		return err
+	}
+	defer record.Terminate()
+
+	recorder, err := record.OpenWith(opts)
+	if err != nil {
+		capture.Fail(os.Stdout, err)
+		return err
+	}
+	defer recorder.Close()
+
+	return capture.Serve(os.Stdin, os.Stdout, recorder)
+}
+
+func listDevices(record.Options) error {
+	if err := record.Init(); err != nil {
+		return err
+	}
+	defer record.Terminate()
+
+	devices, err := record.InputDevices()
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(os.Stdout).Encode(devices)
+}
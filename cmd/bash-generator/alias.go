@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jerilseb/bash-generator/internal/snippets"
+	"github.com/jerilseb/bash-generator/pkg/embed"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// aliasSimilarity is how close in meaning a request has to come to the
+// phrase of an alias to be taken for it, when it isn't spelled like any.
+const aliasSimilarity = 0.9
+
+// snippetStore returns the store of the aliases.
+func snippetStore() *snippets.Store {
+	return &snippets.Store{Path: filepath.Join(configDir(), snippetsFileName)}
+}
+
+// runAlias adds, removes and lists aliases: phrases that stand for a command
+// of the user's own, which is used as it is rather than asking the model.
+func runAlias(args []string) error {
+	fs := flag.NewFlagSet("alias", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %[1]s alias add PHRASE ['->'] COMMAND\n       %[1]s alias rm PHRASE\n       %[1]s alias [list]\n\n"+
+			"PHRASE and COMMAND may hold placeholders like <tag>: what a placeholder in\n"+
+			"PHRASE stands for in a request fills in the one of the same name in COMMAND,\n"+
+			"the others are asked for. Quote them, and the arrow, from the shell, e.g.\n\n"+
+			"  %[1]s alias add 'deploy <tag> to staging' '->' './deploy.sh --env staging <tag>'\n", appName)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	store := snippetStore()
+	switch fs.Arg(0) {
+	case "", "list":
+		if fs.NArg() > 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		return listAliases(store)
+	case "add":
+		rest := fs.Args()[1:]
+		if len(rest) > 1 && rest[1] == "->" {
+			rest = append(rest[:1], rest[2:]...)
+		}
+		if len(rest) < 2 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		sn := snippets.Snippet{Phrase: strings.TrimSpace(rest[0]), Command: strings.TrimSpace(strings.Join(rest[1:], " "))}
+		if snippets.Normalize(sn.Phrase) == "" || sn.Command == "" {
+			return errors.New("the phrase and the command must not be empty")
+		}
+		commandPlaceholders := generate.FindPlaceholders(sn.Command)
+		for _, name := range generate.FindPlaceholders(sn.Phrase) {
+			if !slices.Contains(commandPlaceholders, name) {
+				return fmt.Errorf("the command has no <%s> for what <%s> in the phrase stands for", name, name)
+			}
+		}
+		if err := store.Add(sn); err != nil {
+			return fmt.Errorf("failed to save the alias: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Saying %q now runs: %s\n", sn.Phrase, sn.Command)
+		return nil
+	case "rm":
+		if fs.NArg() != 2 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		removed, err := store.Remove(fs.Arg(1))
+		if err != nil {
+			return fmt.Errorf("failed to remove the alias: %w", err)
+		}
+		if !removed {
+			return fmt.Errorf("there is no alias %q", fs.Arg(1))
+		}
+		fmt.Fprintf(os.Stderr, "Removed the alias %q.\n", fs.Arg(1))
+		return nil
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+func listAliases(store *snippets.Store) error {
+	aliases, err := store.Load()
+	if err != nil {
+		return err
+	}
+	if len(aliases) == 0 {
+		fmt.Fprintf(os.Stderr, "No aliases yet. Add one with: %s alias add PHRASE -> COMMAND\n", appName)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PHRASE\tCOMMAND")
+	for _, a := range aliases {
+		fmt.Fprintf(w, "%s\t%s\n", a.Phrase, strings.ReplaceAll(a.Command, "\n", "; "))
+	}
+	return w.Flush()
+}
+
+// expandAlias returns the command of the alias text is, with the
+// placeholders of its phrase filled in, or nil if it is none. A request not
+// spelled like any alias is compared with them by meaning when there is an
+// embeddings endpoint; that failing only means no alias is used.
+func (p *pipeline) expandAlias(ctx context.Context, text string) (*generate.Response, error) {
+	aliases, err := snippetStore().Load()
+	if err != nil || len(aliases) == 0 {
+		return nil, err
+	}
+	m := snippets.Find(aliases, text)
+	if m == nil && p.embedder != nil {
+		m, err = p.closestAlias(ctx, aliases, text)
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		if err != nil {
+			slog.Warn("failed to compare the request with the aliases", "err", err)
+		}
+	}
+	if m == nil {
+		return nil, nil
+	}
+	slog.Info("alias", "phrase", m.Snippet.Phrase, "exact", m.Exact)
+	command := replacePlaceholders(m.Snippet.Command, m.Values, p.shell)
+	explanation := fmt.Sprintf("The alias %q.", m.Snippet.Phrase)
+	if !m.Exact {
+		explanation = fmt.Sprintf("The alias %q, which the request sounded like.", m.Snippet.Phrase)
+	}
+	return &generate.Response{Command: command, Explanation: explanation, Placeholders: generate.FindPlaceholders(command)}, nil
+}
+
+// closestAlias returns the alias without placeholders whose phrase means the
+// same as text, at aliasSimilarity or closer, or nil if there is none.
+func (p *pipeline) closestAlias(ctx context.Context, aliases []snippets.Snippet, text string) (*snippets.Match, error) {
+	var candidates []snippets.Snippet
+	texts := []string{text}
+	for _, a := range aliases {
+		if !snippets.HasPlaceholders(a.Phrase) {
+			candidates = append(candidates, a)
+			texts = append(texts, a.Phrase)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	vectors, err := p.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	var best *snippets.Match
+	bestSimilarity := aliasSimilarity
+	for i, a := range candidates {
+		if s := embed.Similarity(vectors[0], vectors[i+1]); s >= bestSimilarity {
+			best, bestSimilarity = &snippets.Match{Snippet: a}, s
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jerilseb/bash-generator/internal/audit"
+	"github.com/jerilseb/bash-generator/internal/history"
+)
+
+// auditLog gets every command recordHistory saves, for -audit-log; nil if
+// there is no audit log.
+var auditLog *audit.Log
+
+// setupAudit makes recordHistory also write every command to the audit log
+// at path, signed with the key in keyFile if one is given.
+func setupAudit(path, keyFile string) error {
+	if path == "" {
+		if keyFile != "" {
+			return errors.New("-audit-key needs -audit-log")
+		}
+		return nil
+	}
+	key, err := readAuditKey(keyFile)
+	if err != nil {
+		return err
+	}
+	auditLog = &audit.Log{Path: path, Key: key}
+	return nil
+}
+
+// readAuditKey returns the key in keyFile, or nil if there is no key file.
+func readAuditKey(keyFile string) ([]byte, error) {
+	if keyFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the audit key: %w", err)
+	}
+	key := []byte(strings.TrimSpace(string(data)))
+	if len(key) == 0 {
+		return nil, fmt.Errorf("the audit key file %s is empty", keyFile)
+	}
+	return key, nil
+}
+
+// recordAudit appends e to the audit log, if there is one, with the user and
+// host. Failing to do so is reported but never fatal, like for the history.
+func recordAudit(e history.Entry) {
+	if auditLog == nil {
+		return
+	}
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	r := audit.Record{Time: e.Time, User: name, Host: host, Dir: e.Dir, Transcript: e.Transcript, Command: e.Command,
+		Edited: e.Edited, Accepted: e.Accepted, ExitCode: e.ExitCode}
+	if err := auditLog.Append(r); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write the audit log: %v\n", err)
+	}
+}
+
+// auditFlags are the flags of audit.
+type auditFlags struct {
+	path    string
+	keyFile string
+	verify  bool
+	limit   int
+	who     string
+}
+
+func (f *auditFlags) define(fs *flag.FlagSet, cfg *config) {
+	fs.StringVar(&f.path, "audit-log", cfg.AuditLog, "audit log to read")
+	fs.StringVar(&f.keyFile, "audit-key", cfg.AuditKey, "file with the key the records are signed with")
+	fs.BoolVar(&f.verify, "verify", false, "check that every record follows the one before it, and is signed with the key if one is given, instead of listing them")
+	fs.IntVar(&f.limit, "n", 20, "number of records to show")
+	fs.StringVar(&f.who, "user", "", "only show the commands of this user")
+}
+
+// runAudit lists the latest records of an audit log, or checks that none were
+// changed or removed with -verify.
+func runAudit(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	var flags auditFlags
+	flags.define(fs, cfg)
+	fs.Parse(args)
+	if flags.path == "" {
+		return errors.New("there is no audit log; give one with -audit-log or set audit_log in the config file")
+	}
+	key, err := readAuditKey(flags.keyFile)
+	if err != nil {
+		return err
+	}
+	log := &audit.Log{Path: flags.path, Key: key}
+
+	if flags.verify {
+		n, err := log.Verify()
+		if err != nil {
+			return fmt.Errorf("%s: %w", flags.path, err)
+		}
+		how := "chained"
+		if key != nil {
+			how = "chained and signed"
+		}
+		fmt.Printf("All %d records of %s are %s.\n", n, flags.path, how)
+		return nil
+	}
+
+	records, err := log.Load()
+	if err != nil {
+		return err
+	}
+	if flags.who != "" {
+		var theirs []audit.Record
+		for _, r := range records {
+			if r.User == flags.who {
+				theirs = append(theirs, r)
+			}
+		}
+		records = theirs
+	}
+	if len(records) > flags.limit {
+		records = records[len(records)-flags.limit:]
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tUSER\tHOST\tRUN\tREQUEST\tCOMMAND")
+	for _, r := range records {
+		run := "no"
+		switch {
+		case r.ExitCode != nil:
+			run = fmt.Sprintf("exit %d", *r.ExitCode)
+		case r.Accepted:
+			run = "yes"
+		}
+		command := strings.ReplaceAll(r.Command, "\n", "; ")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Time.Local().Format("2006-01-02 15:04"), r.User, r.Host, run, r.Transcript, command)
+	}
+	return w.Flush()
+}
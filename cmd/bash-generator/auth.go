@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/jerilseb/bash-generator/internal/capability"
+)
+
+// keyringTimeout bounds a call to the keyring program, which may wait on a
+// secret service that never answers.
+const keyringTimeout = 5 * time.Second
+
+// keyringAccount is a key auth login can store.
+type keyringAccount struct {
+	name string
+	// env is the environment variable the stored key stands in for.
+	env    string
+	vendor string
+}
+
+var keyringAccounts = []keyringAccount{
+	{name: "openai", env: "OPENAI_API_KEY", vendor: "OpenAI"},
+	{name: "azure", env: "AZURE_OPENAI_API_KEY", vendor: "Azure OpenAI"},
+	{name: "anthropic", env: "ANTHROPIC_API_KEY", vendor: "Anthropic"},
+	{name: "gemini", env: "GEMINI_API_KEY", vendor: "Gemini"},
+	{name: "deepgram", env: "DEEPGRAM_API_KEY", vendor: "Deepgram"},
+	{name: "assemblyai", env: "ASSEMBLYAI_API_KEY", vendor: "AssemblyAI"},
+	{name: "google", env: "GOOGLE_SPEECH_API_KEY", vendor: "Google Speech-to-Text"},
+}
+
+// apiKey returns the environment variable env if set, else the key stored in
+// the keyring for account, else fallback. Without a keyring, as on headless
+// servers, keys come from the environment and the config file only.
+func apiKey(env, account, fallback string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	if key, err := keyringGet(account); err == nil && key != "" {
+		return key
+	}
+	return fallback
+}
+
+// keyringProgram returns the path of the program that talks to the keyring:
+// security on macOS, secret-tool where there is a Secret Service.
+func keyringProgram() (string, error) {
+	return capability.Require("keyring")
+}
+
+// runKeyring runs the keyring program with stdin and returns its output.
+func runKeyring(stdin string, args ...string) (string, error) {
+	path, err := keyringProgram()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), keyringTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", filepath.Base(path), err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return string(out), nil
+}
+
+// keyringGet returns the key stored for account, or "" if there is none.
+func keyringGet(account string) (string, error) {
+	path, err := keyringProgram()
+	if err != nil {
+		return "", err
+	}
+	var out string
+	if filepath.Base(path) == "security" {
+		out, err = runKeyring("", "find-generic-password", "-s", appName, "-a", account, "-w")
+	} else {
+		out, err = runKeyring("", "lookup", "service", appName, "account", account)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// Both programs fail when nothing is stored.
+		return "", nil
+	}
+	return strings.TrimSpace(out), err
+}
+
+// keyringSet stores key for account, replacing what was stored before. The key
+// goes through stdin, never the command line, where other users could see it.
+func keyringSet(account, key string) error {
+	path, err := keyringProgram()
+	if err != nil {
+		return err
+	}
+	if filepath.Base(path) == "security" {
+		// In interactive mode security reads its commands from stdin; -X takes
+		// the password in hex, which needs no quoting.
+		_, err = runKeyring(fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n", appName, account, hex.EncodeToString([]byte(key))), "-i")
+		return err
+	}
+	_, err = runKeyring(key, "store", "--label", appName+" "+account+" API key", "service", appName, "account", account)
+	return err
+}
+
+// keyringDelete removes the key stored for account, if any.
+func keyringDelete(account string) error {
+	path, err := keyringProgram()
+	if err != nil {
+		return err
+	}
+	if filepath.Base(path) == "security" {
+		_, err = runKeyring("", "delete-generic-password", "-s", appName, "-a", account)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// Nothing was stored.
+			return nil
+		}
+		return err
+	}
+	_, err = runKeyring("", "clear", "service", appName, "account", account)
+	return err
+}
+
+// runAuth stores API keys in the OS keyring, so they needn't sit in plain text
+// in the environment or the config file.
+func runAuth(args []string) error {
+	fs := flag.NewFlagSet("auth", flag.ExitOnError)
+	names := make([]string, len(keyringAccounts))
+	for i, a := range keyringAccounts {
+		names[i] = a.name
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s auth login|logout [%s]\n       %s auth status\n", appName, strings.Join(names, "|"), appName)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if fs.Arg(0) == "status" {
+		return printAuthStatus()
+	}
+	account := keyringAccounts[0]
+	if fs.NArg() == 2 {
+		i := -1
+		for j, a := range keyringAccounts {
+			if a.name == fs.Arg(1) {
+				i = j
+			}
+		}
+		if i < 0 {
+			return fmt.Errorf("unknown key %q (expected %s)", fs.Arg(1), strings.Join(names, ", "))
+		}
+		account = keyringAccounts[i]
+	}
+	if _, err := keyringProgram(); err != nil {
+		return fmt.Errorf("%w; set %s in the environment instead", err, account.env)
+	}
+
+	switch fs.Arg(0) {
+	case "login":
+		key, err := readAPIKey(account.vendor)
+		if err != nil {
+			return err
+		}
+		if err := keyringSet(account.name, key); err != nil {
+			return fmt.Errorf("failed to store the key: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Stored the %s API key in the keyring. %s still takes precedence when set.\n", account.vendor, account.env)
+	case "logout":
+		if err := keyringDelete(account.name); err != nil {
+			return fmt.Errorf("failed to remove the key: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Removed the %s API key from the keyring.\n", account.vendor)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+// readAPIKey asks for a key without echoing it, or reads it from stdin when
+// that isn't a terminal, so it can be piped in.
+func readAPIKey(vendor string) (string, error) {
+	var key string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprintf(os.Stderr, "Paste your %s API key: ", vendor)
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the key: %w", err)
+		}
+		key = string(b)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read the key: %w", err)
+		}
+		key = line
+	}
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", errors.New("no key given")
+	}
+	return key, nil
+}
+
+// printAuthStatus shows where each key would be taken from.
+func printAuthStatus() error {
+	if _, err := keyringProgram(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v; keys come from the environment and the config file.\n\n", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tKEYRING\tENVIRONMENT")
+	for _, a := range keyringAccounts {
+		stored := "no"
+		if key, err := keyringGet(a.name); err == nil && key != "" {
+			stored = "yes"
+		}
+		env := "-"
+		if os.Getenv(a.env) != "" {
+			env = a.env + " (used)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", a.name, stored, env)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"github.com/jerilseb/bash-generator/pkg/safety"
+)
+
+// Batch output formats.
+const (
+	batchScript = "script"
+	batchJSON   = "json"
+)
+
+// batchResult is what came of one request of a batch, as the JSON report has it.
+type batchResult struct {
+	// Line is the line of the file the request is on.
+	Line        int      `json:"line"`
+	Request     string   `json:"request"`
+	Command     string   `json:"command,omitempty"`
+	Explanation string   `json:"explanation,omitempty"`
+	Level       string   `json:"level,omitempty"`
+	Warnings    []string `json:"warnings,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// batchFlags are the flags of batch.
+type batchFlags struct {
+	opts   *options
+	format string
+	out    string
+	jobs   int
+}
+
+func (f *batchFlags) define(fs *flag.FlagSet, cfg *config) error {
+	var err error
+	if f.opts, err = addPipelineFlags(fs, cfg); err != nil {
+		return err
+	}
+	fs.StringVar(&f.format, "format", batchScript, "format to write in: script (a Bash script with each request as a comment) or json (a report with the command, explanation and warnings of each request)")
+	fs.StringVar(&f.out, "o", "", "file to write to; standard output if empty")
+	fs.IntVar(&f.jobs, "jobs", 4, "most requests to work on at once")
+	return nil
+}
+
+// runBatch generates commands for a file of requests, one per line, e.g. the
+// steps of a runbook, and writes them out as a script to review or as a JSON
+// report. The requests are sent a few at a time, within -concurrency.
+func runBatch(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	var flags batchFlags
+	if err := flags.define(fs, cfg); err != nil {
+		return err
+	}
+	opts := flags.opts
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s batch [flags] FILE\n\nGenerates a command for each line of FILE, or of standard input if FILE is -.\nBlank lines and lines starting with # are skipped.\n\n", appName)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if flags.format != batchScript && flags.format != batchJSON {
+		return fmt.Errorf("unknown format %q (expected script or json)", flags.format)
+	}
+	if flags.jobs < 1 {
+		return fmt.Errorf("invalid -jobs %d: expected at least 1", flags.jobs)
+	}
+	// The jobs share the API's rate limits like the clients of serve.
+	if opts.Concurrency == "" {
+		opts.Concurrency = defaultServerConcurrency
+	}
+
+	results, err := readBatch(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no requests in %s", fs.Arg(0))
+	}
+
+	p, err := newPipeline(opts)
+	if err != nil {
+		return err
+	}
+	if opts.ShowCost {
+		defer func() { printUsage(os.Stderr, p.takeUsage()) }()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	failed := p.generateBatch(ctx, results, flags.jobs)
+	if ctx.Err() != nil {
+		return exitWith(exitGeneration, cancelled(os.Stderr, ctx.Err()))
+	}
+
+	var data bytes.Buffer
+	if flags.format == batchJSON {
+		enc := json.NewEncoder(&data)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	} else {
+		writeBatchScript(&data, fs.Arg(0), results)
+	}
+	if err != nil {
+		return err
+	}
+	if flags.out == "" {
+		_, err = os.Stdout.Write(data.Bytes())
+	} else if flags.format == batchScript {
+		err = os.WriteFile(flags.out, data.Bytes(), 0o755)
+	} else {
+		err = os.WriteFile(flags.out, data.Bytes(), 0o644)
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return &exitStatus{code: exitGeneration, err: fmt.Errorf("no command for %d of %d requests", failed, len(results))}
+	}
+	return nil
+}
+
+// readBatch reads the requests in path, or standard input if it is -.
+func readBatch(path string) ([]batchResult, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var results []batchResult
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		request := strings.TrimSpace(sc.Text())
+		if request == "" || strings.HasPrefix(request, "#") {
+			continue
+		}
+		results = append(results, batchResult{Line: line, Request: request})
+	}
+	return results, sc.Err()
+}
+
+// generateBatch generates the commands for results, jobs at a time, and
+// returns how many couldn't be generated. Failures are reported on stderr as
+// they happen.
+func (p *pipeline) generateBatch(ctx context.Context, results []batchResult, jobs int) (failed int) {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, jobs)
+	)
+	for i := range results {
+		wg.Add(1)
+		go func(r *batchResult) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+			generated, err := p.generate(ctx, r.Request, typedRequest, nil)
+			if err != nil {
+				r.Error = err.Error()
+				mu.Lock()
+				failed++
+				fmt.Fprintf(os.Stderr, "Line %d: %v\n", r.Line, err)
+				mu.Unlock()
+				return
+			}
+			r.Command = generated.Command
+			r.Explanation = generated.Explanation
+			verdict := checkCommand(generated)
+			r.Level = verdict.Level.String()
+			r.Warnings = verdict.Reasons
+		}(&results[i])
+	}
+	wg.Wait()
+	return failed
+}
+
+// writeBatchScript writes results as a script. Each command comes after its
+// request, as a comment; dangerous ones are commented out too, so they only
+// run once someone has looked at them.
+func writeBatchScript(w io.Writer, source string, results []batchResult) {
+	fmt.Fprintln(w, "#!/usr/bin/env bash")
+	fmt.Fprintf(w, "# Generated by %s batch from %s. Review it before running it.\n", appName, source)
+	for _, r := range results {
+		fmt.Fprintf(w, "\n# %d: %s\n", r.Line, r.Request)
+		if r.Error != "" {
+			fmt.Fprintf(w, "# No command: %s\n", r.Error)
+			continue
+		}
+		if r.Explanation != "" {
+			fmt.Fprintf(w, "# %s\n", r.Explanation)
+		}
+		if len(r.Warnings) > 0 {
+			fmt.Fprintf(w, "# Warning (%s): this command %s.\n", r.Level, strings.Join(r.Warnings, ", "))
+		}
+		command := r.Command
+		if r.Level == safety.Dangerous.String() {
+			fmt.Fprintln(w, "# Commented out until reviewed:")
+			command = "# " + strings.ReplaceAll(command, "\n", "\n# ")
+		}
+		fmt.Fprintln(w, command)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/usage"
+)
+
+// budgetWarnShare is the share of the monthly budget past which a warning is shown.
+const budgetWarnShare = 0.8
+
+// monthStart returns the start of the calendar month t is in.
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// monthSpend adds up the estimated cost of the API calls made so far in the
+// month of now, from the usage log. Calls to models without a known price
+// count as free.
+func monthSpend(now time.Time) (float64, error) {
+	calls, err := usageStore().Load(monthStart(now))
+	if err != nil {
+		return 0, err
+	}
+	var usd float64
+	for _, c := range calls {
+		if c.Kind == usage.Run {
+			continue
+		}
+		cost, _ := c.Cost()
+		usd += cost
+	}
+	return usd, nil
+}
+
+// checkBudget refuses API calls once this month's spend has reached the
+// budget, unless -over-budget is given, and warns once per run when it passes
+// budgetWarnShare of it. An unreadable usage log is reported but lets the
+// call through.
+func (p *pipeline) checkBudget() error {
+	if p.budget <= 0 {
+		return nil
+	}
+	spent, err := monthSpend(time.Now())
+	if err != nil {
+		slog.Warn("failed to add up this month's spend", "err", err)
+		return nil
+	}
+	if spent >= p.budget && !p.overBudget {
+		return &exitStatus{
+			code: exitOverBudget,
+			err:  fmt.Errorf("this month's API calls have cost $%.2f, reaching the monthly budget of $%.2f; pass -over-budget to make them anyway", spent, p.budget),
+		}
+	}
+	if spent >= budgetWarnShare*p.budget {
+		p.budgetWarning.Do(func() {
+			fmt.Fprintf(os.Stderr, "Warning: this month's API calls have cost $%.2f, %.0f%% of the monthly budget of $%.2f.\n", spent, 100*spent/p.budget, p.budget)
+		})
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const bundleVersion = 1
+
+// bundleMerge decides how an imported file is combined with the local copy.
+type bundleMerge int
+
+const (
+	// mergeReplace writes the imported file, keeping an existing local file unless forced.
+	mergeReplace bundleMerge = iota
+	// mergeConfig overlays the imported settings on the local config, keeping local secrets.
+	mergeConfig
+	// mergeLines appends the imported lines that are not present locally yet.
+	mergeLines
+)
+
+// bundleFile is one file that export/import knows how to carry.
+type bundleFile struct {
+	Name  string // path inside the bundle
+	Path  func() string
+	Merge bundleMerge
+}
+
+var bundleFiles = []bundleFile{
+	{Name: "config/" + configFileName, Path: func() string { return filepath.Join(configDir(), configFileName) }, Merge: mergeConfig},
+	{Name: "config/" + vocabFileName, Path: func() string { return filepath.Join(configDir(), vocabFileName) }, Merge: mergeReplace},
+	{Name: "config/" + snippetsFileName, Path: func() string { return filepath.Join(configDir(), snippetsFileName) }, Merge: mergeReplace},
+	{Name: "data/" + historyFileName, Path: func() string { return filepath.Join(dataDir(), historyFileName) }, Merge: mergeLines},
+}
+
+// bundleManifest is stored as manifest.json at the start of every bundle.
+type bundleManifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Files   []string  `json:"files"`
+}
+
+// exportFlags are the flags of export.
+type exportFlags struct {
+	out string
+}
+
+func (f *exportFlags) define(fs *flag.FlagSet) {
+	fs.StringVar(&f.out, "out", fmt.Sprintf("%s-%s.tar.zst", appName, time.Now().Format("20060102")), "bundle file to write")
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var flags exportFlags
+	flags.define(fs)
+	fs.Parse(args)
+
+	contents := make(map[string][]byte)
+	manifest := bundleManifest{Version: bundleVersion, Created: time.Now().UTC()}
+	for _, bf := range bundleFiles {
+		data, err := os.ReadFile(bf.Path())
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if bf.Merge == mergeConfig {
+			if data, err = stripSecrets(data); err != nil {
+				return fmt.Errorf("failed to read %s: %w", bf.Path(), err)
+			}
+		}
+		contents[bf.Name] = data
+		manifest.Files = append(manifest.Files, bf.Name)
+	}
+
+	f, err := os.OpenFile(flags.out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, "manifest.json", manifestData); err != nil {
+		return err
+	}
+	for _, name := range manifest.Files {
+		if err := writeTarFile(tw, name, contents[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d file(s) to %s (API keys are not included)\n", len(manifest.Files), flags.out)
+	return nil
+}
+
+// importFlags are the flags of import.
+type importFlags struct {
+	force bool
+}
+
+func (f *importFlags) define(fs *flag.FlagSet) {
+	fs.BoolVar(&f.force, "force", false, "overwrite existing vocabulary and snippet files")
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var flags importFlags
+	flags.define(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s import [-force] <bundle.tar.zst>\n", appName)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	contents, err := readBundle(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read bundle: %w", err)
+	}
+
+	for _, bf := range bundleFiles {
+		data, ok := contents[bf.Name]
+		if !ok {
+			continue
+		}
+		path := bf.Path()
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return err
+		}
+		local, err := os.ReadFile(path)
+		exists := err == nil
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		switch bf.Merge {
+		case mergeConfig:
+			if exists {
+				if data, err = mergeConfigData(local, data); err != nil {
+					return fmt.Errorf("failed to merge %s: %w", path, err)
+				}
+			}
+		case mergeLines:
+			data = mergeLineData(local, data)
+		case mergeReplace:
+			if exists && !flags.force && !bytes.Equal(local, data) {
+				fmt.Printf("Skipping %s: file exists (use -force to overwrite)\n", path)
+				continue
+			}
+		}
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return err
+		}
+		fmt.Printf("Imported %s\n", path)
+	}
+	return nil
+}
+
+// readBundle returns the known files of a bundle keyed by their name in the bundle.
+func readBundle(path string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	known := make(map[string]bool, len(bundleFiles))
+	for _, bf := range bundleFiles {
+		known[bf.Name] = true
+	}
+
+	contents := make(map[string][]byte)
+	var manifest *bundleManifest
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case hdr.Name == "manifest.json":
+			manifest = &bundleManifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+		case known[hdr.Name]:
+			contents[hdr.Name] = data
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("not a %s bundle: manifest.json missing", appName)
+	}
+	if manifest.Version > bundleVersion {
+		return nil, fmt.Errorf("bundle version %d is newer than supported version %d", manifest.Version, bundleVersion)
+	}
+	return contents, nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// stripSecrets removes credentials from a JSON config document.
+func stripSecrets(data []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for key := range fields {
+		if isSecretConfigKey(key) {
+			delete(fields, key)
+		}
+	}
+	return json.MarshalIndent(fields, "", "  ")
+}
+
+// mergeConfigData overlays the imported settings on the local config. Local
+// secrets are always kept, and secrets in the import are ignored.
+func mergeConfigData(local, imported []byte) ([]byte, error) {
+	var localFields, importedFields map[string]json.RawMessage
+	if err := json.Unmarshal(local, &localFields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(imported, &importedFields); err != nil {
+		return nil, err
+	}
+	if localFields == nil {
+		localFields = make(map[string]json.RawMessage)
+	}
+	for key, value := range importedFields {
+		if isSecretConfigKey(key) {
+			continue
+		}
+		localFields[key] = value
+	}
+	return json.MarshalIndent(localFields, "", "  ")
+}
+
+// mergeLineData appends the lines of imported that local does not contain yet.
+func mergeLineData(local, imported []byte) []byte {
+	seen := make(map[string]bool)
+	var out bytes.Buffer
+	out.Write(local)
+	if len(local) > 0 && !bytes.HasSuffix(local, []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(local))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		seen[scanner.Text()] = true
+	}
+	scanner = bufio.NewScanner(bytes.NewReader(imported))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || seen[line] {
+			continue
+		}
+		seen[line] = true
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
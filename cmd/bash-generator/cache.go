@@ -0,0 +1,185 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/history"
+	"github.com/jerilseb/bash-generator/internal/semcache"
+	"github.com/jerilseb/bash-generator/pkg/embed"
+	"github.com/jerilseb/bash-generator/pkg/transcribe"
+)
+
+// Semantic cache settings.
+const (
+	// cacheSimilarity is how close an earlier request has to come to a new
+	// one for its command to be offered instead of asking the model. Requests
+	// that differ in a file name or number score lower.
+	cacheSimilarity = 0.93
+	// maxCacheBackfill caps how many earlier requests without an embedding
+	// are embedded along with a new one.
+	maxCacheBackfill = 200
+	// embeddingDimensions shortens OpenAI's embeddings, which are plenty
+	// precise at that size to tell near-identical requests apart.
+	embeddingDimensions = 256
+)
+
+// embedder returns a client for the embeddings endpoint: the one configured
+// with embeddings_url, or the one next to the transcription endpoint. It is
+// nil if there is none to be found, as on Azure, where embeddings have a
+// deployment of their own, or with another transcription provider and no
+// OpenAI key.
+func (ep *apiEndpoint) embedder(cfg *config) *embed.Client {
+	c := &embed.Client{URL: cfg.EmbeddingsURL, Model: cfg.EmbeddingsModel, Header: ep.header()}
+	if c.URL == "" {
+		if ep.Provider != transcribe.OpenAI && ep.APIKey == "" {
+			return nil
+		}
+		const transcriptions = "/audio/transcriptions"
+		u, err := url.Parse(ep.TranscriptionURL)
+		if ep.Azure || err != nil || !strings.HasSuffix(u.Path, transcriptions) {
+			return nil
+		}
+		u.Path = strings.TrimSuffix(u.Path, transcriptions) + "/embeddings"
+		u.RawPath = ""
+		c.URL = u.String()
+	}
+	if c.Model == "" {
+		c.Model = embed.DefaultModel
+		c.Dimensions = embeddingDimensions
+	}
+	return c
+}
+
+// cachedCommand is an earlier command offered for a new request.
+type cachedCommand struct {
+	entry      history.Entry
+	similarity float64
+}
+
+// findCached returns the commands of the earlier requests that mean the same
+// as text, closest first, with each command only once. Earlier requests get
+// their embeddings in the same API call as text, as they are needed, so the
+// cache fills up by itself.
+func (p *pipeline) findCached(ctx context.Context, text string) ([]cachedCommand, error) {
+	entries, err := historyStore().Load()
+	if err != nil {
+		return nil, err
+	}
+	store := embeddingStore()
+	embeddings, err := store.Load(p.embedder.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	undone := make(map[time.Time]bool)
+	for _, e := range entries {
+		if e.UndoOf != nil {
+			undone[e.UndoOf.UTC()] = true
+		}
+	}
+	var candidates, missing []history.Entry
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if !cacheable(e) || undone[e.Time.UTC()] {
+			continue
+		}
+		candidates = append(candidates, e)
+		if _, ok := embeddings[e.Time.UTC()]; !ok && len(missing) < maxCacheBackfill {
+			missing = append(missing, e)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	texts := []string{text}
+	for _, e := range missing {
+		texts = append(texts, e.Transcript)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	vectors, err := p.embedder.Embed(ctx, texts)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("embedding timed out after %s (see -timeout)", p.timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	added := make([]semcache.Vector, len(missing))
+	for i, e := range missing {
+		embeddings[e.Time.UTC()] = vectors[i+1]
+		added[i] = semcache.NewVector(e.Time, p.embedder.Model, vectors[i+1])
+	}
+	if err := store.Append(added...); err != nil {
+		return nil, err
+	}
+
+	// The latest of equally close requests wins, as candidates are newest
+	// first and the sort is stable.
+	var matches []cachedCommand
+	seen := make(map[string]int)
+	for _, e := range candidates {
+		similarity := embed.Similarity(vectors[0], embeddings[e.Time.UTC()])
+		if similarity < cacheSimilarity {
+			continue
+		}
+		if i, ok := seen[e.Command]; ok {
+			if similarity > matches[i].similarity {
+				matches[i] = cachedCommand{entry: e, similarity: similarity}
+			}
+			continue
+		}
+		seen[e.Command] = len(matches)
+		matches = append(matches, cachedCommand{entry: e, similarity: similarity})
+	}
+	slices.SortStableFunc(matches, func(a, b cachedCommand) int {
+		return cmp.Compare(b.similarity, a.similarity)
+	})
+	return matches, nil
+}
+
+// cacheable reports whether the command of e is worth offering again: a
+// single line the user accepted that didn't fail when it was run.
+func cacheable(e history.Entry) bool {
+	return e.Accepted && e.UndoOf == nil && e.Transcript != "" && !strings.Contains(e.Command, "\n") &&
+		(e.ExitCode == nil || *e.ExitCode == 0)
+}
+
+// offerCached shows the command found for the request and asks whether to use
+// it rather than generating a new one.
+func offerCached(ui io.Writer, input *lineReader, cached *cachedCommand) (bool, error) {
+	fmt.Fprintf(ui, "\nYou asked for this before (%q, on %s):\n\n%s\n\nUse it again? (Y/n to generate a new one): ",
+		cached.entry.Transcript, cached.entry.Time.Local().Format("2006-01-02 15:04"), cached.entry.Command)
+	response, err := input.ReadLine()
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read user input: %w", err)
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "" || response == "y" || response == "yes", nil
+}
+
+// pickCached lets the user choose among the commands found for the request
+// with pk, or to generate a new one. It returns nil for a new one.
+func pickCached(pk *picker, matches []cachedCommand) (*cachedCommand, error) {
+	choices := make([]string, len(matches)+1)
+	for i, m := range matches {
+		choices[i] = fmt.Sprintf("%s    # %s (%s)", m.entry.Command, m.entry.Transcript, m.entry.Time.Local().Format("2006-01-02 15:04"))
+	}
+	choices[len(matches)] = "Generate a new command"
+	i, err := pk.pick("command", choices)
+	if errors.Is(err, errNothingPicked) || i == len(matches) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &matches[i], nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+// Chunked transcription settings.
+const (
+	// transcriptChunk is how long the chunks of a long recording are that
+	// are transcribed while recording goes on. Recordings shorter than one
+	// chunk are uploaded in one piece when they stop.
+	transcriptChunk = 30 * time.Second
+	// transcriptOverlap is how much consecutive chunks share, so a word cut
+	// off at the end of one is heard whole at the start of the next.
+	transcriptOverlap = 2 * time.Second
+	// maxChunkUploads caps the chunks being transcribed at the same time.
+	maxChunkUploads = 3
+	// maxStitchWords is the longest run of words looked for where two
+	// transcripts overlap.
+	maxStitchWords = 12
+)
+
+// chunkedTranscript transcribes a long recording in overlapping chunks while
+// it is being made, so once it stops only the last chunk is left to wait for.
+type chunkedTranscript struct {
+	p         *pipeline
+	ctx       context.Context
+	cancel    context.CancelFunc
+	resampler *record.Resampler
+	// audio is the recording so far, as mono at record.SpeechSampleRate;
+	// next is where the chunk that hasn't been sent yet starts in it.
+	audio []int16
+	next  int
+
+	wg      sync.WaitGroup
+	uploads chan struct{}
+	mu      sync.Mutex
+	parts   []string
+	err     error
+	// unsure is the chunk the transcription was least sure of, if any was
+	// below -min-confidence.
+	unsure *unsureTranscriptError
+}
+
+// startChunks prepares chunked transcription of audio captured with opts.
+func (p *pipeline) startChunks(ctx context.Context, opts record.Options) *chunkedTranscript {
+	ctx, cancel := context.WithCancel(ctx)
+	return &chunkedTranscript{
+		p:         p,
+		ctx:       ctx,
+		cancel:    cancel,
+		resampler: record.NewResampler(opts.Channels, opts.SampleRate, record.SpeechSampleRate),
+		uploads:   make(chan struct{}, maxChunkUploads),
+	}
+}
+
+// onChunk is passed to Recorder.RecordFunc. Every full chunk is transcribed
+// in the background.
+func (c *chunkedTranscript) onChunk(chunk []int16) {
+	c.audio = append(c.audio, c.resampler.Resample(chunk)...)
+	size := samplesFor(transcriptChunk)
+	for len(c.audio)-c.next >= size {
+		// Uploads fill in their part while more are added.
+		c.mu.Lock()
+		i := len(c.parts)
+		c.parts = append(c.parts, "")
+		c.mu.Unlock()
+		samples := c.audio[c.next : c.next+size : c.next+size]
+		c.next += size - samplesFor(transcriptOverlap)
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.uploads <- struct{}{}
+			defer func() { <-c.uploads }()
+			text, err := c.transcribe(i, samples)
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.parts[i] = text
+			if err != nil && c.err == nil {
+				c.err = err
+			}
+		}()
+	}
+}
+
+// transcribe uploads the ith chunk.
+func (c *chunkedTranscript) transcribe(i int, samples []int16) (string, error) {
+	rec := &record.Recording{Samples: samples, Channels: 1, SampleRate: record.SpeechSampleRate}
+	audio, err := c.p.encode(rec)
+	if err != nil {
+		return "", err
+	}
+	start := time.Now()
+	text, err := c.p.upload(c.ctx, audio, fmt.Sprintf("chunk%d%s", i+1, c.p.encoder.Ext()), rec.Duration())
+	slog.Debug("chunk transcribed", "chunk", i+1, "duration", rec.Duration(), "latency", time.Since(start), "err", err)
+	// An unsure chunk makes the whole transcript unsure, which finish reports.
+	if unsure, ok := unsureTranscript(err); ok {
+		c.mu.Lock()
+		if c.unsure == nil || unsure.confidence < c.unsure.confidence {
+			c.unsure = unsure
+		}
+		c.mu.Unlock()
+		return text, nil
+	}
+	return text, err
+}
+
+// split reports whether chunks were sent while recording.
+func (c *chunkedTranscript) split() bool {
+	return len(c.parts) > 0
+}
+
+// finish transcribes what is left of rec after the chunks sent while it was
+// recorded, and returns the transcripts stitched together. A recording too
+// short to have been split is transcribed whole. Callers fall back to
+// uploading rec whole if a split one fails, but not if it is only unsure.
+func (c *chunkedTranscript) finish(ctx context.Context, rec *record.Recording) (string, error) {
+	if !c.split() {
+		return c.p.transcribe(ctx, rec)
+	}
+	defer c.p.timing.since(phaseTranscribe, time.Now())
+	if c.p.saveAudio != "" {
+		audio, err := c.p.encode(rec)
+		if err != nil {
+			return "", err
+		}
+		if err := c.p.save(audio); err != nil {
+			return "", err
+		}
+	}
+	// The chunks were sent with the context of the recording; Ctrl+C from
+	// now on has to stop them too.
+	stop := context.AfterFunc(ctx, c.cancel)
+	defer stop()
+
+	var last string
+	var lastErr error
+	// Only the overlap is left when the recording stopped right after a chunk.
+	if rest := c.audio[c.next:]; len(rest) > samplesFor(transcriptOverlap) {
+		last, lastErr = c.transcribe(len(c.parts), rest)
+	}
+	c.wg.Wait()
+	if err := errors.Join(c.err, lastErr); err != nil {
+		return "", err
+	}
+	text := stitchTranscripts(append(c.parts, last)...)
+	if c.unsure != nil {
+		return text, &unsureTranscriptError{text: text, confidence: c.unsure.confidence}
+	}
+	return text, nil
+}
+
+// close stops the uploads still in progress.
+func (c *chunkedTranscript) close() {
+	c.cancel()
+}
+
+// samplesFor returns how many samples of mono speech audio last d.
+func samplesFor(d time.Duration) int {
+	return int(d * record.SpeechSampleRate / time.Second)
+}
+
+// stitchTranscripts joins the transcripts of overlapping chunks. The words
+// heard twice, at the end of one chunk and the start of the next, are found
+// by comparing them without case and punctuation, and only kept once.
+func stitchTranscripts(parts ...string) string {
+	var words []string
+	for _, part := range parts {
+		next := strings.Fields(part)
+		overlap := 0
+		for n := min(maxStitchWords, len(words), len(next)); n > 0; n-- {
+			if sameWords(words[len(words)-n:], next[:n]) {
+				overlap = n
+				break
+			}
+		}
+		words = append(words, next[overlap:]...)
+	}
+	return strings.Join(words, " ")
+}
+
+func sameWords(a, b []string) bool {
+	for i := range a {
+		if normalizeWord(a[i]) != normalizeWord(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeWord(w string) string {
+	return strings.ToLower(strings.TrimFunc(w, func(r rune) bool { return unicode.IsPunct(r) }))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/internal/capability"
+)
+
+// clipboardPrograms maps the programs of the clipboard capability to the
+// arguments that make them copy stdin, and to the environment variable that
+// tells whether their display server is in use.
+var clipboardPrograms = map[string]struct {
+	args    []string
+	display string
+}{
+	"pbcopy":  {},
+	"wl-copy": {display: "WAYLAND_DISPLAY"},
+	"xclip":   {args: []string{"-selection", "clipboard"}, display: "DISPLAY"},
+	"xsel":    {args: []string{"--clipboard", "--input"}, display: "DISPLAY"},
+	"clip":    {},
+}
+
+// copyToClipboard puts text on the system clipboard and returns how it did so.
+// Without a usable clipboard program, as over SSH, it asks the terminal to do
+// it with an OSC 52 escape sequence, which most modern terminals support.
+func copyToClipboard(text string) (string, error) {
+	for _, program := range capability.Lookup("clipboard").Programs {
+		p := clipboardPrograms[program]
+		if p.display != "" && os.Getenv(p.display) == "" {
+			continue
+		}
+		path, err := exec.LookPath(program)
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, p.args...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("%s failed: %w", program, err)
+		}
+		return program, nil
+	}
+
+	// The escape sequence must reach the terminal even when stdout is captured.
+	var w io.Writer = os.Stderr
+	if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		defer tty.Close()
+		w = tty
+	}
+	if err := writeOSC52(w, text); err != nil {
+		return "", err
+	}
+	return "the terminal", nil
+}
+
+// writeOSC52 writes the escape sequence that sets the clipboard to text.
+// Inside tmux the sequence is wrapped so tmux passes it to the outer terminal.
+func writeOSC52(w io.Writer, text string) error {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	if os.Getenv("TMUX") != "" {
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	_, err := io.WriteString(w, seq)
+	return err
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// shells are the shells init and completion write scripts for.
+var shells = []string{"zsh", "bash", "fish"}
+
+// completionFlag is a flag as completion scripts offer it.
+type completionFlag struct {
+	Name  string
+	About string
+	// Value is set for flags that take a value, which is completed as a file name.
+	Value bool
+}
+
+// completionCommand is a subcommand, or the generator itself when Name is
+// empty, as completion scripts offer it.
+type completionCommand struct {
+	Name  string
+	About string
+	Words []string
+	Flags []completionFlag
+}
+
+// ValueFlags returns the names of the flags that take a value, for bash.
+func (c completionCommand) ValueFlags() []string {
+	var names []string
+	for _, f := range c.Flags {
+		if f.Value {
+			names = append(names, "-"+f.Name)
+		}
+	}
+	return names
+}
+
+// FlagNames returns the names of all the flags, for bash.
+func (c completionCommand) FlagNames() []string {
+	names := make([]string, len(c.Flags))
+	for i, f := range c.Flags {
+		names[i] = "-" + f.Name
+	}
+	return names
+}
+
+// completionFlags lists the flags of fs.
+func completionFlags(fs *flag.FlagSet) []completionFlag {
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		b, isBool := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{
+			Name:  f.Name,
+			About: flagSummary(f.Usage),
+			Value: !isBool || !b.IsBoolFlag(),
+		})
+	})
+	return flags
+}
+
+// flagSummary shortens a flag's usage to what fits next to it in a menu: the
+// part before any explanation in parentheses or after a semicolon.
+func flagSummary(usage string) string {
+	if i := strings.IndexAny(usage, ";("); i > 0 {
+		usage = usage[:i]
+	}
+	return strings.TrimSpace(usage)
+}
+
+// completionCommands describes the generator and every subcommand.
+func completionCommands() []completionCommand {
+	fs := flag.NewFlagSet(appName, flag.ContinueOnError)
+	new(generateFlags).define(fs, &config{})
+	all := []completionCommand{{Flags: completionFlags(fs)}}
+	for _, c := range commands() {
+		fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+		if c.flags != nil {
+			c.flags(fs)
+		}
+		all = append(all, completionCommand{
+			Name:  c.name,
+			About: c.about,
+			Words: c.words,
+			Flags: completionFlags(fs),
+		})
+	}
+	return all
+}
+
+// completionScripts complete the generator's flags, subcommands and their
+// flags and arguments. Flags that take a value complete file names, the most
+// common kind of value.
+var completionScripts = map[string]string{
+	"bash": `# bash-generator bash completion
+# Add to ~/.bashrc:  source <({{.Bin}} completion bash)
+_bash_generator_completion() {
+  local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+  local cmd= flags values words
+  (( COMP_CWORD > 1 )) && cmd=${COMP_WORDS[1]}
+  case $cmd in
+{{- range .Commands}}{{if .Name}}
+  {{.Name}})
+    flags='{{join .FlagNames " "}}'
+    values='{{join .ValueFlags " "}}'
+    words='{{join .Words " "}}' ;;
+{{- end}}{{end}}
+  *)
+{{- with index .Commands 0}}
+    flags='{{join .FlagNames " "}}'
+    values='{{join .ValueFlags " "}}'
+{{- end}}
+    words=
+    (( COMP_CWORD == 1 )) && words='{{.Names}}' ;;
+  esac
+  if [[ " $values " == *" $prev "* ]]; then
+    COMPREPLY=($(compgen -f -- "$cur"))
+  elif [[ $cur == -* ]]; then
+    COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+  else
+    COMPREPLY=($(compgen -W "$words" -- "$cur"))
+  fi
+}
+complete -o default -F _bash_generator_completion {{.Name}}
+`,
+	"zsh": `#compdef {{.Name}}
+# bash-generator zsh completion
+# Add to ~/.zshrc:  source <({{.Bin}} completion zsh)
+_bash_generator_completion() {
+  local -a commands
+  commands=(
+{{- range .Commands}}{{if .Name}}
+    {{zshQuote (print .Name ":" .About)}}
+{{- end}}{{end}}
+  )
+  if (( CURRENT == 2 )) && [[ $PREFIX != -* ]]; then
+    _describe -t commands 'command' commands
+    return
+  fi
+  case $words[2] in
+{{- range .Commands}}{{if .Name}}
+  {{.Name}})
+    shift words
+    (( CURRENT-- ))
+    _arguments{{range .Flags}} \
+      {{zshFlag .}}{{end}}{{if .Words}} \
+      '1:argument:({{join .Words " "}})'{{end}} ;;
+{{- end}}{{end}}
+  *)
+{{- with index .Commands 0}}
+    _arguments{{range .Flags}} \
+      {{zshFlag .}}{{end}} ;;
+{{- end}}
+  esac
+}
+compdef _bash_generator_completion {{.Name}}
+`,
+	"fish": `# bash-generator fish completion
+# Add to ~/.config/fish/config.fish:  {{.Bin}} completion fish | source
+complete -c {{.Name}} -f
+{{- range .Commands}}{{if .Name}}
+complete -c {{$.Name}} -n __fish_use_subcommand -a {{.Name}} -d {{fishQuote .About}}
+{{- end}}{{end}}
+{{- with index .Commands 0}}{{range .Flags}}
+complete -c {{$.Name}} -n 'not __fish_seen_subcommand_from {{$.Names}}' {{fishFlag .}}
+{{- end}}{{end}}
+{{- range .Commands}}{{if .Name}}{{$cmd := .Name}}
+{{- if .Words}}
+complete -c {{$.Name}} -n '__fish_seen_subcommand_from {{$cmd}}' -a {{fishQuote (join .Words " ")}}
+{{- end}}
+{{- range .Flags}}
+complete -c {{$.Name}} -n '__fish_seen_subcommand_from {{$cmd}}' {{fishFlag .}}
+{{- end}}{{end}}{{end}}
+`,
+}
+
+// zshQuote quotes s in single quotes for zsh.
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// zshFlag returns the _arguments spec of f.
+func zshFlag(f completionFlag) string {
+	about := strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(f.About)
+	spec := "-" + f.Name + "[" + about + "]"
+	if f.Value {
+		spec += ":" + f.Name + ":_files"
+	}
+	return zshQuote(spec)
+}
+
+// fishQuote quotes s in single quotes for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// fishFlag returns the options of complete that offer f.
+func fishFlag(f completionFlag) string {
+	opts := "-o " + f.Name
+	if f.Value {
+		opts += " -r -F"
+	}
+	return opts + " -d " + fishQuote(f.About)
+}
+
+// runCompletion prints the completion script for a shell.
+func runCompletion(args []string) error {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s completion zsh|bash|fish\n", appName)
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	shell := fs.Arg(0)
+	script, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q (expected zsh, bash or fish)", shell)
+	}
+
+	bin, err := os.Executable()
+	if err != nil {
+		bin = appName
+	}
+
+	all := completionCommands()
+	names := make([]string, 0, len(all)-1)
+	for _, c := range all[1:] {
+		names = append(names, c.Name)
+	}
+	funcs := template.FuncMap{
+		"join":      strings.Join,
+		"zshQuote":  zshQuote,
+		"zshFlag":   zshFlag,
+		"fishQuote": fishQuote,
+		"fishFlag":  fishFlag,
+	}
+	tmpl := template.Must(template.New(shell).Funcs(funcs).Parse(script))
+	return tmpl.Execute(os.Stdout, struct {
+		Bin, Name, Names string
+		Commands         []completionCommand
+	}{
+		Bin:      shellQuote(bin),
+		Name:     appName,
+		Names:    strings.Join(names, " "),
+		Commands: all,
+	})
+}
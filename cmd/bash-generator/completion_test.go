@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestCompletionCommands(t *testing.T) {
+	all := completionCommands()
+	byName := make(map[string]completionCommand, len(all))
+	for _, c := range all {
+		byName[c.Name] = c
+	}
+	if len(byName) != len(commands())+1 {
+		t.Fatalf("got %d commands, want the generator and %d subcommands", len(byName), len(commands()))
+	}
+
+	tests := []struct {
+		name string
+		// flag is one of its flags, and value whether it takes a value.
+		flag  string
+		value bool
+	}{
+		{"", "print", false},
+		{"gen", "learn", false},
+		{"serve", "hotkey", true},
+		{"install-service", "socket", true},
+		{"export", "out", true},
+		{"models", "local-only", false},
+		{"cache", "expired", false},
+		{"batch", "context", true},
+	}
+	for _, tt := range tests {
+		var found *completionFlag
+		for _, f := range byName[tt.name].Flags {
+			if f.Name == tt.flag {
+				found = &f
+			}
+		}
+		switch {
+		case found == nil:
+			t.Errorf("%q has no flag -%s", tt.name, tt.flag)
+		case found.Value != tt.value:
+			t.Errorf("-%s of %q takes a value = %v, want %v", tt.flag, tt.name, found.Value, tt.value)
+		}
+	}
+
+	for _, name := range []string{"config", "devices", "doctor", "alias", "auth", "completion"} {
+		if flags := byName[name].Flags; len(flags) != 0 {
+			t.Errorf("%s has flags %v, want none", name, flags)
+		}
+	}
+}
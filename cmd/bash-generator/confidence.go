@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// unsureTranscriptError is returned, along with the transcript, when the
+// transcription provider is less sure of it than -min-confidence. Commands
+// are not generated from such transcripts without someone checking them.
+type unsureTranscriptError struct {
+	text       string
+	confidence float64
+}
+
+func (e *unsureTranscriptError) Error() string {
+	return fmt.Sprintf("the transcription is only %.0f%% sure it heard %q (see -min-confidence)", 100*e.confidence, e.text)
+}
+
+// unsureTranscript returns the transcript err was returned with, if it is
+// only an unsureTranscriptError.
+func unsureTranscript(err error) (*unsureTranscriptError, bool) {
+	var unsure *unsureTranscriptError
+	ok := errors.As(err, &unsure)
+	return unsure, ok
+}
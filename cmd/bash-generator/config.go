@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/internal/cost"
+	"github.com/jerilseb/bash-generator/internal/models"
+)
+
+// config is the on-disk configuration. Every field is optional and provides
+// the default for the command line flag of the same name.
+type config struct {
+	Context            string `json:"context,omitempty"`
+	ContextTokens      int    `json:"context_tokens,omitempty"`
+	RedactRules        string `json:"redact_rules,omitempty"`
+	APIType            string `json:"api_type,omitempty"`
+	BaseURL            string `json:"base_url,omitempty"`
+	TranscriptionURL   string `json:"transcription_url,omitempty"`
+	ChatURL            string `json:"chat_url,omitempty"`
+	TranscriptionModel string `json:"transcription_model,omitempty"`
+	APIKey             string `json:"api_key,omitempty"`
+	// TranscriptionProvider and TranscriptionAPIKey select the API speech is transcribed with.
+	TranscriptionProvider string `json:"transcription_provider,omitempty"`
+	TranscriptionAPIKey   string `json:"transcription_api_key,omitempty"`
+	// LocalWhisperURL is a self-hosted faster-whisper or whisperX server to
+	// transcribe with while it is up, and LocalWhisperModel the model it
+	// runs, for servers with an OpenAI-compatible API.
+	LocalWhisperURL   string `json:"local_whisper_url,omitempty"`
+	LocalWhisperModel string `json:"local_whisper_model,omitempty"`
+	// Backend, ChatModel and ChatAPIKey select the API commands are generated with.
+	Backend     string `json:"backend,omitempty"`
+	ChatModel   string `json:"chat_model,omitempty"`
+	ChatAPIKey  string `json:"chat_api_key,omitempty"`
+	MaxAttempts int    `json:"max_attempts,omitempty"`
+	Timeout     string `json:"timeout,omitempty"`
+	Proxy       string `json:"proxy,omitempty"`
+	MaxDuration string `json:"max_duration,omitempty"`
+	// MinSpeech is how much speech, as a duration, a recording needs to be
+	// transcribed; "0s" transcribes any.
+	MinSpeech string `json:"min_speech,omitempty"`
+	// LocalOnly refuses to send anything to a server not on this machine.
+	LocalOnly bool `json:"local_only,omitempty"`
+	// Concurrency caps the API calls made to each backend at once, as a
+	// number for all of them or as backend=number pairs.
+	Concurrency string `json:"concurrency,omitempty"`
+	// Race lists more backends, as backend or backend:model, that requests
+	// are sent to at the same time as the configured backend.
+	Race string `json:"race,omitempty"`
+	// Temperature is the sampling temperature, 0 by default for the most
+	// predictable commands. MaxTokens caps answers; the API decides if zero.
+	Temperature float64 `json:"temperature,omitempty"`
+	MaxTokens   int     `json:"max_tokens,omitempty"`
+	// PlainTextOutput turns off structured output, for OpenAI-compatible
+	// servers that reject response_format.
+	PlainTextOutput bool `json:"plain_text_output,omitempty"`
+	// Vocabulary adds words to the transcription prompt, on top of vocab.txt.
+	Vocabulary    []string `json:"vocabulary,omitempty"`
+	PromptHistory bool     `json:"prompt_history,omitempty"`
+	// Shell is the shell commands are generated for: bash, powershell or cmd.
+	Shell string `json:"shell,omitempty"`
+	// Language is the spoken language, empty to detect it; Translate asks for
+	// an English transcript instead.
+	Language    string `json:"language,omitempty"`
+	Translate   bool   `json:"translate,omitempty"`
+	AudioFormat string `json:"audio_format,omitempty"`
+	// MinConfidence is how sure, from 0 to 1, the transcription has to be of
+	// what it heard for a command to be generated without asking first.
+	MinConfidence float64 `json:"min_confidence,omitempty"`
+	// Denoise and Gain clean up recordings before they are uploaded; Gain is
+	// auto, off, or a change in dB.
+	Denoise bool   `json:"denoise,omitempty"`
+	Gain    string `json:"gain,omitempty"`
+	// TranscriptionFormats overrides the audio formats the transcription
+	// endpoint is assumed to accept, for servers stricter than OpenAI.
+	TranscriptionFormats []string `json:"transcription_formats,omitempty"`
+	ConfirmTranscript    bool     `json:"confirm_transcript,omitempty"`
+	Copy                 bool     `json:"copy,omitempty"`
+	Estimate             bool     `json:"estimate,omitempty"`
+	Cost                 bool     `json:"cost,omitempty"`
+	// MonthlyBudget is the most the API calls of a calendar month may cost, in USD.
+	MonthlyBudget  float64 `json:"monthly_budget,omitempty"`
+	Timing         bool    `json:"timing,omitempty"`
+	WhatIf         bool    `json:"what_if,omitempty"`
+	Live           bool    `json:"live,omitempty"`
+	PushToTalk     string  `json:"push_to_talk,omitempty"`
+	NoAudio        bool    `json:"no_audio,omitempty"`
+	RememberOutput bool    `json:"remember_output,omitempty"`
+	Lint           string  `json:"lint,omitempty"`
+	CheckTools     string  `json:"check_tools,omitempty"`
+	// Stream transcribes while recording over the Realtime API, with
+	// StreamModel; gpt-4o-mini-transcribe if empty.
+	Stream      bool   `json:"stream,omitempty"`
+	StreamModel string `json:"stream_model,omitempty"`
+	// WakeWordDetector is the command listen runs to hear the wake word, and
+	// WakePhrase the wake word it listens for.
+	WakeWordDetector []string `json:"wake_word_detector,omitempty"`
+	WakePhrase       string   `json:"wake_phrase,omitempty"`
+	// VoiceConfirm has listen ask to run each command and listen for the answer.
+	VoiceConfirm bool `json:"voice_confirm,omitempty"`
+	// FewShot sends the latest accepted commands from the history as examples.
+	FewShot      bool `json:"few_shot,omitempty"`
+	FewShotCount int  `json:"few_shot_count,omitempty"`
+	// SandboxImage is the image -sandbox runs commands in, and SandboxRuntime
+	// the program running it; Podman or Docker, whichever is installed, if empty.
+	SandboxImage   string `json:"sandbox_image,omitempty"`
+	SandboxRuntime string `json:"sandbox_runtime,omitempty"`
+	// TmuxTarget is the pane -tmux types commands into when none is given.
+	TmuxTarget string `json:"tmux_target,omitempty"`
+	// ChatPrices and TranscriptionPrices add to or override the built-in price
+	// tables: USD per million tokens, and USD per minute of audio.
+	ChatPrices          map[string]cost.ChatPrice `json:"chat_prices,omitempty"`
+	TranscriptionPrices map[string]float64        `json:"transcription_prices,omitempty"`
+	// Placeholders asks for placeholders in place of values the model would
+	// have to guess, and for their values before the command is shown.
+	Placeholders bool `json:"placeholders,omitempty"`
+	// Speak reads commands aloud: explanation or command. SpeechEngine is
+	// local (say or espeak) or openai; a local one if installed when empty.
+	// SpeechModel and SpeechVoice pick the voice.
+	Speak        string `json:"speak,omitempty"`
+	SpeechEngine string `json:"speech_engine,omitempty"`
+	SpeechModel  string `json:"speech_model,omitempty"`
+	SpeechVoice  string `json:"speech_voice,omitempty"`
+	// Mode narrows requests down to one tool: k8s, docker or git.
+	Mode string `json:"mode,omitempty"`
+	// NoProjectRules ignores the .bashgen files of projects.
+	NoProjectRules bool `json:"no_project_rules,omitempty"`
+	// NoSpokenForms sends requests on without turning spoken flags, paths
+	// and numbers, like "dash r f", into what they stand for.
+	NoSpokenForms bool `json:"no_spoken_forms,omitempty"`
+	// CacheTTL is how long, as a duration, transcripts and commands are
+	// cached for, to answer the same recording or request again at once;
+	// they aren't cached if it is empty.
+	CacheTTL string `json:"cache_ttl,omitempty"`
+	// NoCache turns off offering the commands of earlier requests that mean
+	// the same as a new one. EmbeddingsURL and EmbeddingsModel pick the
+	// embeddings endpoint requests are compared with, such as a local one.
+	NoCache         bool   `json:"no_cache,omitempty"`
+	EmbeddingsURL   string `json:"embeddings_url,omitempty"`
+	EmbeddingsModel string `json:"embeddings_model,omitempty"`
+	// Picker is the program, rofi, fzf or dmenu, that earlier commands are
+	// chosen with when there is more than one to choose from.
+	Picker string `json:"picker,omitempty"`
+	// AutoFix is how many corrected commands are offered, one after the
+	// other, when a command fails.
+	AutoFix int `json:"auto_fix,omitempty"`
+	// Learn stores edits to generated commands as per-project conventions.
+	Learn bool `json:"learn,omitempty"`
+	// LogFile is where -v logs go, as JSON Lines, instead of stderr.
+	LogFile string `json:"log_file,omitempty"`
+	// AuditLog also gets every command, with the user and host, for teams
+	// sharing a machine; AuditKey is a file with the key to sign it with.
+	AuditLog string `json:"audit_log,omitempty"`
+	AuditKey string `json:"audit_key,omitempty"`
+	// InputChannel records only that input channel, counting from 1, rather
+	// than mixing all of them down.
+	InputChannel int `json:"input_channel,omitempty"`
+	// SaveAudio keeps the uploaded audio, like -save-audio; a directory
+	// collects every recording.
+	SaveAudio string `json:"save_audio,omitempty"`
+
+	// Daemon settings.
+	MetricsEndpoint string `json:"metrics_endpoint,omitempty"`
+	MetricsInterval string `json:"metrics_interval,omitempty"`
+	LowPower        bool   `json:"low_power,omitempty"`
+	HTTPToken       string `json:"http_token,omitempty"`
+	// Hotkey is the global key combination serve registers, e.g. ctrl+shift+space.
+	Hotkey string `json:"hotkey,omitempty"`
+
+	// Models adds to or overrides the built-in registry of local models.
+	Models []models.Model `json:"models,omitempty"`
+}
+
+func configPath() string {
+	return filepath.Join(configDir(), configFileName)
+}
+
+// loadConfig reads the config file. A missing file yields an empty config.
+func loadConfig() (*config, error) {
+	cfg := &config{}
+	data, err := os.ReadFile(configPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", configPath(), err)
+	}
+	maps.Copy(cost.ChatPrices, cfg.ChatPrices)
+	maps.Copy(cost.TranscriptionPrices, cfg.TranscriptionPrices)
+	return cfg, nil
+}
+
+// isSecretConfigKey reports whether a config key holds a credential that must
+// never leave the machine (API keys, tokens, passwords).
+func isSecretConfigKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range []string{"key", "token", "secret", "password"} {
+		if strings.HasSuffix(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// configKeys returns the keys the config file can hold, in the order of config.
+func configKeys() []string {
+	var keys []string
+	t := reflect.TypeOf(config{})
+	for i := range t.NumField() {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+// readConfigFields reads the config file as its top-level fields, so writing
+// it back keeps the values as they were written. A missing file yields none.
+func readConfigFields() (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	data, err := os.ReadFile(configPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return fields, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", configPath(), err)
+	}
+	return fields, nil
+}
+
+// writeConfigFields checks fields against config and writes them to the
+// config file, readable only by the user as it may hold API keys.
+func writeConfigFields(fields map[string]json.RawMessage) error {
+	data, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &config{}); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(configDir(), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(configPath(), append(data, '\n'), 0o600)
+}
+
+// runConfig shows and changes the config file, so settings can be scripted
+// without editing JSON by hand.
+func runConfig(args []string) error {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s config path | show | get <key> | set <key> <value> | unset <key> | edit\n", appName)
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	action, rest := fs.Arg(0), fs.Args()[1:]
+	wantArgs := map[string]int{"path": 0, "show": 0, "get": 1, "set": 2, "unset": 1, "edit": 0}
+	n, ok := wantArgs[action]
+	if !ok || len(rest) != n {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if n > 0 && !slices.Contains(configKeys(), rest[0]) {
+		return fmt.Errorf("unknown config key %q", rest[0])
+	}
+
+	switch action {
+	case "path":
+		fmt.Println(configPath())
+		return nil
+	case "edit":
+		if err := editFile(configPath()); err != nil {
+			return err
+		}
+		_, err := loadConfig()
+		return err
+	}
+
+	fields, err := readConfigFields()
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "show":
+		// Keys are left out, as in export; get shows one when asked.
+		for key := range fields {
+			if isSecretConfigKey(key) {
+				fields[key] = json.RawMessage(`"********"`)
+			}
+		}
+		data, err := json.MarshalIndent(fields, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "get":
+		value, ok := fields[rest[0]]
+		if !ok {
+			return fmt.Errorf("%s is not set", rest[0])
+		}
+		// Strings are printed as they are, for scripts.
+		var s string
+		if json.Unmarshal(value, &s) == nil {
+			fmt.Println(s)
+		} else {
+			fmt.Println(string(value))
+		}
+	case "set":
+		// Values that aren't JSON, like most strings, are taken as strings.
+		value := json.RawMessage(rest[1])
+		if !json.Valid(value) {
+			value, _ = json.Marshal(rest[1])
+		}
+		fields[rest[0]] = value
+		if err := writeConfigFields(fields); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", rest[0], err)
+		}
+	case "unset":
+		delete(fields, rest[0])
+		return writeConfigFields(fields)
+	}
+	return nil
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/history"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// contextSources maps a source name (as used with -context) to its collector.
+// The order of contextPriority decides which sources survive truncation.
+var contextSources = map[string]func() ([]string, error){
+	"last":       collectLastCommand,
+	"history":    collectShellHistory,
+	"requests":   collectPastRequests,
+	"dir":        collectDirListing,
+	"tools":      collectToolList,
+	"kube":       collectKube,
+	"containers": collectContainers,
+	"git":        collectGit,
+}
+
+var contextPriority = []string{"last", "kube", "containers", "git", "history", "requests", "dir", "tools"}
+
+var contextTitles = map[string]string{
+	"last":       "The last command run in the user's shell and how it ended",
+	"history":    "Recent shell history (most recent first)",
+	"requests":   "Earlier requests to this tool and their commands, those made in the current repository first (most recent first)",
+	"dir":        "Files in the current directory",
+	"tools":      "Tools installed on this machine",
+	"kube":       "The current Kubernetes context, namespace and resources in it",
+	"containers": "Docker containers (name, image, status) and images",
+	"git":        "The state of the Git repository in the current directory",
+}
+
+const (
+	maxHistoryLines = 50
+	maxPastRequests = 30
+	maxDirEntries   = 200
+	maxResources    = 100
+	maxBranches     = 30
+)
+
+// probeTimeout bounds the commands that look into clusters, containers and
+// repositories, so an unreachable cluster doesn't hold up the request.
+const probeTimeout = 3 * time.Second
+
+// The shell integration from init exports the last command line and its exit
+// status in these, so "why did that fail?" can refer to a command typed by hand.
+const (
+	lastCommandEnv = "BASH_GENERATOR_LAST_COMMAND"
+	lastStatusEnv  = "BASH_GENERATOR_LAST_STATUS"
+)
+
+// commonTools is the list of programs we probe for when building the tool list.
+var commonTools = []string{
+	"awk", "sed", "grep", "rg", "ag", "find", "fd", "fzf", "jq", "yq", "xargs", "parallel",
+	"curl", "wget", "rsync", "scp", "ssh", "tar", "zip", "unzip", "gzip", "zstd", "7z",
+	"git", "gh", "docker", "podman", "kubectl", "helm", "terraform", "aws", "gcloud", "az",
+	"systemctl", "journalctl", "apt", "dnf", "pacman", "brew", "pip", "npm", "go", "cargo",
+	"python3", "node", "ffmpeg", "convert", "htop", "lsof", "ss", "netstat", "ip", "dig",
+}
+
+// parseContextSources validates a comma separated list of context source names.
+func parseContextSources(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := contextSources[name]; !ok {
+			return nil, fmt.Errorf("unknown context source %q (available: %s)", name, strings.Join(contextPriority, ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// collectContext gathers the enabled context sources in priority order, ready for
+// generate.FitContext. Sources that fail to collect are skipped rather than failing the whole run.
+func collectContext(enabled []string) []generate.Segment {
+	want := make(map[string]bool, len(enabled))
+	for _, name := range enabled {
+		want[name] = true
+	}
+	var segments []generate.Segment
+	for _, name := range contextPriority {
+		if !want[name] {
+			continue
+		}
+		lines, err := contextSources[name]()
+		if err != nil || len(lines) == 0 {
+			continue
+		}
+		segments = append(segments, generate.Segment{Name: name, Title: contextTitles[name], Lines: lines})
+	}
+	return segments
+}
+
+// collectLastCommand returns the last command run in the parent shell and its
+// exit status, as exported by the shell integration.
+func collectLastCommand() ([]string, error) {
+	command := strings.TrimSpace(os.Getenv(lastCommandEnv))
+	if command == "" {
+		return nil, nil
+	}
+	lines := []string{"$ " + command}
+	status, err := strconv.Atoi(os.Getenv(lastStatusEnv))
+	if err != nil {
+		return lines, nil
+	}
+	switch {
+	case status == 0:
+		lines = append(lines, "exit status 0 (succeeded)")
+	case status == 126:
+		lines = append(lines, "exit status 126 (not executable)")
+	case status == 127:
+		lines = append(lines, "exit status 127 (command not found)")
+	case status > 128 && status < 160:
+		lines = append(lines, fmt.Sprintf("exit status %d (killed by signal %d)", status, status-128))
+	default:
+		lines = append(lines, fmt.Sprintf("exit status %d (failed)", status))
+	}
+	return lines, nil
+}
+
+// shellHistoryFile returns the path of the user's shell history file: HISTFILE,
+// or else ~/.zsh_history or ~/.bash_history, whichever exists. It is empty if
+// none is found.
+func shellHistoryFile() (string, error) {
+	if path := os.Getenv("HISTFILE"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []string{".zsh_history", ".bash_history"} {
+		candidate := filepath.Join(home, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", nil
+}
+
+// collectShellHistory returns the user's most recent shell commands, newest first.
+func collectShellHistory() ([]string, error) {
+	path, err := shellHistoryFile()
+	if err != nil || path == "" {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var all []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// zsh extended history: ": <timestamp>:<duration>;<command>"
+		if strings.HasPrefix(line, ": ") {
+			if i := strings.Index(line, ";"); i >= 0 {
+				line = line[i+1:]
+			}
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		all = append(all, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var recent []string
+	seen := make(map[string]bool)
+	for i := len(all) - 1; i >= 0 && len(recent) < maxHistoryLines; i-- {
+		if seen[all[i]] {
+			continue
+		}
+		seen[all[i]] = true
+		recent = append(recent, all[i])
+	}
+	return recent, nil
+}
+
+// collectPastRequests returns earlier requests and the commands generated for
+// them, so "do the same as yesterday" can be answered. Inside a git repository
+// the ones made in it come first.
+func collectPastRequests() ([]string, error) {
+	entries, err := historyStore().Load()
+	if err != nil {
+		return nil, err
+	}
+	root, inRepo := gitRoot()
+	var here, elsewhere []history.Entry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if inRepo && entries[i].InProject(root) {
+			here = append(here, entries[i])
+		} else {
+			elsewhere = append(elsewhere, entries[i])
+		}
+	}
+	ordered := append(here, elsewhere...)
+
+	now := time.Now()
+	lines := []string{"(today is " + now.Format("Monday 2006-01-02") + ")"}
+	seen := make(map[string]bool)
+	for _, e := range ordered {
+		if len(lines) > maxPastRequests {
+			break
+		}
+		if seen[e.Command] || strings.ContainsRune(e.Command, '\n') {
+			continue
+		}
+		seen[e.Command] = true
+		line := fmt.Sprintf("%s %q: %s", e.Time.Local().Format("2006-01-02 15:04"), e.Transcript, e.Command)
+		if !e.Accepted {
+			line += " (not run)"
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 1 {
+		return nil, nil
+	}
+	return lines, nil
+}
+
+// collectDirListing lists the entries of the current working directory, directories marked with a trailing slash.
+func collectDirListing() ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(cwd)
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{"(cwd: " + cwd + ")"}
+	for i, e := range entries {
+		if i >= maxDirEntries {
+			break
+		}
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		lines = append(lines, name)
+	}
+	return lines, nil
+}
+
+// collectToolList reports which of the common command line tools are on PATH.
+func collectToolList() ([]string, error) {
+	var found []string
+	for _, tool := range commonTools {
+		if _, err := exec.LookPath(tool); err == nil {
+			found = append(found, tool)
+		}
+	}
+	sort.Strings(found)
+
+	// Group the tools a few per line so truncation can drop part of the list.
+	var lines []string
+	for len(found) > 0 {
+		n := min(len(found), 10)
+		lines = append(lines, strings.Join(found[:n], " "))
+		found = found[n:]
+	}
+	return lines, nil
+}
+
+// probe runs a command for context and returns the lines of its output.
+func probe(name string, args ...string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimRight(line, " \r"); strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// collectKube describes the current kubectl context: its namespace, the other
+// contexts, and the workloads and services in the namespace.
+func collectKube() ([]string, error) {
+	current, err := probe("kubectl", "config", "current-context")
+	if err != nil || len(current) == 0 {
+		return nil, err
+	}
+	namespace := "default"
+	if ns, err := probe("kubectl", "config", "view", "--minify", "-o", "jsonpath={..namespace}"); err == nil && len(ns) > 0 {
+		namespace = ns[0]
+	}
+	lines := []string{"context: " + current[0], "namespace: " + namespace}
+	if contexts, err := probe("kubectl", "config", "get-contexts", "-o", "name"); err == nil && len(contexts) > 1 {
+		lines = append(lines, "other contexts: "+strings.Join(slices.DeleteFunc(contexts, func(c string) bool { return c == current[0] }), ", "))
+	}
+	// The cluster may well be out of reach; the names above still help.
+	resources, err := probe("kubectl", "get", "deployments,statefulsets,daemonsets,cronjobs,services,pods", "-o", "name", "--request-timeout="+probeTimeout.String())
+	if err != nil {
+		return lines, nil
+	}
+	if len(resources) > maxResources {
+		resources = resources[:maxResources]
+	}
+	return append(lines, resources...), nil
+}
+
+// collectContainers lists the Docker (or Podman) containers, running or not,
+// and the images on this machine, and notes a compose file in the current
+// directory.
+func collectContainers() ([]string, error) {
+	runtime := "docker"
+	if _, err := exec.LookPath(runtime); err != nil {
+		runtime = "podman"
+	}
+	containers, err := probe(runtime, "ps", "--all", "--format", "{{.Names}}\t{{.Image}}\t{{.Status}}")
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, name := range []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"} {
+		if _, err := os.Stat(name); err == nil {
+			lines = append(lines, "compose file: "+name)
+			break
+		}
+	}
+	if len(containers) > maxResources {
+		containers = containers[:maxResources]
+	}
+	lines = append(lines, containers...)
+	if images, err := probe(runtime, "images", "--format", "image {{.Repository}}:{{.Tag}}", "--filter", "dangling=false"); err == nil {
+		if len(images) > maxResources/2 {
+			images = images[:maxResources/2]
+		}
+		lines = append(lines, images...)
+	}
+	return lines, nil
+}
+
+// collectGit describes the repository in the current directory: the branch
+// and how it compares to its upstream, changed files, other branches, remotes
+// and the latest commits.
+func collectGit() ([]string, error) {
+	// The first line is "## branch...upstream [ahead 1]".
+	lines, err := probe("git", "status", "--short", "--branch")
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) > maxResources {
+		lines = append(lines[:maxResources], fmt.Sprintf("... (%d more changed files)", len(lines)-maxResources))
+	}
+	if branches, err := probe("git", "branch", "--all", "--format=%(refname:short)"); err == nil {
+		if len(branches) > maxBranches {
+			branches = branches[:maxBranches]
+		}
+		lines = append(lines, "branches: "+strings.Join(branches, ", "))
+	}
+	if remotes, err := probe("git", "remote", "-v"); err == nil {
+		for _, remote := range remotes {
+			// Each remote is listed for fetch and for push; once is enough.
+			if strings.HasSuffix(remote, "(fetch)") {
+				lines = append(lines, "remote "+strings.TrimSuffix(remote, " (fetch)"))
+			}
+		}
+	}
+	if commits, err := probe("git", "log", "--oneline", "-5"); err == nil {
+		for _, commit := range commits {
+			lines = append(lines, "commit "+commit)
+		}
+	}
+	return lines, nil
+}
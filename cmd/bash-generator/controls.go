@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+// errRetake is returned when the user throws a recording away to record again.
+var errRetake = errors.New("recording thrown away to start over")
+
+// controlsHint is shown while recording with single key controls.
+const controlsHint = "Enter to stop, space to pause, r to start over, Esc to discard"
+
+// canUseControls reports whether recordings can be controlled with single
+// keys: stdin must be a terminal nobody is reading lines from.
+func canUseControls(input *lineReader) bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && input.idle()
+}
+
+type controlAction int
+
+const (
+	actionStop controlAction = iota
+	actionPause
+	actionRetake
+	actionDiscard
+)
+
+// recordWithControls records until Enter or until stop is closed, reading
+// single keys from the terminal: space (or p) pauses and resumes, r throws the
+// recording away and returns errRetake, and Esc, x or Ctrl+C discards it.
+//
+// Each stretch between pauses is a separate call to capture, which must record
+// until the channel it is given is closed, as stopCapture does. The microphone
+// is off while paused, so nothing said meanwhile is ever captured. paused is
+// called when recording pauses, to show so. The stretches together are cut off
+// at limit, if it isn't zero.
+func recordWithControls(stop <-chan struct{}, limit time.Duration, capture func(stop <-chan struct{}, stopCapture func()) (*record.Recording, error), paused func()) (*record.Recording, error) {
+	keys, err := openKeys(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	defer keys.close()
+
+	actions := make(chan controlAction, 1)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			ev, ok, err := keys.next(pttPoll)
+			var action controlAction
+			switch {
+			case err != nil:
+				// Without keys the recording can't be controlled any more.
+				action = actionStop
+			case !ok || ev.kind == keyRelease:
+				continue
+			case ev.key == '\r' || ev.key == '\n':
+				action = actionStop
+			case ev.key == ' ' || ev.key == 'p' || ev.key == 'P':
+				action = actionPause
+			case ev.key == 'r' || ev.key == 'R':
+				action = actionRetake
+			case ev.cancels() || ev.key == 'x' || ev.key == 'X':
+				action = actionDiscard
+			default:
+				continue
+			}
+			select {
+			case actions <- action:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	var whole *record.Recording
+	// add appends a stretch to the recording.
+	add := func(rec *record.Recording) {
+		if whole == nil {
+			whole = rec
+			return
+		}
+		whole.Samples = append(whole.Samples, rec.Samples...)
+		whole.Truncated = rec.Truncated
+	}
+	for {
+		// Record a stretch, stopping it at whatever is left of the limit.
+		segment := make(chan struct{})
+		var once sync.Once
+		stopSegment := func() { once.Do(func() { close(segment) }) }
+		var timer *time.Timer
+		if limit > 0 {
+			left := limit
+			if whole != nil {
+				left -= whole.Duration()
+			}
+			timer = time.AfterFunc(left, stopSegment)
+		}
+		type result struct {
+			rec *record.Recording
+			err error
+		}
+		results := make(chan result, 1)
+		go func() {
+			rec, err := capture(segment, stopSegment)
+			results <- result{rec, err}
+		}()
+
+		var action controlAction
+		var res result
+		select {
+		case action = <-actions:
+			stopSegment()
+			res = <-results
+		case <-stop:
+			action = actionStop
+			stopSegment()
+			res = <-results
+		case res = <-results:
+			// The stretch ended by itself, at the limit.
+			action = actionStop
+		}
+		if res.err != nil {
+			return nil, res.err
+		}
+		if timer != nil && !timer.Stop() {
+			// The stretch was stopped at the limit, possibly just as a key was pressed.
+			res.rec.Truncated = true
+		}
+		switch action {
+		case actionRetake:
+			return nil, errRetake
+		case actionDiscard:
+			return nil, errDiscarded
+		}
+		add(res.rec)
+		if action == actionStop || whole.Truncated {
+			return whole, nil
+		}
+
+		// Paused: wait for the recording to resume or end.
+		paused()
+		select {
+		case action = <-actions:
+		case <-stop:
+			action = actionStop
+		}
+		switch action {
+		case actionStop:
+			return whole, nil
+		case actionRetake:
+			return nil, errRetake
+		case actionDiscard:
+			return nil, errDiscarded
+		}
+	}
+}
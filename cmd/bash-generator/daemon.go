@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/cost"
+	"github.com/jerilseb/bash-generator/internal/metrics"
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+// daemonRequest is one line sent by a trigger client over the socket.
+type daemonRequest struct {
+	// Action is one of start, stop, toggle, hotkey, cancel, status or stats.
+	Action string `json:"action"`
+}
+
+// daemonResponse is the daemon's single-line reply. Safety is the verdict on
+// Command, the model's own included.
+type daemonResponse struct {
+	State      string       `json:"state"`
+	Transcript string       `json:"transcript,omitempty"`
+	Command    string       `json:"command,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	Warning    string       `json:"warning,omitempty"`
+	Safety     *apiSafety   `json:"safety,omitempty"`
+	Stats      *daemonStats `json:"stats,omitempty"`
+}
+
+// daemonStats describes the daemon's resource usage since it started.
+type daemonStats struct {
+	Uptime     time.Duration      `json:"uptime"`
+	CPU        time.Duration      `json:"cpu"`
+	SampleRate int                `json:"sample_rate"`
+	Counters   map[string]float64 `json:"counters,omitempty"`
+}
+
+const (
+	stateIdle       = "idle"
+	stateRecording  = "recording"
+	stateProcessing = "processing"
+)
+
+// daemon keeps the audio subsystem and HTTP connections alive between requests,
+// so a trigger only pays for the recording and the API calls.
+type daemon struct {
+	p        *pipeline
+	recorder microphone
+	capture  record.Options
+	metrics  *metrics.Registry
+	started  time.Time
+	// hotkey is the key combination registered with -hotkey, if any.
+	hotkey string
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan recordResult
+	// abort cancels the transcription and generation of the last recording
+	// while they run, which they do without d.mu held.
+	abort context.CancelFunc
+}
+
+type recordResult struct {
+	rec *record.Recording
+	err error
+}
+
+// serveFlags are the flags of serve.
+type serveFlags struct {
+	opts            *options
+	socket          string
+	metricsEndpoint string
+	metricsInterval time.Duration
+	lowPower        bool
+	httpAddr        string
+	httpToken       string
+	httpMaxUpload   int64
+	hotkey          string
+}
+
+func (f *serveFlags) define(fs *flag.FlagSet, cfg *config) error {
+	var err error
+	if f.opts, err = addPipelineFlags(fs, cfg); err != nil {
+		return err
+	}
+	fs.BoolVar(&f.opts.DiscardChatter, "discard-chatter", true, "skip generation when the transcript looks like background conversation rather than a request")
+	fs.StringVar(&f.socket, "socket", socketPath(), "path of the Unix socket to listen on")
+	fs.StringVar(&f.metricsEndpoint, "metrics-endpoint", cfg.MetricsEndpoint, "export usage metrics to statsd://host:port or an OTLP/HTTP collector URL")
+	metricsInterval := time.Minute
+	if cfg.MetricsInterval != "" {
+		if metricsInterval, err = time.ParseDuration(cfg.MetricsInterval); err != nil {
+			return fmt.Errorf("invalid metrics_interval in config: %w", err)
+		}
+	}
+	fs.DurationVar(&f.metricsInterval, "metrics-interval", metricsInterval, "how often to export metrics")
+	fs.BoolVar(&f.lowPower, "low-power", cfg.LowPower, "capture at 16 kHz with larger buffers to save battery")
+	fs.StringVar(&f.httpAddr, "http", "", "serve the HTTP API on this address, e.g. :8080, instead of recording from the microphone")
+	fs.StringVar(&f.httpToken, "http-token", "", "bearer token HTTP API clients must send; required unless listening on localhost (default $"+httpTokenEnv+")")
+	fs.Int64Var(&f.httpMaxUpload, "http-max-upload", 25, "largest audio file, in MB, the HTTP API accepts")
+	fs.StringVar(&f.hotkey, "hotkey", cfg.Hotkey, "register a global hotkey, e.g. ctrl+shift+space, that starts and stops recording and types the command into the focused window")
+	return nil
+}
+
+func runServe(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var flags serveFlags
+	if err := flags.define(fs, cfg); err != nil {
+		return err
+	}
+	opts := flags.opts
+	fs.Parse(args)
+	// Requests from the hotkey and HTTP clients may come at once.
+	if opts.Concurrency == "" {
+		opts.Concurrency = defaultServerConcurrency
+	}
+
+	p, err := newPipeline(opts)
+	if err != nil {
+		return err
+	}
+	if opts.LocalOnly {
+		if flags.metricsEndpoint != "" {
+			if err := requireLocal("usage metrics", flags.metricsEndpoint); err != nil {
+				return err
+			}
+		}
+		if flags.httpAddr != "" && !isLoopbackAddr(flags.httpAddr) {
+			return errors.New("-local-only: the HTTP API would answer clients on other machines; listen on localhost, e.g. -http 127.0.0.1:8080")
+		}
+	}
+	registry := metrics.New()
+	if flags.metricsEndpoint != "" {
+		exp, err := metrics.NewExporter(flags.metricsEndpoint, "bash_generator")
+		if err != nil {
+			return err
+		}
+		stopMetrics := make(chan struct{})
+		exported := make(chan struct{})
+		go func() {
+			registry.Run(exp, flags.metricsInterval, stopMetrics, func(err error) {
+				fmt.Fprintf(os.Stderr, "Failed to export metrics: %v\n", err)
+			})
+			close(exported)
+		}()
+		// Flush the last interval on shutdown.
+		defer func() {
+			close(stopMetrics)
+			<-exported
+		}()
+	}
+
+	var key hotkey
+	if flags.hotkey != "" {
+		if flags.httpAddr != "" {
+			return errors.New("-hotkey records from the microphone, so it can't be combined with -http")
+		}
+		if key, err = parseHotkey(flags.hotkey); err != nil {
+			return err
+		}
+	}
+
+	if flags.httpAddr != "" {
+		if flags.httpMaxUpload <= 0 {
+			return fmt.Errorf("invalid -http-max-upload %d: must be positive", flags.httpMaxUpload)
+		}
+		// The token isn't a flag default, which -h would print.
+		token := setting(flags.httpToken, httpTokenEnv, cfg.HTTPToken)
+		api := &httpAPI{p: p, token: token, maxBody: flags.httpMaxUpload << 20, metrics: registry, started: time.Now()}
+		return serveHTTP(flags.httpAddr, api)
+	}
+
+	capture := record.DefaultOptions
+	if flags.lowPower {
+		capture = record.LowPowerOptions
+	}
+	capture, err = captureOptions(capture, opts.MaxDuration, opts.Channel)
+	if err != nil {
+		return err
+	}
+	recorder, closeMicrophone, err := openMicrophone(capture)
+	if err != nil {
+		return err
+	}
+	defer closeMicrophone()
+
+	ln, err := listenUnix(flags.socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(flags.socket)
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, shutdownSignals...)
+	go func() {
+		<-c
+		ln.Close()
+	}()
+
+	d := &daemon{p: p, recorder: recorder, capture: capture, metrics: registry, started: time.Now()}
+	fmt.Printf("Listening on %s\n", flags.socket)
+	if flags.hotkey != "" {
+		bin, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		unbind, via, err := bindHotkey(key, shellQuote(bin)+" trigger -socket "+shellQuote(flags.socket)+" hotkey")
+		if err != nil {
+			return fmt.Errorf("failed to register the hotkey: %w", err)
+		}
+		defer unbind()
+		d.hotkey = key.String()
+		fmt.Printf("Press %s to start and stop recording (registered with %s)\n", d.hotkey, via)
+	}
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			d.cancel()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go d.serveConn(conn)
+	}
+}
+
+// listenUnix listens on path, replacing a stale socket left behind by a daemon that died.
+func listenUnix(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already listening on %s", path)
+	}
+	os.Remove(path)
+
+	ln, err := listenPrivate(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	return ln, nil
+}
+
+func (d *daemon) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	var req daemonRequest
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &req)
+	}
+	var resp daemonResponse
+	if err != nil {
+		resp = daemonResponse{State: d.state(), Error: "invalid request: " + err.Error()}
+	} else {
+		resp = d.handle(req.Action)
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
+
+func (d *daemon) handle(action string) daemonResponse {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	recording := d.stop != nil
+	switch action {
+	case "toggle":
+		if recording {
+			return d.finish()
+		}
+		return d.begin()
+	case "hotkey":
+		// A toggle whose outcome goes to the desktop, as nobody sees the
+		// output of the trigger the hotkey runs.
+		if !recording {
+			resp := d.begin()
+			if resp.Error == "" {
+				notify("Listening…", "Press "+d.hotkey+" again when you're done.")
+			} else {
+				notify("Not listening", resp.Error)
+			}
+			return resp
+		}
+		resp := d.finish()
+		deliver(resp)
+		return resp
+	case "start":
+		if recording {
+			return daemonResponse{State: stateRecording, Error: "already recording"}
+		}
+		return d.begin()
+	case "stop":
+		if !recording {
+			return daemonResponse{State: stateIdle, Error: "not recording"}
+		}
+		return d.finish()
+	case "cancel":
+		if recording {
+			close(d.stop)
+			<-d.done
+			d.stop, d.done = nil, nil
+		}
+		if d.abort != nil {
+			d.abort()
+		}
+		return daemonResponse{State: stateIdle}
+	case "status":
+		return daemonResponse{State: d.stateLocked()}
+	case "stats":
+		return daemonResponse{State: d.stateLocked(), Stats: d.stats()}
+	default:
+		return daemonResponse{State: d.stateLocked(), Error: fmt.Sprintf("unknown action %q", action)}
+	}
+}
+
+// begin starts recording in the background. d.mu must be held.
+func (d *daemon) begin() daemonResponse {
+	if d.abort != nil {
+		return daemonResponse{State: stateProcessing, Error: "still working on the last recording"}
+	}
+	d.stop = make(chan struct{})
+	d.done = make(chan recordResult, 1)
+	stop, done := d.stop, d.done
+	go func() {
+		rec, err := d.recorder.Record(stop)
+		done <- recordResult{rec, err}
+	}()
+	go d.p.warm()
+	return daemonResponse{State: stateRecording}
+}
+
+// finish stops the recording and runs it through the pipeline. d.mu must be
+// held; it is released while the API calls run, so that status answers and
+// cancel can abort them meanwhile.
+func (d *daemon) finish() daemonResponse {
+	close(d.stop)
+	res := <-d.done
+	d.stop, d.done = nil, nil
+
+	ctx, abort := context.WithCancel(context.Background())
+	d.abort = abort
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		abort()
+		d.abort = nil
+	}()
+	return d.process(ctx, res)
+}
+
+// process transcribes the recording in res and generates the command, each
+// call bounded by the pipeline's timeout.
+func (d *daemon) process(ctx context.Context, res recordResult) daemonResponse {
+	m := d.metrics
+	m.Add("requests", 1)
+	if res.err != nil {
+		m.Add("errors", 1)
+		return daemonResponse{State: stateIdle, Error: res.err.Error()}
+	}
+	var warning string
+	if res.rec.Truncated {
+		warning = fmt.Sprintf("the recording stopped at the %s limit (see -max-duration)", d.capture.MaxDuration)
+	}
+	audio := res.rec.Duration()
+	m.Add("audio.seconds", audio.Seconds())
+
+	start := time.Now()
+	callCtx, cancel := context.WithTimeout(ctx, d.p.timeout)
+	transcript, err := d.p.transcribe(callCtx, res.rec)
+	cancel()
+	m.Observe("transcribe.latency", time.Since(start))
+	if ctx.Err() != nil {
+		return daemonResponse{State: stateIdle, Warning: warning, Error: "cancelled"}
+	}
+	if err != nil {
+		m.Add("errors", 1)
+		return daemonResponse{State: stateIdle, Warning: warning, Error: err.Error()}
+	}
+	m.Add("cost.usd", cost.Transcription(d.p.transcriber.Model, audio))
+
+	start = time.Now()
+	callCtx, cancel = context.WithTimeout(ctx, d.p.timeout)
+	generated, err := d.p.generate(callCtx, transcript, spokenRequest, nil)
+	cancel()
+	if ctx.Err() != nil {
+		return daemonResponse{State: stateIdle, Warning: warning, Transcript: transcript, Error: "cancelled"}
+	}
+	if errors.Is(err, errChatter) {
+		m.Add("discarded", 1)
+		return daemonResponse{State: stateIdle, Warning: warning, Transcript: transcript, Error: err.Error()}
+	}
+	m.Observe("generate.latency", time.Since(start))
+	if err != nil {
+		m.Add("errors", 1)
+		return daemonResponse{State: stateIdle, Warning: warning, Transcript: transcript, Error: err.Error()}
+	}
+	m.Add("tokens.prompt", float64(generated.Usage.PromptTokens))
+	m.Add("tokens.completion", float64(generated.Usage.CompletionTokens))
+	m.Add("cost.usd", cost.Chat(generated.Model, generated.Usage.PromptTokens, generated.Usage.CompletionTokens))
+	verdict := checkCommand(generated)
+	return daemonResponse{
+		State:      stateIdle,
+		Warning:    warning,
+		Transcript: transcript,
+		Command:    generated.Command,
+		Safety:     &apiSafety{Level: verdict.Level.String(), Reasons: verdict.Reasons},
+	}
+}
+
+func (d *daemon) stats() *daemonStats {
+	return &daemonStats{
+		Uptime:     time.Since(d.started),
+		CPU:        cpuTime(),
+		SampleRate: d.capture.SampleRate,
+		Counters:   d.metrics.Snapshot().Counters,
+	}
+}
+
+func (d *daemon) cancel() {
+	d.handle("cancel")
+}
+
+func (d *daemon) state() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stateLocked()
+}
+
+func (d *daemon) stateLocked() string {
+	switch {
+	case d.stop != nil:
+		return stateRecording
+	case d.abort != nil:
+		return stateProcessing
+	}
+	return stateIdle
+}
+
+// triggerFlags are the flags of trigger.
+type triggerFlags struct {
+	socket string
+}
+
+func (f *triggerFlags) define(fs *flag.FlagSet) {
+	fs.StringVar(&f.socket, "socket", socketPath(), "path of the daemon's Unix socket")
+}
+
+func runTrigger(args []string) error {
+	fs := flag.NewFlagSet("trigger", flag.ExitOnError)
+	var flags triggerFlags
+	flags.define(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s trigger [-socket path] [toggle|start|stop|hotkey|cancel|status|stats]\n", appName)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	action := "toggle"
+	if fs.NArg() > 0 {
+		action = fs.Arg(0)
+	}
+
+	resp, err := sendDaemonRequest(flags.socket, daemonRequest{Action: action})
+	if err != nil {
+		return err
+	}
+	if resp.Warning != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", resp.Warning)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	switch {
+	case resp.Stats != nil:
+		printDaemonStats(resp)
+	case resp.Command != "":
+		// Only the command goes to stdout, so the trigger can be used in scripts and key bindings.
+		fmt.Fprintf(os.Stderr, "%s\n", resp.Transcript)
+		fmt.Println(resp.Command)
+	default:
+		fmt.Fprintln(os.Stderr, resp.State)
+	}
+	return nil
+}
+
+func printDaemonStats(resp *daemonResponse) {
+	st := resp.Stats
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "state\t%s\n", resp.State)
+	fmt.Fprintf(w, "uptime\t%s\n", st.Uptime.Round(time.Second))
+	fmt.Fprintf(w, "cpu time\t%s\n", st.CPU.Round(time.Millisecond))
+	if st.Uptime > 0 {
+		fmt.Fprintf(w, "cpu usage\t%.2f%%\n", 100*float64(st.CPU)/float64(st.Uptime))
+	}
+	fmt.Fprintf(w, "sample rate\t%d Hz\n", st.SampleRate)
+	names := make([]string, 0, len(st.Counters))
+	for name := range st.Counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%g\n", name, st.Counters[name])
+	}
+	w.Flush()
+}
+
+func sendDaemonRequest(socket string, req daemonRequest) (*daemonResponse, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the daemon (is `%s serve` running?): %w", appName, err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var resp daemonResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("invalid response from daemon: %w", err)
+	}
+	return &resp, nil
+}
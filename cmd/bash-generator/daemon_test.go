@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/metrics"
+	"github.com/jerilseb/bash-generator/pkg/record"
+	"github.com/jerilseb/bash-generator/pkg/safety"
+)
+
+// fakeMicrophone records a second of tone whenever it is asked to.
+type fakeMicrophone struct{}
+
+func (fakeMicrophone) Options() record.Options { return record.DefaultOptions }
+
+func (m fakeMicrophone) Record(stop <-chan struct{}) (*record.Recording, error) {
+	return m.RecordFunc(stop, nil)
+}
+
+func (fakeMicrophone) RecordFunc(stop <-chan struct{}, onChunk func(chunk []int16)) (*record.Recording, error) {
+	<-stop
+	samples := make([]int16, 16000)
+	for i := range samples {
+		samples[i] = int16(8000 * math.Sin(float64(i)/10))
+	}
+	return &record.Recording{Samples: samples, Channels: 1, SampleRate: 16000}, nil
+}
+
+// TestDaemonCancel checks that status and cancel answer while a recording is
+// being transcribed, and that cancel stops the transcription.
+func TestDaemonCancel(t *testing.T) {
+	api := &fakeAPI{command: "ls -la"}
+	uploaded := make(chan struct{})
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// begin warms the connection up with a HEAD request first.
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/audio/transcriptions" {
+			// The server only notices the client going away once the
+			// body has been read.
+			io.Copy(io.Discard, r.Body)
+			close(uploaded)
+			<-r.Context().Done()
+			return
+		}
+		api.serve(w, r)
+	}))
+	t.Cleanup(api.Close)
+	p := testPipeline(t, api)
+	d := &daemon{p: p, recorder: fakeMicrophone{}, capture: record.DefaultOptions, metrics: metrics.New(), started: time.Now()}
+
+	if resp := d.handle("start"); resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	stopped := make(chan daemonResponse)
+	go func() { stopped <- d.handle("stop") }()
+	select {
+	case <-uploaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the recording wasn't uploaded")
+	}
+
+	if resp := d.handle("status"); resp.State != stateProcessing {
+		t.Errorf("status = %q, want %q", resp.State, stateProcessing)
+	}
+	if resp := d.handle("start"); resp.Error == "" {
+		t.Error("start while processing succeeded, want an error")
+	}
+	d.handle("cancel")
+	select {
+	case resp := <-stopped:
+		if resp.Error != "cancelled" || resp.Command != "" {
+			t.Errorf("stop = %+v, want it cancelled", resp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancel didn't stop the transcription")
+	}
+	if resp := d.handle("status"); resp.State != stateIdle {
+		t.Errorf("status after cancel = %q, want %q", resp.State, stateIdle)
+	}
+}
+
+// TestDaemonSafety checks that the daemon's verdict on a command includes the
+// model's, which the hotkey decides on.
+func TestDaemonSafety(t *testing.T) {
+	tests := []struct {
+		command, danger string
+		want            safety.Level
+	}{
+		{"ls -la", "safe", safety.Safe},
+		{"ls -la", "dangerous", safety.Dangerous},
+		{"rm -rf /", "safe", safety.Dangerous},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command+" "+tt.danger, func(t *testing.T) {
+			api := newFakeAPI(t, tt.command)
+			api.danger = tt.danger
+			d := &daemon{p: testPipeline(t, api), recorder: fakeMicrophone{}, capture: record.DefaultOptions, metrics: metrics.New(), started: time.Now()}
+			d.handle("start")
+			resp := d.handle("stop")
+			if resp.Error != "" || resp.Safety == nil {
+				t.Fatalf("stop = %+v, want a checked command", resp)
+			}
+			if level, _ := safety.ParseLevel(resp.Safety.Level); level != tt.want {
+				t.Errorf("safety = %+v, want %v", resp.Safety, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+// listenPrivate creates the socket with owner-only permissions from the start.
+func listenPrivate(path string) (net.Listener, error) {
+	oldMask := syscall.Umask(0o177)
+	defer syscall.Umask(oldMask)
+	return net.Listen("unix", path)
+}
+
+// cpuTime returns the user and system CPU time consumed by this process.
+func cpuTime() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
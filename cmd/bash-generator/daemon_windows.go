@@ -0,0 +1,17 @@
+package main
+
+import (
+	"net"
+	"time"
+)
+
+// listenPrivate listens on path. The socket file inherits the ACL of the
+// directory, which is private to the user under the default socket path.
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
+
+// cpuTime isn't implemented on Windows.
+func cpuTime() time.Duration {
+	return 0
+}
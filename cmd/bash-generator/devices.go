@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+// runDevices lists the audio input devices, marking the default one, which is
+// the one recordings are made with.
+func runDevices(args []string) error {
+	fs := flag.NewFlagSet("devices", flag.ExitOnError)
+	fs.Parse(args)
+
+	list := inputDevices
+	if os.Getenv(captureHelperEnv) != "" {
+		list = captureHelperDevices
+	}
+	devices, err := list()
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return record.ErrNoInputDevice
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEFAULT\tNAME\tHOST API\tCHANNELS\tRATE")
+	for _, d := range devices {
+		def := ""
+		if d.Default {
+			def = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d Hz\n", def, d.Name, d.HostAPI, d.Channels, d.SampleRate)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jerilseb/bash-generator/internal/capability"
+)
+
+// runDoctor prints which optional features are available on this machine.
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.Parse(args)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tFEATURE\tSTATUS")
+	for _, c := range capability.Registry {
+		status := "missing " + strings.Join(c.Programs, " or ")
+		if c.Hint != "" {
+			status += " (" + c.Hint + ")"
+		}
+		if path, ok := c.Path(); ok {
+			status = "ok (" + path + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.Name, c.Feature, status)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/jerilseb/bash-generator/pkg/generate"
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+// editorProtocolVersion is the version of the protocol -stdio-server speaks.
+// It goes up only for changes old clients would misread; new methods, fields
+// and stages are added without a new version, and clients ignore what they
+// don't know.
+const editorProtocolVersion = 1
+
+// Error codes of the editor protocol, besides the JSON-RPC ones.
+const (
+	// editorFailed means the request was understood but failed, e.g. the
+	// recording couldn't be transcribed. The message says why.
+	editorFailed = -32000
+	// editorBusy means a dictation is already running.
+	editorBusy = -32001
+	// editorNoRecording means stop was called with no dictation running.
+	editorNoRecording = -32002
+)
+
+// Stages a generate or dictate request reports with progress notifications.
+const (
+	stageRecording    = "recording"
+	stageTranscribing = "transcribing"
+	stageTranscript   = "transcript"
+	stageGenerating   = "generating"
+)
+
+// editorProgress is the params of a progress notification.
+type editorProgress struct {
+	// ID is the ID of the request the notification is about.
+	ID    json.RawMessage `json:"id"`
+	Stage string          `json:"stage"`
+	// Text is the transcript, at stageTranscript.
+	Text string `json:"text,omitempty"`
+}
+
+// editorRequest is the params of generate and dictate.
+type editorRequest struct {
+	// Text is the request, for generate.
+	Text string `json:"text"`
+	// Context is anything the editor has that the request may be about, such
+	// as the selection or the output in its terminal.
+	Context string `json:"context"`
+}
+
+// editorResult answers generate and dictate.
+type editorResult struct {
+	Command     string `json:"command"`
+	Explanation string `json:"explanation,omitempty"`
+	// Transcript is what was heard, for dictate.
+	Transcript string `json:"transcript,omitempty"`
+	// Safety is safe, caution or dangerous, with Reasons for the latter two.
+	Safety  string   `json:"safety"`
+	Reasons []string `json:"reasons,omitempty"`
+	// Warning is something the editor should show next to the command.
+	Warning string `json:"warning,omitempty"`
+}
+
+// editorServer serves the pipeline to editor extensions over stdio, for
+// -stdio-server: they send requests, typed or dictated, and insert the
+// command into their terminal.
+type editorServer struct {
+	p       *pipeline
+	conn    *rpcConn
+	capture record.Options
+
+	mu sync.Mutex
+	// recorder is opened on the first dictation and kept open.
+	recorder        microphone
+	closeMicrophone func()
+	// stop ends the dictation being recorded; nil if there is none.
+	stop chan struct{}
+}
+
+// serveEditor serves the editor protocol on stdin and stdout until stdin is
+// closed.
+func serveEditor(p *pipeline, opts *options) error {
+	capture, err := captureOptions(record.DefaultOptions, opts.MaxDuration, opts.Channel)
+	if err != nil {
+		return err
+	}
+	s := &editorServer{p: p, capture: capture}
+	s.conn = newRPCConn(os.Stdout, s.handle, "cancel", "id")
+	defer func() {
+		if s.closeMicrophone != nil {
+			s.closeMicrophone()
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), shutdownSignals...)
+	defer stop()
+	return s.conn.serve(ctx, os.Stdin)
+}
+
+func (s *editorServer) handle(ctx context.Context, id json.RawMessage, method string, params json.RawMessage) (any, *rpcError) {
+	switch method {
+	case "initialize":
+		serverVersion := "(devel)"
+		if info, ok := debug.ReadBuildInfo(); ok {
+			serverVersion = info.Main.Version
+		}
+		return map[string]any{
+			"protocolVersion": editorProtocolVersion,
+			"serverInfo":      map[string]string{"name": appName, "version": serverVersion},
+		}, nil
+	case "generate":
+		var req editorRequest
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		text := strings.TrimSpace(req.Text)
+		if text == "" {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "text is required"}
+		}
+		return s.generate(ctx, id, text, typedRequest, req.Context)
+	case "dictate":
+		var req editorRequest
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &req); err != nil {
+				return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+			}
+		}
+		return s.dictate(ctx, id, req.Context)
+	case "stop":
+		if !s.stopRecording() {
+			return nil, &rpcError{Code: editorNoRecording, Message: "no dictation is being recorded"}
+		}
+		return map[string]any{}, nil
+	case "":
+		return nil, &rpcError{Code: rpcInvalidRequest, Message: "missing method"}
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: "unknown method " + method}
+	}
+}
+
+// progress tells the client which stage request id has reached.
+func (s *editorServer) progress(id json.RawMessage, stage, text string) {
+	s.conn.notify("progress", editorProgress{ID: id, Stage: stage, Text: text})
+}
+
+// dictate records until stop is called, the recording reaches its limit or
+// the request is cancelled, then transcribes it and generates a command.
+func (s *editorServer) dictate(ctx context.Context, id json.RawMessage, editorContext string) (any, *rpcError) {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return nil, &rpcError{Code: editorBusy, Message: "a dictation is already being recorded"}
+	}
+	if s.recorder == nil {
+		recorder, closeMicrophone, err := openMicrophone(s.capture)
+		if err != nil {
+			s.mu.Unlock()
+			return nil, &rpcError{Code: editorFailed, Message: err.Error()}
+		}
+		s.recorder, s.closeMicrophone = recorder, closeMicrophone
+	}
+	stop := make(chan struct{})
+	s.stop = stop
+	recorder := s.recorder
+	s.mu.Unlock()
+
+	s.progress(id, stageRecording, "")
+	done := make(chan recordResult, 1)
+	go func() {
+		rec, err := recorder.Record(stop)
+		done <- recordResult{rec, err}
+	}()
+	go s.p.warm()
+
+	var res recordResult
+	select {
+	case res = <-done:
+		s.stopRecording()
+	case <-ctx.Done():
+		s.stopRecording()
+		<-done
+		return nil, &rpcError{Code: editorFailed, Message: "cancelled"}
+	}
+	if res.err != nil {
+		return nil, &rpcError{Code: editorFailed, Message: res.err.Error()}
+	}
+
+	s.progress(id, stageTranscribing, "")
+	transcript, err := s.p.transcribe(ctx, res.rec)
+	if err != nil {
+		return nil, &rpcError{Code: editorFailed, Message: err.Error()}
+	}
+	transcript = strings.TrimSpace(transcript)
+	s.progress(id, stageTranscript, transcript)
+	if transcript == "" {
+		return nil, &rpcError{Code: editorFailed, Message: "nothing was heard"}
+	}
+
+	result, rpcErr := s.generate(ctx, id, transcript, spokenRequest, editorContext)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	result.Transcript = transcript
+	if res.rec.Truncated {
+		result.Warning = fmt.Sprintf("the recording stopped at the %s limit (see -max-duration)", s.capture.MaxDuration)
+	}
+	return result, nil
+}
+
+// stopRecording ends the dictation being recorded, reporting whether there was one.
+func (s *editorServer) stopRecording() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil {
+		return false
+	}
+	close(s.stop)
+	s.stop = nil
+	return true
+}
+
+// generate turns text into a command, with the editor's context if any.
+func (s *editorServer) generate(ctx context.Context, id json.RawMessage, text string, from origin, editorContext string) (*editorResult, *rpcError) {
+	var extra []generate.Segment
+	if editorContext = strings.TrimSpace(editorContext); editorContext != "" {
+		extra = append(extra, generate.Segment{Name: "editor", Title: "From the editor the request was made in", Lines: strings.Split(editorContext, "\n")})
+	}
+	s.progress(id, stageGenerating, "")
+	generated, err := s.p.generate(ctx, text, from, nil, extra...)
+	if errors.Is(err, context.Canceled) {
+		return nil, &rpcError{Code: editorFailed, Message: "cancelled"}
+	}
+	if err != nil {
+		return nil, &rpcError{Code: editorFailed, Message: err.Error()}
+	}
+	verdict := checkCommand(generated)
+	return &editorResult{
+		Command:     generated.Command,
+		Explanation: generated.Explanation,
+		Safety:      verdict.Level.String(),
+		Reasons:     verdict.Reasons,
+	}, nil
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/pkg/generate"
+	"github.com/jerilseb/bash-generator/pkg/transcribe"
+)
+
+const (
+	defaultBaseURL         = "https://api.openai.com/v1"
+	defaultAzureAPIVersion = "2024-10-21"
+)
+
+// apiEndpoint describes where and how to reach an OpenAI-compatible API.
+type apiEndpoint struct {
+	// TranscriptionURL and ChatURL are the full URLs of the two endpoints we call.
+	TranscriptionURL string
+	ChatURL          string
+
+	// TranscriptionModel is sent as the "model" field of transcription requests.
+	TranscriptionModel string
+	// AudioFormats lists the audio formats the transcription endpoint
+	// accepts, most preferred first; empty means the OpenAI set.
+	AudioFormats []string
+
+	// APIKey is sent either as a bearer token or, for Azure, in the api-key header.
+	APIKey string
+	Azure  bool
+
+	// Provider is the speech-to-text API recordings are sent to. For
+	// providers other than OpenAI, ProviderURL and ProviderKey are used for
+	// transcription, while TranscriptionURL and APIKey still locate the
+	// OpenAI endpoints next to it, such as embeddings.
+	Provider    transcribe.Provider
+	ProviderURL string
+	ProviderKey string
+
+	// Backend is the API the chat endpoint speaks.
+	Backend generate.Backend
+	// ChatModel is the model commands are generated with.
+	ChatModel string
+	// ChatKey authenticates chat requests to Anthropic or Gemini, which have keys of their own.
+	ChatKey string
+	// PlainText asks for commands as plain text rather than structured output.
+	PlainText bool
+
+	// LocalWhisperURL is a self-hosted Whisper server recordings are sent to
+	// first, with LocalWhisperModel, the transcription API above only taking
+	// over while it is down; none if empty.
+	LocalWhisperURL   string
+	LocalWhisperModel string
+}
+
+// endpointOptions holds the user supplied settings endpoints are resolved from.
+// Empty fields fall back to the corresponding environment variables, then to the config file.
+type endpointOptions struct {
+	APIType            string
+	BaseURL            string
+	TranscriptionURL   string
+	ChatURL            string
+	TranscriptionModel string
+	Provider           string
+	Backend            string
+	ChatModel          string
+	LocalWhisper       string
+
+	// Config provides the last-resort defaults; it may be nil.
+	Config *config
+}
+
+// setting returns value if set, else the environment variable key, else fallback.
+func setting(value, key, fallback string) string {
+	if value != "" {
+		return value
+	}
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// resolveEndpoint works out the endpoint URLs and credentials from opts and the environment.
+//
+// For the default "openai" type the URLs are derived from OPENAI_BASE_URL, which makes any
+// OpenAI-compatible server (OpenRouter, Groq, LM Studio, ...) usable. The "azure" type builds
+// deployment URLs from AZURE_OPENAI_ENDPOINT and the configured deployment names.
+// Commands can instead be generated with Anthropic's or Google's own API, selected
+// with BASH_GENERATOR_BACKEND, and speech transcribed by Deepgram, AssemblyAI or
+// Google, selected with BASH_GENERATOR_TRANSCRIPTION_PROVIDER.
+func resolveEndpoint(opts endpointOptions) (*apiEndpoint, error) {
+	cfg := opts.Config
+	if cfg == nil {
+		cfg = &config{}
+	}
+	apiType := strings.ToLower(setting(opts.APIType, "OPENAI_API_TYPE", cfg.APIType))
+	ep := &apiEndpoint{
+		TranscriptionModel: setting(opts.TranscriptionModel, "OPENAI_TRANSCRIPTION_MODEL", cfg.TranscriptionModel),
+		AudioFormats:       cfg.TranscriptionFormats,
+		PlainText:          cfg.PlainTextOutput,
+		LocalWhisperURL:    setting(opts.LocalWhisper, "BASH_GENERATOR_LOCAL_WHISPER_URL", cfg.LocalWhisperURL),
+		LocalWhisperModel:  cfg.LocalWhisperModel,
+	}
+
+	switch apiType {
+	case "", "openai":
+		ep.APIKey = apiKey("OPENAI_API_KEY", "openai", cfg.APIKey)
+		base := strings.TrimRight(setting(opts.BaseURL, "OPENAI_BASE_URL", cfg.BaseURL), "/")
+		if base == "" {
+			base = defaultBaseURL
+		}
+		ep.TranscriptionURL = base + "/audio/transcriptions"
+		ep.ChatURL = base + "/chat/completions"
+	case "azure":
+		ep.Azure = true
+		ep.APIKey = apiKey("AZURE_OPENAI_API_KEY", "azure", cfg.APIKey)
+		azureEndpoint := strings.TrimRight(setting(opts.BaseURL, "AZURE_OPENAI_ENDPOINT", cfg.BaseURL), "/")
+		if azureEndpoint == "" {
+			return nil, fmt.Errorf("Azure endpoint not found. Please set AZURE_OPENAI_ENDPOINT in your environment")
+		}
+		version := os.Getenv("AZURE_OPENAI_API_VERSION")
+		if version == "" {
+			version = defaultAzureAPIVersion
+		}
+		deploymentURL := func(deployment, path string) string {
+			return fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s",
+				azureEndpoint, url.PathEscape(deployment), path, url.QueryEscape(version))
+		}
+		if d := os.Getenv("AZURE_OPENAI_TRANSCRIPTION_DEPLOYMENT"); d != "" {
+			ep.TranscriptionURL = deploymentURL(d, "audio/transcriptions")
+		}
+		if d := os.Getenv("AZURE_OPENAI_CHAT_DEPLOYMENT"); d != "" {
+			ep.ChatURL = deploymentURL(d, "chat/completions")
+		}
+	default:
+		return nil, fmt.Errorf("unknown API type %q (expected openai or azure)", apiType)
+	}
+
+	// Each chat backend has its own key, and its own variable to pick the model with.
+	modelEnv, keyEnv, vendor := "OPENAI_CHAT_MODEL", "", ""
+	ep.Backend = generate.Backend(strings.ToLower(setting(opts.Backend, "BASH_GENERATOR_BACKEND", cfg.Backend)))
+	switch ep.Backend {
+	case "", generate.OpenAI:
+		ep.Backend = generate.OpenAI
+	case generate.Anthropic:
+		modelEnv, keyEnv, vendor = "ANTHROPIC_MODEL", "ANTHROPIC_API_KEY", "Anthropic"
+		ep.ChatURL = generate.DefaultAnthropicURL
+		ep.ChatKey = apiKey(keyEnv, "anthropic", cfg.ChatAPIKey)
+	case generate.Gemini:
+		modelEnv, keyEnv, vendor = "GEMINI_MODEL", "GEMINI_API_KEY", "Gemini"
+		ep.ChatURL = generate.DefaultGeminiURL
+		if ep.ChatKey = setting("", keyEnv, os.Getenv("GOOGLE_API_KEY")); ep.ChatKey == "" {
+			ep.ChatKey = apiKey(keyEnv, "gemini", cfg.ChatAPIKey)
+		}
+	default:
+		return nil, fmt.Errorf("unknown backend %q (expected openai, anthropic or gemini)", ep.Backend)
+	}
+	ep.ChatModel = setting(opts.ChatModel, modelEnv, cfg.ChatModel)
+	if ep.ChatModel == "" {
+		ep.ChatModel = generate.DefaultModelFor(ep.Backend)
+	}
+
+	// So does each transcription provider.
+	providerEnv, providerVendor := "", ""
+	ep.Provider = transcribe.Provider(strings.ToLower(setting(opts.Provider, "BASH_GENERATOR_TRANSCRIPTION_PROVIDER", cfg.TranscriptionProvider)))
+	switch ep.Provider {
+	case "", transcribe.OpenAI:
+		ep.Provider = transcribe.OpenAI
+	case transcribe.Deepgram:
+		providerEnv, providerVendor = "DEEPGRAM_API_KEY", "Deepgram"
+	case transcribe.AssemblyAI:
+		providerEnv, providerVendor = "ASSEMBLYAI_API_KEY", "AssemblyAI"
+	case transcribe.Google:
+		providerEnv, providerVendor = "GOOGLE_SPEECH_API_KEY", "Google Speech-to-Text"
+	default:
+		return nil, fmt.Errorf("unknown transcription provider %q (expected openai, deepgram, assemblyai or google)", ep.Provider)
+	}
+	if providerEnv != "" {
+		ep.ProviderKey = apiKey(providerEnv, string(ep.Provider), cfg.TranscriptionAPIKey)
+	}
+	if ep.TranscriptionModel == "" {
+		ep.TranscriptionModel = transcribe.DefaultModelFor(ep.Provider)
+	}
+
+	// Explicit URLs always win, so the two endpoints can live on different servers.
+	if u := setting(opts.TranscriptionURL, "OPENAI_TRANSCRIPTION_URL", cfg.TranscriptionURL); u != "" {
+		if ep.Provider == transcribe.OpenAI {
+			ep.TranscriptionURL = u
+		} else {
+			ep.ProviderURL = u
+		}
+	}
+	if ep.Provider != transcribe.OpenAI && ep.ProviderURL == "" {
+		ep.ProviderURL = transcribe.DefaultURLFor(ep.Provider)
+	}
+	if u := setting(opts.ChatURL, "OPENAI_CHAT_URL", cfg.ChatURL); u != "" {
+		ep.ChatURL = u
+	}
+
+	if ep.TranscriptionURL == "" && ep.Provider == transcribe.OpenAI {
+		return nil, fmt.Errorf("transcription endpoint not configured. Please set AZURE_OPENAI_TRANSCRIPTION_DEPLOYMENT or OPENAI_TRANSCRIPTION_URL")
+	}
+	if ep.ChatURL == "" {
+		return nil, fmt.Errorf("chat endpoint not configured. Please set AZURE_OPENAI_CHAT_DEPLOYMENT or OPENAI_CHAT_URL")
+	}
+	if keyEnv != "" && ep.ChatKey == "" && !isLocalURL(ep.ChatURL) {
+		return nil, fmt.Errorf("%s API key not found. Please set %s in your environment or run `%s auth login %s`", vendor, keyEnv, appName, ep.Backend)
+	}
+	// With a local Whisper server, the transcription API is only a fallback
+	// and can go without its key.
+	if providerEnv != "" && ep.ProviderKey == "" && !isLocalURL(ep.ProviderURL) && ep.LocalWhisperURL == "" {
+		return nil, fmt.Errorf("%s API key not found. Please set %s in your environment or run `%s auth login %s`", providerVendor, providerEnv, appName, ep.Provider)
+	}
+	if ep.APIKey == "" {
+		if ep.Azure {
+			return nil, fmt.Errorf("Azure OpenAI API key not found. Please set AZURE_OPENAI_API_KEY in your environment or run `%s auth login azure`", appName)
+		}
+		transcriptionNeedsKey := ep.Provider == transcribe.OpenAI && !isLocalURL(ep.TranscriptionURL) && ep.LocalWhisperURL == ""
+		chatNeedsKey := ep.Backend == generate.OpenAI && !isLocalURL(ep.ChatURL)
+		if transcriptionNeedsKey || chatNeedsKey {
+			return nil, fmt.Errorf("OpenAI API key not found. Please set OPENAI_API_KEY in your environment or run `%s auth login`", appName)
+		}
+	}
+	return ep, nil
+}
+
+// header returns the authentication header the endpoint expects.
+func (ep *apiEndpoint) header() http.Header {
+	h := make(http.Header)
+	if ep.APIKey == "" {
+		return h
+	}
+	if ep.Azure {
+		h.Set("api-key", ep.APIKey)
+		return h
+	}
+	h.Set("Authorization", "Bearer "+ep.APIKey)
+	return h
+}
+
+// translationURL returns the URL of the translation endpoint that sits next to
+// the transcription endpoint, as it does on OpenAI and Azure.
+func (ep *apiEndpoint) translationURL() (string, error) {
+	if ep.Provider != transcribe.OpenAI {
+		return "", fmt.Errorf("-translate only works with OpenAI-compatible transcription, not %s", ep.Provider)
+	}
+	const transcriptions, translations = "/audio/transcriptions", "/audio/translations"
+	u, err := url.Parse(ep.TranscriptionURL)
+	if err != nil || !strings.HasSuffix(u.Path, transcriptions) {
+		return "", fmt.Errorf("can't tell the translation endpoint from the transcription URL %s; it should end in %s", ep.TranscriptionURL, transcriptions)
+	}
+	u.Path = strings.TrimSuffix(u.Path, transcriptions) + translations
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// realtime returns a client for the Realtime API next to the transcription
+// endpoint, which transcribes with model, or the default realtime model if
+// model is empty.
+func (ep *apiEndpoint) realtime(model string) (*transcribe.Realtime, error) {
+	if ep.Azure {
+		return nil, errors.New("-stream isn't supported with Azure OpenAI")
+	}
+	if ep.Provider != transcribe.OpenAI {
+		return nil, fmt.Errorf("-stream only works with OpenAI's Realtime API, not %s", ep.Provider)
+	}
+	const transcriptions = "/audio/transcriptions"
+	u, err := url.Parse(ep.TranscriptionURL)
+	if err != nil || !strings.HasSuffix(u.Path, transcriptions) {
+		return nil, fmt.Errorf("can't tell the Realtime endpoint from the transcription URL %s; it should end in %s", ep.TranscriptionURL, transcriptions)
+	}
+	u.Path = strings.TrimSuffix(u.Path, transcriptions) + "/realtime"
+	u.RawPath = ""
+	u.RawQuery = "intent=transcription"
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	if model == "" {
+		model = transcribe.DefaultRealtimeModel
+	}
+	return &transcribe.Realtime{URL: u.String(), Model: model, Header: ep.header()}, nil
+}
+
+// transcriber returns a transcription client for the endpoint.
+func (ep *apiEndpoint) transcriber() *transcribe.Client {
+	c := &transcribe.Client{
+		Provider: ep.Provider,
+		URL:      ep.TranscriptionURL,
+		Model:    ep.TranscriptionModel,
+		Formats:  ep.AudioFormats,
+		Header:   ep.header(),
+	}
+	switch {
+	case ep.Provider != transcribe.OpenAI:
+		c.URL = ep.ProviderURL
+		c.Header = ep.providerHeader()
+		if ep.Provider == transcribe.Google {
+			c.MaxUploadSize = transcribe.GoogleMaxUploadSize
+		}
+	// Other servers have limits of their own, or none.
+	case ep.Azure || strings.HasPrefix(ep.TranscriptionURL, "https://api.openai.com/"):
+		c.MaxUploadSize = transcribe.OpenAIMaxUploadSize
+	}
+	return c
+}
+
+// transcriptionReady reports whether the transcription API has the key it
+// needs, or needs none, which it may lack behind a local Whisper server.
+func (ep *apiEndpoint) transcriptionReady() bool {
+	if ep.Provider != transcribe.OpenAI {
+		return ep.ProviderKey != "" || isLocalURL(ep.ProviderURL)
+	}
+	return ep.APIKey != "" || isLocalURL(ep.TranscriptionURL)
+}
+
+// providerHeader returns the authentication header the transcription provider expects.
+func (ep *apiEndpoint) providerHeader() http.Header {
+	h := make(http.Header)
+	if ep.ProviderKey == "" {
+		return h
+	}
+	switch ep.Provider {
+	case transcribe.Deepgram:
+		h.Set("Authorization", "Token "+ep.ProviderKey)
+	case transcribe.AssemblyAI:
+		h.Set("Authorization", ep.ProviderKey)
+	case transcribe.Google:
+		h.Set("X-Goog-Api-Key", ep.ProviderKey)
+	}
+	return h
+}
+
+// generator returns a command generation client for the endpoint.
+func (ep *apiEndpoint) generator() *generate.Client {
+	return &generate.Client{
+		Backend:   ep.Backend,
+		URL:       ep.ChatURL,
+		Model:     ep.ChatModel,
+		Header:    ep.chatHeader(),
+		PlainText: ep.PlainText,
+	}
+}
+
+// chatHeader returns the authentication header the chat endpoint expects.
+func (ep *apiEndpoint) chatHeader() http.Header {
+	switch ep.Backend {
+	case generate.Anthropic:
+		return http.Header{"X-Api-Key": {ep.ChatKey}}
+	case generate.Gemini:
+		return http.Header{"X-Goog-Api-Key": {ep.ChatKey}}
+	default:
+		return ep.header()
+	}
+}
+
+// isLocalURL reports whether rawURL points at this machine; local servers such as
+// LM Studio usually don't require an API key.
+func isLocalURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/cost"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// Assumptions for estimating a request before its transcript is known.
+const (
+	// spokenTokensPerMinute is about 150 words a minute at 1.3 tokens a word.
+	spokenTokensPerMinute = 200
+	// typicalReplyTokens is the length of a typical one-line command.
+	typicalReplyTokens = 50
+	// typicalScriptTokens is the length of a typical script from -script.
+	typicalScriptTokens = 800
+)
+
+// costEstimate is the expected cost of one request, worked out before any API call.
+type costEstimate struct {
+	transcriptionModel string
+	audio              time.Duration
+	transcription      float64
+
+	chatModel    string
+	promptTokens int
+	chat         float64
+}
+
+// estimateCost works out what transcribing audio of the given length and
+// generating a command for it will cost, including the context that would be sent.
+func (p *pipeline) estimateCost(audio time.Duration) costEstimate {
+	model := p.generator.ModelFor(generate.Request{})
+	prompt := p.systemPrompt() + generate.ContextPreamble
+	transcriptTokens := int(audio.Minutes()*spokenTokensPerMinute) + 1
+	promptTokens := generate.CountTokens(model, p.systemPrompt()) + transcriptTokens + 2*generate.TokensPerMessage
+	if context := p.fitContext(model, prompt); context != "" {
+		promptTokens += generate.CountTokens(model, generate.ContextPreamble+context) + generate.TokensPerMessage
+	}
+	for _, example := range p.examples() {
+		promptTokens += generate.CountTokens(model, example.Request+example.Command) + 2*generate.TokensPerMessage
+	}
+	replyTokens := typicalReplyTokens
+	if p.script {
+		replyTokens = typicalScriptTokens
+	}
+	return costEstimate{
+		transcriptionModel: p.transcriber.Model,
+		audio:              audio,
+		transcription:      cost.Transcription(p.transcriber.Model, audio),
+		chatModel:          model,
+		promptTokens:       promptTokens,
+		chat:               cost.Chat(model, promptTokens, replyTokens),
+	}
+}
+
+// print writes the estimate, one line per API call.
+func (e costEstimate) print(w io.Writer) {
+	price := func(usd float64, known bool) string {
+		if !known {
+			return "price unknown"
+		}
+		return fmt.Sprintf("$%.4f", usd)
+	}
+	transcriptionKnown := cost.TranscriptionPriced(e.transcriptionModel)
+	chatKnown := cost.ChatPriced(e.chatModel)
+
+	fmt.Fprintf(w, "\nTranscribing %.1fs of audio with %s: %s\n", e.audio.Seconds(), e.transcriptionModel, price(e.transcription, transcriptionKnown))
+	fmt.Fprintf(w, "Generating with %s, about %d prompt tokens: %s\n", e.chatModel, e.promptTokens, price(e.chat, chatKnown))
+	total := fmt.Sprintf("$%.4f", e.transcription+e.chat)
+	if !transcriptionKnown || !chatKnown {
+		total += " plus the unknown part"
+	}
+	fmt.Fprintf(w, "Estimated total: %s\n", total)
+}
+
+// confirmEstimate shows what the request is expected to cost and asks whether to send it.
+func confirmEstimate(ui io.Writer, input *lineReader, e costEstimate) (bool, error) {
+	e.print(ui)
+	fmt.Fprint(ui, "Send the request? (Y/n): ")
+	response, err := input.ReadLine()
+	if err != nil {
+		return false, fmt.Errorf("failed to read user input: %w", err)
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "" || response == "y" || response == "yes", nil
+}
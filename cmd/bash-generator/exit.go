@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Exit codes, so wrapper scripts and shell widgets can tell what happened
+// without parsing the output. They are part of the interface; don't renumber.
+const (
+	exitOK = 0
+	// exitFailure is for everything else: bad flags, no microphone, a
+	// command that failed to run.
+	exitFailure = 1
+	// exitAborted means the user stopped: Ctrl+C, a discarded recording, an
+	// empty request or a command they chose not to run.
+	exitAborted = 2
+	// exitTranscription means the recording couldn't be transcribed.
+	exitTranscription = 3
+	// exitGeneration means no command could be generated.
+	exitGeneration = 4
+	// exitUnsafe means a command found dangerous was not confirmed.
+	exitUnsafe = 5
+	// exitOverBudget means this month's API spend has reached monthly_budget.
+	exitOverBudget = 6
+)
+
+// exitStatus is an error that ends the program with a particular exit code.
+type exitStatus struct {
+	code int
+	// err is printed, unless it is nil because the outcome has been told
+	// to the user already.
+	err error
+}
+
+func (e *exitStatus) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e *exitStatus) Unwrap() error { return e.err }
+
+// exitWith makes err end the program with code, unless it is nil or already
+// has an exit code of its own.
+func exitWith(code int, err error) error {
+	var status *exitStatus
+	if err == nil || errors.As(err, &status) {
+		return err
+	}
+	return &exitStatus{code: code, err: err}
+}
+
+// exit reports err, if any, and ends the program with its exit code.
+func exit(err error) {
+	if err == nil {
+		os.Exit(exitOK)
+	}
+	var status *exitStatus
+	if !errors.As(err, &status) {
+		status = &exitStatus{code: exitFailure, err: err}
+	}
+	if status.err != nil {
+		fmt.Fprintf(os.Stderr, "An error occurred: %v\n", status.err)
+	}
+	os.Exit(status.code)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// Limits on the output piped in with -fix, or captured with -auto-fix. Errors
+// are usually at the end, so that is what is kept.
+const (
+	maxOutputLines      = 60
+	maxOutputLineLength = 300
+)
+
+// readPipedOutput reads the output of a command that went wrong from stdin,
+// for -fix, and returns its last lines. stdin is then reopened on the terminal,
+// so recording, the single key controls and the questions about the command
+// work as they do without a pipe.
+func readPipedOutput() ([]string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("-fix reads the output of the command to fix from stdin; pipe it in, as in: make 2>&1 | %s -fix", appName)
+	}
+	lines, err := lastLines(bufio.NewScanner(os.Stdin))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the piped output: %w", err)
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("-fix got no output on stdin to fix")
+	}
+
+	tty, err := os.Open(terminalPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the terminal for the rest of -fix: %w", err)
+	}
+	os.Stdin = tty
+	return lines, nil
+}
+
+// lastLines returns the last maxOutputLines lines scanner reads, each cut to
+// maxOutputLineLength, noting how many came before them.
+func lastLines(scanner *bufio.Scanner) ([]string, error) {
+	var lines []string
+	omitted := 0
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) > maxOutputLineLength {
+			line = line[:maxOutputLineLength] + "..."
+		}
+		lines = append(lines, line)
+		if len(lines) > maxOutputLines {
+			lines = lines[1:]
+			omitted++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if omitted > 0 {
+		lines = append([]string{fmt.Sprintf("(%d earlier lines omitted)", omitted)}, lines...)
+	}
+	return lines, nil
+}
+
+// fixFailed asks the model to correct command, generated for text, after it
+// exited with status code, for -auto-fix. The end of what it wrote to stderr
+// goes along in the context.
+func (p *pipeline) fixFailed(ctx context.Context, text, command string, code int, stderr *outputCapture) (*generate.Response, error) {
+	var extra []generate.Segment
+	if lines, err := lastLines(bufio.NewScanner(strings.NewReader(stderr.String()))); err == nil && len(lines) > 0 {
+		title := fmt.Sprintf("What the command wrote to stderr before it exited with status %d", code)
+		extra = append(extra, generate.Segment{Name: "stderr", Title: title, Lines: lines})
+	}
+	request := fmt.Sprintf("That command failed with exit status %d. Give a corrected command that does what I asked for.", code)
+	return p.complete(ctx, request, []generate.Turn{{Request: text, Command: command}}, extra...)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jerilseb/bash-generator/internal/history"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// historyFlags are the flags of history.
+type historyFlags struct {
+	all        bool
+	limit      int
+	pickerName string
+}
+
+func (f *historyFlags) define(fs *flag.FlagSet) {
+	fs.BoolVar(&f.all, "all", false, "show requests from everywhere, not just the current repository")
+	fs.IntVar(&f.limit, "n", 20, "number of entries to show")
+	fs.StringVar(&f.pickerName, "picker", "", "choose one of the commands with rofi, fzf or dmenu and print it, instead of listing them")
+}
+
+// runHistory lists recent requests and their commands. Inside a git repository
+// only the ones made in it are shown, unless -all is given. With -picker the
+// user chooses one of the commands instead, which is printed alone, for
+// launchers and key bindings to use. history export and history import move
+// it between machines.
+func runHistory(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "export":
+			return runHistoryExport(args[1:])
+		case "import":
+			return runHistoryImport(args[1:])
+		}
+	}
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	var flags historyFlags
+	flags.define(fs)
+	fs.Parse(args)
+	entries, err := historyStore().Load()
+	if err != nil {
+		return err
+	}
+	if root, ok := gitRoot(); ok && !flags.all {
+		var here []history.Entry
+		for _, e := range entries {
+			if e.InProject(root) {
+				here = append(here, e)
+			}
+		}
+		entries = here
+		if flags.pickerName == "" {
+			fmt.Printf("Requests made in %s (-all shows everything):\n\n", root)
+		}
+	}
+	if flags.pickerName != "" {
+		return pickFromHistory(flags.pickerName, entries)
+	}
+	if len(entries) > flags.limit {
+		entries = entries[len(entries)-flags.limit:]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tRUN\tREQUEST\tCOMMAND")
+	for _, e := range entries {
+		run := "no"
+		if e.Accepted {
+			run = "yes"
+		}
+		command := strings.ReplaceAll(e.Command, "\n", "; ")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Time.Local().Format("2006-01-02 15:04"), run, e.Transcript, command)
+	}
+	return w.Flush()
+}
+
+// pickFromHistory lets the user choose one of the commands in entries with the
+// picker called name, newest first and each only once, and prints it.
+func pickFromHistory(name string, entries []history.Entry) error {
+	pk, err := newPicker(name)
+	if err != nil {
+		return err
+	}
+	var commands, choices []string
+	seen := make(map[string]bool)
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Command == "" || seen[e.Command] {
+			continue
+		}
+		seen[e.Command] = true
+		commands = append(commands, e.Command)
+		choices = append(choices, fmt.Sprintf("%s    # %s", e.Command, e.Transcript))
+	}
+	if len(commands) == 0 {
+		return errors.New("the history has no commands yet")
+	}
+	i, err := pk.pick("command", choices)
+	if errors.Is(err, errNothingPicked) {
+		return &exitStatus{code: exitAborted}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(commands[i])
+	return nil
+}
+
+// fewShotExamples returns up to n of the most recent commands the user ran,
+// with the requests they came from, oldest first. Commands that failed, undos
+// and scripts are left out, as are repeats of a command already picked. A history
+// that can't be read gives no examples.
+func fewShotExamples(n int) []generate.Turn {
+	entries, err := historyStore().Load()
+	if err != nil {
+		return nil
+	}
+	var examples []generate.Turn
+	seen := make(map[string]bool)
+	for i := len(entries) - 1; i >= 0 && len(examples) < n; i-- {
+		e := entries[i]
+		failed := e.ExitCode != nil && *e.ExitCode != 0
+		if !e.Accepted || failed || e.UndoOf != nil || e.Transcript == "" || strings.Contains(e.Command, "\n") || seen[e.Command] {
+			continue
+		}
+		seen[e.Command] = true
+		examples = append(examples, generate.Turn{Request: e.Transcript, Command: e.Command})
+	}
+	slices.Reverse(examples)
+	return examples
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/internal/history"
+)
+
+// History export formats.
+const (
+	historyJSON  = "json"
+	historyCSV   = "csv"
+	historyShell = "shellhistory"
+)
+
+// runHistoryExport writes the whole history out, for another machine to
+// import or for the shell's own history. With -merge the commands that were
+// run go straight into the shell history file, in time order.
+func runHistoryExport(args []string) error {
+	fs := flag.NewFlagSet("history export", flag.ExitOnError)
+	format := fs.String("format", historyJSON, "format to export in: json (one entry per line), csv, or shellhistory (the commands that were run, as the shell keeps them)")
+	out := fs.String("o", "", "file to write to, or with -merge the shell history file to merge into; standard output, or HISTFILE with -merge, if empty")
+	shellName := fs.String("shell", defaultHistoryShell(), "shell whose history format to write with -format shellhistory: bash or zsh (extended history)")
+	merge := fs.Bool("merge", false, "merge the commands into the shell history file, by their timestamps, rather than writing them out; implies -format shellhistory")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *merge {
+		*format = historyShell
+	}
+	if *shellName != "bash" && *shellName != "zsh" {
+		return fmt.Errorf("unknown shell %q (expected bash or zsh)", *shellName)
+	}
+
+	entries, err := historyStore().Load()
+	if err != nil {
+		return err
+	}
+	var data bytes.Buffer
+	switch *format {
+	case historyJSON:
+		err = history.WriteJSON(&data, entries)
+	case historyCSV:
+		err = history.WriteCSV(&data, entries)
+	case historyShell:
+		if *merge {
+			return mergeShellHistory(*out, *shellName, shellCommands(entries))
+		}
+		shellFormat := history.Bash
+		if *shellName == "zsh" {
+			shellFormat = history.ZshExtended
+		}
+		data.Write(history.FormatShellHistory(shellFormat, shellCommands(entries)))
+	default:
+		return fmt.Errorf("unknown format %q (expected json, csv or shellhistory)", *format)
+	}
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(data.Bytes())
+		return err
+	}
+	return os.WriteFile(*out, data.Bytes(), 0o600)
+}
+
+// runHistoryImport adds the entries of a file made by history export to the
+// history, leaving out those it already has.
+func runHistoryImport(args []string) error {
+	fs := flag.NewFlagSet("history import", flag.ExitOnError)
+	format := fs.String("format", "", "format of the file: json or csv; by its extension if empty")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s history import [-format json|csv] FILE\n\nFILE is made with history export; - reads standard input.\n", appName)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = historyJSON
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			*format = historyCSV
+		}
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	var entries []history.Entry
+	var err error
+	switch *format {
+	case historyJSON:
+		entries, err = history.ReadJSON(r)
+	case historyCSV:
+		entries, err = history.ReadCSV(r)
+	default:
+		return fmt.Errorf("unknown format %q (expected json or csv)", *format)
+	}
+	if err != nil {
+		return err
+	}
+	added, err := historyStore().Merge(entries)
+	if err != nil {
+		return fmt.Errorf("failed to add to the history: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d entries; %d were in the history already.\n", added, len(entries)-added)
+	return nil
+}
+
+// shellCommands returns the commands of the entries that were run, as a
+// shell history would have them.
+func shellCommands(entries []history.Entry) []history.ShellCommand {
+	var cmds []history.ShellCommand
+	for _, e := range entries {
+		if e.Accepted && strings.TrimSpace(e.Command) != "" {
+			cmds = append(cmds, history.ShellCommand{Time: e.Time, Command: e.Command})
+		}
+	}
+	return cmds
+}
+
+// mergeShellHistory merges cmds into the shell history file at path, or the
+// user's own one if path is empty. The file keeps its format, which
+// shellName only decides for a file that doesn't show it yet, and is replaced
+// in one go.
+func mergeShellHistory(path, shellName string, cmds []history.ShellCommand) error {
+	if path == "" {
+		var err error
+		if path, err = shellHistoryFile(); err != nil {
+			return err
+		}
+		if path == "" {
+			return errors.New("no shell history file found; set HISTFILE or pass -o")
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	name := filepath.Base(path)
+	zsh := strings.Contains(name, "zsh") || shellName == "zsh" && !strings.Contains(name, "bash")
+	format := history.DetectShellFormat(data, zsh)
+	merged, added := history.MergeShellHistory(data, format, cmds)
+	if added == 0 {
+		fmt.Fprintf(os.Stderr, "%s has all %d commands already.\n", path, len(cmds))
+		return nil
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(merged); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Merged %d commands into %s. Shells already open see them after history -r (bash) or fc -R (zsh).\n", added, path)
+	return nil
+}
+
+// defaultHistoryShell is the shell whose history format is written unless
+// -shell says otherwise: zsh if it is the login shell or HISTFILE is its.
+func defaultHistoryShell() string {
+	if filepath.Base(os.Getenv("SHELL")) == "zsh" || strings.Contains(filepath.Base(os.Getenv("HISTFILE")), "zsh") {
+		return "zsh"
+	}
+	return "bash"
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/internal/capability"
+	"github.com/jerilseb/bash-generator/pkg/safety"
+)
+
+// hotkey is a key combination such as ctrl+shift+space.
+type hotkey struct {
+	// mods are among ctrl, shift, alt and super, in that order.
+	mods []string
+	// key is a lowercase letter or digit, space, or f1 to f12.
+	key string
+}
+
+// hotkeyMods maps the names modifiers go by to the ones hotkey uses, in the
+// order they are listed in.
+var hotkeyMods = []struct {
+	name    string
+	aliases []string
+}{
+	{"ctrl", []string{"ctrl", "control"}},
+	{"shift", []string{"shift"}},
+	{"alt", []string{"alt", "option", "opt"}},
+	{"super", []string{"super", "cmd", "command", "win", "meta", "mod4"}},
+}
+
+// parseHotkey parses a key combination written as modifiers and a key joined
+// by +, such as ctrl+shift+space or super+v.
+func parseHotkey(s string) (hotkey, error) {
+	parts := strings.Split(strings.ToLower(strings.ReplaceAll(s, " ", "")), "+")
+	k := hotkey{key: parts[len(parts)-1]}
+	if !validHotkeyKey(k.key) {
+		return hotkey{}, fmt.Errorf("invalid hotkey %q: the key must be a letter, a digit, space or f1 to f12", s)
+	}
+	given := make(map[string]bool)
+	for _, part := range parts[:len(parts)-1] {
+		found := false
+		for _, m := range hotkeyMods {
+			for _, alias := range m.aliases {
+				if part == alias {
+					given[m.name], found = true, true
+				}
+			}
+		}
+		if !found {
+			return hotkey{}, fmt.Errorf("invalid hotkey %q: unknown modifier %q (expected ctrl, shift, alt or super)", s, part)
+		}
+	}
+	for _, m := range hotkeyMods {
+		if given[m.name] {
+			k.mods = append(k.mods, m.name)
+		}
+	}
+	if len(k.mods) == 0 {
+		return hotkey{}, fmt.Errorf("invalid hotkey %q: it needs at least one modifier, or it would take the key away from every program", s)
+	}
+	return k, nil
+}
+
+func validHotkeyKey(key string) bool {
+	if len(key) == 1 {
+		return key[0] >= 'a' && key[0] <= 'z' || key[0] >= '0' && key[0] <= '9'
+	}
+	if key == "space" {
+		return true
+	}
+	for i := 1; i <= 12; i++ {
+		if key == fmt.Sprintf("f%d", i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k hotkey) String() string {
+	return strings.Join(append(append([]string{}, k.mods...), k.key), "+")
+}
+
+// spell returns the modifiers of the hotkey by the given names, followed by
+// the key as X11 keysyms name it: a, 1, space or F1.
+func (k hotkey) spell(names map[string]string) []string {
+	var parts []string
+	for _, m := range k.mods {
+		parts = append(parts, names[m])
+	}
+	key := k.key
+	if key[0] == 'f' && len(key) > 1 {
+		key = strings.ToUpper(key)
+	}
+	return append(parts, key)
+}
+
+// bindHotkey asks the desktop to run command when k is pressed, through the
+// compositor on sway and Hyprland, xbindkeys on X11 and skhd on macOS. It
+// returns a function that removes the binding again, and what made it.
+func bindHotkey(k hotkey, command string) (unbind func(), via string, err error) {
+	lookup := func(program string) (string, error) {
+		path, err := exec.LookPath(program)
+		if err != nil {
+			return "", &capability.MissingError{Capability: capability.Lookup("hotkey")}
+		}
+		return path, nil
+	}
+	switch {
+	case runtime.GOOS == "darwin":
+		path, err := lookup("skhd")
+		if err != nil {
+			return nil, "", err
+		}
+		keys := k.spell(map[string]string{"ctrl": "ctrl", "shift": "shift", "alt": "alt", "super": "cmd"})
+		mods, key := keys[:len(keys)-1], strings.ToLower(keys[len(keys)-1])
+		config := strings.Join(mods, " + ") + " - " + key + " : " + command + "\n"
+		return runHotkeyDaemon(path, "skhd", config, "-c")
+	case os.Getenv("SWAYSOCK") != "":
+		path, err := lookup("swaymsg")
+		if err != nil {
+			return nil, "", err
+		}
+		combo := strings.Join(k.spell(map[string]string{"ctrl": "Ctrl", "shift": "Shift", "alt": "Mod1", "super": "Mod4"}), "+")
+		if out, err := exec.Command(path, "bindsym", combo, "exec", command).CombinedOutput(); err != nil {
+			return nil, "", fmt.Errorf("swaymsg bindsym failed: %s", strings.TrimSpace(string(out)))
+		}
+		return func() { exec.Command(path, "unbindsym", combo).Run() }, "sway", nil
+	case os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "":
+		path, err := lookup("hyprctl")
+		if err != nil {
+			return nil, "", err
+		}
+		keys := k.spell(map[string]string{"ctrl": "CTRL", "shift": "SHIFT", "alt": "ALT", "super": "SUPER"})
+		mods, key := strings.Join(keys[:len(keys)-1], " "), keys[len(keys)-1]
+		// hyprctl reports failures on stdout, with a zero exit status.
+		if out, err := exec.Command(path, "keyword", "bind", mods+","+key+",exec,"+command).CombinedOutput(); err != nil || strings.TrimSpace(string(out)) != "ok" {
+			return nil, "", fmt.Errorf("hyprctl keyword bind failed: %s", strings.TrimSpace(string(out)))
+		}
+		return func() { exec.Command(path, "keyword", "unbind", mods+","+key).Run() }, "Hyprland", nil
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		return nil, "", fmt.Errorf("this Wayland compositor doesn't let programs register hotkeys; bind %s to %s in its keyboard settings instead", command, k)
+	case os.Getenv("DISPLAY") != "":
+		path, err := lookup("xbindkeys")
+		if err != nil {
+			return nil, "", err
+		}
+		keys := k.spell(map[string]string{"ctrl": "Control", "shift": "Shift", "alt": "Mod1", "super": "Mod4"})
+		config := fmt.Sprintf("%q\n    %s\n", command, strings.Join(keys, "+"))
+		return runHotkeyDaemon(path, "xbindkeys", config, "-n", "-f")
+	default:
+		return nil, "", errors.New("there is no graphical session (neither DISPLAY nor WAYLAND_DISPLAY is set) to register the hotkey with")
+	}
+}
+
+// runHotkeyDaemon starts a hotkey daemon that runs in the foreground, with
+// config in a file passed after args. Stopping it unbinds the hotkey.
+func runHotkeyDaemon(path, name, config string, args ...string) (func(), string, error) {
+	base, err := tempDir()
+	if err != nil {
+		return nil, "", err
+	}
+	dir, err := os.MkdirTemp(base, "hotkey-")
+	if err != nil {
+		return nil, "", err
+	}
+	file := filepath.Join(dir, name+"rc")
+	if err := os.WriteFile(file, []byte(config), 0o600); err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+	cmd := exec.Command(path, append(args, file)...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, "", fmt.Errorf("failed to start %s: %w", name, err)
+	}
+	return func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(dir)
+	}, name, nil
+}
+
+// typingPrograms maps the programs of the typing capability to the arguments
+// that make them type the text that follows into the focused window, and to
+// the environment variable that tells whether their display server is in use.
+var typingPrograms = map[string]struct {
+	args    []string
+	display string
+}{
+	"osascript": {args: []string{"-e", "on run argv", "-e", `tell application "System Events" to keystroke (item 1 of argv)`, "-e", "end run"}},
+	"wtype":     {args: []string{"--"}, display: "WAYLAND_DISPLAY"},
+	"xdotool":   {args: []string{"type", "--clearmodifiers", "--"}, display: "DISPLAY"},
+	"ydotool":   {args: []string{"type", "--"}},
+}
+
+// typeText types text into the focused window, without pressing Enter, and
+// returns the program that did. Programs that fail, such as wtype on
+// compositors without a virtual keyboard, make way for the next one.
+func typeText(text string) (string, error) {
+	var lastErr error = &capability.MissingError{Capability: capability.Lookup("typing")}
+	for _, program := range capability.Lookup("typing").Programs {
+		p := typingPrograms[program]
+		if p.display != "" && os.Getenv(p.display) == "" {
+			continue
+		}
+		path, err := exec.LookPath(program)
+		if err != nil {
+			continue
+		}
+		if out, err := exec.Command(path, append(p.args, text)...).CombinedOutput(); err != nil {
+			lastErr = fmt.Errorf("%s failed: %s", program, strings.TrimSpace(string(out)))
+			continue
+		}
+		return program, nil
+	}
+	return "", lastErr
+}
+
+// notify shows a desktop notification. It fails silently, as there is
+// nowhere else to report to.
+func notify(title, body string) {
+	path, err := capability.Require("notify")
+	if err != nil {
+		return
+	}
+	if filepath.Base(path) == "osascript" {
+		exec.Command(path, "-e", "on run argv", "-e", "display notification (item 2 of argv) with title (item 1 of argv)", "-e", "end run", title, body).Run()
+		return
+	}
+	exec.Command(path, "--app-name="+appName, "--", title, body).Run()
+}
+
+// deliver shows the outcome of a request made with the hotkey, and types the
+// command into the focused window, which is usually the terminal it is meant
+// for. Commands of several lines are put on the clipboard instead, as typing
+// the line breaks would run them, and so are risky ones, so that it takes
+// pasting them to go ahead. Dangerous commands are only shown.
+func deliver(resp daemonResponse) {
+	if resp.Error != "" {
+		body := resp.Error
+		if resp.Transcript != "" {
+			body = fmt.Sprintf("%q: %s", resp.Transcript, resp.Error)
+		}
+		notify("No command", body)
+		return
+	}
+	// A command the daemon didn't check isn't trusted.
+	verdict := safety.Verdict{Level: safety.Dangerous, Reasons: []string{"wasn't checked"}}
+	if resp.Safety != nil {
+		if level, ok := safety.ParseLevel(resp.Safety.Level); ok {
+			verdict = safety.Verdict{Level: level, Reasons: resp.Safety.Reasons}
+		}
+	}
+	body := resp.Command
+	if verdict.Level > safety.Safe {
+		body += fmt.Sprintf("\nWarning (%s): this command %s.", verdict.Level, strings.Join(verdict.Reasons, ", "))
+	}
+	if verdict.Level == safety.Dangerous {
+		notify("Not typed: dangerous command", body)
+		return
+	}
+	if verdict.Level > safety.Safe || strings.Contains(resp.Command, "\n") {
+		if _, err := copyToClipboard(resp.Command); err != nil {
+			notify("Failed to copy the command", err.Error())
+			return
+		}
+		notify("Copied to the clipboard", body)
+		return
+	}
+	if _, err := typeText(resp.Command); err != nil {
+		if _, copyErr := copyToClipboard(resp.Command); copyErr == nil {
+			notify("Copied to the clipboard", fmt.Sprintf("%s\n(typing failed: %v)", body, err))
+			return
+		}
+		notify("Failed to type the command", fmt.Sprintf("%s\n%v", body, err))
+		return
+	}
+	notify(resp.Transcript, body)
+}
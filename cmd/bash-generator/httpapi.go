@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/cost"
+	"github.com/jerilseb/bash-generator/internal/metrics"
+)
+
+// maxTextBody bounds the JSON body of a text request; a spoken or typed
+// request is a sentence or two.
+const maxTextBody = 64 << 10
+
+// multipartOverhead is what the multipart framing of an upload may add to
+// the audio itself.
+const multipartOverhead = 64 << 10
+
+// httpTokenEnv holds the token HTTP API clients must send.
+const httpTokenEnv = "BASH_GENERATOR_HTTP_TOKEN"
+
+// apiResponse is the JSON body of every HTTP API response.
+type apiResponse struct {
+	Transcript  string       `json:"transcript,omitempty"`
+	Command     string       `json:"command,omitempty"`
+	Explanation string       `json:"explanation,omitempty"`
+	Safety      *apiSafety   `json:"safety,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	Usage       *apiUsage    `json:"usage,omitempty"`
+	Stats       *daemonStats `json:"stats,omitempty"`
+}
+
+// apiSafety is the safety verdict on a generated command, for clients to warn
+// about risky commands the way the CLI does.
+type apiSafety struct {
+	Level   string   `json:"level"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+type apiUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// httpAPI serves the pipeline over HTTP, for clients that can't reach the Unix
+// socket: editors, chat bots or a phone on the same network.
+type httpAPI struct {
+	p       *pipeline
+	token   string
+	maxBody int64
+	metrics *metrics.Registry
+	started time.Time
+}
+
+func (a *httpAPI) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/generate", a.authorized(a.handleGenerate))
+	mux.HandleFunc("POST /v1/transcribe-generate", a.authorized(a.handleTranscribeGenerate))
+	mux.HandleFunc("GET /v1/stats", a.authorized(a.handleStats))
+	return mux
+}
+
+// authorized requires the bearer token, if one is configured, before calling h.
+// Requests are told apart by the host they come from, which the queue of API
+// calls takes turns between.
+func (a *httpAPI) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+appName+`"`)
+				writeAPIResponse(w, http.StatusUnauthorized, apiResponse{Error: "missing or wrong token"})
+				return
+			}
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		h(w, r.WithContext(withClient(r.Context(), host)))
+	}
+}
+
+func (a *httpAPI) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTextBody))
+	if err := dec.Decode(&req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		writeAPIResponse(w, http.StatusBadRequest, apiResponse{Error: "text is empty"})
+		return
+	}
+
+	a.metrics.Add("requests", 1)
+	a.respond(w, r.Context(), text, typedRequest)
+}
+
+func (a *httpAPI) handleTranscribeGenerate(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, a.maxBody+multipartOverhead)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	defer file.Close()
+	// Only the audio counts towards the limit, however it was framed.
+	if header.Size > a.maxBody {
+		writeAPIResponse(w, http.StatusRequestEntityTooLarge, apiResponse{Error: fmt.Sprintf("the audio is larger than %d bytes", a.maxBody)})
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	a.metrics.Add("requests", 1)
+	audio, filename, length, err := a.p.prepareAudio(data, header.Filename)
+	if err != nil {
+		writeAPIResponse(w, http.StatusUnprocessableEntity, apiResponse{Error: err.Error()})
+		return
+	}
+	a.metrics.Add("audio.seconds", length.Seconds())
+
+	start := time.Now()
+	transcript, err := a.p.upload(r.Context(), audio, filename, length)
+	a.metrics.Observe("transcribe.latency", time.Since(start))
+	if err != nil {
+		a.metrics.Add("errors", 1)
+		writeAPIResponse(w, http.StatusBadGateway, apiResponse{Error: err.Error()})
+		return
+	}
+	a.metrics.Add("cost.usd", cost.Transcription(a.p.transcriber.Model, length))
+	transcript = strings.TrimSpace(transcript)
+	a.respond(w, r.Context(), transcript, spokenRequest)
+}
+
+// respond generates a command for text, made as from says, and writes it out.
+func (a *httpAPI) respond(w http.ResponseWriter, ctx context.Context, text string, from origin) {
+	start := time.Now()
+	generated, err := a.p.generate(ctx, text, from, nil)
+	if errors.Is(err, errChatter) {
+		a.metrics.Add("discarded", 1)
+		writeAPIResponse(w, http.StatusUnprocessableEntity, apiResponse{Transcript: text, Error: err.Error()})
+		return
+	}
+	a.metrics.Observe("generate.latency", time.Since(start))
+	if err != nil {
+		a.metrics.Add("errors", 1)
+		writeAPIResponse(w, http.StatusBadGateway, apiResponse{Transcript: text, Error: err.Error()})
+		return
+	}
+	a.metrics.Add("tokens.prompt", float64(generated.Usage.PromptTokens))
+	a.metrics.Add("tokens.completion", float64(generated.Usage.CompletionTokens))
+	a.metrics.Add("cost.usd", cost.Chat(generated.Model, generated.Usage.PromptTokens, generated.Usage.CompletionTokens))
+
+	verdict := checkCommand(generated)
+	writeAPIResponse(w, http.StatusOK, apiResponse{
+		Transcript:  text,
+		Command:     generated.Command,
+		Explanation: generated.Explanation,
+		Safety:      &apiSafety{Level: verdict.Level.String(), Reasons: verdict.Reasons},
+		Usage:       &apiUsage{PromptTokens: generated.Usage.PromptTokens, CompletionTokens: generated.Usage.CompletionTokens},
+	})
+}
+
+func (a *httpAPI) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeAPIResponse(w, http.StatusOK, apiResponse{Stats: &daemonStats{
+		Uptime:   time.Since(a.started),
+		CPU:      cpuTime(),
+		Counters: a.metrics.Snapshot().Counters,
+	}})
+}
+
+// writeBodyError reports a request body that couldn't be read.
+func writeBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeAPIResponse(w, http.StatusRequestEntityTooLarge, apiResponse{Error: fmt.Sprintf("the request is larger than %d bytes", tooLarge.Limit)})
+		return
+	}
+	writeAPIResponse(w, http.StatusBadRequest, apiResponse{Error: "invalid request: " + err.Error()})
+}
+
+func writeAPIResponse(w http.ResponseWriter, status int, resp apiResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// isLoopbackAddr reports whether the listen address addr only accepts
+// connections from this machine.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// serveHTTP serves the HTTP API on addr until the process is told to stop.
+func serveHTTP(addr string, api *httpAPI) error {
+	if api.token == "" && !isLoopbackAddr(addr) {
+		return fmt.Errorf("refusing to serve on %s without a token; set -http-token or %s, or listen on localhost", addr, httpTokenEnv)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	srv := &http.Server{
+		Handler:           api.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		// Generous enough for an upload and both API calls.
+		WriteTimeout: 2*api.p.timeout + time.Minute,
+		IdleTimeout:  2 * time.Minute,
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, shutdownSignals...)
+	drained := make(chan struct{})
+	go func() {
+		<-c
+		// Let requests in flight finish, within reason.
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+		close(drained)
+	}()
+
+	fmt.Printf("Listening on http://%s\n", ln.Addr())
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-drained
+	return nil
+}
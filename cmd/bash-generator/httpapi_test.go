@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jerilseb/bash-generator/internal/metrics"
+	"github.com/jerilseb/bash-generator/internal/snippets"
+)
+
+func TestHTTPGenerate(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// command is what the model answers with.
+		command    string
+		wantStatus int
+		want       string
+		// asked is set if the model must have been asked.
+		asked bool
+	}{
+		{"request", "list the files", "ls -la", http.StatusOK, "ls -la", true},
+		{"typed chatter", "yeah", "ls -la", http.StatusOK, "ls -la", true},
+		{"alias", "deploy the site", "ls -la", http.StatusOK, "make deploy", false},
+		{"invalid syntax", "say hi", "echo 'hi", http.StatusBadGateway, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI(t, tt.command)
+			p := testPipeline(t, api)
+			p.discardChatter = true
+			if err := snippetStore().Add(snippets.Snippet{Phrase: "deploy the site", Command: "make deploy"}); err != nil {
+				t.Fatal(err)
+			}
+			a := &httpAPI{p: p, maxBody: 1 << 20, metrics: metrics.New()}
+
+			req := httptest.NewRequest("POST", "/v1/generate", strings.NewReader(`{"text": "`+tt.text+`"}`))
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+			var resp apiResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.wantStatus || resp.Command != tt.want {
+				t.Errorf("status %d, command %q (error %q); want %d, %q", w.Code, resp.Command, resp.Error, tt.wantStatus, tt.want)
+			}
+			if asked := api.sent() != ""; asked != tt.asked {
+				t.Errorf("model asked = %v, want %v", asked, tt.asked)
+			}
+		})
+	}
+}
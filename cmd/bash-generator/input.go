@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// lineReader reads lines from the terminal on demand. A read is only started
+// when someone asks for a line, so nothing is taken from stdin while a command
+// we run owns it; a read that was started but not consumed (Enter to stop a
+// recording that Ctrl+C stopped first) is handed to the next caller.
+type lineReader struct {
+	r *bufio.Reader
+
+	mu      sync.Mutex
+	pending chan lineResult
+}
+
+type lineResult struct {
+	line string
+	err  error
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{r: bufio.NewReader(r)}
+}
+
+// next returns a channel delivering the next line, starting a read unless one
+// is already in progress. The receiver must call consumed afterwards.
+func (l *lineReader) next() <-chan lineResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending == nil {
+		ch := make(chan lineResult, 1)
+		l.pending = ch
+		go func() {
+			line, err := l.r.ReadString('\n')
+			ch <- lineResult{line, err}
+		}()
+	}
+	return l.pending
+}
+
+func (l *lineReader) consumed() {
+	l.mu.Lock()
+	l.pending = nil
+	l.mu.Unlock()
+}
+
+// ReadLine blocks until the next line has been entered.
+func (l *lineReader) ReadLine() (string, error) {
+	res := <-l.next()
+	l.consumed()
+	return res.line, res.err
+}
+
+// idle reports whether no read is in progress and nothing typed is waiting,
+// so the terminal can be read from directly for a while.
+func (l *lineReader) idle() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pending == nil && l.r.Buffered() == 0
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// intentVerdict is the result of classifying a transcript before generation.
+type intentVerdict struct {
+	Command bool
+	Score   int
+	Reasons []string
+	// ChatterReasons are those of Reasons that point to chatter rather than
+	// to a request.
+	ChatterReasons []string
+}
+
+// addChatter adds a reason that points to chatter.
+func (v *intentVerdict) addChatter(reason string) {
+	v.Reasons = append(v.Reasons, reason)
+	v.ChatterReasons = append(v.ChatterReasons, reason)
+}
+
+// Whisper tends to produce these for silence or background noise.
+var whisperHallucinations = []string{
+	"thank you for watching", "thanks for watching", "subtitles by", "please subscribe",
+	"like and subscribe", "see you next time", "thank you.", "you",
+}
+
+var requestVerbs = map[string]bool{
+	"list": true, "show": true, "find": true, "search": true, "grep": true, "display": true, "print": true,
+	"count": true, "delete": true, "remove": true, "create": true, "make": true, "copy": true, "move": true,
+	"rename": true, "compress": true, "extract": true, "unzip": true, "zip": true, "archive": true, "kill": true,
+	"stop": true, "start": true, "restart": true, "install": true, "uninstall": true, "update": true,
+	"upgrade": true, "download": true, "upload": true, "run": true, "check": true, "open": true, "change": true,
+	"set": true, "convert": true, "sort": true, "get": true, "replace": true, "monitor": true, "watch": true,
+	"mount": true, "unmount": true, "push": true, "pull": true, "commit": true, "clone": true, "build": true,
+	"deploy": true, "scale": true, "backup": true, "sync": true, "ping": true, "connect": true, "add": true,
+	"clean": true, "clear": true, "resize": true, "split": true, "merge": true, "tail": true, "append": true,
+}
+
+var technicalWords = map[string]bool{
+	"file": true, "files": true, "folder": true, "folders": true, "directory": true, "directories": true,
+	"process": true, "processes": true, "port": true, "ports": true, "disk": true, "memory": true, "cpu": true,
+	"log": true, "logs": true, "branch": true, "container": true, "containers": true, "image": true,
+	"images": true, "package": true, "packages": true, "service": true, "services": true, "user": true,
+	"permissions": true, "size": true, "network": true, "server": true, "repo": true, "repository": true,
+	"extension": true, "line": true, "lines": true, "pod": true, "pods": true, "deployment": true,
+	"kilobytes": true, "megabytes": true, "gigabytes": true, "mb": true, "gb": true, "kb": true,
+	"recursively": true, "hidden": true, "symlink": true, "environment": true, "variable": true,
+}
+
+var chatterMarkers = []string{
+	"i think", "you know", "i mean", "yeah", "lol", "oh my god", "did you", "are you", "i was", "we were",
+	"he said", "she said", "they said", "thank you", "thanks", "hello", "bye", "good morning", "how are you",
+	"what time", "dinner", "lunch", "anyway", "honestly", "kind of like",
+}
+
+var (
+	pathLike    = regexp.MustCompile(`(^|\s)(~|\.{1,2})?/\S*|\.\w{1,5}\b`)
+	questionAsk = regexp.MustCompile(`^(how (do|can) i|how to|what is the command|what's the command|is there a way to|can you|could you|please|i want to|i need to|i'd like to)\b`)
+)
+
+// classifyIntent decides, with cheap local heuristics only, whether text looks
+// like a request for a shell command or like chatter picked up by the microphone.
+// Only text with conversational phrases in it that nothing else makes up for
+// is taken for chatter: a missed piece of chatter costs one API call, while a
+// wrongly discarded request, like "who is logged in", annoys the user.
+func classifyIntent(text string) intentVerdict {
+	normalized := strings.ToLower(strings.TrimSpace(text))
+	normalized = strings.Trim(normalized, " .!?,")
+	var v intentVerdict
+
+	if normalized == "" {
+		v.addChatter("empty transcript")
+		return v
+	}
+	for _, h := range whisperHallucinations {
+		if normalized == strings.Trim(h, ".") {
+			v.addChatter("looks like a transcription of silence")
+			return v
+		}
+	}
+
+	words := strings.FieldsFunc(normalized, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '.' || r == '!' || r == '?'
+	})
+
+	if questionAsk.MatchString(normalized) {
+		v.Score += 2
+		v.Reasons = append(v.Reasons, "phrased as a request")
+	}
+	if len(words) > 0 && requestVerbs[words[0]] {
+		v.Score += 2
+		v.Reasons = append(v.Reasons, "starts with an imperative verb")
+	}
+
+	var verbs, technical, tools int
+	for _, w := range words {
+		if requestVerbs[w] {
+			verbs++
+		}
+		if technicalWords[w] {
+			technical++
+		}
+		for _, tool := range commonTools {
+			if w == tool {
+				tools++
+				break
+			}
+		}
+	}
+	if verbs > 0 {
+		v.Score++
+	}
+	if technical > 0 {
+		v.Score += min(technical, 2)
+		v.Reasons = append(v.Reasons, "mentions technical terms")
+	}
+	if tools > 0 {
+		v.Score += 2
+		v.Reasons = append(v.Reasons, "mentions a command line tool")
+	}
+	if pathLike.MatchString(normalized) {
+		v.Score++
+		v.Reasons = append(v.Reasons, "contains a path or file extension")
+	}
+
+	chatter := 0
+	for _, marker := range chatterMarkers {
+		if strings.Contains(" "+normalized+" ", " "+marker+" ") {
+			chatter++
+			v.Score -= 2
+			v.addChatter("contains conversational phrase \"" + marker + "\"")
+		}
+	}
+	if len(words) < 2 {
+		v.Score--
+		v.addChatter("too short")
+	}
+	if len(words) > 60 {
+		v.Score -= 2
+		v.addChatter("too long for a single request")
+	}
+
+	v.Command = chatter == 0 || v.Score >= 0
+	return v
+}
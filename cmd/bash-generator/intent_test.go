@@ -0,0 +1,50 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestClassifyIntent(t *testing.T) {
+	tests := []struct {
+		text    string
+		command bool
+	}{
+		{"what's using port 8080", true},
+		{"how much disk space is left", true},
+		{"who is logged in", true},
+		{"undo the last commit", true},
+		{"which version of python do I have", true},
+		{"list all files larger than 100 megabytes", true},
+		{"find the .go files in ~/src", true},
+		{"I think I need to restart the docker service", true},
+		{"", false},
+		{"Thank you for watching.", false},
+		{"yeah", false},
+		{"I mean, honestly, we were just talking about dinner", false},
+		{"did you see what she said at lunch, lol", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if v := classifyIntent(tt.text); v.Command != tt.command {
+				t.Errorf("classifyIntent(%q).Command = %v, want %v (score %d: %v)", tt.text, v.Command, tt.command, v.Score, v.Reasons)
+			}
+		})
+	}
+}
+
+func TestClassifyIntentChatterReasons(t *testing.T) {
+	text := "honestly you know the log was at lunch"
+	v := classifyIntent(text)
+	if v.Command {
+		t.Fatalf("classifyIntent(%q).Command = true, want chatter (score %d: %v)", text, v.Score, v.Reasons)
+	}
+	want := `contains conversational phrase "you know", contains conversational phrase "lunch", contains conversational phrase "honestly"`
+	if got := strings.Join(v.ChatterReasons, ", "); got != want {
+		t.Errorf("ChatterReasons = %q, want %q", got, want)
+	}
+	if !slices.Contains(v.Reasons, "mentions technical terms") {
+		t.Errorf("Reasons = %q, want the technical terms among them", v.Reasons)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/internal/capability"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// Lint modes.
+const (
+	lintOff  = "off"
+	lintWarn = "warn"
+	lintFix  = "fix"
+)
+
+// lintIssue is one ShellCheck comment, as reported by its json1 format.
+type lintIssue struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Level   string `json:"level"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (i lintIssue) String() string {
+	return fmt.Sprintf("SC%d (%s, line %d column %d): %s", i.Code, i.Level, i.Line, i.Column, i.Message)
+}
+
+// shellcheck lints command as a Bash script. Style suggestions are left out.
+func shellcheck(ctx context.Context, command string) ([]lintIssue, error) {
+	path, err := capability.Require("shellcheck")
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, path, "--shell=bash", "--severity=info", "--format=json1", "-")
+	cmd.Stdin = strings.NewReader(command)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// ShellCheck exits with 1 when it found something, which is not a failure here.
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return nil, fmt.Errorf("shellcheck failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var out struct {
+		Comments []lintIssue `json:"comments"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("unexpected output from shellcheck: %w", err)
+	}
+	return out.Comments, nil
+}
+
+// lint checks a generated command according to the lint mode and returns the
+// issues left. In fix mode the model gets one chance to correct what
+// ShellCheck found, and resp is replaced by its answer. Failing to lint is
+// reported but never fatal.
+func (p *pipeline) lint(ctx context.Context, text string, history []generate.Turn, resp *generate.Response) []lintIssue {
+	if p.lintMode == lintOff {
+		return nil
+	}
+	issues, err := shellcheck(ctx, resp.Command)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to lint the command: %v\n", err)
+		return nil
+	}
+	if len(issues) == 0 || p.lintMode != lintFix {
+		return issues
+	}
+
+	var report strings.Builder
+	report.WriteString("ShellCheck reports these problems with that command:\n")
+	for _, issue := range issues {
+		report.WriteString(issue.String() + "\n")
+	}
+	report.WriteString("Fix them without changing what the command does.")
+	turns := append(history[:len(history):len(history)], generate.Turn{Request: text, Command: resp.Command})
+	fixed, err := p.complete(ctx, report.String(), turns)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to fix the command: %v\n", err)
+		return issues
+	}
+	remaining, err := shellcheck(ctx, fixed.Command)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to lint the command: %v\n", err)
+		return issues
+	}
+	// Keep the original if the fix made things worse.
+	if len(remaining) > len(issues) {
+		return issues
+	}
+	*resp = *fixed
+	return remaining
+}
+
+// lintNotes formats issues for display under the command.
+func lintNotes(issues []lintIssue) []string {
+	notes := make([]string, len(issues))
+	for i, issue := range issues {
+		notes[i] = "ShellCheck " + issue.String()
+	}
+	return notes
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jerilseb/bash-generator/internal/capability"
+	"github.com/jerilseb/bash-generator/internal/wakeword"
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+const (
+	// defaultWakePhrase is what the bundled openWakeWord detector listens for
+	// with its default model.
+	defaultWakePhrase = "hey jarvis"
+	// speechLevel is how loud audio must be, in dBFS, to count as speech when
+	// telling where a request ends.
+	speechLevel = -40
+	// noRequestTimeout gives up on a request that never starts.
+	noRequestTimeout = 5 * time.Second
+	// wakePreRoll is how much audio from before the detection is kept with the
+	// request, in case it follows the wake word without a pause.
+	wakePreRoll = 500 * time.Millisecond
+)
+
+// wakeListener segments requests out of a continuous recording: after the
+// detector hears the wake word, everything up to the first pause is the
+// request.
+type wakeListener struct {
+	detector  *wakeword.Detector
+	resampler *record.Resampler
+	opts      record.Options
+	// endSilence is how long a pause ends a request; maxDuration caps it.
+	endSilence  time.Duration
+	maxDuration time.Duration
+	// stop ends the recording once a request is complete.
+	stop func()
+
+	mu sync.Mutex
+	// recent is the latest audio while waiting for the wake word.
+	recent []int16
+	// awake is set from the wake word until the end of the request.
+	awake   bool
+	request []int16
+	heard   bool
+	silent  time.Duration
+}
+
+// onChunk is passed to RecordFunc.
+func (l *wakeListener) onChunk(chunk []int16) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.awake {
+		l.detector.Write(l.resampler.Resample(chunk))
+		keep := int(wakePreRoll.Seconds()*float64(l.opts.SampleRate)) * l.opts.Channels
+		l.recent = append(l.recent, chunk...)
+		if len(l.recent) > keep {
+			l.recent = append(l.recent[:0], l.recent[len(l.recent)-keep:]...)
+		}
+		return
+	}
+	l.request = append(l.request, chunk...)
+	frames := len(chunk) / l.opts.Channels
+	length := time.Duration(frames) * time.Second / time.Duration(l.opts.SampleRate)
+	if record.Level(chunk) > speechLevel {
+		l.heard, l.silent = true, 0
+	} else {
+		l.silent += length
+	}
+	total := time.Duration(len(l.request)/l.opts.Channels) * time.Second / time.Duration(l.opts.SampleRate)
+	if (l.heard && l.silent >= l.endSilence) || (!l.heard && total >= noRequestTimeout) || total >= l.maxDuration {
+		l.stop()
+	}
+}
+
+// wake starts a request, unless one is already being recorded.
+func (l *wakeListener) wake() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.awake {
+		return false
+	}
+	l.awake, l.heard, l.silent = true, false, 0
+	l.request = append([]int16(nil), l.recent...)
+	l.recent = l.recent[:0]
+	return true
+}
+
+// take returns the request recorded since the wake word, if any was spoken,
+// and goes back to waiting for the wake word.
+func (l *wakeListener) take() *record.Recording {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	awake, heard := l.awake, l.heard
+	l.awake = false
+	if !awake || !heard {
+		return nil
+	}
+	return &record.Recording{Samples: l.request, Channels: l.opts.Channels, SampleRate: l.opts.SampleRate}
+}
+
+// listenFlags are the flags of listen.
+type listenFlags struct {
+	opts       *options
+	detector   string
+	wakePhrase string
+	endSilence time.Duration
+	confirm    bool
+}
+
+func (f *listenFlags) define(fs *flag.FlagSet, cfg *config) error {
+	var err error
+	if f.opts, err = addPipelineFlags(fs, cfg); err != nil {
+		return err
+	}
+	fs.BoolVar(&f.opts.DiscardChatter, "discard-chatter", true, "skip generation when the transcript looks like background conversation rather than a request")
+	fs.StringVar(&f.detector, "detector", strings.Join(cfg.WakeWordDetector, " "), "wake-word detector command; by default bash-generator-wakeword from PATH")
+	fs.StringVar(&f.wakePhrase, "wake-phrase", cfg.WakePhrase, "the wake word, removed from the start of transcripts (default \""+defaultWakePhrase+"\")")
+	fs.DurationVar(&f.endSilence, "end-silence", 1200*time.Millisecond, "how long a pause ends a request")
+	fs.BoolVar(&f.confirm, "confirm", cfg.VoiceConfirm, "after each command, listen for \"run it\", \"cancel\" or \"explain\" and run the command when told to, except dangerous ones; best with -speak")
+	return nil
+}
+
+// runListen waits for the wake word and turns what is said after it into a
+// command, hands-free, until interrupted. Commands go to stdout, one per line,
+// and everything else to stderr.
+func runListen(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("listen", flag.ExitOnError)
+	var flags listenFlags
+	if err := flags.define(fs, cfg); err != nil {
+		return err
+	}
+	opts := flags.opts
+	fs.Parse(args)
+	if flags.wakePhrase == "" {
+		flags.wakePhrase = defaultWakePhrase
+	}
+	if flags.endSilence <= 0 {
+		return fmt.Errorf("invalid -end-silence %s: must be positive", flags.endSilence)
+	}
+	if opts.MaxDuration == 0 || opts.MaxDuration > recordingLimit {
+		opts.MaxDuration = recordingLimit
+	}
+
+	command := strings.Fields(flags.detector)
+	if len(command) == 0 {
+		path, err := capability.Require("wakeword")
+		if err != nil {
+			return err
+		}
+		command = []string{path}
+	}
+
+	p, err := newPipeline(opts)
+	if err != nil {
+		return err
+	}
+
+	// Listening runs for hours, so capture the way the low-power daemon does.
+	// Each round of listening is one recording, ended by a request or the limit.
+	capture, err := captureOptions(record.LowPowerOptions, 0, opts.Channel)
+	if err != nil {
+		return err
+	}
+	recorder, closeMicrophone, err := openMicrophone(capture)
+	if err != nil {
+		return err
+	}
+	defer closeMicrophone()
+
+	detector, err := wakeword.Start(command)
+	if err != nil {
+		return err
+	}
+	defer detector.Close()
+
+	got := recorder.Options()
+	l := &wakeListener{
+		detector:    detector,
+		resampler:   record.NewResampler(got.Channels, got.SampleRate, wakeword.SampleRate),
+		opts:        got,
+		endSilence:  flags.endSilence,
+		maxDuration: opts.MaxDuration,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), shutdownSignals...)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "Listening for %q (Ctrl+C to quit)\n", flags.wakePhrase)
+	for ctx.Err() == nil {
+		roundDone := make(chan struct{})
+		var once sync.Once
+		l.stop = func() { once.Do(func() { close(roundDone) }) }
+
+		// The round ends when a request is complete, on Ctrl+C, or when the
+		// detector goes away.
+		var detectorErr error
+		watched := make(chan struct{})
+		go func() {
+			defer close(watched)
+			for {
+				select {
+				case _, ok := <-detector.Detections():
+					if !ok {
+						detectorErr = detector.Err()
+						l.stop()
+						return
+					}
+					if l.wake() {
+						fmt.Fprintln(os.Stderr, "Heard the wake word, listening...")
+					}
+				case <-ctx.Done():
+					l.stop()
+					return
+				case <-roundDone:
+					return
+				}
+			}
+		}()
+
+		_, err := recorder.RecordFunc(roundDone, l.onChunk)
+		l.stop()
+		<-watched
+		if err != nil {
+			return err
+		}
+		if detectorErr != nil {
+			return detectorErr
+		}
+		rec := l.take()
+		if rec == nil || ctx.Err() != nil {
+			continue
+		}
+		var listen func() (*record.Recording, error)
+		if flags.confirm {
+			listen = func() (*record.Recording, error) { return l.listenForAnswer(ctx, recorder) }
+		}
+		handleWakeRequest(ctx, p, rec, flags.wakePhrase, listen)
+	}
+	return nil
+}
+
+// handleWakeRequest transcribes a request and prints its command. With
+// listen, which records an answer, it then asks whether to run it. Failures
+// are reported and listening goes on.
+func handleWakeRequest(ctx context.Context, p *pipeline, rec *record.Recording, wakePhrase string, listen func() (*record.Recording, error)) {
+	if err := p.checkSpeech(rec); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		p.say(ctx, "Didn't catch that, say "+wakePhrase+" to try again.")
+		return
+	}
+	text, err := p.transcribe(ctx, rec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to transcribe the request: %v\n", err)
+		return
+	}
+	text = stripWakePhrase(strings.TrimSpace(text), wakePhrase)
+	if err := checkTranscript(text); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		p.say(ctx, "Didn't catch that, say "+wakePhrase+" to try again.")
+		return
+	}
+	fmt.Fprintln(os.Stderr, text)
+	generated, err := p.generate(ctx, text, spokenRequest, nil)
+	if errors.Is(err, errChatter) {
+		fmt.Fprintf(os.Stderr, "Ignoring %q: %v\n", text, err)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to generate a command: %v\n", err)
+		return
+	}
+	fmt.Println(generated.Command)
+	p.speak(ctx, generated)
+	p.speaker.wait()
+	if listen != nil {
+		confirmByVoice(ctx, p, text, generated, listen)
+	}
+}
+
+// stripWakePhrase removes the wake phrase from the start of a transcript, in
+// case the request was caught with the end of it, whatever the punctuation
+// and case.
+func stripWakePhrase(text, phrase string) string {
+	normalize := func(w string) string {
+		return strings.ToLower(strings.TrimFunc(w, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }))
+	}
+	words, want := strings.Fields(text), strings.Fields(phrase)
+	if len(want) == 0 || len(words) < len(want) {
+		return text
+	}
+	for i, w := range want {
+		if normalize(words[i]) != normalize(w) {
+			return text
+		}
+	}
+	return strings.Join(words[len(want):], " ")
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+// errDiscarded is returned when the user throws a recording away.
+var errDiscarded = errors.New("recording discarded")
+
+const (
+	// livePartialInterval is how often the audio recorded so far is transcribed.
+	livePartialInterval = 2 * time.Second
+	// livePartialWindow caps how much of the end of the recording is sent for a
+	// partial transcript, so the cost of -live grows linearly with the recording.
+	livePartialWindow = 12 * time.Second
+	// livePartialLines is how many lines of partial transcript are shown.
+	livePartialLines = 3
+	// meterWidth is the width of the level meter in characters.
+	meterWidth = 30
+)
+
+// liveRecording shows a level meter and a running transcript while recording.
+// The transcript comes from the Realtime session with -stream, and otherwise
+// from sending the end of the recording so far to the transcription endpoint
+// every few seconds.
+type liveRecording struct {
+	p    *pipeline
+	view *termView
+	opts record.Options
+	// hint tells how to stop the recording.
+	hint   string
+	stream *streamingTranscript
+
+	mu      sync.Mutex
+	samples []int16
+	level   float64
+	partial string
+	// cut is set when partial only covers the end of the recording.
+	cut bool
+}
+
+func newLiveRecording(p *pipeline, view *termView, opts record.Options, hint string, stream *streamingTranscript) *liveRecording {
+	return &liveRecording{p: p, view: view, opts: opts, hint: hint, stream: stream, level: -96}
+}
+
+// onChunk is passed to Recorder.RecordFunc.
+func (l *liveRecording) onChunk(chunk []int16) {
+	l.mu.Lock()
+	l.samples = append(l.samples, chunk...)
+	l.level = record.Level(chunk)
+	l.mu.Unlock()
+	if l.stream != nil {
+		l.stream.onChunk(chunk)
+	}
+}
+
+// run renders the view and fetches partial transcripts until stop is closed,
+// then clears the view.
+func (l *liveRecording) run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if l.stream == nil {
+			l.transcribePartials(ctx)
+		}
+	}()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			cancel()
+			wg.Wait()
+			l.view.clear()
+			return
+		case <-ticker.C:
+			l.view.draw(l.lines())
+		}
+	}
+}
+
+// lines returns the current frame: the meter, then the partial transcript.
+func (l *liveRecording) lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	duration := time.Duration(len(l.samples)/l.opts.Channels) * time.Second / time.Duration(l.opts.SampleRate)
+	// Map -60..0 dBFS onto the meter; quieter is shown as silence.
+	filled := int(float64(meterWidth) * (l.level + 60) / 60)
+	filled = min(max(filled, 0), meterWidth)
+	meter := strings.Repeat("█", filled) + strings.Repeat("░", meterWidth-filled)
+	lines := []string{fmt.Sprintf("● Recording %4.1fs %s  %s", duration.Seconds(), meter, l.hint)}
+
+	partial, cut := l.partial, l.cut
+	if l.stream != nil {
+		partial, cut = l.stream.text(), false
+	}
+	if partial != "" {
+		width := l.view.width() - 3
+		text := partial
+		if cut {
+			text = "…" + text
+		}
+		for _, line := range wrapTail(text, width, livePartialLines) {
+			lines = append(lines, "  "+line)
+		}
+	}
+	return lines
+}
+
+// transcribePartials transcribes the end of the recording every
+// livePartialInterval until ctx is done. Failures are ignored; the next
+// attempt will probably do better, and the final transcript is what counts.
+func (l *liveRecording) transcribePartials(ctx context.Context) {
+	client := *l.p.transcriber
+	client.HTTPClient = l.p.directClient()
+	// The partials go where the final transcript most likely will.
+	if lw := l.p.localWhisper; lw != nil && lw.up(ctx) {
+		client = *lw.client
+		client.Language = l.p.transcriber.Language
+	}
+	client.Prompt = transcriptionPrompt(l.p.vocabulary, l.p.promptHistory)
+	window := int(livePartialWindow.Seconds()) * l.opts.SampleRate * l.opts.Channels
+
+	ticker := time.NewTicker(livePartialInterval)
+	defer ticker.Stop()
+	sent := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		l.mu.Lock()
+		total := len(l.samples)
+		if total == sent {
+			l.mu.Unlock()
+			continue
+		}
+		sent = total
+		start := max(total-window, 0)
+		start -= start % l.opts.Channels
+		rec := &record.Recording{
+			Samples:    append([]int16(nil), l.samples[start:]...),
+			Channels:   l.opts.Channels,
+			SampleRate: l.opts.SampleRate,
+		}
+		l.mu.Unlock()
+
+		audio, err := l.p.encode(rec)
+		if err != nil {
+			continue
+		}
+		reqCtx, cancel := context.WithTimeout(ctx, livePartialInterval*3)
+		text, err := client.Transcribe(reqCtx, audio, "partial"+l.p.encoder.Ext())
+		cancel()
+		if err != nil {
+			continue
+		}
+		l.p.recordTranscription(client.Model, rec.Duration())
+		l.mu.Lock()
+		l.partial, l.cut = strings.TrimSpace(text), start > 0
+		l.mu.Unlock()
+	}
+}
+
+// liveView returns a view for -live on f, telling the user if it isn't possible.
+func liveView(f *os.File) *termView {
+	view, ok := newTermView(f)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "-live needs a terminal; showing a spinner instead.")
+	}
+	return view
+}
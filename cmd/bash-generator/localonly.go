@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// requireLocal returns an error unless rawURL, where what would be sent, is
+// on this machine, as -local-only demands.
+func requireLocal(what, rawURL string) error {
+	if isLocalURL(rawURL) {
+		return nil
+	}
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return fmt.Errorf("-local-only: %s would go to %s, which isn't this machine; point it at a local server or drop -local-only", what, host)
+}
+
+// checkLocalOnly makes sure every API the pipeline calls is on this machine.
+func (p *pipeline) checkLocalOnly(proxy string) error {
+	var targets [][2]string
+	if p.localWhisper != nil {
+		targets = append(targets, [2]string{"speech for -local-whisper", p.localWhisper.client.URL})
+		if cache := p.localWhisper.models; cache != nil {
+			if m, _ := cache.Lookup(p.localWhisper.client.Model); !cache.Installed(m) {
+				targets = append(targets, [2]string{"the download of " + m.Name, m.URL})
+			}
+		}
+	}
+	if p.localWhisper == nil || p.localWhisper.fallback != "" {
+		targets = append(targets, [2]string{"speech for transcription", p.transcriber.URL})
+	}
+	targets = append(targets, [2]string{"requests for commands", p.generator.URL})
+	for _, r := range p.racers {
+		targets = append(targets, [2]string{"requests raced with -race", r.generator.URL})
+	}
+	if p.realtime != nil {
+		targets = append(targets, [2]string{"speech streamed with -stream", p.realtime.URL})
+	}
+	if p.embedder != nil {
+		targets = append(targets, [2]string{"requests for embeddings", p.embedder.URL})
+	}
+	if p.speaker != nil && p.speaker.client != nil {
+		targets = append(targets, [2]string{"text to speak", p.speaker.client.URL})
+	}
+	if proxy != "" {
+		targets = append(targets, [2]string{"API requests through -proxy", proxy})
+	}
+	for _, t := range targets {
+		if err := requireLocal(t[0], t[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localOnlyTransport makes t refuse connections to anywhere but this machine,
+// in case a URL slipped past checkLocalOnly. Host names other than localhost
+// are refused without looking them up, as the lookup would leave the machine
+// too. Unless proxy was given, the one in HTTPS_PROXY is ignored.
+func localOnlyTransport(t *http.Transport, proxy string) {
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if !isLoopbackAddr(addr) {
+			return nil, fmt.Errorf("-local-only: refusing to connect to %s, which isn't this machine", addr)
+		}
+		return dial(ctx, network, addr)
+	}
+	if proxy == "" {
+		t.Proxy = nil
+	}
+}
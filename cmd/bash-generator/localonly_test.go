@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jerilseb/bash-generator/pkg/generate"
+	"github.com/jerilseb/bash-generator/pkg/transcribe"
+)
+
+// TestLocalOnlyTransport checks that with -local-only the API clients, and
+// the WebSocket of -stream, never dial anywhere but this machine, even for a
+// URL that slipped past checkLocalOnly.
+func TestLocalOnlyTransport(t *testing.T) {
+	var mu sync.Mutex
+	var dialed []string
+	base := &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		dialed = append(dialed, addr)
+		mu.Unlock()
+		if !isLoopbackAddr(addr) {
+			t.Errorf("dialed %s, which isn't this machine", addr)
+			return nil, errors.New("not this machine")
+		}
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}}
+	localOnlyTransport(base, "")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			io.WriteString(w, `{"choices": [{"message": {"content": "ls -la"}}]}`)
+		case "/v1/audio/transcriptions":
+			io.WriteString(w, `{"text": "list the files"}`)
+		default:
+			http.Error(w, "no WebSocket here", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	p := &pipeline{
+		transcriber: &transcribe.Client{Model: "whisper-1"},
+		generator:   &generate.Client{Model: "test-model", PlainText: true},
+		realtime:    &transcribe.Realtime{Model: "test-model"},
+		attempts:    1,
+	}
+	p.setTransport(base)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	generateAt := func(url string) error {
+		p.generator.URL = url
+		_, err := p.generator.Generate(ctx, generate.Request{Text: "list the files"})
+		return err
+	}
+	transcribeAt := func(url string) error {
+		p.transcriber.URL = url
+		_, err := p.transcriber.TranscribeResult(ctx, strings.NewReader("audio"), "recording.flac")
+		return err
+	}
+	streamAt := func(url string) error {
+		p.realtime.URL = url
+		_, err := p.realtime.Start(ctx).Finish(ctx)
+		return err
+	}
+	local := strings.TrimPrefix(srv.URL, "http://")
+	tests := []struct {
+		name string
+		call func(string) error
+		url  string
+		// refused is set if the connection must be refused by -local-only.
+		refused bool
+	}{
+		{"generate remote", generateAt, "https://api.openai.com/v1/chat/completions", true},
+		{"generate remote address", generateAt, "http://203.0.113.7:8080/v1/chat/completions", true},
+		{"generate local", generateAt, srv.URL + "/v1/chat/completions", false},
+		{"transcribe remote", transcribeAt, "https://api.openai.com/v1/audio/transcriptions", true},
+		{"transcribe local", transcribeAt, srv.URL + "/v1/audio/transcriptions", false},
+		{"stream remote", streamAt, "wss://api.openai.com/v1/realtime?intent=transcription", true},
+		{"stream remote address", streamAt, "ws://203.0.113.7:8080/v1/realtime", true},
+		{"stream local", streamAt, "ws://" + local + "/v1/realtime", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(tt.url)
+			switch refused := err != nil && strings.Contains(err.Error(), "-local-only"); {
+			case tt.refused && !refused:
+				t.Errorf("error = %v, want the connection refused by -local-only", err)
+			case !tt.refused && refused:
+				t.Errorf("error = %v, want the connection made", err)
+			}
+		})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, addr := range dialed {
+		if addr != local {
+			t.Errorf("dialed %s, want only %s", addr, local)
+		}
+	}
+	if len(dialed) == 0 {
+		t.Error("nothing was dialed, not even the local server")
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/models"
+	"github.com/jerilseb/bash-generator/pkg/transcribe"
+)
+
+const (
+	// defaultLocalWhisperModel is what faster-whisper-server and Speaches
+	// are asked to transcribe with when local_whisper_model isn't set.
+	defaultLocalWhisperModel = "Systran/faster-whisper-small"
+	// localWhisperProbe bounds the health check of a local Whisper server.
+	// It is close by, so one that takes longer is as good as down.
+	localWhisperProbe = 2 * time.Second
+	// localWhisperRetry is how long a server found down is left alone
+	// before it is checked on again.
+	localWhisperRetry = 30 * time.Second
+)
+
+// localWhisper is a self-hosted Whisper server, such as faster-whisper-server,
+// Speaches or whisper-asr-webservice running faster-whisper or whisperX,
+// that recordings are transcribed with while it is up.
+type localWhisper struct {
+	client *transcribe.Client
+	// health is the URL checked before each recording is sent. Servers
+	// without a health endpoint answer it with 404, which does as well.
+	health string
+	// fallback is the name of the API transcribing while the server is
+	// down; empty if there is none to fall back on.
+	fallback string
+	// models is set if the model asked for is in the registry of local
+	// models, to download it on first use.
+	models *models.Cache
+
+	mu        sync.Mutex
+	down      bool
+	downUntil time.Time
+}
+
+// newLocalWhisper returns the client for the server at rawURL: the /asr
+// endpoint of whisper-asr-webservice, the transcription endpoint of an
+// OpenAI-compatible server, or the address of one, to which
+// /v1/audio/transcriptions is added. With translate it asks for English.
+func newLocalWhisper(rawURL, model string, translate bool) (*localWhisper, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid -local-whisper %q: expected an http:// or https:// URL, e.g. http://localhost:8000", rawURL)
+	}
+	c := &transcribe.Client{Provider: transcribe.OpenAI, Model: model}
+	path := strings.TrimRight(u.Path, "/")
+	switch {
+	case strings.HasSuffix(path, "/asr"):
+		c.Provider, c.Model = transcribe.WhisperASR, "whisper-asr"
+		if translate {
+			q := u.Query()
+			q.Set("task", "translate")
+			u.RawQuery = q.Encode()
+		}
+	case strings.HasSuffix(path, "/audio/transcriptions"):
+	case strings.HasSuffix(path, "/v1"):
+		path += "/audio/transcriptions"
+	default:
+		path += "/v1/audio/transcriptions"
+	}
+	if c.Provider == transcribe.OpenAI {
+		if translate {
+			path = strings.TrimSuffix(path, "/audio/transcriptions") + "/audio/translations"
+		}
+		if c.Model == "" {
+			c.Model = defaultLocalWhisperModel
+		}
+	}
+	u.Path, u.RawPath = path, ""
+	c.URL = u.String()
+	health := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/health"}
+	return &localWhisper{client: c, health: health.String()}, nil
+}
+
+// up reports whether the server is there to transcribe, checking unless it
+// was found down less than localWhisperRetry ago.
+func (l *localWhisper) up(ctx context.Context) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.down && time.Now().Before(l.downUntil) {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, localWhisperProbe)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.health, nil)
+	if err != nil {
+		return false
+	}
+	start := time.Now()
+	resp, err := l.httpClient().Do(req)
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			err = fmt.Errorf("health check answered %s", resp.Status)
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil && errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("no answer within %s", localWhisperProbe)
+		}
+		l.setDown(err)
+		return false
+	}
+	slog.Debug("local Whisper server up", "url", l.health, "latency", time.Since(start))
+	if l.down {
+		fmt.Fprintf(os.Stderr, "The local Whisper server at %s is back.\n", l.host())
+		l.down = false
+	}
+	return true
+}
+
+// markDown notes that the server failed to transcribe with err, so the next
+// recordings go to the fallback for a while.
+func (l *localWhisper) markDown(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.setDown(err)
+}
+
+func (l *localWhisper) setDown(err error) {
+	slog.Warn("local Whisper server down", "url", l.client.URL, "err", err)
+	if !l.down {
+		switch {
+		case l.fallback != "":
+			fmt.Fprintf(os.Stderr, "The local Whisper server at %s isn't working (%v); transcribing with %s until it is.\n", l.host(), err, l.fallback)
+		default:
+			fmt.Fprintf(os.Stderr, "The local Whisper server at %s isn't working (%v).\n", l.host(), err)
+		}
+	}
+	l.down = true
+	l.downUntil = time.Now().Add(localWhisperRetry)
+}
+
+func (l *localWhisper) host() string {
+	if u, err := url.Parse(l.client.URL); err == nil {
+		return u.Host
+	}
+	return l.client.URL
+}
+
+// model returns the model to ask the server for. One from the registry of
+// local models is downloaded first, if it isn't yet, and asked for by the
+// path of its file, for servers that load models from this machine's disk.
+func (l *localWhisper) model(ctx context.Context) (string, error) {
+	if l.models == nil {
+		return l.client.Model, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m, _ := l.models.Lookup(l.client.Model)
+	if l.models.Installed(m) {
+		return l.models.Path(m), nil
+	}
+	path, err := l.models.Ensure(ctx, m.Name)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to download the model for -local-whisper: %w", err)
+	}
+	return path, nil
+}
+
+func (l *localWhisper) httpClient() *http.Client {
+	if l.client.HTTPClient != nil {
+		return l.client.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// errLocalWhisperDown is returned when the local Whisper server is down and
+// there is no transcription API to fall back on.
+var errLocalWhisperDown = errors.New("the local Whisper server is down and there is no transcription API to fall back on")
+
+// transcribeLocally transcribes audio with the local Whisper server, with
+// prompt. ok is false if the server is down, or fails to transcribe, and the
+// audio should go to the fallback instead.
+func (p *pipeline) transcribeLocally(ctx context.Context, audio []byte, filename, prompt string) (res *transcribe.Result, ok bool, err error) {
+	l := p.localWhisper
+	if !l.up(ctx) {
+		return nil, false, nil
+	}
+	model, err := l.model(ctx)
+	if err != nil {
+		return nil, true, err
+	}
+	client := *l.client
+	client.Model = model
+	client.Prompt = prompt
+	client.Language = p.transcriber.Language
+	client.Confidence = p.transcriber.Confidence
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	start := time.Now()
+	res, err = client.TranscribeResult(ctx, bytes.NewReader(audio), filename)
+	if err != nil {
+		if ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, true, err
+		}
+		l.markDown(err)
+		return nil, false, nil
+	}
+	slog.Info("transcribed", "model", client.Model, "url", client.URL, "latency", time.Since(start), "chars", len(res.Text), "confidence", res.Confidence)
+	return res, true, nil
+}
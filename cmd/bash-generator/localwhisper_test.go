@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jerilseb/bash-generator/internal/models"
+)
+
+// TestLocalWhisperModel checks that a model of the registry is downloaded
+// on first use and asked for by the path of its file.
+func TestLocalWhisperModel(t *testing.T) {
+	const body = "ggml model weights"
+	sum := sha256.Sum256([]byte(body))
+	downloads := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	l, err := newLocalWhisper("http://localhost:8080", "whisper-test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := models.Model{Name: "whisper-test", Kind: models.KindWhisper, URL: srv.URL + "/ggml-test.bin", SHA256: hex.EncodeToString(sum[:])}
+	l.models = &models.Cache{Dir: t.TempDir(), Models: []models.Model{m}, HTTPClient: srv.Client()}
+	for i := 0; i < 2; i++ {
+		if got, err := l.model(context.Background()); got != l.models.Path(m) || err != nil {
+			t.Fatalf("model = %q, %v; want %q", got, err, l.models.Path(m))
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("downloaded %d times, want once", downloads)
+	}
+
+	l.models.Models[0].SHA256 = ""
+	l.models.Dir = t.TempDir()
+	if got, err := l.model(context.Background()); err == nil {
+		t.Errorf("model of an unpinned model = %q, nil; want an error", got)
+	}
+}
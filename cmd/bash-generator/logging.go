@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// discardHandler drops every record, so nothing is logged unless -v or
+// -log-file asks for it.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// verbosityFlag is -v or -vv, which raise the verbosity to their level.
+type verbosityFlag struct {
+	verbosity *int
+	level     int
+}
+
+func (f verbosityFlag) String() string   { return "" }
+func (f verbosityFlag) IsBoolFlag() bool { return true }
+
+func (f verbosityFlag) Set(s string) error {
+	on, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if on {
+		*f.verbosity = max(*f.verbosity, f.level)
+	}
+	return nil
+}
+
+// setupLogging makes the default logger write each phase of the pipeline:
+// info with -v, debug as well with -vv. Logs go to stderr as text, or to a
+// file as JSON Lines, one object per record, to attach to bug reports. A log
+// file without -v gets info.
+func setupLogging(verbosity int, path string) error {
+	if verbosity == 0 && path == "" {
+		return nil
+	}
+	level := slog.LevelInfo
+	if verbosity > 1 {
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if path == "" {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+		return nil
+	}
+	// The file is left open for the lifetime of the process; records are
+	// written unbuffered, so nothing is lost on exit.
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open the log file: %w", err)
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(f, opts)))
+	return nil
+}
+
+// loggingTransport logs every HTTP request it sends: each attempt of a retried
+// one, as it sits below the retry transport.
+type loggingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !slog.Default().Enabled(req.Context(), slog.LevelInfo) {
+		return base.RoundTrip(req)
+	}
+
+	// The query is left out, as some APIs take the key there.
+	attrs := []any{"method", req.Method, "url", req.URL.Scheme + "://" + req.URL.Host + req.URL.Path}
+	var body *countingReader
+	if req.Body != nil && req.Body != http.NoBody {
+		body = &countingReader{ReadCloser: req.Body}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	attrs = append(attrs, "latency", time.Since(start))
+	if body != nil {
+		attrs = append(attrs, "bytes_sent", body.n.Load())
+	}
+	if err != nil {
+		slog.Warn("http request failed", append(attrs, "err", err)...)
+		return nil, err
+	}
+	attrs = append(attrs, "status", resp.StatusCode)
+	for _, header := range []string{"X-Request-Id", "Request-Id", "Apim-Request-Id"} {
+		if id := resp.Header.Get(header); id != "" {
+			attrs = append(attrs, "request_id", id)
+			break
+		}
+	}
+	slog.Info("http request", attrs...)
+	slog.Debug("http response", "url", req.URL.Host+req.URL.Path, "content_length", resp.ContentLength, "content_type", resp.Header.Get("Content-Type"))
+	return resp, nil
+}
+
+// countingReader counts the bytes read from a request body, which is how
+// many were uploaded.
+type countingReader struct {
+	io.ReadCloser
+	// n is read while the transport may still be sending the body.
+	n atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
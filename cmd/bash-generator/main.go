@@ -0,0 +1,1180 @@
+// Command bash-generator records a spoken instruction, transcribes it and
+// turns it into a Bash command that can be run after confirmation.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/briandowns/spinner"
+
+	"github.com/jerilseb/bash-generator/internal/history"
+	"github.com/jerilseb/bash-generator/internal/prefs"
+	"github.com/jerilseb/bash-generator/internal/qr"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+	"github.com/jerilseb/bash-generator/pkg/record"
+	"github.com/jerilseb/bash-generator/pkg/safety"
+)
+
+func main() {
+	slog.SetDefault(slog.New(discardHandler{}))
+	exit(run(os.Args[1:]))
+}
+
+// command is a subcommand.
+type command struct {
+	name  string
+	about string
+	run   func(args []string) error
+	// words are the arguments it takes, for completion.
+	words []string
+	// flags defines its flags on fs, as run does, for completion. It is nil
+	// for subcommands without flags. Defaults come from an empty config,
+	// which cannot fail to parse.
+	flags func(fs *flag.FlagSet)
+}
+
+// commands returns the subcommands.
+func commands() []command {
+	return []command{
+		{name: "record", about: "record a request and generate a command, as without a subcommand", run: runGenerate, flags: func(fs *flag.FlagSet) { new(generateFlags).define(fs, &config{}) }},
+		{name: "gen", about: "generate a command for a typed request", run: runGen, flags: func(fs *flag.FlagSet) { new(generateFlags).define(fs, &config{}) }},
+		{name: "config", about: "show or change the config file", run: runConfig, words: []string{"path", "show", "get", "set", "unset", "edit"}},
+		{name: "devices", about: "list the audio input devices", run: runDevices},
+		{name: "export", about: "bundle the config, vocabulary, snippets and history into a file", run: runExport, flags: func(fs *flag.FlagSet) { new(exportFlags).define(fs) }},
+		{name: "import", about: "restore a bundle made with export", run: runImport, flags: func(fs *flag.FlagSet) { new(importFlags).define(fs) }},
+		{name: "serve", about: "run the daemon, for the hotkey and the HTTP API", run: runServe, flags: func(fs *flag.FlagSet) { new(serveFlags).define(fs, &config{}) }},
+		{name: "trigger", about: "control the running daemon", run: runTrigger, words: []string{"toggle", "start", "stop", "hotkey", "cancel", "status", "stats"}, flags: func(fs *flag.FlagSet) { new(triggerFlags).define(fs) }},
+		{name: "install-service", about: "install serve as a systemd user service", run: runInstallService, flags: func(fs *flag.FlagSet) { new(serveFlags).define(fs, &config{}) }},
+		{name: "stats", about: "add up what the API calls cost and how long they took", run: runStats, flags: func(fs *flag.FlagSet) { new(statsFlags).define(fs) }},
+		{name: "init", about: "print the widget for a shell", run: runInit, words: shells, flags: func(fs *flag.FlagSet) { new(initFlags).define(fs) }},
+		{name: "completion", about: "print the completion script for a shell", run: runCompletion, words: shells},
+		{name: "suggest", about: "print the last accepted command starting with a prefix", run: runSuggest, flags: func(fs *flag.FlagSet) { new(suggestFlags).define(fs) }},
+		{name: "models", about: "manage local models", run: runModels, words: []string{"list", "pull", "rm", "remote"}, flags: func(fs *flag.FlagSet) { new(modelsFlags).define(fs, &config{}) }},
+		{name: "doctor", about: "show which optional features are available", run: runDoctor},
+		{name: "history", about: "list recent requests and their commands", run: runHistory, words: []string{"export", "import"}, flags: func(fs *flag.FlagSet) { new(historyFlags).define(fs) }},
+		{name: "repl", about: "make one request after another in a session", run: runRepl, flags: func(fs *flag.FlagSet) { new(replFlags).define(fs, &config{}) }},
+		{name: "transcribe", about: "transcribe an audio file", run: runTranscribe, flags: func(fs *flag.FlagSet) { new(transcribeFlags).define(fs, &config{}) }},
+		{name: "batch", about: "generate commands for a file of requests, one per line, as a script to review", run: runBatch, flags: func(fs *flag.FlagSet) { new(batchFlags).define(fs, &config{}) }},
+		{name: "auth", about: "store API keys in the keyring", run: runAuth, words: []string{"login", "logout", "status"}},
+		{name: "mcp", about: "serve the Model Context Protocol on stdin and stdout", run: runMCP, flags: func(fs *flag.FlagSet) { new(mcpFlags).define(fs, &config{}) }},
+		{name: "listen", about: "wait for the wake word, hands-free", run: runListen, flags: func(fs *flag.FlagSet) { new(listenFlags).define(fs, &config{}) }},
+		{name: "alias", about: "use commands of your own for phrases you say often", run: runAlias, words: []string{"add", "rm", "list"}},
+		{name: "undo", about: "reverse the last command that was run", run: runUndo, flags: func(fs *flag.FlagSet) { new(undoFlags).define(fs, &config{}) }},
+		{name: "audit", about: "list or verify the commands in an audit log", run: runAudit, flags: func(fs *flag.FlagSet) { new(auditFlags).define(fs, &config{}) }},
+		{name: "cache", about: "show or clear the cached transcripts and commands", run: runCache, words: []string{"stats", "clear"}, flags: func(fs *flag.FlagSet) { new(cacheFlags).define(fs, &config{}) }},
+	}
+}
+
+// run dispatches to a subcommand, or records and generates a command when none is given.
+func run(args []string) error {
+	if len(args) > 0 {
+		for _, c := range commands() {
+			if c.name == args[0] {
+				return c.run(args[1:])
+			}
+		}
+	}
+	return runGenerate(args)
+}
+
+// options are the settings shared by everything that runs the record → transcribe → generate pipeline.
+type options struct {
+	Context        string
+	ContextTokens  int
+	RedactRules    string
+	DiscardChatter bool
+	PromptHistory  bool
+	NoProjectRules bool
+	NoSpokenForms  bool
+	AudioFormat    string
+	Denoise        bool
+	Gain           string
+	Lint           string
+	CheckTools     string
+	SaveAudio      string
+	Attempts       int
+	Proxy          string
+	LocalOnly      bool
+	Timeout        time.Duration
+	MaxDuration    time.Duration
+	MinSpeech      time.Duration
+	CacheTTL       time.Duration
+	Channel        int
+	Shell          string
+	Language       string
+	Translate      bool
+	MinConfidence  float64
+	Stream         bool
+	FewShot        bool
+	FewShotCount   int
+	ShowCost       bool
+	Budget         float64
+	OverBudget     bool
+	Race           string
+	Concurrency    string
+	Temperature    float64
+	MaxTokens      int
+	Speak          speakMode
+	Mode           string
+	Verbosity      int
+	Timing         bool
+	LogFile        string
+	AuditLog       string
+	AuditKey       string
+	Endpoint       endpointOptions
+}
+
+// addPipelineFlags registers the pipeline flags on fs, with defaults taken from cfg.
+func addPipelineFlags(fs *flag.FlagSet, cfg *config) (*options, error) {
+	if cfg.ContextTokens == 0 {
+		cfg.ContextTokens = 2000
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 4
+	}
+	if cfg.Lint == "" {
+		cfg.Lint = lintOff
+	}
+	if cfg.CheckTools == "" {
+		cfg.CheckTools = lintWarn
+	}
+	if cfg.FewShotCount == 0 {
+		cfg.FewShotCount = 5
+	}
+	timeout := 2 * time.Minute
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout in config: %w", err)
+		}
+		timeout = d
+	}
+	maxDuration := time.Minute
+	if cfg.MaxDuration != "" {
+		d, err := time.ParseDuration(cfg.MaxDuration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_duration in config: %w", err)
+		}
+		maxDuration = d
+	}
+	minSpeech := defaultMinSpeech
+	if cfg.MinSpeech != "" {
+		d, err := time.ParseDuration(cfg.MinSpeech)
+		if err != nil {
+			return nil, fmt.Errorf("invalid min_speech in config: %w", err)
+		}
+		minSpeech = d
+	}
+	cacheTTL, err := cacheTTL(cfg)
+	if err != nil {
+		return nil, err
+	}
+	o := &options{Speak: speakMode(cfg.Speak), Endpoint: endpointOptions{Config: cfg}}
+	fs.StringVar(&o.Context, "context", cfg.Context, "comma separated context sources to include in the prompt: "+strings.Join(contextPriority, ", "))
+	fs.IntVar(&o.ContextTokens, "context-tokens", cfg.ContextTokens, "maximum number of tokens to spend on injected context")
+	fs.StringVar(&o.RedactRules, "redact-rules", cfg.RedactRules, "file of regular expressions, one per line, for credentials to mask in the context besides the built-in ones")
+	fs.BoolVar(&o.PromptHistory, "prompt-history", cfg.PromptHistory, "hint the speech-to-text model with the programs in your recent shell history")
+	fs.StringVar(&o.Shell, "shell", cfg.Shell, "shell to generate commands for and run them with: bash, powershell or cmd (default "+defaultShell+")")
+	fs.StringVar(&o.Language, "language", cfg.Language, "ISO-639-1 code of the language you speak, e.g. de; by default it is detected from the audio")
+	fs.BoolVar(&o.Translate, "translate", cfg.Translate, "transcribe speech in any language into English, using the translation endpoint (whisper-1 only)")
+	fs.Float64Var(&o.MinConfidence, "min-confidence", cfg.MinConfidence, "show the transcript and ask before going on when the transcription is less sure than this, from 0 to 1, of what it heard; 0 never asks")
+	fs.StringVar(&o.AudioFormat, "audio-format", cfg.AudioFormat, "format recordings are uploaded in: flac, opus (needs opusenc) or wav; by default the first one the transcription endpoint accepts")
+	fs.BoolVar(&o.Denoise, "denoise", cfg.Denoise, "turn down steady background noise, like fans and hum, before uploading the recording")
+	fs.StringVar(&o.Gain, "gain", cfg.Gain, "make the recording louder before uploading it: auto to bring speech to a standard level, off, or a change in dB such as 6")
+	fs.Var(&o.Speak, "speak", "read the explanation of the command aloud, or the command itself with -speak=command, with say, espeak or the API's speech endpoint")
+	fs.StringVar(&o.Mode, "mode", cfg.Mode, "specialize in one tool, with its own instructions and context: k8s (the current kube context and resources), docker (containers and images) or git (the repository's status)")
+	fs.BoolVar(&o.NoSpokenForms, "no-spoken-forms", cfg.NoSpokenForms, "send requests as they are, without turning spoken flags, paths and numbers like \"dash r f\" or \"port eighty eighty\" into -rf and 8080")
+	fs.BoolVar(&o.NoProjectRules, "no-project-rules", cfg.NoProjectRules, "ignore the "+rulesFileName+" file in the root of the project, with instructions of its own for the commands generated in it")
+	fs.BoolVar(&o.FewShot, "few-shot", cfg.FewShot, "show the model your latest commands that ran, with their requests, so it picks up the tools and names you prefer")
+	fs.IntVar(&o.FewShotCount, "few-shot-count", cfg.FewShotCount, "how many commands -few-shot sends")
+	fs.StringVar(&o.Lint, "lint", cfg.Lint, "check generated commands with shellcheck: off, warn to show its findings, or fix to also let the model correct them")
+	fs.StringVar(&o.CheckTools, "check-tools", cfg.CheckTools, "look for programs the command runs that aren't installed: off, warn to point them out, or fix to also let the model do without them")
+	fs.StringVar(&o.SaveAudio, "save-audio", cfg.SaveAudio, "also write the uploaded audio to this file, or to a new file named after the time in this directory, e.g. ~/recordings/, for every recording")
+	fs.IntVar(&o.Channel, "channel", cfg.InputChannel, "record only this input channel, counting from 1, e.g. the input of an audio interface the microphone is plugged into; by default all channels are mixed down")
+	fs.DurationVar(&o.MaxDuration, "max-duration", maxDuration, "stop recording after this long, in case it was left running; 0 for the hard limit of "+recordingLimit.String())
+	fs.DurationVar(&o.MinSpeech, "min-speech", minSpeech, "offer to record again, without transcribing, when a recording has less speech than this in it; 0 transcribes any")
+	fs.DurationVar(&o.CacheTTL, "cache-ttl", cacheTTL, "answer a recording or request heard before with the transcript or command it got then, if that was less than this long ago, e.g. 24h; 0 doesn't cache them. "+appName+" cache stats and cache clear manage them")
+	fs.BoolVar(&o.ShowCost, "cost", cfg.Cost, "show what the API calls cost once they are done; "+appName+" stats adds up earlier ones")
+	o.Budget = cfg.MonthlyBudget
+	fs.BoolVar(&o.OverBudget, "over-budget", false, "make API calls even though this month's spend has reached monthly_budget")
+	fs.BoolVar(&o.Timing, "timing", cfg.Timing, "show how long recording, encoding, transcription and generation took once the command is ready; "+appName+" stats adds up earlier runs")
+	fs.DurationVar(&o.Timeout, "timeout", timeout, "give up on an API call, retries included, after this long")
+	fs.IntVar(&o.Attempts, "max-attempts", cfg.MaxAttempts, "how many times to try an API request that fails with a timeout, 429 or 5xx")
+	fs.StringVar(&o.Proxy, "proxy", cfg.Proxy, "send API requests through this proxy, e.g. http://proxy:3128 or socks5://localhost:1080, instead of the one in HTTPS_PROXY")
+	fs.BoolVar(&o.LocalOnly, "local-only", cfg.LocalOnly, "fail rather than send anything off this machine: only local transcription and chat servers, on localhost, may be used")
+	fs.StringVar(&o.Endpoint.APIType, "api-type", "", "API flavour: openai (default) or azure (env OPENAI_API_TYPE)")
+	fs.StringVar(&o.Endpoint.BaseURL, "base-url", "", "base URL of an OpenAI-compatible API, or the Azure resource endpoint (env OPENAI_BASE_URL / AZURE_OPENAI_ENDPOINT)")
+	fs.StringVar(&o.Endpoint.TranscriptionURL, "transcription-url", "", "full URL of the transcription endpoint (env OPENAI_TRANSCRIPTION_URL)")
+	fs.StringVar(&o.Endpoint.ChatURL, "chat-url", "", "full URL of the chat completions endpoint (env OPENAI_CHAT_URL)")
+	fs.StringVar(&o.Endpoint.Backend, "backend", "", "API to generate commands with: openai (default), anthropic or gemini (env BASH_GENERATOR_BACKEND)")
+	fs.StringVar(&o.Endpoint.ChatModel, "chat-model", "", "chat model name (env OPENAI_CHAT_MODEL, ANTHROPIC_MODEL or GEMINI_MODEL, per backend); "+appName+" models remote lists them")
+	fs.StringVar(&o.Endpoint.ChatModel, "model", "", "short for -chat-model")
+	fs.StringVar(&o.Race, "race", cfg.Race, "also send requests to these backends at once, comma separated as backend or backend:model, e.g. anthropic,openai:gpt-4o, and take the first command found safe, or choose among them")
+	fs.StringVar(&o.Concurrency, "concurrency", cfg.Concurrency, "most API calls to make to each backend at once, the rest waiting their turn: a number, or limits per backend like openai=4,anthropic=2; 0 for no limit (default "+defaultServerConcurrency+" for serve and mcp, none otherwise)")
+	fs.Float64Var(&o.Temperature, "temperature", cfg.Temperature, "sampling temperature of the chat model; higher gives more varied commands")
+	fs.IntVar(&o.MaxTokens, "max-tokens", cfg.MaxTokens, "maximum number of tokens the chat model may answer with; 0 for the API's default")
+	fs.StringVar(&o.Endpoint.TranscriptionModel, "transcription-model", "", "transcription model name (env OPENAI_TRANSCRIPTION_MODEL; default whisper-1, or the provider's own)")
+	fs.StringVar(&o.Endpoint.LocalWhisper, "local-whisper", "", "transcribe with this self-hosted faster-whisper or whisperX server while it is up, e.g. http://localhost:8000 or whisper-asr-webservice's http://localhost:9000/asr, falling back to the transcription API while it is down (env BASH_GENERATOR_LOCAL_WHISPER_URL)")
+	fs.StringVar(&o.Endpoint.Provider, "transcription-provider", "", "API to transcribe speech with: openai (default), deepgram, assemblyai or google (env BASH_GENERATOR_TRANSCRIPTION_PROVIDER)")
+	fs.Var(verbosityFlag{&o.Verbosity, 1}, "v", "log each step to stderr: the microphone, the audio, every API request with its status, latency and size, and retries")
+	fs.Var(verbosityFlag{&o.Verbosity, 2}, "vv", "like -v, with debugging details such as the context and prompt sizes")
+	fs.StringVar(&o.AuditLog, "audit-log", cfg.AuditLog, "also append every command, with the user, host, transcript and exit status, to this append-only audit log; "+appName+" audit reads it")
+	fs.StringVar(&o.AuditKey, "audit-key", cfg.AuditKey, "file with a key to sign the records of the audit log with")
+	fs.StringVar(&o.LogFile, "log-file", cfg.LogFile, "write the log to this file as JSON Lines instead of to stderr, at -v level unless -vv is given")
+	return o, nil
+}
+
+// runGen generates a command for the request given as arguments, or typed
+// when there are none, without opening the microphone.
+func runGen(args []string) error {
+	return runGenerate(append([]string{"-no-audio"}, args...))
+}
+
+// generateFlags are the flags of the generator itself, and of record and gen.
+type generateFlags struct {
+	opts              *options
+	printOnly         bool
+	learn             bool
+	summarize         bool
+	confirmTranscript bool
+	scriptPath        string
+	editScript        bool
+	pushToTalkKey     string
+	live              bool
+	estimate          bool
+	copyCommand       bool
+	useSandbox        bool
+	whatIf            bool
+	showQR            bool
+	askPlaceholders   bool
+	noCache           bool
+	pickerName        string
+	autoFix           int
+	noAudio           bool
+	fromAudio         string
+	fix               bool
+	stdioServer       bool
+	tmuxPane          tmuxFlag
+}
+
+func (f *generateFlags) define(fs *flag.FlagSet, cfg *config) error {
+	var err error
+	if f.opts, err = addPipelineFlags(fs, cfg); err != nil {
+		return err
+	}
+	fs.BoolVar(&f.opts.DiscardChatter, "discard-chatter", false, "skip generation when the transcript looks like background conversation rather than a request")
+	fs.BoolVar(&f.printOnly, "print", false, "print the command to stdout instead of offering to run it; everything else goes to stderr")
+	fs.BoolVar(&f.printOnly, "quiet", false, "same as -print, for scripts: stdout carries nothing but the command, and the exit code tells what happened")
+	fs.BoolVar(&f.learn, "learn", cfg.Learn, "remember the edits you make to commands as conventions of the current project")
+	fs.BoolVar(&f.summarize, "summarize", false, "capture the output of the command and offer a short summary when it is long")
+	fs.BoolVar(&f.confirmTranscript, "confirm-transcript", cfg.ConfirmTranscript, "show the transcript and let you correct it or record again before generating")
+	fs.StringVar(&f.scriptPath, "script", "", "write a complete, commented script for longer requests to this file instead of generating a command")
+	fs.BoolVar(&f.editScript, "edit", false, "with -script, open the script in $EDITOR once it is written")
+	fs.StringVar(&f.pushToTalkKey, "push-to-talk", cfg.PushToTalk, "record while this key (space or a single character) is held down, instead of until Enter")
+	fs.BoolVar(&f.live, "live", cfg.Live, "show a level meter and a running transcript while recording (sends the audio for transcription every few seconds)")
+	fs.BoolVar(&f.opts.Stream, "stream", cfg.Stream, "transcribe while recording, over a Realtime API session, so the transcript is ready as soon as you stop")
+	fs.BoolVar(&f.estimate, "estimate", cfg.Estimate, "show what the API calls are expected to cost and ask before making them")
+	fs.BoolVar(&f.copyCommand, "copy", cfg.Copy, "also copy the command to the clipboard")
+	fs.BoolVar(&f.useSandbox, "sandbox", false, "first run the command in a throwaway Docker or Podman container, with the current directory read-only, and show its output")
+	fs.BoolVar(&f.whatIf, "what-if", cfg.WhatIf, "show what the command would do, read from the command without running it: the files it reads, writes and deletes, whether it uses the network and whether it gains privileges")
+	fs.BoolVar(&f.showQR, "qr", false, "also show the command as a QR code, to scan it with a phone and run it elsewhere")
+	fs.BoolVar(&f.askPlaceholders, "placeholders", cfg.Placeholders, "have the model mark values it doesn't know, like host names and paths, as placeholders and ask for them")
+	fs.BoolVar(&f.noCache, "no-cache", cfg.NoCache, "always ask the model, instead of first offering the command of an earlier request that means the same")
+	fs.StringVar(&f.pickerName, "picker", cfg.Picker, "choose among the earlier commands for a request with rofi, fzf or dmenu, instead of being offered the closest one")
+	fs.IntVar(&f.autoFix, "auto-fix", cfg.AutoFix, "when the command fails, send what it wrote to stderr back to the model and offer a corrected command, up to this many times")
+	fs.BoolVar(&f.noAudio, "no-audio", cfg.NoAudio, "never open the microphone and type the request instead, e.g. in containers and CI")
+	fs.StringVar(&f.fromAudio, "from-audio", "", "transcribe this audio file, e.g. one kept with -save-audio, instead of recording")
+	fs.BoolVar(&f.fix, "fix", false, "read the output of a command that went wrong from stdin, as in: make 2>&1 | "+appName+" -fix, for a command that fixes the problem")
+	fs.BoolVar(&f.stdioServer, "stdio-server", false, "serve requests from an editor extension as JSON-RPC on stdin and stdout, see the README for the protocol")
+	fs.Var(&f.tmuxPane, "tmux", "type the command into a tmux pane, without running it, instead of offering to run it here; -tmux=PANE picks the pane by index, name or title (default: the previous pane)")
+	return nil
+}
+
+func runGenerate(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// Usage errors exit with exitFailure rather than the flag package's 2, which means exitAborted here.
+	fs := flag.NewFlagSet(appName, flag.ContinueOnError)
+	var flags generateFlags
+	if err := flags.define(fs, cfg); err != nil {
+		return err
+	}
+	opts := flags.opts
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return &exitStatus{code: exitFailure}
+	}
+	if flags.tmuxPane.set && flags.tmuxPane.target == "" {
+		flags.tmuxPane.target = cfg.TmuxTarget
+	}
+
+	// In print mode stdout carries nothing but the command, so it can be captured by shell widgets.
+	ui := os.Stdout
+	if flags.printOnly {
+		ui = os.Stderr
+	}
+
+	if opts.Stream && flags.estimate {
+		return errors.New("-estimate can't be combined with -stream, which sends the audio while recording")
+	}
+
+	pk, err := newPicker(flags.pickerName)
+	if err != nil {
+		return err
+	}
+
+	p, err := newPipeline(opts)
+	if err != nil {
+		return err
+	}
+	// Stdout carries the protocol, so nothing else may be printed to it.
+	if flags.stdioServer {
+		return serveEditor(p, opts)
+	}
+	if opts.ShowCost {
+		defer func() { printUsage(ui, p.takeUsage()) }()
+	}
+	defer p.speaker.wait()
+	p.script = flags.scriptPath != ""
+	if p.script && !p.shell.bash() {
+		return fmt.Errorf("-script writes Bash scripts; it can't be used with -shell %s", p.shell.name)
+	}
+	p.placeholders = flags.askPlaceholders && !p.script
+	if p.script && flags.tmuxPane.set {
+		return errors.New("-tmux can't be combined with -script")
+	}
+	if flags.autoFix < 0 {
+		return fmt.Errorf("invalid -auto-fix %d: must not be negative", flags.autoFix)
+	}
+	var sb *sandbox
+	if flags.useSandbox {
+		if flags.printOnly || p.script || flags.tmuxPane.set {
+			return errors.New("-sandbox can't be combined with -print, -script or -tmux")
+		}
+		if !p.shell.bash() {
+			return fmt.Errorf("-sandbox runs commands in Bash; it can't be used with -shell %s", p.shell.name)
+		}
+		if sb, err = newSandbox(cfg.SandboxRuntime, cfg.SandboxImage); err != nil {
+			return err
+		}
+	}
+	if flags.fix {
+		if p.output, err = readPipedOutput(); err != nil {
+			return err
+		}
+	}
+	ptt, err := newPushToTalk(flags.pushToTalkKey)
+	if err != nil {
+		return err
+	}
+
+	captureOpts, err := captureOptions(record.DefaultOptions, opts.MaxDuration, opts.Channel)
+	if err != nil {
+		return err
+	}
+	// A request given as arguments is taken as it is, without recording.
+	// Without a working microphone the request is typed instead.
+	request := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if request != "" && flags.fromAudio != "" {
+		return errors.New("-from-audio can't be combined with a request given as arguments")
+	}
+	var recorder microphone
+	var micErr error
+	if flags.noAudio {
+		micErr = errNoAudio
+	} else if request == "" && flags.fromAudio == "" {
+		var closeMicrophone func()
+		recorder, closeMicrophone, micErr = openMicrophone(captureOpts)
+		if micErr == nil {
+			defer closeMicrophone()
+		}
+	}
+
+	// Use a spinner to replicate the Halo spinner from Python
+	s := spinner.New(spinner.CharSets[11], 100*time.Millisecond, spinner.WithWriterFile(ui))
+	defer s.Stop()
+	input := newLineReader(os.Stdin)
+	p.chooseAnswer = func(answers []raceAnswer) (int, error) {
+		s.Stop()
+		defer s.Start()
+		return askAnswer(ui, input, answers)
+	}
+
+	var view *termView
+	if flags.live {
+		view = liveView(ui)
+	}
+
+	// Ctrl+C stops the recording in progress; outside of a recording it cancels
+	// the API request in flight.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var stopMu sync.Mutex
+	var stopCurrent func()
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, shutdownSignals...)
+	go func() {
+		for range c {
+			stopMu.Lock()
+			stopRecording := stopCurrent
+			stopMu.Unlock()
+			if stopRecording != nil {
+				stopRecording()
+			} else {
+				cancel()
+			}
+		}
+	}()
+
+	// With -stream, stream is the transcription of the latest recording.
+	// Otherwise chunks transcribes it as it goes, once it is long enough;
+	// not with -estimate, which asks before anything is sent.
+	var stream *streamingTranscript
+	var chunks *chunkedTranscript
+
+	// recordRequest records until the user hits Enter OR presses Ctrl+C, or
+	// while the push-to-talk key is held.
+	recordRequest := func() (*record.Recording, error) {
+		stop := make(chan struct{})
+		var stopOnce sync.Once
+		stopRecording := func() { stopOnce.Do(func() { close(stop) }) }
+		stopMu.Lock()
+		stopCurrent = stopRecording
+		stopMu.Unlock()
+		defer func() {
+			stopMu.Lock()
+			stopCurrent = nil
+			stopMu.Unlock()
+		}()
+
+		controls := ptt == nil && canUseControls(input)
+		hint := "Enter to stop, x Enter to discard"
+		switch {
+		case ptt != nil:
+			hint = ptt.hint()
+		case controls:
+			hint = controlsHint
+		}
+		switch {
+		case p.realtime != nil:
+			stream = p.startStream(ctx, recorder.Options())
+		case !flags.estimate:
+			chunks = p.startChunks(ctx, recorder.Options())
+		}
+		// capture records until stop is closed, by stopCapture if need be.
+		capture := func(stop <-chan struct{}, stopCapture func()) (*record.Recording, error) {
+			if view == nil {
+				s.Suffix = " Recording"
+				s.Start()
+				switch {
+				case stream != nil:
+					return recorder.RecordFunc(stop, stream.onChunk)
+				case chunks != nil:
+					return recorder.RecordFunc(stop, chunks.onChunk)
+				}
+				return recorder.Record(stop)
+			}
+			live := newLiveRecording(p, view, recorder.Options(), hint, stream)
+			done := make(chan struct{})
+			go func() {
+				live.run(stop)
+				close(done)
+			}()
+			onChunk := live.onChunk
+			if chunks != nil {
+				onChunk = func(chunk []int16) {
+					live.onChunk(chunk)
+					chunks.onChunk(chunk)
+				}
+			}
+			rec, err := recorder.RecordFunc(stop, onChunk)
+			stopCapture()
+			<-done
+			return rec, err
+		}
+		if ptt != nil {
+			return ptt.record(ui, stop, stopRecording, func() (*record.Recording, error) { return capture(stop, stopRecording) })
+		}
+		if controls {
+			if view == nil {
+				fmt.Fprintln(ui, hint+".")
+			}
+			return recordWithControls(stop, recorder.Options().MaxDuration, capture, func() {
+				if view == nil {
+					s.Suffix = " Paused (space to resume, Enter to stop)"
+					s.Start()
+				} else {
+					fmt.Fprint(ui, "Paused (space to resume, Enter to stop)\r\n")
+				}
+			})
+		}
+
+		discarded := false
+		go func() {
+			select {
+			case res := <-input.next():
+				input.consumed()
+				discarded = strings.TrimSpace(res.line) == "x"
+				stopRecording()
+			case <-stop:
+			}
+		}()
+		rec, err := capture(stop, stopRecording)
+		// A recording that stopped at its limit leaves the read for Enter pending.
+		stopRecording()
+		if err == nil && discarded {
+			return nil, errDiscarded
+		}
+		return rec, err
+	}
+
+	transcribedText := request
+	// The request is typed unless it is recorded or read from an audio file.
+	from := typedRequest
+	if flags.fromAudio != "" || recorder != nil && request == "" {
+		from = spokenRequest
+	}
+	if flags.fromAudio != "" {
+		audio, filename, length, err := p.loadAudioFile(flags.fromAudio)
+		if err != nil {
+			return err
+		}
+		s.Suffix = " Transcribing audio..."
+		s.Start()
+		start := time.Now()
+		transcribedText, err = p.upload(ctx, audio, filename, length)
+		p.timing.since(phaseTranscribe, start)
+		s.Stop()
+		if unsure, ok := unsureTranscript(err); ok {
+			// There is no recording again from a file; asking for it gives up.
+			fmt.Fprintf(ui, "The transcription is only %.0f%% sure of what it heard (see -min-confidence).", 100*unsure.confidence)
+			text, again, err := confirmTranscription(ui, input, transcribedText)
+			if err != nil {
+				return err
+			}
+			if again {
+				return &exitStatus{code: exitAborted}
+			}
+			transcribedText = text
+		} else if err != nil {
+			return exitWith(exitTranscription, cancelled(ui, err))
+		} else if nothing, ok := nothingHeard(checkTranscript(transcribedText)); ok {
+			fmt.Fprintf(ui, "Didn't catch a request in %s: %s.\n", flags.fromAudio, nothing.reason)
+			return &exitStatus{code: exitAborted}
+		} else {
+			fmt.Fprintf(ui, "Heard: %s\n", transcribedText)
+		}
+	} else if recorder == nil && request == "" {
+		if note := typingNote(micErr); note != "" {
+			fmt.Fprintln(ui, note)
+		}
+		transcribedText, err = readRequest(ui, input)
+		if err != nil {
+			return err
+		}
+		if transcribedText == "" {
+			fmt.Fprintln(ui, "Nothing to do.")
+			return &exitStatus{code: exitAborted}
+		}
+	}
+	// recordAgain offers to record again after err, a nothingHeardError, and
+	// returns what to exit with if the user doesn't want to.
+	recordAgain := func(err error) (bool, error) {
+		s.Stop()
+		nothing, _ := nothingHeard(err)
+		again, err := offerRecordAgain(ui, input, nothing)
+		if err != nil {
+			return false, err
+		}
+		if !again {
+			fmt.Fprintln(ui, "Nothing to do.")
+			return false, &exitStatus{code: exitAborted}
+		}
+		if chunks != nil {
+			chunks.close()
+		}
+		return true, nil
+	}
+	// A retake's stream or chunks are closed before the next recording
+	// starts, and the last ones when done.
+	closeTranscripts := func() {
+		if stream != nil {
+			stream.close()
+		}
+		if chunks != nil {
+			chunks.close()
+		}
+	}
+	defer closeTranscripts()
+	for recorder != nil && request == "" {
+		closeTranscripts()
+		recording, err := recordRequest()
+		if errors.Is(err, errDiscarded) {
+			s.Stop()
+			fmt.Fprintln(ui, "Recording discarded.")
+			return &exitStatus{code: exitAborted}
+		}
+		if errors.Is(err, errRetake) {
+			if chunks != nil {
+				chunks.close()
+			}
+			s.Stop()
+			fmt.Fprintln(ui, "Starting over.")
+			continue
+		}
+		if err != nil {
+			s.Stop()
+			return cancelled(ui, err)
+		}
+		p.timing.add(phaseRecord, recording.Duration())
+		if recording.Truncated {
+			s.Stop()
+			ok, err := confirmTruncated(ui, input, captureOpts.MaxDuration)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				fmt.Fprintln(ui, "Recording discarded.")
+				return &exitStatus{code: exitAborted}
+			}
+		}
+		// A recording with hardly any speech in it isn't worth transcribing.
+		if err := p.checkSpeech(recording); err != nil {
+			if again, err := recordAgain(err); !again {
+				return err
+			}
+			continue
+		}
+		if flags.estimate {
+			s.Stop()
+			send, err := confirmEstimate(ui, input, p.estimateCost(recording.Duration()))
+			if err != nil {
+				return err
+			}
+			if !send {
+				fmt.Fprintln(ui, "Nothing was sent.")
+				return &exitStatus{code: exitAborted}
+			}
+			s.Start()
+		}
+
+		// Transcription request
+		s.Suffix = " Transcribing audio..."
+		s.Start()
+		if stream != nil {
+			transcribedText, err = p.finishStream(ctx, stream, recording)
+			if err != nil && ctx.Err() == nil {
+				s.Stop()
+				fmt.Fprintf(ui, "Failed to stream the audio for transcription: %v\nUploading the recording instead.\n", err)
+				s.Start()
+				transcribedText, err = p.transcribe(ctx, recording)
+			}
+		} else if chunks != nil {
+			transcribedText, err = chunks.finish(ctx, recording)
+			if _, unsure := unsureTranscript(err); err != nil && !unsure && ctx.Err() == nil && chunks.split() {
+				s.Stop()
+				fmt.Fprintf(ui, "Failed to transcribe the recording in parts: %v\nUploading it in one piece instead.\n", err)
+				s.Start()
+				transcribedText, err = p.transcribe(ctx, recording)
+			}
+		} else {
+			transcribedText, err = p.transcribe(ctx, recording)
+		}
+		// A transcript the transcription isn't sure of is checked like one
+		// with -confirm-transcript.
+		unsure, isUnsure := unsureTranscript(err)
+		if isUnsure {
+			err = nil
+		}
+		if err != nil {
+			s.Stop()
+			return exitWith(exitTranscription, cancelled(ui, err))
+		}
+		if err := checkTranscript(transcribedText); err != nil {
+			if again, err := recordAgain(err); !again {
+				return err
+			}
+			continue
+		}
+		if !flags.confirmTranscript && !isUnsure {
+			break
+		}
+
+		s.Stop()
+		if isUnsure {
+			fmt.Fprintf(ui, "\nThe transcription is only %.0f%% sure of what it heard (see -min-confidence).", 100*unsure.confidence)
+		}
+		text, again, err := confirmTranscription(ui, input, transcribedText)
+		if err != nil {
+			return err
+		}
+		if !again {
+			transcribedText = text
+			break
+		}
+	}
+
+	// Send transcribed text to the chat model to get a Bash command
+	// A request like one answered before gets the command it got then, if
+	// the user wants it.
+	var generated *generate.Response
+	if !flags.noCache && p.embedder != nil && p.output == nil && !p.script {
+		s.Suffix = " Looking for earlier requests like this one..."
+		s.Start()
+		cached, err := p.findCached(ctx, transcribedText)
+		s.Stop()
+		switch {
+		case errors.Is(err, context.Canceled):
+			return cancelled(ui, err)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Failed to look for earlier requests like this one: %v (-no-cache skips this)\n", err)
+		case len(cached) > 0 && pk != nil:
+			picked, err := pickCached(pk, cached)
+			if err != nil {
+				return err
+			}
+			if picked != nil {
+				generated = &generate.Response{Command: picked.entry.Command}
+			}
+		case len(cached) > 0:
+			use, err := offerCached(ui, input, &cached[0])
+			if err != nil {
+				return err
+			}
+			if use {
+				generated = &generate.Response{Command: cached[0].entry.Command}
+			}
+		}
+	}
+
+	// The command from the history already ran, so it needs no checking.
+	var notes []string
+	if generated == nil {
+		s.Suffix = " Generating command..."
+		s.Start()
+		generated, err = p.generate(ctx, transcribedText, from, nil)
+		if errors.Is(err, errChatter) {
+			s.Stop()
+			fmt.Fprintf(ui, "\nIgnoring %q: %v\n", transcribedText, err)
+			return &exitStatus{code: exitGeneration}
+		}
+		if err != nil {
+			s.Stop()
+			return exitWith(exitGeneration, cancelled(ui, err))
+		}
+		if p.lintMode != lintOff || p.toolMode == lintFix {
+			s.Suffix = " Checking command..."
+		}
+		toolNotes := p.checkTools(ctx, transcribedText, nil, generated)
+		notes = append(lintNotes(p.lint(ctx, transcribedText, nil, generated)), toolNotes...)
+	}
+	// Stop the spinner and print the result
+	s.Stop()
+	p.finishRun(ui)
+	// From here on Ctrl+C should behave as usual again.
+	signal.Stop(c)
+
+	if flags.scriptPath != "" {
+		entry := newHistoryEntry(transcribedText, generated.Command)
+		entry.Accepted, err = writeScript(ui, input, flags.scriptPath, generated.Command, notes, flags.editScript)
+		recordHistory(entry)
+		return err
+	}
+	if len(generated.Placeholders) > 0 {
+		generated.Command, err = fillPlaceholders(ui, input, generated.Command, generated.Placeholders, p.shell)
+		if err != nil {
+			return cancelled(ui, err)
+		}
+		if left := generate.FindPlaceholders(generated.Command); len(left) > 0 {
+			notes = append(notes, "Still to fill in: <"+strings.Join(left, ">, <")+">")
+		}
+	}
+	cleanCommand := generated.Command
+
+	entry := newHistoryEntry(transcribedText, cleanCommand)
+
+	verdict := checkCommand(generated)
+	notes = commandNotes(generated, notes)
+	p.speak(ctx, generated)
+	if flags.copyCommand {
+		if via, err := copyToClipboard(cleanCommand); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to copy the command: %v\n", err)
+		} else {
+			fmt.Fprintf(ui, "\nCopied to the clipboard (via %s).\n", via)
+		}
+	}
+	if flags.showQR {
+		printQR(ui, cleanCommand)
+	}
+	if flags.tmuxPane.set {
+		for _, note := range notes {
+			fmt.Fprintln(ui, note)
+		}
+		if flags.whatIf {
+			printEffects(ui, cleanCommand)
+		}
+		if verdict.Level > safety.Safe {
+			fmt.Fprintf(ui, "Warning (%s): this command %s.\n", verdict.Level, strings.Join(verdict.Reasons, ", "))
+		}
+		printRootNote(ui, p.rootCheck(ctx, transcribedText, nil, generated), cleanCommand)
+		if flags.printOnly {
+			fmt.Println(cleanCommand)
+		} else {
+			fmt.Fprintf(ui, "\n%s\n", cleanCommand)
+		}
+		pane, err := sendToTmux(flags.tmuxPane.target, cleanCommand)
+		if err != nil {
+			return fmt.Errorf("failed to type the command into tmux: %w", err)
+		}
+		fmt.Fprintf(ui, "Typed into tmux pane %s; press Enter there to run it.\n", pane)
+		recordHistory(entry)
+		return nil
+	}
+	if flags.printOnly {
+		for _, note := range notes {
+			fmt.Fprintln(ui, note)
+		}
+		if flags.whatIf {
+			printEffects(ui, cleanCommand)
+		}
+		if verdict.Level > safety.Safe {
+			fmt.Fprintf(ui, "Warning (%s): this command %s.\n", verdict.Level, strings.Join(verdict.Reasons, ", "))
+		}
+		printRootNote(ui, p.rootCheck(ctx, transcribedText, nil, generated), cleanCommand)
+		fmt.Println(cleanCommand)
+		recordHistory(entry)
+		return nil
+	}
+
+	// With -auto-fix, a command that fails is followed by a fix, reviewed
+	// like the command was, until one works or the fixes run out.
+	for fixes := 0; ; fixes++ {
+		run, err := reviewCommand(input, &entry, notes, verdict, flags.whatIf, flags.learn, sb, p.rootCheck(ctx, transcribedText, nil, generated))
+		if err != nil {
+			return err
+		}
+		cleanCommand = entry.Command
+
+		if !run {
+			recordHistory(entry)
+			fmt.Println("Command not executed.")
+			if entry.Edited {
+				verdict = safety.Check(cleanCommand)
+			}
+			if verdict.Level == safety.Dangerous {
+				return &exitStatus{code: exitUnsafe}
+			}
+			return &exitStatus{code: exitAborted}
+		}
+
+		entry.Accepted = true
+		entry.Undo = undoFor(entry, generated, p.shell)
+		fmt.Printf("\n")
+		cmd := p.shell.command(cleanCommand)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		// Capturing means the command no longer writes to a terminal, so only do it when asked.
+		var output, stderr *outputCapture
+		if flags.summarize {
+			output = &outputCapture{}
+			cmd.Stdout = io.MultiWriter(os.Stdout, output)
+			cmd.Stderr = io.MultiWriter(os.Stderr, output)
+		}
+		if flags.autoFix > 0 {
+			stderr = &outputCapture{}
+			cmd.Stderr = io.MultiWriter(cmd.Stderr, stderr)
+		}
+		err = cmd.Run()
+		exitCode := cmd.ProcessState.ExitCode()
+		entry.ExitCode = &exitCode
+		recordHistory(entry)
+		if output != nil {
+			offerSummary(p, input, cleanCommand, output)
+		}
+		if err == nil {
+			return nil
+		}
+		// A command that couldn't start, or was killed, has nothing to fix.
+		if exitCode <= 0 || fixes == flags.autoFix {
+			return fmt.Errorf("failed to execute command: %w", err)
+		}
+
+		s.Suffix = fmt.Sprintf(" Exit status %d, asking for a fix (%d of %d)...", exitCode, fixes+1, flags.autoFix)
+		s.Start()
+		fixed, fixErr := p.fixFailed(ctx, transcribedText, cleanCommand, exitCode, stderr)
+		if fixErr == nil {
+			toolNotes := p.checkTools(ctx, transcribedText, nil, fixed)
+			notes = append(lintNotes(p.lint(ctx, transcribedText, nil, fixed)), toolNotes...)
+		}
+		s.Stop()
+		if fixErr != nil {
+			fmt.Fprintf(os.Stderr, "Failed to fix the command: %v\n", fixErr)
+			return fmt.Errorf("failed to execute command: %w", err)
+		}
+		if fixed.Command == cleanCommand {
+			fmt.Println("\nThe model has no other command to offer.")
+			return fmt.Errorf("failed to execute command: %w", err)
+		}
+		fmt.Printf("\nThe command failed with exit status %d. Fix %d of %d:\n", exitCode, fixes+1, flags.autoFix)
+		generated = fixed
+		entry = newHistoryEntry(transcribedText, fixed.Command)
+		verdict = checkCommand(fixed)
+		notes = commandNotes(fixed, notes)
+	}
+}
+
+// reviewCommand shows the command of entry, with notes about it, and asks
+// whether to run it. The user may edit it first, in which case entry is updated,
+// the notes dropped and, with learn, the edit remembered as a convention of the
+// current project. With a sandbox, each version of the command is previewed
+// in it first; with whatIf, what it would do is shown. Commands that need
+// root, as root tells, come with the offer to add sudo or find a way without.
+func reviewCommand(input *lineReader, entry *history.Entry, notes []string, verdict safety.Verdict, whatIf, learn bool, sb *sandbox, root *rootCheck) (bool, error) {
+	previewed := ""
+	for {
+		if sb != nil && entry.Command != previewed {
+			sb.preview(entry.Command)
+			previewed = entry.Command
+		}
+		fmt.Printf("\n%s\n\n", entry.Command)
+		for _, note := range notes {
+			fmt.Println(note)
+		}
+		if len(notes) > 0 {
+			fmt.Println()
+		}
+		if whatIf {
+			printEffects(os.Stdout, entry.Command)
+			fmt.Println()
+		}
+		if verdict.Level > safety.Safe {
+			fmt.Printf("Warning (%s): this command %s.\n\n", verdict.Level, strings.Join(verdict.Reasons, ", "))
+		}
+		rootReasons := root.reasons(entry.Command)
+		if len(rootReasons) > 0 {
+			fmt.Printf("This command needs root, as it %s. Answer 's' to run it with sudo, or 'r' for a way without root.\n\n", strings.Join(rootReasons, ", "))
+		}
+		if verdict.Level == safety.Dangerous {
+			fmt.Print("Type 'yes' to run this command, or 'e' to edit it: ")
+		} else if len(rootReasons) > 0 {
+			fmt.Print("Run this command? (Y/n/e to edit/s for sudo/r for rootless): ")
+		} else {
+			fmt.Print("Run this command? (Y/n/e to edit): ")
+		}
+
+		response, err := input.ReadLine()
+		if err != nil {
+			return false, fmt.Errorf("failed to read user input: %w", err)
+		}
+		var edited string
+		switch answer := strings.ToLower(strings.TrimSpace(response)); {
+		case answer == "e":
+			if edited, err = editText(entry.Command, ".sh"); err != nil {
+				return false, err
+			}
+			if learn && edited != "" && edited != entry.Command {
+				learnFromEdit(entry.Command, edited)
+			}
+		case answer == "s" && len(rootReasons) > 0:
+			edited = withSudo(entry.Command)
+		case answer == "r" && len(rootReasons) > 0:
+			fmt.Println("Asking for a way without root...")
+			if edited, err = root.rootless(entry.Command, rootReasons); err != nil {
+				fmt.Printf("Failed to get one: %v\n", err)
+			}
+		default:
+			return confirmed(response, verdict.Level), nil
+		}
+		if edited != "" && edited != entry.Command {
+			entry.Command = edited
+			entry.Edited = true
+			notes = nil
+			verdict = safety.Check(edited)
+			// What the model said is about the command it gave.
+			if root != nil {
+				root = &rootCheck{rootless: root.rootless}
+			}
+		}
+	}
+}
+
+// readRequest asks for the request to be typed, for when it can't be spoken.
+func readRequest(ui io.Writer, input *lineReader) (string, error) {
+	fmt.Fprint(ui, "Type your request: ")
+	line, err := input.ReadLine()
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read user input: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// confirmTranscription shows the transcript and lets the user accept it, type
+// a correction, edit it, or ask to record again.
+func confirmTranscription(ui io.Writer, input *lineReader, transcript string) (text string, again bool, err error) {
+	for {
+		fmt.Fprintf(ui, "\nHeard: %s\n", transcript)
+		fmt.Fprint(ui, "Enter to continue, type a correction, 'e' to edit or 'r' to record again: ")
+		line, err := input.ReadLine()
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read user input: %w", err)
+		}
+		switch line = strings.TrimSpace(line); line {
+		case "":
+			return transcript, false, nil
+		case "r", "R":
+			return "", true, nil
+		case "e", "E":
+			edited, err := editText(transcript, ".txt")
+			if err != nil {
+				return "", false, err
+			}
+			if edited != "" {
+				transcript = edited
+			}
+		default:
+			transcript = line
+		}
+	}
+}
+
+// cancelled reports an API call interrupted with Ctrl+C as such, rather than
+// as an error, and exits with exitAborted.
+func cancelled(ui io.Writer, err error) error {
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(ui, "\nCancelled.")
+		return &exitStatus{code: exitAborted}
+	}
+	return err
+}
+
+func newHistoryEntry(transcript, command string) history.Entry {
+	dir, _ := os.Getwd()
+	project, _ := gitRoot()
+	return history.Entry{Time: time.Now(), Transcript: transcript, Command: command, Dir: dir, Project: project}
+}
+
+// recordHistory appends e to the history, and to the audit log if there is
+// one. Failing to do so is reported but never fatal.
+func recordHistory(e history.Entry) {
+	if err := historyStore().Append(e); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save history: %v\n", err)
+	}
+	recordAudit(e)
+}
+
+// editText opens text in $VISUAL or $EDITOR and returns the edited text.
+func editText(text, ext string) (string, error) {
+	dir, err := tempDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	f, err := os.CreateTemp(dir, "edit-*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(text + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := editFile(f.Name()); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// editFile opens path in $VISUAL or $EDITOR and waits for the editor to exit.
+func editFile(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	cmd := editorCommand(editor, path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor failed: %w", err)
+	}
+	return nil
+}
+
+// learnFromEdit stores what the user's edit says about the current project's
+// conventions. Failing to do so is reported but never fatal.
+func learnFromEdit(generated, edited string) {
+	note, ok := prefs.Distill(generated, edited)
+	if !ok {
+		return
+	}
+	root := projectRoot()
+	if err := prefsStore(root).Add(root, note); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save preference: %v\n", err)
+		return
+	}
+	fmt.Printf("Noted for %s: %s\n", root, note)
+}
+
+// printQR draws command as a QR code on w. Failing to do so is reported but never fatal.
+func printQR(w io.Writer, command string) {
+	code, err := qr.Encode([]byte(command))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot show QR code: %v\n", err)
+		return
+	}
+	fmt.Fprintln(w)
+	code.WriteTerminal(w)
+}
+
+// checkCommand returns the safety verdict on a generated command: that of the
+// rules in package safety, made stricter by the model's own view of the risk.
+func checkCommand(generated *generate.Response) safety.Verdict {
+	verdict := safety.Check(generated.Command)
+	switch level, _ := safety.ParseLevel(generated.Danger); level {
+	case safety.Caution:
+		verdict = verdict.Raise(level, "looks risky to the model")
+	case safety.Dangerous:
+		verdict = verdict.Raise(level, "looks dangerous to the model")
+	}
+	if generated.NeedsSudo && !strings.Contains(generated.Command, "sudo") {
+		verdict = verdict.Raise(safety.Caution, "needs root privileges")
+	}
+	return verdict
+}
+
+// commandNotes puts the model's explanation of a command ahead of notes.
+func commandNotes(generated *generate.Response, notes []string) []string {
+	if generated.Explanation == "" {
+		return notes
+	}
+	return append([]string{generated.Explanation}, notes...)
+}
+
+// confirmed interprets the answer to the run prompt. Dangerous commands need an explicit "yes".
+func confirmed(response string, level safety.Level) bool {
+	response = strings.ToLower(strings.TrimSpace(response))
+	if level == safety.Dangerous {
+		return response == "yes"
+	}
+	return response == "" || response == "y" || response == "yes"
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/pkg/safety"
+)
+
+// mcpProtocolVersions are the Model Context Protocol revisions the server
+// speaks, newest first.
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// mcpTool describes a tool to clients; InputSchema is a JSON Schema.
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// mcpContent is a block of a tool result. Only text is produced.
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+var mcpTools = []mcpTool{
+	{
+		Name:        "generate_bash_command",
+		Description: "Turn a request in plain language, e.g. \"find files larger than 1 GB modified this week\", into a single shell command. The command is returned, not run; a safety warning follows it when it is risky.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"request": map[string]any{"type": "string", "description": "what the command should do"},
+			},
+			"required": []string{"request"},
+		},
+	},
+	{
+		Name:        "explain_command",
+		Description: "Explain what a shell command does, part by part, and what it changes, deletes or sends over the network.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"command": map[string]any{"type": "string", "description": "the command to explain"},
+			},
+			"required": []string{"command"},
+		},
+	},
+}
+
+// mcpServer serves the pipeline as a Model Context Protocol server over stdio,
+// so MCP clients like desktop assistants and IDE agents can call into it.
+type mcpServer struct {
+	p *pipeline
+}
+
+// mcpFlags are the flags of mcp.
+type mcpFlags struct {
+	opts *options
+}
+
+func (f *mcpFlags) define(fs *flag.FlagSet, cfg *config) error {
+	var err error
+	if f.opts, err = addPipelineFlags(fs, cfg); err != nil {
+		return err
+	}
+	return nil
+}
+
+func runMCP(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("mcp", flag.ExitOnError)
+	var flags mcpFlags
+	if err := flags.define(fs, cfg); err != nil {
+		return err
+	}
+	opts := flags.opts
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s mcp [flags]\n\nServes the Model Context Protocol on stdin and stdout.\n\n", appName)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	// Clients may call tools concurrently.
+	if opts.Concurrency == "" {
+		opts.Concurrency = defaultServerConcurrency
+	}
+
+	p, err := newPipeline(opts)
+	if err != nil {
+		return err
+	}
+	s := &mcpServer{p: p}
+	conn := newRPCConn(os.Stdout, s.handle, "notifications/cancelled", "requestId")
+
+	ctx, stop := signal.NotifyContext(context.Background(), shutdownSignals...)
+	defer stop()
+	return conn.serve(ctx, os.Stdin)
+}
+
+func (s *mcpServer) handle(ctx context.Context, _ json.RawMessage, method string, params json.RawMessage) (any, *rpcError) {
+	switch method {
+	case "initialize":
+		var req struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(params, &req)
+		// Agree to the client's revision if it is one we speak, else offer ours.
+		version := mcpProtocolVersions[0]
+		if slices.Contains(mcpProtocolVersions, req.ProtocolVersion) {
+			version = req.ProtocolVersion
+		}
+		serverVersion := "(devel)"
+		if info, ok := debug.ReadBuildInfo(); ok {
+			serverVersion = info.Main.Version
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]string{"name": appName, "version": serverVersion},
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": mcpTools}, nil
+	case "tools/call":
+		var req struct {
+			Name      string            `json:"name"`
+			Arguments map[string]string `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		return s.callTool(ctx, req.Name, req.Arguments)
+	case "":
+		return nil, &rpcError{Code: rpcInvalidRequest, Message: "missing method"}
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: "unknown method " + method}
+	}
+}
+
+// callTool runs a tool. Failures of the tool itself are results flagged as
+// errors, for the model to see, rather than protocol errors.
+func (s *mcpServer) callTool(ctx context.Context, name string, args map[string]string) (any, *rpcError) {
+	switch name {
+	case "generate_bash_command":
+		request := strings.TrimSpace(args["request"])
+		if request == "" {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "request is required"}
+		}
+		generated, err := s.p.complete(ctx, request, nil)
+		if err != nil {
+			return toolError(err), nil
+		}
+		content := []mcpContent{{Type: "text", Text: generated.Command}}
+		if generated.Explanation != "" {
+			content = append(content, mcpContent{Type: "text", Text: generated.Explanation})
+		}
+		if verdict := checkCommand(generated); verdict.Level > safety.Safe {
+			content = append(content, mcpContent{Type: "text", Text: fmt.Sprintf("Warning (%s): this command %s.", verdict.Level, strings.Join(verdict.Reasons, ", "))})
+		}
+		return mcpToolResult{Content: content}, nil
+	case "explain_command":
+		command := strings.TrimSpace(args["command"])
+		if command == "" {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "command is required"}
+		}
+		explanation, err := s.p.explain(ctx, command)
+		if err != nil {
+			return toolError(fmt.Errorf("error explaining the command: %w", err)), nil
+		}
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: explanation}}}, nil
+	default:
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "unknown tool " + name}
+	}
+}
+
+func toolError(err error) mcpToolResult {
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMCP(t *testing.T) {
+	api := newFakeAPI(t, "ls -la")
+	s := &mcpServer{p: testPipeline(t, api)}
+	responses := rpcRoundTrip(t, s.handle,
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2025-03-26", "capabilities": {}, "clientInfo": {"name": "test", "version": "1"}}}`,
+		`{"jsonrpc": "2.0", "method": "notifications/initialized"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "tools/list"}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "tools/call", "params": {"name": "generate_bash_command", "arguments": {"request": "list the files"}}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "tools/call", "params": {"name": "explain_command", "arguments": {"command": "ls -la"}}}`,
+		`{"jsonrpc": "2.0", "id": 5, "method": "tools/call", "params": {"name": "generate_bash_command", "arguments": {}}}`,
+		`{"jsonrpc": "2.0", "id": 6, "method": "tools/call", "params": {"name": "rm_everything", "arguments": {}}}`,
+		`{"jsonrpc": "2.0", "id": 7, "method": "initialize", "params": {"protocolVersion": "1999-01-01"}}`,
+		`{"jsonrpc": "2.0", "id": 8, "method": "ping"}`,
+	)
+	if len(responses) != 8 {
+		t.Errorf("got %d responses, want 8, the notification unanswered: %v", len(responses), responses)
+	}
+
+	var initialized struct {
+		ProtocolVersion string         `json:"protocolVersion"`
+		Capabilities    map[string]any `json:"capabilities"`
+		ServerInfo      struct {
+			Name string `json:"name"`
+		} `json:"serverInfo"`
+	}
+	decodeResult(t, responses["1"], &initialized)
+	if initialized.ProtocolVersion != "2025-03-26" || initialized.Capabilities["tools"] == nil || initialized.ServerInfo.Name != appName {
+		t.Errorf("initialize = %+v", initialized)
+	}
+	decodeResult(t, responses["7"], &initialized)
+	if initialized.ProtocolVersion != mcpProtocolVersions[0] {
+		t.Errorf("initialize with an unknown revision agreed to %q, want %q", initialized.ProtocolVersion, mcpProtocolVersions[0])
+	}
+
+	var list struct {
+		Tools []mcpTool `json:"tools"`
+	}
+	decodeResult(t, responses["2"], &list)
+	if len(list.Tools) != 2 || list.Tools[0].Name != "generate_bash_command" || list.Tools[1].Name != "explain_command" {
+		t.Errorf("tools/list = %+v", list)
+	}
+	for _, tool := range list.Tools {
+		if tool.InputSchema["type"] != "object" {
+			t.Errorf("tool %s has input schema %v", tool.Name, tool.InputSchema)
+		}
+	}
+
+	var generated mcpToolResult
+	decodeResult(t, responses["3"], &generated)
+	if generated.IsError || len(generated.Content) == 0 || generated.Content[0].Text != "ls -la" {
+		t.Errorf("generate_bash_command = %+v", generated)
+	}
+	if sent := api.sent(); !strings.Contains(sent, "user: list the files") {
+		t.Errorf("the model was sent:\n%s", sent)
+	}
+	var explained mcpToolResult
+	decodeResult(t, responses["4"], &explained)
+	if explained.IsError || len(explained.Content) != 1 || explained.Content[0].Text == "" {
+		t.Errorf("explain_command = %+v", explained)
+	}
+
+	for _, id := range []string{"5", "6"} {
+		if err := responses[id].Error; err == nil || err.Code != rpcInvalidParams {
+			t.Errorf("response %s = %+v, want an invalid params error", id, responses[id])
+		}
+	}
+	var pong map[string]any
+	decodeResult(t, responses["8"], &pong)
+}
+
+func TestMCPToolError(t *testing.T) {
+	api := newFakeAPI(t, "ls -la")
+	s := &mcpServer{p: testPipeline(t, api, "-max-attempts", "1")}
+	api.Close()
+	responses := rpcRoundTrip(t, s.handle,
+		`{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "generate_bash_command", "arguments": {"request": "list the files"}}}`)
+	var result mcpToolResult
+	decodeResult(t, responses["1"], &result)
+	if !result.IsError || len(result.Content) == 0 {
+		t.Errorf("tools/call with the API down = %+v, want a result flagged as an error", result)
+	}
+}
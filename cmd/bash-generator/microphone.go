@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/capability"
+	"github.com/jerilseb/bash-generator/internal/capture"
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+// microphone records from the default input device, either in this process or
+// through the capture helper.
+type microphone interface {
+	Options() record.Options
+	Record(stop <-chan struct{}) (*record.Recording, error)
+	RecordFunc(stop <-chan struct{}, onChunk func(chunk []int16)) (*record.Recording, error)
+}
+
+// captureHelperEnv names the capture helper to use instead of recording in
+// this process, e.g. one built for a different audio system.
+const captureHelperEnv = "BASH_GENERATOR_CAPTURE"
+
+// recordingLimit caps -max-duration. Ten minutes stays under OpenAI's upload
+// limit in every format recordings are uploaded in, and keeps a recording
+// that was left running from taking more than a few tens of megabytes.
+const recordingLimit = 10 * time.Minute
+
+// limitRecording returns opts with recordings stopping after max, or after
+// recordingLimit if max is zero.
+func limitRecording(opts record.Options, max time.Duration) (record.Options, error) {
+	switch {
+	case max == 0:
+		max = recordingLimit
+	case max < 0 || max > recordingLimit:
+		return opts, fmt.Errorf("invalid -max-duration %s: at most %s is allowed", max, recordingLimit)
+	}
+	opts.MaxDuration = max
+	return opts, nil
+}
+
+// captureOptions returns base with recordings stopping after max, see
+// limitRecording, and taking only the input channel picked with -channel, if
+// any.
+func captureOptions(base record.Options, max time.Duration, channel int) (record.Options, error) {
+	if channel < 0 {
+		return base, fmt.Errorf("invalid -channel %d: channels count from 1", channel)
+	}
+	base.Channel = channel
+	return limitRecording(base, max)
+}
+
+// confirmTruncated tells the user the recording reached its length limit and
+// asks whether to transcribe it anyway. Asking also takes the Enter that was
+// meant to stop the recording, so it can't answer a later question.
+func confirmTruncated(ui io.Writer, input *lineReader, limit time.Duration) (bool, error) {
+	fmt.Fprintf(ui, "\nRecording stopped at the %s limit (see -max-duration). Transcribe it? (Y/n): ", limit)
+	response, err := input.ReadLine()
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read user input: %w", err)
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "" || response == "y" || response == "yes", nil
+}
+
+// errNoAudio stands in for the microphone with -no-audio.
+var errNoAudio = errors.New("-no-audio is set")
+
+// typingNote explains why requests have to be typed, given the error opening
+// the microphone. -no-audio asked for it, so that needs no explanation.
+func typingNote(err error) string {
+	switch {
+	case errors.Is(err, errNoAudio):
+		return ""
+	case errors.Is(err, record.ErrNoInputDevice):
+		return "No microphone found (-no-audio skips looking for one)."
+	default:
+		return fmt.Sprintf("Cannot record: %v", err)
+	}
+}
+
+// openMicrophone opens the default input device with opts. The returned
+// function releases it.
+func openMicrophone(opts record.Options) (microphone, func(), error) {
+	open := openDevice
+	if os.Getenv(captureHelperEnv) != "" {
+		open = openCaptureHelper
+	}
+	start := time.Now()
+	mic, closeMicrophone, err := open(opts)
+	if err != nil {
+		slog.Warn("microphone unavailable", "err", err)
+		return nil, nil, err
+	}
+	o := mic.Options()
+	slog.Info("microphone opened", "sample_rate", o.SampleRate, "channels", o.Channels,
+		"frames_per_chunk", o.FramesPerChunk, "max_duration", o.MaxDuration, "took", time.Since(start))
+	return mic, closeMicrophone, nil
+}
+
+// openCaptureHelper starts the capture helper, see internal/capture.
+func openCaptureHelper(opts record.Options) (microphone, func(), error) {
+	path, err := captureHelperPath()
+	if err != nil {
+		return nil, nil, err
+	}
+	helper, err := capture.Start(path, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return helper, func() { helper.Close() }, nil
+}
+
+// captureHelperDevices lists the devices the capture helper can record from.
+func captureHelperDevices() ([]record.Device, error) {
+	path, err := captureHelperPath()
+	if err != nil {
+		return nil, err
+	}
+	return capture.InputDevices(path)
+}
+
+// captureHelperPath finds the capture helper: $BASH_GENERATOR_CAPTURE, then
+// next to this executable, as release archives ship it, then on PATH.
+func captureHelperPath() (string, error) {
+	if path := os.Getenv(captureHelperEnv); path != "" {
+		return path, nil
+	}
+	name := "bash-generator-capture"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	if exe, err := os.Executable(); err == nil {
+		path := filepath.Join(filepath.Dir(exe), name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return capability.Require("capture")
+}
@@ -0,0 +1,30 @@
+//go:build cgo
+
+package main
+
+import "github.com/jerilseb/bash-generator/pkg/record"
+
+// openDevice records in this process through PortAudio.
+func openDevice(opts record.Options) (microphone, func(), error) {
+	if err := record.Init(); err != nil {
+		return nil, nil, err
+	}
+	recorder, err := record.OpenWith(opts)
+	if err != nil {
+		record.Terminate()
+		return nil, nil, err
+	}
+	return recorder, func() {
+		recorder.Close()
+		record.Terminate()
+	}, nil
+}
+
+// inputDevices lists the devices PortAudio can record from.
+func inputDevices() ([]record.Device, error) {
+	if err := record.Init(); err != nil {
+		return nil, err
+	}
+	defer record.Terminate()
+	return record.InputDevices()
+}
@@ -0,0 +1,15 @@
+//go:build !cgo
+
+package main
+
+import "github.com/jerilseb/bash-generator/pkg/record"
+
+// openDevice records through the capture helper, as PortAudio needs cgo.
+func openDevice(opts record.Options) (microphone, func(), error) {
+	return openCaptureHelper(opts)
+}
+
+// inputDevices asks the capture helper for the devices it can record from.
+func inputDevices() ([]record.Device, error) {
+	return captureHelperDevices()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/models"
+)
+
+// modelCache returns the shared cache of local models, with the registry
+// extended by the models defined in cfg.
+func modelCache(cfg *config) *models.Cache {
+	return &models.Cache{
+		Dir:    filepath.Join(cacheDir(), "models"),
+		Models: append(append([]models.Model{}, models.Builtin...), cfg.Models...),
+		Progress: func(name string, done, total int64) {
+			if total > 0 {
+				fmt.Fprintf(os.Stderr, "\rDownloading %s: %3d%%", name, done*100/total)
+			} else {
+				fmt.Fprintf(os.Stderr, "\rDownloading %s: %d MB", name, done>>20)
+			}
+		},
+	}
+}
+
+// modelClient returns the client models are downloaded with: through proxy
+// if given, and with localOnly to nowhere but this machine.
+func modelClient(proxy string, localOnly bool) (*http.Client, error) {
+	t, err := newTransport(proxy)
+	if err != nil {
+		return nil, err
+	}
+	if localOnly {
+		localOnlyTransport(t, proxy)
+	}
+	return &http.Client{Transport: &loggingTransport{base: t}}, nil
+}
+
+// modelsFlags are the flags of models.
+type modelsFlags struct {
+	proxy     string
+	localOnly bool
+}
+
+func (f *modelsFlags) define(fs *flag.FlagSet, cfg *config) {
+	fs.StringVar(&f.proxy, "proxy", cfg.Proxy, "download models through this proxy instead of the one in HTTPS_PROXY")
+	fs.BoolVar(&f.localOnly, "local-only", cfg.LocalOnly, "only download models from a mirror on this machine")
+}
+
+func runModels(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("models", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s models [-proxy url] [-local-only] list | pull <name>... | rm <name>... | remote\n", appName)
+		fs.PrintDefaults()
+	}
+	var flags modelsFlags
+	flags.define(fs, cfg)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cache := modelCache(cfg)
+	if cache.HTTPClient, err = modelClient(flags.proxy, flags.localOnly); err != nil {
+		return err
+	}
+
+	names := fs.Args()[1:]
+	switch fs.Arg(0) {
+	case "list", "ls":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tKIND\tSTATUS")
+		for _, m := range cache.Sorted() {
+			status := "-"
+			if cache.Installed(m) {
+				status = fmt.Sprintf("installed (%d MB)", cache.Size(m)>>20)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", m.Name, m.Kind, status)
+		}
+		return w.Flush()
+	case "pull":
+		if len(names) == 0 {
+			return errors.New("no model given")
+		}
+		for _, name := range names {
+			m, ok := cache.Lookup(name)
+			if !ok {
+				return fmt.Errorf("unknown model %q (see `%s models list`)", name, appName)
+			}
+			// A model can still be pulled from a mirror on this machine.
+			if flags.localOnly {
+				if err := requireLocal("the download of "+name, m.URL); err != nil {
+					return err
+				}
+				if flags.proxy != "" {
+					if err := requireLocal("the download of "+name+" through -proxy", flags.proxy); err != nil {
+						return err
+					}
+				}
+			}
+			err := cache.Pull(context.Background(), m)
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return err
+			}
+			fmt.Println(cache.Path(m))
+		}
+		return nil
+	case "rm":
+		if len(names) == 0 {
+			return errors.New("no model given")
+		}
+		for _, name := range names {
+			m, ok := cache.Lookup(name)
+			if !ok {
+				return fmt.Errorf("unknown model %q (see `%s models list`)", name, appName)
+			}
+			if err := cache.Remove(m); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", name, err)
+			}
+		}
+		return nil
+	case "remote":
+		return listRemoteModels(cfg, cache.HTTPClient, flags.localOnly)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+// listRemoteModels prints the chat models of the configured backend, marking
+// the one commands are generated with. The request goes through client.
+func listRemoteModels(cfg *config, client *http.Client, localOnly bool) error {
+	ep, err := resolveEndpoint(endpointOptions{Config: cfg})
+	if err != nil {
+		return err
+	}
+	if localOnly {
+		if err := requireLocal("the request for models", ep.ChatURL); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	g := ep.generator()
+	g.HTTPClient = client
+	names, err := g.Models(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list the %s models: %w", ep.Backend, err)
+	}
+	for _, name := range names {
+		if name == ep.ChatModel {
+			fmt.Println(name, "(configured)")
+		} else {
+			fmt.Println(name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+// defaultMinSpeech is how much speech a recording needs by default to be
+// transcribed; even "ls" takes longer to say.
+const defaultMinSpeech = 300 * time.Millisecond
+
+// nothingHeardError is returned for a recording, or its transcript, with no
+// request in it, so that it isn't sent on.
+type nothingHeardError struct {
+	reason string
+}
+
+func (e *nothingHeardError) Error() string {
+	return "didn't catch a request: " + e.reason
+}
+
+// nothingHeard returns why nothing was heard, if that is what err says.
+func nothingHeard(err error) (*nothingHeardError, bool) {
+	var nothing *nothingHeardError
+	ok := errors.As(err, &nothing)
+	return nothing, ok
+}
+
+var (
+	// fillerSound matches hesitations however long they are drawn out, like
+	// "ummm" and "hmm".
+	fillerSound = regexp.MustCompile(`^(u+h*m*|u+m+|e+r+m*|a+h+|e+h+|h+m+|m+h*m+|o+h+|huh)$`)
+	// soundTag matches what Whisper writes for sounds that aren't speech, like
+	// "[BLANK_AUDIO]", "(music)" and "♪".
+	soundTag = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)|\*[^*]*\*|[♪♫]`)
+)
+
+// fillerWords go with fillerSound in filler, but are words.
+var fillerWords = map[string]bool{
+	"like": true, "so": true, "well": true, "okay": true, "ok": true, "yeah": true, "right": true, "uh-huh": true,
+}
+
+// checkSpeech returns a nothingHeardError for a recording with less than
+// minSpeech of speech in it, going by how much of it is louder than
+// speechLevel.
+func (p *pipeline) checkSpeech(rec *record.Recording) error {
+	if p.minSpeech == 0 {
+		return nil
+	}
+	if speech := rec.SpeechDuration(speechLevel); speech < p.minSpeech {
+		if speech == 0 {
+			return &nothingHeardError{reason: "the recording is silent"}
+		}
+		return &nothingHeardError{reason: fmt.Sprintf("only %s of the recording sounds like speech (see -min-speech)", speech)}
+	}
+	return nil
+}
+
+// checkTranscript returns a nothingHeardError for a transcript that can't be
+// a request: empty, only filler words like "um, uh", only sounds, or what
+// Whisper makes of silence.
+func checkTranscript(text string) error {
+	normalized := strings.ToLower(strings.TrimSpace(text))
+	if normalized == "" {
+		return &nothingHeardError{reason: "the transcript is empty"}
+	}
+	normalized = strings.TrimSpace(soundTag.ReplaceAllString(normalized, " "))
+	if normalized == "" {
+		return &nothingHeardError{reason: "only sounds, no speech, were heard"}
+	}
+	for _, h := range whisperHallucinations {
+		if strings.Trim(normalized, " .!?,") == strings.Trim(h, ".") {
+			return &nothingHeardError{reason: fmt.Sprintf("%q is what silence tends to be transcribed as", text)}
+		}
+	}
+	words := strings.FieldsFunc(normalized, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '.' || r == '!' || r == '?' || r == '…'
+	})
+	for _, w := range words {
+		if !fillerWords[w] && !fillerSound.MatchString(w) {
+			return nil
+		}
+	}
+	return &nothingHeardError{reason: fmt.Sprintf("%q is only filler words", strings.TrimSpace(text))}
+}
+
+// offerRecordAgain says why nothing was heard and asks whether to record
+// again, which is the default unless input has ended.
+func offerRecordAgain(ui io.Writer, input *lineReader, nothing *nothingHeardError) (bool, error) {
+	fmt.Fprintf(ui, "\nDidn't catch a request: %s. Record again? (Y/n): ", nothing.reason)
+	response, err := input.ReadLine()
+	if err == io.EOF {
+		fmt.Fprintln(ui)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read user input: %w", err)
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "" || response == "y" || response == "yes", nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jerilseb/bash-generator/internal/history"
+	"github.com/jerilseb/bash-generator/internal/prefs"
+	"github.com/jerilseb/bash-generator/internal/semcache"
+	"github.com/jerilseb/bash-generator/internal/usage"
+)
+
+const appName = "bash-generator"
+
+// Files that make up the user's configuration and data.
+const (
+	configFileName     = "config.json"
+	vocabFileName      = "vocab.txt"
+	snippetsFileName   = "snippets.json"
+	historyFileName    = "history.jsonl"
+	usageFileName      = "usage.jsonl"
+	embeddingsFileName = "embeddings.jsonl"
+)
+
+// xdgDir returns $<env>/bash-generator, or ~/<fallback>/bash-generator when the variable is unset.
+func xdgDir(env, fallback string) string {
+	base := os.Getenv(env)
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
+		}
+		base = filepath.Join(home, fallback)
+	}
+	return filepath.Join(base, appName)
+}
+
+// configDir holds files the user edits: the config file, vocabulary and snippets.
+func configDir() string {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// dataDir holds files the tool maintains itself, such as the history.
+func dataDir() string {
+	return xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+// cacheDir holds files that can be downloaded again, such as local models.
+func cacheDir() string {
+	return xdgDir("XDG_CACHE_HOME", ".cache")
+}
+
+// tempDir returns the directory for files that only last as long as a run,
+// such as audio being played and text being edited, creating it if need be.
+// Unlike the shared temp directory it is private to the user, so other
+// users can't read the files or guess their names.
+func tempDir() (string, error) {
+	dir := filepath.Join(cacheDir(), "tmp")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// socketPath is where the daemon listens. It lives in $XDG_RUNTIME_DIR, which is
+// private to the user, falling back to a per-user name in the temp directory.
+func socketPath() string {
+	return runtimeSocket(appName)
+}
+
+// suggestSocketPath is where suggest -serve listens, next to the daemon.
+func suggestSocketPath() string {
+	return runtimeSocket(appName + "-suggest")
+}
+
+func runtimeSocket(name string) string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, name+".sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d.sock", name, os.Getuid()))
+}
+
+// historyStore returns the store generated commands are recorded in.
+func historyStore() *history.Store {
+	return &history.Store{Path: filepath.Join(dataDir(), historyFileName)}
+}
+
+// embeddingStore returns the store of the embeddings of earlier requests.
+func embeddingStore() *semcache.Store {
+	return &semcache.Store{Path: filepath.Join(dataDir(), embeddingsFileName)}
+}
+
+func usageStore() *usage.Store {
+	return &usage.Store{Path: filepath.Join(dataDir(), usageFileName)}
+}
+
+// projectRoot returns the root of the git repository containing the current
+// directory, or the current directory itself outside of a repository.
+func projectRoot() string {
+	if root, ok := gitRoot(); ok {
+		return root
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+	return cwd
+}
+
+// gitRoot returns the root of the git repository containing the current directory.
+func gitRoot() (string, bool) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+	return gitRootOf(cwd)
+}
+
+// gitRootOf returns the root of the git repository containing dir.
+func gitRootOf(dir string) (string, bool) {
+	for ; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		if filepath.Dir(dir) == dir {
+			return "", false
+		}
+	}
+}
+
+// prefsStore returns the store of learned conventions for the project at root.
+// Projects are keyed by a hash of their path so nothing is written into the project.
+func prefsStore(root string) *prefs.Store {
+	sum := sha256.Sum256([]byte(root))
+	name := hex.EncodeToString(sum[:8]) + ".json"
+	return &prefs.Store{Path: filepath.Join(dataDir(), "preferences", name)}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/internal/capability"
+)
+
+// pickerArgs are the arguments each picker is run with, for a prompt. They all
+// read the choices from stdin, one per line, and print the chosen one.
+var pickerArgs = map[string]func(prompt string) []string{
+	"fzf": func(prompt string) []string {
+		return []string{"--prompt", prompt + "> ", "--no-sort", "--layout", "reverse", "--height", "40%"}
+	},
+	"rofi": func(prompt string) []string {
+		return []string{"-dmenu", "-i", "-p", prompt}
+	},
+	"dmenu": func(prompt string) []string {
+		return []string{"-i", "-l", "10", "-p", prompt}
+	},
+}
+
+// errNothingPicked is returned when the picker is closed without a choice.
+var errNothingPicked = errors.New("nothing was picked")
+
+// picker lets the user choose among lines with fzf, rofi or dmenu, so choosing
+// among earlier commands fits into the launcher they already use.
+type picker struct {
+	name string
+	path string
+}
+
+// newPicker returns the picker called name, or nil if name is empty.
+func newPicker(name string) (*picker, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if _, ok := pickerArgs[name]; !ok {
+		return nil, fmt.Errorf("unknown picker %q (expected rofi, fzf or dmenu)", name)
+	}
+	path, err := capability.Require(name)
+	if err != nil {
+		return nil, err
+	}
+	return &picker{name: name, path: path}, nil
+}
+
+// pick shows choices and returns the index of the one picked, or
+// errNothingPicked. Newlines in choices are shown as "; ", as every choice has
+// to fit on a line.
+func (pk *picker) pick(prompt string, choices []string) (int, error) {
+	lines := make([]string, len(choices))
+	for i, c := range choices {
+		lines[i] = strings.ReplaceAll(strings.TrimSpace(c), "\n", "; ")
+	}
+
+	cmd := exec.Command(pk.path, pickerArgs[pk.name](prompt)...)
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	picked := string(bytes.TrimRight(out, "\r\n"))
+	// fzf, rofi and dmenu all exit with a non-zero status when closed with Escape.
+	if picked == "" {
+		var exitErr *exec.ExitError
+		if err == nil || errors.As(err, &exitErr) {
+			return 0, errNothingPicked
+		}
+		return 0, fmt.Errorf("failed to run %s: %w", pk.name, err)
+	}
+	for i, line := range lines {
+		if line == picked {
+			return i, nil
+		}
+	}
+	// rofi and dmenu let the user type something that isn't one of the choices.
+	return 0, errNothingPicked
+}
@@ -0,0 +1,848 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/capability"
+	"github.com/jerilseb/bash-generator/internal/models"
+	"github.com/jerilseb/bash-generator/internal/redact"
+	"github.com/jerilseb/bash-generator/internal/resultcache"
+	"github.com/jerilseb/bash-generator/internal/retry"
+	"github.com/jerilseb/bash-generator/internal/spoken"
+	"github.com/jerilseb/bash-generator/internal/usage"
+	"github.com/jerilseb/bash-generator/pkg/embed"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+	"github.com/jerilseb/bash-generator/pkg/record"
+	"github.com/jerilseb/bash-generator/pkg/transcribe"
+)
+
+// errChatter is returned by pipeline.generate when the transcript was discarded as chatter.
+var errChatter = errors.New("it doesn't look like a command request")
+
+// encoderNeeds names the capability an encoder depends on, if any.
+var encoderNeeds = map[string]string{
+	"opus": "opus",
+}
+
+// selectEncoder picks the audio encoder for uploads: the preferred format if
+// one is configured, otherwise the first format the endpoint accepts that can
+// be encoded on this machine.
+func selectEncoder(preferred string, accepted []string) (record.Encoder, error) {
+	if preferred != "" {
+		enc, ok := record.Encoders[preferred]
+		if !ok {
+			return nil, fmt.Errorf("unknown audio format %q (expected flac, opus or wav)", preferred)
+		}
+		if !slices.Contains(accepted, preferred) {
+			return nil, fmt.Errorf("the transcription endpoint doesn't accept %s audio (it accepts %s)", preferred, strings.Join(accepted, ", "))
+		}
+		if needs := encoderNeeds[preferred]; needs != "" {
+			if _, err := capability.Require(needs); err != nil {
+				return nil, err
+			}
+		}
+		return enc, nil
+	}
+	for _, format := range accepted {
+		enc, ok := record.Encoders[format]
+		if !ok {
+			continue
+		}
+		if needs := encoderNeeds[format]; needs != "" {
+			if _, err := capability.Require(needs); err != nil {
+				continue
+			}
+		}
+		return enc, nil
+	}
+	return nil, fmt.Errorf("none of the audio formats the transcription endpoint accepts (%s) can be encoded", strings.Join(accepted, ", "))
+}
+
+// parseLanguage checks that language is an ISO-639-1 code, the only form the
+// transcription endpoint takes, and returns it in lower case.
+func parseLanguage(language string) (string, error) {
+	code := strings.ToLower(language)
+	if len(code) != 2 || code[0] < 'a' || code[0] > 'z' || code[1] < 'a' || code[1] > 'z' {
+		return "", fmt.Errorf("invalid language %q: use a two-letter ISO-639-1 code such as en, de or ja", language)
+	}
+	return code, nil
+}
+
+// localeLanguage returns the ISO-639-1 code of the language of the locale,
+// such as de for de_DE.UTF-8, or "" if there is none.
+func localeLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := os.Getenv(name); locale != "" {
+			code, _, _ := strings.Cut(locale, "_")
+			if code, err := parseLanguage(code); err == nil {
+				return code
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// pipeline holds the clients and settings needed to turn a recording into a command.
+// It is built once and can be reused for many requests.
+type pipeline struct {
+	transcriber    *transcribe.Client
+	generator      *generate.Client
+	contextNames   []string
+	contextTokens  int
+	discardChatter bool
+	vocabulary     []string
+	promptHistory  bool
+	encoder        record.Encoder
+	denoise        bool
+	gain           gain
+	saveAudio      string
+	attempts       int
+	lintMode       string
+	toolMode       string
+	// shell is what commands are generated for and run with.
+	shell targetShell
+	// minConfidence is how sure the transcription has to be of a transcript
+	// for upload to return it without an unsureTranscriptError; 0 if it
+	// needn't be.
+	minConfidence float64
+	// minSpeech is how much speech a recording needs for heardNothing to
+	// let it be transcribed.
+	minSpeech time.Duration
+	// spokenForms turns spoken flags, paths and numbers into what they stand
+	// for, in English and spokenLanguage, before requests are sent.
+	spokenForms    bool
+	spokenLanguage string
+	// localWhisper is the self-hosted Whisper server recordings go to while
+	// it is up, for -local-whisper; nil otherwise.
+	localWhisper *localWhisper
+	// results answers recordings and requests made before with what they
+	// got then, for -cache-ttl; nil otherwise.
+	results *resultcache.Cache
+	// realtime transcribes while recording, for -stream; nil otherwise.
+	realtime *transcribe.Realtime
+	// fewShot is how many accepted commands from the history are sent as
+	// examples; none if zero.
+	fewShot int
+	// script asks for complete scripts rather than one-liners.
+	script bool
+	// placeholders asks for placeholders in place of values the model
+	// would have to guess, for the user to fill in.
+	placeholders bool
+	// output is what was piped in with -fix, sent first in the context.
+	output []string
+	// redactor masks credentials in the context before it is sent.
+	redactor *redact.Redactor
+	// session is the output of the commands run earlier in a repl, with
+	// -remember-output; nil otherwise.
+	session *session
+	// domain is the -mode requests are narrowed down to; none if empty.
+	domain string
+	// rules are the rules of the current project, from its .bashgen file.
+	rules string
+	// temperature and maxTokens are sent with every generation request.
+	temperature float64
+	maxTokens   int
+	// timeout bounds each API call, retries included.
+	timeout time.Duration
+	// embedder compares requests with earlier ones; nil if there is no
+	// embeddings endpoint to be found.
+	embedder *embed.Client
+	// speaker reads commands aloud, for -speak; nil otherwise.
+	speaker *speaker
+	// racers are the backends requests are sent to at once, the configured
+	// one first, for -race; none otherwise. chooseAnswer picks among the
+	// commands when they disagree and none is safe; the least risky one is
+	// taken if it is nil.
+	racers       []racer
+	chooseAnswer func(answers []raceAnswer) (int, error)
+	// queue holds back calls beyond -concurrency, for transcriptionBackend
+	// and chatBackend, the names limits are given for; nil if there is none.
+	queue                *apiQueue
+	transcriptionBackend string
+	chatBackend          string
+
+	// calls are the API calls made since takeUsage was last called.
+	usageMu sync.Mutex
+	calls   []usage.Call
+	// timing is how long the phases of the current run took so far, shown
+	// with -timing.
+	timing     timing
+	showTiming bool
+	// budget is the monthly_budget in USD, zero for none; overBudget lets
+	// calls through beyond it.
+	budget        float64
+	overBudget    bool
+	budgetWarning sync.Once
+}
+
+func newPipeline(opts *options) (*pipeline, error) {
+	if err := setupLogging(opts.Verbosity, opts.LogFile); err != nil {
+		return nil, err
+	}
+	if err := setupAudit(opts.AuditLog, opts.AuditKey); err != nil {
+		return nil, err
+	}
+	contextNames, err := parseContextSources(opts.Context)
+	if err != nil {
+		return nil, err
+	}
+	ep, err := resolveEndpoint(opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("endpoint", "transcription_url", ep.TranscriptionURL, "transcription_provider", ep.Provider, "transcription_model", ep.TranscriptionModel, "chat_url", ep.ChatURL, "chat_model", ep.ChatModel, "backend", ep.Backend)
+	transcriber := ep.transcriber()
+	if opts.Translate {
+		// The translation endpoint detects the language itself and takes no hint.
+		if transcriber.URL, err = ep.translationURL(); err != nil {
+			return nil, err
+		}
+	} else if opts.Language != "" {
+		if transcriber.Language, err = parseLanguage(opts.Language); err != nil {
+			return nil, err
+		}
+	}
+	encoder, err := selectEncoder(opts.AudioFormat, transcriber.AcceptedFormats())
+	if err != nil {
+		return nil, err
+	}
+	shell, err := lookupShell(opts.Shell)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Lint != lintOff && !shell.bash() {
+		return nil, fmt.Errorf("-lint checks Bash only; it can't be used with -shell %s", shell.name)
+	}
+	switch opts.Lint {
+	case lintOff:
+	case lintWarn, lintFix:
+		if _, err := capability.Require("shellcheck"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown lint mode %q (expected off, warn or fix)", opts.Lint)
+	}
+	switch opts.CheckTools {
+	case lintOff, lintWarn, lintFix:
+	default:
+		return nil, fmt.Errorf("unknown -check-tools mode %q (expected off, warn or fix)", opts.CheckTools)
+	}
+	if opts.Temperature < 0 || opts.Temperature > 2 {
+		return nil, fmt.Errorf("invalid -temperature %g: must be between 0 and 2", opts.Temperature)
+	}
+	if opts.MaxTokens < 0 {
+		return nil, fmt.Errorf("invalid -max-tokens %d: must not be negative", opts.MaxTokens)
+	}
+	contextNames, err = addModeContext(opts.Mode, contextNames)
+	if err != nil {
+		return nil, err
+	}
+	g, err := parseGain(opts.Gain)
+	if err != nil {
+		return nil, err
+	}
+	vocab, err := loadVocabulary(opts.Endpoint.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vocabulary: %w", err)
+	}
+	var rules []*regexp.Regexp
+	if opts.RedactRules != "" {
+		if rules, err = redact.LoadRules(opts.RedactRules); err != nil {
+			return nil, fmt.Errorf("failed to read redaction rules: %w", err)
+		}
+	}
+	p := &pipeline{
+		transcriber:    transcriber,
+		generator:      ep.generator(),
+		contextNames:   contextNames,
+		contextTokens:  opts.ContextTokens,
+		discardChatter: opts.DiscardChatter,
+		vocabulary:     vocab,
+		redactor:       redact.New(rules...),
+		promptHistory:  opts.PromptHistory,
+		encoder:        encoder,
+		denoise:        opts.Denoise,
+		gain:           g,
+		saveAudio:      opts.SaveAudio,
+		attempts:       opts.Attempts,
+		lintMode:       opts.Lint,
+		toolMode:       opts.CheckTools,
+		shell:          shell,
+		domain:         opts.Mode,
+		temperature:    opts.Temperature,
+		maxTokens:      opts.MaxTokens,
+		timeout:        opts.Timeout,
+		showTiming:     opts.Timing,
+		budget:         opts.Budget,
+		overBudget:     opts.OverBudget,
+	}
+	if p.queue, err = parseConcurrency(opts.Concurrency); err != nil {
+		return nil, err
+	}
+	p.transcriptionBackend, p.chatBackend = string(ep.Provider), string(ep.Backend)
+	if opts.MinConfidence < 0 || opts.MinConfidence > 1 {
+		return nil, fmt.Errorf("invalid -min-confidence %g: must be between 0 and 1", opts.MinConfidence)
+	}
+	if opts.MinSpeech < 0 {
+		return nil, fmt.Errorf("invalid -min-speech %s: must not be negative", opts.MinSpeech)
+	}
+	p.minSpeech = opts.MinSpeech
+	if opts.CacheTTL < 0 {
+		return nil, fmt.Errorf("invalid -cache-ttl %s: must not be negative", opts.CacheTTL)
+	}
+	if opts.CacheTTL > 0 {
+		p.results = resultCache(opts.CacheTTL)
+	}
+	if opts.MinConfidence > 0 {
+		p.minConfidence = opts.MinConfidence
+		p.transcriber.Confidence = true
+	}
+	if opts.Stream {
+		if opts.Translate {
+			return nil, errors.New("-stream can't be combined with -translate; the Realtime API only transcribes")
+		}
+		if p.realtime, err = ep.realtime(opts.Endpoint.Config.StreamModel); err != nil {
+			return nil, err
+		}
+		p.realtime.Language = transcriber.Language
+	}
+	if ep.LocalWhisperURL != "" {
+		if p.localWhisper, err = newLocalWhisper(ep.LocalWhisperURL, ep.LocalWhisperModel, opts.Translate); err != nil {
+			return nil, err
+		}
+		// A Whisper model of the registry is downloaded on first use.
+		cache := modelCache(opts.Endpoint.Config)
+		if m, ok := cache.Lookup(p.localWhisper.client.Model); ok {
+			if m.Kind != models.KindWhisper {
+				return nil, fmt.Errorf("invalid local_whisper_model %q: it is a %s model, not a Whisper one", m.Name, m.Kind)
+			}
+			p.localWhisper.models = cache
+		}
+		// Nothing but the local server may be used with -local-only.
+		if ep.transcriptionReady() && !(opts.LocalOnly && !isLocalURL(transcriber.URL)) {
+			p.localWhisper.fallback = string(ep.Provider)
+		}
+	}
+	p.embedder = ep.embedder(opts.Endpoint.Config)
+	if opts.Race != "" {
+		if p.racers, err = newRacers(opts.Race, opts.Endpoint, ep); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Speak != "" {
+		if p.speaker, err = newSpeaker(string(opts.Speak), opts.Endpoint.Config.SpeechEngine, opts.Endpoint.Config, ep, opts.Timeout); err != nil {
+			return nil, err
+		}
+	}
+	if !opts.NoSpokenForms {
+		p.spokenForms = true
+		switch {
+		case opts.Translate:
+			p.spokenLanguage = "en"
+		case transcriber.Language != "":
+			p.spokenLanguage = transcriber.Language
+		default:
+			p.spokenLanguage = localeLanguage()
+		}
+	}
+	if !opts.NoProjectRules {
+		if p.rules, err = loadProjectRules(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.FewShot {
+		if opts.FewShotCount < 1 {
+			return nil, fmt.Errorf("invalid -few-shot-count %d: must be at least 1", opts.FewShotCount)
+		}
+		p.fewShot = opts.FewShotCount
+	}
+	transport, err := newTransport(opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if opts.LocalOnly {
+		if err := p.checkLocalOnly(opts.Proxy); err != nil {
+			return nil, err
+		}
+		localOnlyTransport(transport, opts.Proxy)
+	}
+	p.setTransport(transport)
+	return p, nil
+}
+
+// transcribe uploads the recording, downsampled and compressed, and returns its
+// transcript. The audio never touches the disk unless saveAudio is set.
+func (p *pipeline) transcribe(ctx context.Context, rec *record.Recording) (string, error) {
+	slog.Info("recording captured", "samples", len(rec.Samples), "sample_rate", rec.SampleRate, "channels", rec.Channels,
+		"duration", rec.Duration(), "truncated", rec.Truncated, "level_dbfs", record.Level(rec.Samples))
+	start := time.Now()
+	audio, err := p.encode(rec)
+	if err != nil {
+		return "", err
+	}
+	p.timing.since(phaseEncode, start)
+	slog.Info("audio encoded", "format", p.encoder.Ext(), "bytes", audio.Len(), "took", time.Since(start))
+	if err := p.save(audio); err != nil {
+		return "", err
+	}
+	defer p.timing.since(phaseTranscribe, time.Now())
+	return p.upload(ctx, audio, "recording"+p.encoder.Ext(), rec.Duration())
+}
+
+// save writes encoded audio to the saveAudio file, if one is set. If it is
+// a directory, or ends in a slash to make it one, every recording is kept in
+// a file of its own there, named after the time it was saved.
+func (p *pipeline) save(audio *bytes.Buffer) error {
+	if p.saveAudio == "" {
+		return nil
+	}
+	path := p.saveAudio
+	info, err := os.Stat(path)
+	if (err == nil && info.IsDir()) || strings.HasSuffix(path, "/") || strings.HasSuffix(path, string(filepath.Separator)) {
+		if err := os.MkdirAll(path, 0o700); err != nil {
+			return fmt.Errorf("failed to save audio: %w", err)
+		}
+		path = filepath.Join(path, time.Now().Format("2006-01-02T15-04-05.000")+p.encoder.Ext())
+	}
+	if err := os.WriteFile(path, audio.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("failed to save audio: %w", err)
+	}
+	slog.Info("audio saved", "path", path)
+	return nil
+}
+
+// upload sends encoded audio for transcription. The extension of filename
+// tells the endpoint the format; length is how long the audio is, for the
+// usage log, or zero if that isn't known. A transcript the transcription
+// is less sure of than minConfidence comes with an unsureTranscriptError.
+func (p *pipeline) upload(ctx context.Context, audio io.Reader, filename string, length time.Duration) (string, error) {
+	// The history changes between requests, so the prompt is rebuilt every
+	// time, on a copy of the client as requests may run concurrently.
+	client := *p.transcriber
+	client.Prompt = transcriptionPrompt(p.vocabulary, p.promptHistory)
+	slog.Debug("transcription prompt", "chars", len(client.Prompt))
+	var key string
+	if p.results != nil {
+		data, err := io.ReadAll(audio)
+		if err != nil {
+			return "", err
+		}
+		audio = bytes.NewReader(data)
+		key = p.transcriptKey(data, &client)
+	}
+	res := new(transcribe.Result)
+	if !p.cachedResult(resultcache.Transcripts, key, res) {
+		if err := p.checkBudget(); err != nil {
+			return "", err
+		}
+		var err error
+		if res, err = p.transcribeAudio(ctx, &client, audio, filename, length); err != nil {
+			return "", err
+		}
+		p.cacheResult(resultcache.Transcripts, key, res)
+	}
+	if res.HasConfidence && res.Confidence < p.minConfidence && strings.TrimSpace(res.Text) != "" {
+		return res.Text, &unsureTranscriptError{text: res.Text, confidence: res.Confidence}
+	}
+	return res.Text, nil
+}
+
+// transcribeAudio has the local Whisper server transcribe audio if there is
+// one and it is up, and client otherwise.
+func (p *pipeline) transcribeAudio(ctx context.Context, client *transcribe.Client, audio io.Reader, filename string, length time.Duration) (*transcribe.Result, error) {
+	if p.localWhisper != nil {
+		// The audio is kept to send it again should the server fail.
+		data, err := io.ReadAll(audio)
+		if err != nil {
+			return nil, err
+		}
+		res, ok, err := p.transcribeLocally(ctx, data, filename, client.Prompt)
+		if ok {
+			if err == nil {
+				p.recordTranscription(p.localWhisper.client.Model, length)
+			}
+			return res, err
+		}
+		if p.localWhisper.fallback == "" {
+			return nil, errLocalWhisperDown
+		}
+		audio = bytes.NewReader(data)
+	}
+	// Waiting for a turn doesn't count towards the timeout.
+	done, err := p.queue.acquire(ctx, p.transcriptionBackend)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	start := time.Now()
+	res, err := client.TranscribeResult(ctx, audio, filename)
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("transcription timed out", "timeout", p.timeout)
+		return nil, fmt.Errorf("transcription timed out after %s (see -timeout)", p.timeout)
+	}
+	if err != nil {
+		slog.Warn("transcription failed", "model", client.Model, "latency", time.Since(start), "err", err)
+		return nil, fmt.Errorf("error transcribing audio: %w", err)
+	}
+	slog.Info("transcribed", "model", client.Model, "latency", time.Since(start), "chars", len(res.Text), "confidence", res.Confidence)
+	p.recordTranscription(p.transcriber.Model, length)
+	return res, nil
+}
+
+// encode downsamples and compresses rec for upload.
+func (p *pipeline) encode(rec *record.Recording) (*bytes.Buffer, error) {
+	var audio bytes.Buffer
+	if err := p.encoder.Encode(&audio, p.preprocess(rec.ForSpeech())); err != nil {
+		return nil, fmt.Errorf("failed to encode audio: %w", err)
+	}
+	return &audio, nil
+}
+
+// preprocess cleans up a recording for transcription, as configured.
+func (p *pipeline) preprocess(rec *record.Recording) *record.Recording {
+	if p.denoise {
+		rec = rec.Denoise()
+	}
+	switch {
+	case p.gain.auto:
+		rec = rec.AutoGain()
+	case p.gain.db != 0:
+		rec = rec.Amplify(p.gain.db)
+	}
+	return rec
+}
+
+// gain is a -gain setting: automatic, or a fixed change in dB.
+type gain struct {
+	auto bool
+	db   float64
+}
+
+// parseGain parses a -gain setting: auto, off (or empty), or a number of dB.
+func parseGain(setting string) (gain, error) {
+	switch strings.ToLower(setting) {
+	case "", "off":
+		return gain{}, nil
+	case "auto":
+		return gain{auto: true}, nil
+	}
+	db, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(setting), "db"), 64)
+	if err != nil || db < -40 || db > 40 {
+		return gain{}, fmt.Errorf("invalid -gain %q: use auto, off or a change in dB between -40 and 40", setting)
+	}
+	return gain{db: db}, nil
+}
+
+// redactLines masks credentials in lines, joined so that rules can span
+// several of them, as private keys do.
+func (p *pipeline) redactLines(lines []string) []string {
+	return strings.Split(p.redactor.Redact(strings.Join(lines, "\n")), "\n")
+}
+
+// redactTurns returns turns with the credentials in them masked: the commands
+// of earlier turns are as likely to hold a token as the context is.
+func (p *pipeline) redactTurns(turns []generate.Turn) []generate.Turn {
+	if len(turns) == 0 {
+		return turns
+	}
+	redacted := make([]generate.Turn, len(turns))
+	for i, t := range turns {
+		redacted[i] = generate.Turn{Request: p.redactor.Redact(t.Request), Command: p.redactor.Redact(t.Command)}
+	}
+	return redacted
+}
+
+// modeContext is the context source each -mode adds.
+var modeContext = map[string]string{
+	generate.Kubernetes: "kube",
+	generate.Docker:     "containers",
+	generate.Git:        "git",
+}
+
+// addModeContext checks mode and returns contextNames with the context
+// source of the mode added, if it isn't there yet.
+func addModeContext(mode string, contextNames []string) ([]string, error) {
+	if mode == "" {
+		return contextNames, nil
+	}
+	source, ok := modeContext[mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown mode %q (expected k8s, docker or git)", mode)
+	}
+	if slices.Contains(contextNames, source) {
+		return contextNames, nil
+	}
+	return append(contextNames, source), nil
+}
+
+// origin is how a request was made. Typed text is a request by definition,
+// so generate only checks spoken requests for chatter.
+type origin int
+
+const (
+	spokenRequest origin = iota
+	typedRequest
+)
+
+// generate turns a transcript into a command, adding the configured context.
+// history holds the earlier turns of an interactive session, if any, and extra
+// context that comes with this request alone, such as an editor's selection.
+// A transcript that is an alias gets its command without asking the model,
+// and with -discard-chatter a spoken one that sounds like conversation is
+// refused with errChatter. Commands for Bash that it can't parse are sent back to be corrected.
+func (p *pipeline) generate(ctx context.Context, text string, from origin, history []generate.Turn, extra ...generate.Segment) (*generate.Response, error) {
+	// Aliases don't know about output piped in with -fix, or make scripts.
+	if p.output == nil && !p.script {
+		if resp, err := p.expandAlias(ctx, text); resp != nil || err != nil {
+			return resp, err
+		}
+	}
+	if p.discardChatter && from == spokenRequest {
+		if verdict := classifyIntent(text); !verdict.Command {
+			return nil, fmt.Errorf("%w (%s)", errChatter, strings.Join(verdict.ChatterReasons, ", "))
+		}
+	}
+	if p.spokenForms {
+		if normalized := spoken.Normalize(text, p.spokenLanguage); normalized != text {
+			slog.Debug("spoken forms replaced", "request", normalized)
+			text = normalized
+		}
+	}
+	defer p.timing.since(phaseGenerate, time.Now())
+	resp, err := p.complete(ctx, text, history, extra...)
+	if err != nil || !p.shell.bash() {
+		return resp, err
+	}
+	return p.checkSyntax(ctx, text, history, resp)
+}
+
+// complete sends text to the chat model, with the configured context.
+func (p *pipeline) complete(ctx context.Context, text string, history []generate.Turn, extra ...generate.Segment) (*generate.Response, error) {
+	req := generate.Request{
+		Text:         text,
+		Examples:     p.redactTurns(p.examples()),
+		History:      p.redactTurns(history),
+		Temperature:  p.temperature,
+		MaxTokens:    p.maxTokens,
+		Script:       p.script,
+		Shell:        p.shell.title,
+		Placeholders: p.placeholders,
+		Domain:       p.domain,
+		Rules:        p.rules,
+	}
+
+	prompt := p.systemPrompt() + generate.ContextPreamble + text
+	for _, turn := range slices.Concat(req.Examples, req.History) {
+		prompt += turn.Request + turn.Command
+	}
+	req.Context = p.fitContext(p.generator.ModelFor(req), prompt, extra...)
+	slog.Debug("generation request", "prompt_chars", len(prompt), "context_chars", len(req.Context), "examples", len(req.Examples), "history", len(history))
+
+	var key string
+	if p.results != nil {
+		key = p.commandKey(req)
+	}
+	resp := new(generate.Response)
+	if p.cachedResult(resultcache.Commands, key, resp) {
+		// It was paid for when it was generated.
+		resp.Usage = generate.Usage{}
+		return resp, nil
+	}
+	resp, err := p.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	p.cacheResult(resultcache.Commands, key, resp)
+	return resp, nil
+}
+
+// send sends req to the chat model, or to every backend of -race.
+func (p *pipeline) send(ctx context.Context, req generate.Request) (*generate.Response, error) {
+	if err := p.checkBudget(); err != nil {
+		return nil, err
+	}
+	if len(p.racers) > 0 {
+		ctx, cancel := context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+		resp, err := p.race(ctx, req)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("command generation timed out after %s (see -timeout)", p.timeout)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error generating command: %w", err)
+		}
+		return resp, nil
+	}
+	done, err := p.queue.acquire(ctx, p.chatBackend)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	start := time.Now()
+	resp, err := p.generator.Generate(ctx, req)
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("generation timed out", "timeout", p.timeout)
+		return nil, fmt.Errorf("command generation timed out after %s (see -timeout)", p.timeout)
+	}
+	if err != nil {
+		slog.Warn("generation failed", "model", p.generator.ModelFor(req), "latency", time.Since(start), "err", err)
+		return nil, fmt.Errorf("error generating command: %w", err)
+	}
+	slog.Info("generated", "model", resp.Model, "latency", time.Since(start),
+		"prompt_tokens", resp.Usage.PromptTokens, "completion_tokens", resp.Usage.CompletionTokens)
+	p.recordChat(resp.Model, resp.Usage)
+	return resp, nil
+}
+
+// examples returns the few-shot examples requests are sent with. Commands
+// make poor examples for scripts, so scripts get none.
+func (p *pipeline) examples() []generate.Turn {
+	if p.fewShot == 0 || p.script {
+		return nil
+	}
+	return fewShotExamples(p.fewShot)
+}
+
+// systemPrompt returns the system prompt requests are sent with.
+func (p *pipeline) systemPrompt() string {
+	return generate.RequestPrompt(generate.Request{Script: p.script, Shell: p.shell.title, Placeholders: p.placeholders, Domain: p.domain, Rules: p.rules})
+}
+
+// fitContext gathers the requested context, truncated to what fits in the
+// budget next to prompt. Output piped in with -fix and the extra segments of
+// the request come first, as the request is about them, then the output of
+// the session's earlier commands, which follow-ups refer to, then conventions
+// learned for this project, which are short and specific.
+func (p *pipeline) fitContext(model, prompt string, extra ...generate.Segment) string {
+	segments := collectContext(p.contextNames)
+	if notes, err := prefsStore(projectRoot()).Load(); err == nil && len(notes) > 0 {
+		conventions := generate.Segment{Name: "conventions", Title: "Conventions of this project, learned from the user's corrections", Lines: notes}
+		segments = append([]generate.Segment{conventions}, segments...)
+	}
+	if seg, ok := p.session.segment(); ok {
+		segments = append([]generate.Segment{seg}, segments...)
+	}
+	if len(p.output) > 0 {
+		output := generate.Segment{Name: "output", Title: "Output of a command that went wrong, piped in by the user, which the request is about", Lines: p.output}
+		segments = append([]generate.Segment{output}, segments...)
+	}
+	segments = append(slices.Clip(extra), segments...)
+	if len(segments) == 0 {
+		return ""
+	}
+	for i, seg := range segments {
+		segments[i].Lines = p.redactLines(seg.Lines)
+	}
+	reserve := generate.ReplyTokenReserve
+	if p.script {
+		reserve = generate.ScriptReplyTokenReserve
+	}
+	budget := generate.ContextBudget(model, p.contextTokens, prompt, reserve)
+	return generate.FitContext(model, segments, budget)
+}
+
+// newTransport returns the transport for all API requests of a pipeline. There
+// is only ever one, so the transcription and chat requests, and in the repl
+// and the daemon all later ones, reuse its keep-alive and HTTP/2 connections.
+// proxy, if set, is used instead of HTTPS_PROXY and HTTP_PROXY.
+func newTransport(proxy string) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = 4
+	t.IdleConnTimeout = 10 * time.Minute
+	t.ForceAttemptHTTP2 = true
+	if proxy == "" {
+		return t, nil
+	}
+	u, err := url.Parse(proxy)
+	if err == nil && u.Host == "" {
+		err = errors.New("no host")
+	}
+	if err == nil && !slices.Contains([]string{"http", "https", "socks5", "socks5h"}, u.Scheme) {
+		err = fmt.Errorf("unsupported scheme %q (expected http, https or socks5)", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid -proxy %q: %w", proxy, err)
+	}
+	t.Proxy = http.ProxyURL(u)
+	return t, nil
+}
+
+// setTransport makes the API clients share one client that sends requests
+// through base and retries transient failures. WebSocket connections go
+// through base's proxy and dialer too.
+func (p *pipeline) setTransport(base *http.Transport) {
+	c := &http.Client{Transport: &retry.Transport{
+		Base:     &loggingTransport{base: base},
+		Attempts: p.attempts,
+		OnRetry: func(req *http.Request, attempt int, wait time.Duration, reason string) {
+			slog.Warn("retrying", "method", req.Method, "url", req.URL.Host+req.URL.Path, "reason", reason, "wait", wait, "attempt", attempt+1, "max_attempts", p.attempts)
+			fmt.Fprintf(os.Stderr, "\n%s %s: %s, retrying in %s (attempt %d of %d)\n",
+				req.Method, req.URL.Host, reason, wait.Round(100*time.Millisecond), attempt+1, p.attempts)
+		},
+	}}
+	p.transcriber.HTTPClient = c
+	p.generator.HTTPClient = c
+	if p.localWhisper != nil {
+		// A server that is down isn't retried; the fallback takes over.
+		p.localWhisper.client.HTTPClient = &http.Client{Transport: &loggingTransport{base: base}}
+		if p.localWhisper.models != nil {
+			p.localWhisper.models.HTTPClient = c
+		}
+	}
+	for _, r := range p.racers {
+		r.generator.HTTPClient = c
+	}
+	if p.embedder != nil {
+		p.embedder.HTTPClient = c
+	}
+	if p.speaker != nil && p.speaker.client != nil {
+		p.speaker.client.HTTPClient = c
+	}
+	if p.realtime != nil {
+		p.realtime.Proxy, p.realtime.DialContext = base.Proxy, base.DialContext
+	}
+}
+
+// directClient returns a client that shares the connection pool of the API
+// clients but doesn't retry, for requests whose failure doesn't matter.
+func (p *pipeline) directClient() *http.Client {
+	if rt, ok := p.generator.HTTPClient.Transport.(*retry.Transport); ok && rt.Base != nil {
+		return &http.Client{Transport: rt.Base}
+	}
+	return http.DefaultClient
+}
+
+// warm opens connections to the API hosts ahead of time, so the TLS handshake
+// happens while the user is still speaking. Errors are irrelevant here.
+func (p *pipeline) warm() {
+	client := p.directClient()
+	for _, u := range []string{p.transcriber.URL, p.generator.URL} {
+		req, err := http.NewRequest(http.MethodHead, u, nil)
+		if err != nil {
+			continue
+		}
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// maxCompletions is how many candidates Tab lists when it can't complete.
+const maxCompletions = 30
+
+// fillPlaceholders asks for the value of each placeholder in command and
+// returns the command with them filled in. Placeholders left empty stay in
+// the command, to be edited later. Ctrl+C returns context.Canceled.
+func fillPlaceholders(ui io.Writer, input *lineReader, command string, names []string, shell targetShell) (string, error) {
+	fmt.Fprintf(ui, "\n%s\n\nFill in the placeholders (Tab completes paths, Enter alone leaves one as it is):\n", command)
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		value, err := readPlaceholder(ui, input, fmt.Sprintf("  %s: ", name))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if value != "" {
+			values[name] = value
+		}
+	}
+	return replacePlaceholders(command, values, shell), nil
+}
+
+// readPlaceholder reads one value. On a terminal nobody else is reading from,
+// it offers line editing and completes file names with Tab.
+func readPlaceholder(ui io.Writer, input *lineReader, prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !input.idle() || !term.IsTerminal(fd) {
+		fmt.Fprint(ui, prompt)
+		line, err := input.ReadLine()
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(fd, state)
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, ui}, prompt)
+	if w, h, err := term.GetSize(fd); err == nil && w > 0 {
+		t.SetSize(w, h)
+	}
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return completePath(t, line, pos)
+	}
+	line, err := t.ReadLine()
+	if err == io.EOF {
+		// The terminal reports Ctrl+C and Ctrl+D alike.
+		fmt.Fprint(ui, "\r\n")
+		return "", context.Canceled
+	}
+	return strings.TrimSpace(line), err
+}
+
+// completePath completes the file name before the cursor as far as it is
+// unambiguous, and lists the candidates on t when it can't.
+func completePath(t *term.Terminal, line string, pos int) (string, int, bool) {
+	start := strings.LastIndexAny(line[:pos], " \t") + 1
+	word := line[start:pos]
+	dir, base := filepath.Split(word)
+	listDir := dir
+	if strings.HasPrefix(dir, "~"+string(filepath.Separator)) {
+		if home, err := os.UserHomeDir(); err == nil {
+			listDir = filepath.Join(home, dir[2:])
+		}
+	}
+	if listDir == "" {
+		listDir = "."
+	}
+	entries, err := os.ReadDir(listDir)
+	if err != nil {
+		return line, pos, true
+	}
+	var matches []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		if e.IsDir() {
+			name += string(filepath.Separator)
+		}
+		matches = append(matches, name)
+	}
+	if len(matches) == 0 {
+		return line, pos, true
+	}
+
+	common := matches[0]
+	for _, m := range matches[1:] {
+		n := 0
+		for n < len(common) && n < len(m) && common[n] == m[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	if len(matches) > 1 && common == base {
+		if len(matches) > maxCompletions {
+			matches = append(matches[:maxCompletions], "...")
+		}
+		fmt.Fprintf(t, "%s\n", strings.Join(matches, "  "))
+		return line, pos, true
+	}
+	completed := line[:start] + dir + common
+	return completed + line[pos:], len(completed), true
+}
+
+// replacePlaceholders puts values in place of the placeholders named in it.
+// For Bash, values are quoted as needed where each placeholder stands: bare,
+// in single quotes or in double quotes. Other shells get them as typed.
+func replacePlaceholders(command string, values map[string]string, shell targetShell) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range generate.PlaceholderIndex(command) {
+		value, ok := values[command[m[2]:m[3]]]
+		if !ok {
+			continue
+		}
+		if shell.bash() {
+			switch bashQuoting(command[:m[0]]) {
+			case '\'':
+				value = strings.ReplaceAll(value, "'", `'\''`)
+			case '"':
+				value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(value)
+			default:
+				// Keep ~/ bare so Bash still expands it.
+				if rest, ok := strings.CutPrefix(value, "~/"); ok && rest != "" {
+					value = "~/" + shellQuote(rest)
+				} else {
+					value = shellQuote(value)
+				}
+			}
+		}
+		b.WriteString(command[last:m[0]])
+		b.WriteString(value)
+		last = m[1]
+	}
+	b.WriteString(command[last:])
+	return b.String()
+}
+
+// bashQuoting returns the quote Bash is inside of at the end of prefix: ' or
+// ", or zero outside quotes.
+func bashQuoting(prefix string) byte {
+	var quote byte
+	for i := 0; i < len(prefix); i++ {
+		c := prefix[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case c == '\\':
+			i++
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		}
+	}
+	return quote
+}
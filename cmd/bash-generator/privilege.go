@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/internal/effects"
+	"github.com/jerilseb/bash-generator/internal/programs"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// rootCheck tells, at the run prompt, when a command needs root, and offers
+// to add sudo or to ask the model for a way without root. sudo is never added
+// unless asked for.
+type rootCheck struct {
+	// model is set when the model said the command needs root, which counts
+	// for commands the local checks don't know about.
+	model bool
+	// rootless asks for a command doing the same without root, given why
+	// command needs it.
+	rootless func(command string, reasons []string) (string, error)
+}
+
+// rootCheck returns the check of generated, the answer to text after
+// history. Only Bash commands are checked.
+func (p *pipeline) rootCheck(ctx context.Context, text string, history []generate.Turn, generated *generate.Response) *rootCheck {
+	if !p.shell.bash() {
+		return nil
+	}
+	return &rootCheck{
+		model: generated.NeedsSudo,
+		rootless: func(command string, reasons []string) (string, error) {
+			history := append(slices.Clip(history), generate.Turn{Request: text, Command: command})
+			followUp := "Do that without root privileges and without sudo, e.g. with systemctl --user, pip install --user " +
+				"or podman in place of docker. It needs root as it " + strings.Join(reasons, ", ") + "."
+			resp, err := p.complete(ctx, followUp, history)
+			if err == nil {
+				resp, err = p.checkSyntax(ctx, followUp, history, resp)
+			}
+			if err != nil {
+				return "", err
+			}
+			return resp.Command, nil
+		},
+	}
+}
+
+// reasons returns why command needs root, if it does and doesn't have it
+// yet. A nil check finds nothing, as does running as root.
+func (r *rootCheck) reasons(command string) []string {
+	if r == nil || os.Geteuid() == 0 {
+		return nil
+	}
+	reasons := effects.NeedsRoot(command)
+	if len(reasons) == 0 && r.model && len(effects.Analyze(command).Privileges) == 0 {
+		reasons = []string{"does something only root may do, by the model's account"}
+	}
+	return reasons
+}
+
+// printRootNote says that command needs root, for -print and -tmux, which
+// leave adding sudo to the user.
+func printRootNote(w io.Writer, r *rootCheck, command string) {
+	if reasons := r.reasons(command); len(reasons) > 0 {
+		fmt.Fprintf(w, "This command needs root, as it %s; add sudo if you mean to run it that way.\n", strings.Join(reasons, ", "))
+	}
+}
+
+// withSudo returns command run as root. A single simple command gets sudo in
+// front; anything else, pipelines and redirections included, is run by a
+// root shell, as sudo in front would only cover the first command.
+func withSudo(command string) string {
+	command = strings.TrimSpace(command)
+	cmds := programs.Commands(command)
+	if len(cmds) == 1 && len(cmds[0].Redirects) == 0 && len(cmds[0].Words) > 0 {
+		first := cmds[0].Words[0]
+		if fields := strings.Fields(command); first.Literal && fields[0] == first.Value && !strings.ContainsAny(command, ";&|()<>\n") {
+			return "sudo " + command
+		}
+	}
+	return "sudo bash -c " + shellQuote(command)
+}
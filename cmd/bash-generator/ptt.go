@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+const (
+	// pttRepeatDelay is longer than the usual delay before a held key starts
+	// repeating. A key that doesn't repeat by then was tapped, not held.
+	pttRepeatDelay = 700 * time.Millisecond
+	// pttRepeatGap is longer than the usual interval between repeats, so a
+	// longer gap means the key was released.
+	pttRepeatGap = 250 * time.Millisecond
+	// pttTap is how long a key may be held and still count as tapped, where
+	// the terminal reports releases.
+	pttTap = 300 * time.Millisecond
+	// pttQueryTimeout is how long the terminal gets to answer queries.
+	pttQueryTimeout = 300 * time.Millisecond
+	// pttPoll is how often a wait for keys checks whether it should give up.
+	pttPoll = 100 * time.Millisecond
+
+	keyEscape = 27
+)
+
+// pushToTalk records while a key is held down, instead of from the start until
+// Enter, so neither the wait before speaking nor the keystroke that ends the
+// recording ends up in it.
+//
+// Terminals only report key releases with the kitty keyboard protocol. Others
+// send a held key again and again, so it counts as released when that stops;
+// a key that doesn't repeat was tapped, and toggles recording instead.
+type pushToTalk struct {
+	key  rune
+	name string
+}
+
+// newPushToTalk parses the key setting: "space" or a single character. It
+// returns nil for an empty setting, which leaves push-to-talk off.
+func newPushToTalk(setting string) (*pushToTalk, error) {
+	if setting == "" {
+		return nil, nil
+	}
+	if setting == "space" {
+		return &pushToTalk{key: ' ', name: "space"}, nil
+	}
+	if r, size := utf8.DecodeRuneInString(setting); size == len(setting) && unicode.IsPrint(r) && r != ' ' {
+		return &pushToTalk{key: unicode.ToLower(r), name: string(unicode.ToLower(r))}, nil
+	}
+	return nil, fmt.Errorf("invalid push-to-talk key %q: use space or a single character", setting)
+}
+
+// hint is shown while recording.
+func (t *pushToTalk) hint() string {
+	return fmt.Sprintf("Release %s to stop, Esc to discard", t.name)
+}
+
+// record waits for the key to be pressed, then calls rec, which must record
+// until stop is closed, and calls stopRecording once the key is released. Esc
+// or Ctrl+C cancels before recording starts, and discards the recording after.
+func (t *pushToTalk) record(ui io.Writer, stop <-chan struct{}, stopRecording func(), rec func() (*record.Recording, error)) (*record.Recording, error) {
+	fmt.Fprintf(ui, "Hold %s to talk (or tap it to start and stop), Esc to cancel.\n", t.name)
+	keys, err := openKeys(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	defer keys.close()
+	if err := keys.waitPress(t.key); err != nil {
+		return nil, err
+	}
+
+	var discard bool
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		discard = keys.waitRelease(t.key, stop)
+		stopRecording()
+	}()
+	recording, err := rec()
+	stopRecording()
+	<-done
+	if err == nil && discard {
+		return nil, errDiscarded
+	}
+	return recording, err
+}
+
+type keyKind int
+
+const (
+	keyPress keyKind = iota
+	keyRepeat
+	keyRelease
+	// keyReply is the terminal answering a query rather than a key.
+	keyReply
+)
+
+type keyEvent struct {
+	key  rune
+	kind keyKind
+	ctrl bool
+	// reply is the final byte of a reply, 'u' for the keyboard protocol and 'c'
+	// for the device attributes.
+	reply byte
+}
+
+func (e keyEvent) cancels() bool {
+	return e.kind != keyRelease && (e.key == keyEscape || e.ctrl && e.key == 'c')
+}
+
+// keys reads key events from a terminal in raw mode.
+type keys struct {
+	in    *os.File
+	out   *os.File
+	state *term.State
+	// kitty is set if the terminal reports key releases.
+	kitty bool
+	buf   []byte
+}
+
+// openKeys puts the terminal on in into raw mode and turns on release events
+// if the terminal supports them.
+func openKeys(in *os.File) (*keys, error) {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, errors.New("push-to-talk needs a terminal")
+	}
+	// Queries go to the terminal itself, as stdout may be captured.
+	out, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("push-to-talk needs a terminal: %w", err)
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	k := &keys{in: in, out: out, state: state}
+
+	// Ask for the keyboard protocol flags, then for the device attributes,
+	// which every terminal answers: if the first reply doesn't come before
+	// the second, the protocol isn't supported.
+	out.WriteString("\x1b[?u\x1b[c")
+	deadline := time.Now().Add(pttQueryTimeout)
+	for {
+		ev, ok, err := k.next(time.Until(deadline))
+		if err != nil || !ok || ev.kind == keyReply && ev.reply == 'c' {
+			break
+		}
+		if ev.kind == keyReply && ev.reply == 'u' {
+			k.kitty = true
+		}
+	}
+	if k.kitty {
+		// Report event types (2) for all keys, text included (8).
+		out.WriteString("\x1b[>10u")
+	}
+	return k, nil
+}
+
+// close restores the terminal. Whatever was typed meanwhile is thrown away, so
+// a stray key doesn't answer the next question.
+func (k *keys) close() {
+	if k.kitty {
+		k.out.WriteString("\x1b[<u")
+	}
+	for {
+		if _, ok, err := k.next(0); err != nil || !ok {
+			break
+		}
+	}
+	term.Restore(int(k.in.Fd()), k.state)
+	k.out.Close()
+}
+
+// waitPress blocks until key is pressed. It returns context.Canceled if the
+// user cancels instead.
+func (k *keys) waitPress(key rune) error {
+	for {
+		ev, ok, err := k.next(-1)
+		if err != nil {
+			return err
+		}
+		if !ok || ev.kind != keyPress {
+			continue
+		}
+		if ev.cancels() {
+			return context.Canceled
+		}
+		if unicode.ToLower(ev.key) == key {
+			return nil
+		}
+	}
+}
+
+// waitRelease blocks until key is released or stop is closed, and reports
+// whether the user asked to discard the recording. A read error ends the
+// recording too, as there's no other way left to end it.
+func (k *keys) waitRelease(key rune, stop <-chan struct{}) bool {
+	pressed := time.Now()
+	last := pressed
+	// toggled is set once the key turns out to have been tapped; the next
+	// press then ends the recording.
+	repeating, toggled := false, false
+	for {
+		select {
+		case <-stop:
+			return false
+		default:
+		}
+		ev, ok, err := k.next(pttPoll)
+		if err != nil {
+			return false
+		}
+		if !ok {
+			if !k.kitty && !toggled {
+				if repeating && time.Since(last) > pttRepeatGap {
+					return false
+				}
+				toggled = !repeating && time.Since(pressed) > pttRepeatDelay
+			}
+			continue
+		}
+		if ev.cancels() {
+			return true
+		}
+		if unicode.ToLower(ev.key) != key {
+			continue
+		}
+		switch {
+		case toggled:
+			if ev.kind == keyPress {
+				return false
+			}
+		case ev.kind == keyRelease:
+			if time.Since(pressed) < pttTap {
+				toggled = true
+				continue
+			}
+			return false
+		case !k.kitty:
+			repeating = true
+			last = time.Now()
+		}
+	}
+}
+
+// next returns the next key event, or false if none arrives within timeout. A
+// negative timeout waits forever.
+func (k *keys) next(timeout time.Duration) (keyEvent, bool, error) {
+	deadline := time.Now().Add(timeout)
+	var chunk [64]byte
+	for {
+		if ev, ok := k.parse(); ok {
+			return ev, true, nil
+		}
+		wait := time.Until(deadline)
+		if timeout < 0 {
+			wait = -1
+		} else if wait < 0 {
+			wait = 0
+		}
+		ready, err := waitReadable(k.in, wait)
+		if err != nil {
+			return keyEvent{}, false, err
+		}
+		if !ready {
+			return keyEvent{}, false, nil
+		}
+		n, err := k.in.Read(chunk[:])
+		if err != nil {
+			return keyEvent{}, false, err
+		}
+		k.buf = append(k.buf, chunk[:n]...)
+	}
+}
+
+// parse takes the next event off the buffer. Escape sequences that aren't
+// keys are skipped, and an incomplete one is left for the next read.
+func (k *keys) parse() (keyEvent, bool) {
+	for len(k.buf) > 0 {
+		b := k.buf
+		if b[0] != 0x1b {
+			r, size := utf8.DecodeRune(b)
+			k.buf = b[size:]
+			if r == 3 {
+				return keyEvent{key: 'c', ctrl: true}, true
+			}
+			return keyEvent{key: r}, true
+		}
+		if len(b) == 1 || b[1] != '[' {
+			// Esc on its own. Alt+key sends Esc before the key, which counts as Esc too.
+			k.buf = b[1:]
+			return keyEvent{key: keyEscape}, true
+		}
+		// A control sequence: parameter bytes, then a final byte.
+		end := 2
+		for end < len(b) && (b[end] < 0x40 || b[end] > 0x7e) {
+			end++
+		}
+		if end == len(b) {
+			return keyEvent{}, false
+		}
+		k.buf = b[end+1:]
+		if ev, ok := parseCSI(string(b[2:end]), b[end]); ok {
+			return ev, true
+		}
+	}
+	return keyEvent{}, false
+}
+
+// parseCSI parses a key in the kitty keyboard protocol,
+// CSI code[:alternates][;modifiers[:event]]u, or a reply to a query.
+func parseCSI(params string, final byte) (keyEvent, bool) {
+	if strings.HasPrefix(params, "?") {
+		return keyEvent{kind: keyReply, reply: final}, final == 'u' || final == 'c'
+	}
+	if final != 'u' {
+		return keyEvent{}, false
+	}
+	fields := strings.Split(params, ";")
+	code, err := strconv.Atoi(strings.Split(fields[0], ":")[0])
+	if err != nil {
+		return keyEvent{}, false
+	}
+	ev := keyEvent{key: rune(code)}
+	if len(fields) > 1 {
+		mods := strings.Split(fields[1], ":")
+		if m, err := strconv.Atoi(mods[0]); err == nil {
+			ev.ctrl = (m-1)&4 != 0
+		}
+		if len(mods) > 1 {
+			switch mods[1] {
+			case "2":
+				ev.kind = keyRepeat
+			case "3":
+				ev.kind = keyRelease
+			}
+		}
+	}
+	return ev, true
+}
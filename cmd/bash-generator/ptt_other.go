@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// waitReadable isn't implemented here, so push-to-talk fails to start.
+func waitReadable(f *os.File, timeout time.Duration) (bool, error) {
+	return false, errors.New("push-to-talk isn't supported on this platform")
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// waitReadable waits until f has input or timeout passes, and reports which
+// happened. A negative timeout waits forever.
+func waitReadable(f *os.File, timeout time.Duration) (bool, error) {
+	fd := int(f.Fd())
+	for {
+		var set unix.FdSet
+		set.Set(fd)
+		var tv *unix.Timeval
+		if timeout >= 0 {
+			t := unix.NsecToTimeval(timeout.Nanoseconds())
+			tv = &t
+		}
+		n, err := unix.Select(fd+1, &set, nil, nil, tv)
+		if err == unix.EINTR {
+			continue
+		}
+		return n > 0, err
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultServerConcurrency is how many calls to each backend serve and mcp
+// make at once unless -concurrency says otherwise. It is well within the
+// rate limits of every provider's lowest tier.
+const defaultServerConcurrency = "4"
+
+// clientKey is the context key of the client a request came from.
+type clientKey struct{}
+
+// withClient returns a context for the requests of client, which the queue
+// takes turns between.
+func withClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+func clientOf(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
+
+// apiQueue holds API calls back so that no more than a backend's limit are in
+// flight at once. When one ends, the next to go is picked from the clients
+// waiting in turn, so a client sending many requests at once doesn't keep the
+// others waiting until all of them are done.
+type apiQueue struct {
+	// limits are the limits of the backends named in -concurrency; others
+	// get fallback, or none if it is zero.
+	limits   map[string]int
+	fallback int
+
+	mu       sync.Mutex
+	backends map[string]*backendQueue
+}
+
+// backendQueue is the calls in flight to one backend and those waiting.
+type backendQueue struct {
+	running int
+	// clients are the clients with calls waiting, in the order they take
+	// turns, and waiting their calls, oldest first.
+	clients []string
+	waiting map[string][]chan struct{}
+}
+
+// parseConcurrency parses -concurrency: a limit for every backend, like 4,
+// or limits for some, like openai=4,anthropic=2, optionally with one for the
+// rest, like 2,deepgram=8. Zero is no limit. It returns nil when there are no
+// limits at all.
+func parseConcurrency(s string) (*apiQueue, error) {
+	q := &apiQueue{limits: make(map[string]int), backends: make(map[string]*backendQueue)}
+	limited := false
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		backend, limit, named := strings.Cut(part, "=")
+		if !named {
+			backend, limit = "", part
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid -concurrency %q: expected a number of calls, optionally after backend=", part)
+		}
+		if named {
+			q.limits[strings.ToLower(strings.TrimSpace(backend))] = n
+		} else {
+			q.fallback = n
+		}
+		limited = limited || n > 0
+	}
+	if !limited {
+		return nil, nil
+	}
+	return q, nil
+}
+
+func (q *apiQueue) limit(backend string) int {
+	if n, ok := q.limits[backend]; ok {
+		return n
+	}
+	return q.fallback
+}
+
+// acquire waits for a call to backend to be allowed, and returns the function
+// that ends it. Waiting ends early with an error if ctx is done. A nil queue
+// lets every call through.
+func (q *apiQueue) acquire(ctx context.Context, backend string) (func(), error) {
+	if q == nil || q.limit(backend) == 0 {
+		return func() {}, nil
+	}
+	q.mu.Lock()
+	b := q.backends[backend]
+	if b == nil {
+		b = &backendQueue{waiting: make(map[string][]chan struct{})}
+		q.backends[backend] = b
+	}
+	release := sync.OnceFunc(func() { q.release(backend) })
+	if b.running < q.limit(backend) && len(b.clients) == 0 {
+		b.running++
+		q.mu.Unlock()
+		return release, nil
+	}
+	client := clientOf(ctx)
+	ready := make(chan struct{})
+	if len(b.waiting[client]) == 0 {
+		b.clients = append(b.clients, client)
+	}
+	b.waiting[client] = append(b.waiting[client], ready)
+	q.mu.Unlock()
+
+	start := time.Now()
+	slog.Info("call queued", "backend", backend, "client", client)
+	select {
+	case <-ready:
+		slog.Info("call dequeued", "backend", backend, "client", client, "waited", time.Since(start))
+		return release, nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		select {
+		case <-ready:
+			// The turn came as ctx ended; pass it on.
+			q.releaseLocked(backend)
+		default:
+			b.remove(client, ready)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// release ends a call to backend, letting the next client in turn make one.
+func (q *apiQueue) release(backend string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.releaseLocked(backend)
+}
+
+func (q *apiQueue) releaseLocked(backend string) {
+	b := q.backends[backend]
+	if len(b.clients) == 0 {
+		b.running--
+		return
+	}
+	// The slot goes straight to the next client, which then goes to the
+	// back of the line if it has more calls waiting.
+	client := b.clients[0]
+	b.clients = b.clients[1:]
+	calls := b.waiting[client]
+	close(calls[0])
+	if len(calls) > 1 {
+		b.waiting[client] = calls[1:]
+		b.clients = append(b.clients, client)
+	} else {
+		delete(b.waiting, client)
+	}
+}
+
+// remove takes a call that gave up off the queue.
+func (b *backendQueue) remove(client string, ready chan struct{}) {
+	calls := b.waiting[client]
+	for i, c := range calls {
+		if c == ready {
+			calls = append(calls[:i], calls[i+1:]...)
+			break
+		}
+	}
+	if len(calls) > 0 {
+		b.waiting[client] = calls
+		return
+	}
+	delete(b.waiting, client)
+	for i, c := range b.clients {
+		if c == client {
+			b.clients = append(b.clients[:i], b.clients[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jerilseb/bash-generator/pkg/generate"
+	"github.com/jerilseb/bash-generator/pkg/safety"
+)
+
+// racer is a backend a request is sent to along with the others, for -race.
+type racer struct {
+	// name is the backend and the model, as in backend:model.
+	name      string
+	backend   string
+	generator *generate.Client
+}
+
+// raceAnswer is the command one racer came back with.
+type raceAnswer struct {
+	racer   string
+	resp    *generate.Response
+	verdict safety.Verdict
+}
+
+// newRacers resolves the backends listed in race, each as backend or
+// backend:model, into the racers the configured backend is raced against.
+// Each uses its own key and, unless one is given, the model its variable
+// names or its default one.
+func newRacers(race string, opts endpointOptions, primary *apiEndpoint) ([]racer, error) {
+	racers := []racer{{name: string(primary.Backend) + ":" + primary.ChatModel, backend: string(primary.Backend), generator: primary.generator()}}
+	for _, name := range strings.Split(race, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		backend, model, _ := strings.Cut(name, ":")
+		o := opts
+		o.Backend, o.ChatModel = backend, model
+		// The chat model and key in the config file belong to the configured
+		// backend, and so does a chat URL, unless the racer is the same backend.
+		sameBackend := strings.EqualFold(backend, string(primary.Backend))
+		if !sameBackend {
+			o.ChatURL = ""
+		}
+		if opts.Config != nil {
+			cfg := *opts.Config
+			cfg.Backend, cfg.ChatModel, cfg.ChatAPIKey = "", "", ""
+			if !sameBackend {
+				cfg.ChatURL = ""
+			}
+			o.Config = &cfg
+		}
+		ep, err := resolveEndpoint(o)
+		if err != nil {
+			return nil, fmt.Errorf("-race %s: %w", name, err)
+		}
+		full := string(ep.Backend) + ":" + ep.ChatModel
+		if !containsRacer(racers, full) {
+			racers = append(racers, racer{name: full, backend: string(ep.Backend), generator: ep.generator()})
+		}
+	}
+	if len(racers) < 2 {
+		return nil, fmt.Errorf("-race needs another backend than %s to race it against", racers[0].name)
+	}
+	return racers, nil
+}
+
+func containsRacer(racers []racer, name string) bool {
+	for _, r := range racers {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// confident reports whether an answer can be taken without waiting for the
+// other backends: a command that both the model and the local check find safe.
+func (a raceAnswer) confident() bool {
+	return strings.TrimSpace(a.resp.Command) != "" && a.verdict.Level == safety.Safe
+}
+
+// race sends req to every racer at once. The first answer it is confident in
+// wins and the other requests are cancelled; failing that, it waits for them
+// all and has chooseAnswer pick one. The request only fails if every backend
+// fails.
+func (p *pipeline) race(ctx context.Context, req generate.Request) (*generate.Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		racer racer
+		resp  *generate.Response
+		err   error
+	}
+	results := make(chan result, len(p.racers))
+	start := time.Now()
+	for _, r := range p.racers {
+		go func() {
+			done, err := p.queue.acquire(ctx, r.backend)
+			if err != nil {
+				results <- result{r, nil, err}
+				return
+			}
+			defer done()
+			resp, err := r.generator.Generate(ctx, req)
+			results <- result{r, resp, err}
+		}()
+	}
+
+	var answers []raceAnswer
+	var errs []error
+	for range p.racers {
+		res := <-results
+		if res.err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("generation failed", "backend", res.racer.name, "latency", time.Since(start), "err", res.err)
+				errs = append(errs, fmt.Errorf("%s: %w", res.racer.name, res.err))
+			}
+			continue
+		}
+		slog.Info("generated", "backend", res.racer.name, "model", res.resp.Model, "latency", time.Since(start),
+			"prompt_tokens", res.resp.Usage.PromptTokens, "completion_tokens", res.resp.Usage.CompletionTokens)
+		p.recordChat(res.resp.Model, res.resp.Usage)
+		answer := raceAnswer{racer: res.racer.name, resp: res.resp, verdict: checkCommand(res.resp)}
+		if answer.confident() {
+			slog.Info("race won", "backend", answer.racer)
+			return answer.resp, nil
+		}
+		answers = append(answers, answer)
+	}
+	if len(answers) == 0 {
+		if len(errs) == 0 {
+			return nil, ctx.Err()
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	// Backends that agree are one answer.
+	var distinct []raceAnswer
+	for _, a := range answers {
+		if !containsCommand(distinct, a.resp.Command) {
+			distinct = append(distinct, a)
+		}
+	}
+	if len(distinct) == 1 {
+		return distinct[0].resp, nil
+	}
+	choose := p.chooseAnswer
+	if choose == nil {
+		choose = leastRisky
+	}
+	i, err := choose(distinct)
+	if err != nil {
+		return nil, err
+	}
+	return distinct[i].resp, nil
+}
+
+func containsCommand(answers []raceAnswer, command string) bool {
+	for _, a := range answers {
+		if a.resp.Command == command {
+			return true
+		}
+	}
+	return false
+}
+
+// leastRisky picks the answer the safety check finds least risky, the first
+// to arrive of equally risky ones. It chooses where nobody can be asked.
+func leastRisky(answers []raceAnswer) (int, error) {
+	best := 0
+	for i, a := range answers {
+		if a.verdict.Level < answers[best].verdict.Level {
+			best = i
+		}
+	}
+	return best, nil
+}
+
+// askAnswer shows the commands the backends disagree on and asks which to
+// take. An empty answer takes the least risky one.
+func askAnswer(ui io.Writer, input *lineReader, answers []raceAnswer) (int, error) {
+	fmt.Fprintln(ui, "\nThe backends came back with different commands:")
+	for i, a := range answers {
+		fmt.Fprintf(ui, "\n%d) %s (%s)\n   %s\n", i+1, a.racer, a.verdict.Level, strings.ReplaceAll(a.resp.Command, "\n", "\n   "))
+		if a.resp.Explanation != "" {
+			fmt.Fprintf(ui, "   %s\n", a.resp.Explanation)
+		}
+	}
+	def, _ := leastRisky(answers)
+	for {
+		fmt.Fprintf(ui, "\nWhich one? [1-%d, default %d]: ", len(answers), def+1)
+		response, err := input.ReadLine()
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("failed to read user input: %w", err)
+		}
+		response = strings.TrimSpace(response)
+		if response == "" {
+			return def, nil
+		}
+		if n, convErr := strconv.Atoi(response); convErr == nil && n >= 1 && n <= len(answers) {
+			return n - 1, nil
+		}
+		if err == io.EOF {
+			return def, nil
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/briandowns/spinner"
+
+	"github.com/jerilseb/bash-generator/pkg/generate"
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+// repl is an interactive session. The audio stream and HTTP connections stay
+// open between requests, and earlier requests are sent along with each new one
+// so follow-ups like "now gzip that" work.
+type repl struct {
+	p        *pipeline
+	recorder microphone
+	ptt      *pushToTalk
+	input    *lineReader
+	spinner  *spinner.Spinner
+	learn    bool
+	sandbox  *sandbox
+	whatIf   bool
+	showCost bool
+	// maxTurns is how many earlier turns are sent with a request.
+	maxTurns int
+	turns    []generate.Turn
+
+	mu        sync.Mutex
+	interrupt func()
+}
+
+// replFlags are the flags of repl.
+type replFlags struct {
+	opts           *options
+	learn          bool
+	maxTurns       int
+	useSandbox     bool
+	whatIf         bool
+	pushToTalkKey  string
+	rememberOutput bool
+	noAudio        bool
+}
+
+func (f *replFlags) define(fs *flag.FlagSet, cfg *config) error {
+	var err error
+	if f.opts, err = addPipelineFlags(fs, cfg); err != nil {
+		return err
+	}
+	fs.BoolVar(&f.opts.DiscardChatter, "discard-chatter", true, "skip generation when the transcript looks like background conversation rather than a request")
+	fs.BoolVar(&f.learn, "learn", cfg.Learn, "remember the edits you make to commands as conventions of the current project")
+	fs.IntVar(&f.maxTurns, "turns", 6, "how many earlier requests and commands to send with each request, so follow-ups can refer to them")
+	fs.BoolVar(&f.useSandbox, "sandbox", false, "first run each command in a throwaway Docker or Podman container, with the current directory read-only, and show its output")
+	fs.BoolVar(&f.whatIf, "what-if", cfg.WhatIf, "show what each command would do, read from the command without running it: the files it reads, writes and deletes, whether it uses the network and whether it gains privileges")
+	fs.StringVar(&f.pushToTalkKey, "push-to-talk", cfg.PushToTalk, "after Enter, record while this key (space or a single character) is held down, instead of until Enter")
+	fs.BoolVar(&f.rememberOutput, "remember-output", cfg.RememberOutput, "capture the output of the commands you run, with secrets redacted, and send it with the next request, so follow-ups like \"delete the second one\" work")
+	fs.BoolVar(&f.noAudio, "no-audio", cfg.NoAudio, "never open the microphone and only take typed requests, e.g. in containers and CI")
+	return nil
+}
+
+func runRepl(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	var flags replFlags
+	if err := flags.define(fs, cfg); err != nil {
+		return err
+	}
+	opts := flags.opts
+	fs.Parse(args)
+
+	ptt, err := newPushToTalk(flags.pushToTalkKey)
+	if err != nil {
+		return err
+	}
+
+	p, err := newPipeline(opts)
+	if err != nil {
+		return err
+	}
+	var sb *sandbox
+	if flags.useSandbox {
+		if !p.shell.bash() {
+			return fmt.Errorf("-sandbox runs commands in Bash; it can't be used with -shell %s", p.shell.name)
+		}
+		if sb, err = newSandbox(cfg.SandboxRuntime, cfg.SandboxImage); err != nil {
+			return err
+		}
+	}
+	go p.warm()
+
+	captureOpts, err := captureOptions(record.DefaultOptions, opts.MaxDuration, opts.Channel)
+	if err != nil {
+		return err
+	}
+	// Without a working microphone the session takes typed requests only.
+	var recorder microphone
+	micErr := errNoAudio
+	if !flags.noAudio {
+		var closeMicrophone func()
+		recorder, closeMicrophone, micErr = openMicrophone(captureOpts)
+		if micErr == nil {
+			defer closeMicrophone()
+		}
+	}
+
+	r := &repl{
+		p:        p,
+		recorder: recorder,
+		ptt:      ptt,
+		input:    newLineReader(os.Stdin),
+		spinner:  spinner.New(spinner.CharSets[11], 100*time.Millisecond, spinner.WithWriterFile(os.Stdout)),
+		learn:    flags.learn,
+		sandbox:  sb,
+		whatIf:   flags.whatIf,
+		showCost: opts.ShowCost,
+		maxTurns: flags.maxTurns,
+	}
+	if flags.rememberOutput {
+		p.session = &session{}
+	}
+	defer r.spinner.Stop()
+
+	// Ctrl+C interrupts whatever is in progress, a recording, an API call or a
+	// command, but never ends the session.
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	defer signal.Stop(c)
+	go func() {
+		for range c {
+			r.mu.Lock()
+			interrupt := r.interrupt
+			r.mu.Unlock()
+			if interrupt != nil {
+				interrupt()
+			}
+		}
+	}()
+
+	switch {
+	case recorder != nil && ptt != nil:
+		fmt.Printf("Press Enter, then hold %s to speak, or type a request.\n", ptt.name)
+	case recorder != nil:
+		fmt.Println("Press Enter to speak (Enter again to stop) or type a request.")
+	default:
+		if note := typingNote(micErr); note != "" {
+			fmt.Println(note)
+		}
+		fmt.Println("Type your requests.")
+	}
+	fmt.Println("'history' shows this session, 'exit' or Ctrl+D quits.")
+	for {
+		r.onInterrupt(func() { fmt.Print("\nType exit or press Ctrl+D to quit.\n> ") })
+		fmt.Print("> ")
+		line, err := r.input.ReadLine()
+		if err == io.EOF && strings.TrimSpace(line) == "" {
+			fmt.Println()
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read user input: %w", err)
+		}
+
+		text := strings.TrimSpace(line)
+		from := typedRequest
+		switch text {
+		case "exit", "quit":
+			return nil
+		case "history":
+			r.printHistory()
+			continue
+		case "":
+			if r.recorder == nil {
+				continue
+			}
+			text, err = r.listen()
+			for {
+				nothing, ok := nothingHeard(err)
+				if !ok {
+					break
+				}
+				r.onInterrupt(nil)
+				again, readErr := offerRecordAgain(os.Stdout, r.input, nothing)
+				if readErr != nil {
+					return readErr
+				}
+				if !again {
+					break
+				}
+				text, err = r.listen()
+			}
+			if _, ok := nothingHeard(err); ok {
+				continue
+			}
+			if err != nil {
+				r.report(err)
+				continue
+			}
+			fmt.Printf("You: %s\n", text)
+			from = spokenRequest
+		}
+
+		if err := r.request(text, from); err != nil {
+			return err
+		}
+		if r.showCost {
+			printUsage(os.Stdout, r.p.takeUsage())
+		}
+	}
+}
+
+// onInterrupt sets what Ctrl+C does until the next call.
+func (r *repl) onInterrupt(f func()) {
+	r.mu.Lock()
+	r.interrupt = f
+	r.mu.Unlock()
+}
+
+// withCancel returns a context that Ctrl+C cancels.
+func (r *repl) withCancel() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.onInterrupt(cancel)
+	return ctx, cancel
+}
+
+// listen records until Enter or Ctrl+C, or while the push-to-talk key is
+// held, and returns the transcript. On a terminal the recording can also be
+// paused and started over, see recordWithControls.
+func (r *repl) listen() (string, error) {
+	// A request that ended before there was a command to show isn't timed.
+	r.p.timing.take()
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	stopRecording := func() { stopOnce.Do(func() { close(stop) }) }
+	r.onInterrupt(stopRecording)
+	// Long recordings are transcribed in parts while they go on.
+	chunks := r.p.startChunks(context.Background(), r.recorder.Options())
+	defer func() { chunks.close() }()
+	capture := func(stop <-chan struct{}) (*record.Recording, error) {
+		r.spinner.Suffix = " Recording"
+		r.spinner.Start()
+		return r.recorder.RecordFunc(stop, chunks.onChunk)
+	}
+	defer r.spinner.Stop()
+
+	var recording *record.Recording
+	var err error
+	switch {
+	case r.ptt != nil:
+		recording, err = r.ptt.record(os.Stdout, stop, stopRecording, func() (*record.Recording, error) { return capture(stop) })
+	case canUseControls(r.input):
+		fmt.Println(controlsHint + ".")
+		for {
+			recording, err = recordWithControls(stop, r.recorder.Options().MaxDuration, func(stop <-chan struct{}, _ func()) (*record.Recording, error) {
+				return capture(stop)
+			}, func() {
+				r.spinner.Suffix = " Paused (space to resume, Enter to stop)"
+				r.spinner.Start()
+			})
+			if !errors.Is(err, errRetake) {
+				break
+			}
+			chunks.close()
+			chunks = r.p.startChunks(context.Background(), r.recorder.Options())
+			r.spinner.Stop()
+			fmt.Println("Starting over.")
+		}
+	default:
+		go func() {
+			select {
+			case <-r.input.next():
+				r.input.consumed()
+				stopRecording()
+			case <-stop:
+			}
+		}()
+		recording, err = capture(stop)
+		// A recording that stopped at its limit leaves the read for Enter pending.
+		stopRecording()
+	}
+	if err != nil {
+		return "", err
+	}
+	r.p.timing.add(phaseRecord, recording.Duration())
+
+	if recording.Truncated {
+		r.spinner.Stop()
+		r.onInterrupt(nil)
+		ok, err := confirmTruncated(os.Stdout, r.input, r.recorder.Options().MaxDuration)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", errDiscarded
+		}
+	}
+	if err := r.p.checkSpeech(recording); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := r.withCancel()
+	defer cancel()
+	r.spinner.Suffix = " Transcribing audio..."
+	r.spinner.Start()
+	text, err := chunks.finish(ctx, recording)
+	if _, unsure := unsureTranscript(err); err != nil && !unsure && ctx.Err() == nil && chunks.split() {
+		r.spinner.Stop()
+		fmt.Printf("Failed to transcribe the recording in parts: %v\nUploading it in one piece instead.\n", err)
+		r.spinner.Start()
+		text, err = r.p.transcribe(ctx, recording)
+	}
+	if unsure, ok := unsureTranscript(err); ok {
+		// Recording again is pressing Enter at the next prompt.
+		r.spinner.Stop()
+		r.onInterrupt(nil)
+		fmt.Printf("\nThe transcription is only %.0f%% sure of what it heard (see -min-confidence).", 100*unsure.confidence)
+		text, again, err := confirmTranscription(os.Stdout, r.input, text)
+		if err != nil {
+			return "", err
+		}
+		if again {
+			return "", errDiscarded
+		}
+		return text, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return text, checkTranscript(text)
+}
+
+// request generates a command for text, made as from says, offers to run it
+// and adds the turn to the session. Only failing to read from the terminal is returned; everything
+// else is reported and the session goes on.
+func (r *repl) request(text string, from origin) error {
+	history := r.turns
+	if len(history) > r.maxTurns {
+		history = history[len(history)-r.maxTurns:]
+	}
+
+	ctx, cancel := r.withCancel()
+	r.spinner.Suffix = " Generating command..."
+	r.spinner.Start()
+	generated, err := r.p.generate(ctx, text, from, history)
+	var notes []string
+	if err == nil {
+		toolNotes := r.p.checkTools(ctx, text, history, generated)
+		notes = append(lintNotes(r.p.lint(ctx, text, history, generated)), toolNotes...)
+	}
+	r.spinner.Stop()
+	cancel()
+	r.p.finishRun(os.Stdout)
+	if errors.Is(err, errChatter) {
+		fmt.Printf("Ignoring %q: %v\n", text, err)
+		return nil
+	}
+	if err != nil {
+		r.report(err)
+		return nil
+	}
+
+	entry := newHistoryEntry(text, generated.Command)
+	r.onInterrupt(nil)
+	r.p.speak(context.Background(), generated)
+	run, err := reviewCommand(r.input, &entry, commandNotes(generated, notes), checkCommand(generated), r.whatIf, r.learn, r.sandbox, r.p.rootCheck(context.Background(), text, history, generated))
+	if err != nil {
+		return err
+	}
+	// The command is remembered even if it wasn't run, as the next request may well amend it.
+	r.turns = append(r.turns, generate.Turn{Request: text, Command: entry.Command})
+	if !run {
+		recordHistory(entry)
+		fmt.Println("Command not executed.")
+		return nil
+	}
+
+	entry.Accepted = true
+	entry.Undo = undoFor(entry, generated, r.p.shell)
+	fmt.Println()
+	// The command gets Ctrl+C from the terminal itself.
+	r.onInterrupt(func() {})
+	cmd := r.p.shell.command(entry.Command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// Capturing means the command no longer writes to a terminal, so only do it when asked.
+	var output *outputCapture
+	if r.p.session != nil {
+		output = &outputCapture{}
+		cmd.Stdout = io.MultiWriter(os.Stdout, output)
+		cmd.Stderr = io.MultiWriter(os.Stderr, output)
+	}
+	err = cmd.Run()
+	exitCode := cmd.ProcessState.ExitCode()
+	entry.ExitCode = &exitCode
+	recordHistory(entry)
+	if output != nil {
+		r.p.session.add(entry.Command, exitCode, output)
+	}
+	if err != nil {
+		fmt.Printf("Command failed: %v\n", err)
+	}
+	return nil
+}
+
+// printHistory prints the requests and commands of the session so far.
+func (r *repl) printHistory() {
+	if len(r.turns) == 0 {
+		fmt.Println("Nothing yet.")
+		return
+	}
+	for i, turn := range r.turns {
+		fmt.Printf("%2d  %s\n    $ %s\n", i+1, turn.Request, turn.Command)
+	}
+}
+
+// report prints err, or just "Cancelled." if the user interrupted.
+func (r *repl) report(err error) {
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("\nCancelled.")
+		return
+	}
+	if errors.Is(err, errDiscarded) {
+		fmt.Println("\nRecording discarded.")
+		return
+	}
+	fmt.Printf("Error: %v\n", err)
+}
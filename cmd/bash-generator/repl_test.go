@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/briandowns/spinner"
+)
+
+func TestReplChatter(t *testing.T) {
+	tests := []struct {
+		name string
+		from origin
+		// skipped is set if the request must be ignored without asking the model.
+		skipped bool
+	}{
+		{"spoken", spokenRequest, true},
+		{"typed", typedRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI(t, "ls -la")
+			p := testPipeline(t, api)
+			p.discardChatter = true
+			r := &repl{
+				p:        p,
+				input:    newLineReader(strings.NewReader("n\n")),
+				spinner:  spinner.New(spinner.CharSets[11], 100*time.Millisecond, spinner.WithWriter(io.Discard)),
+				maxTurns: 6,
+			}
+			const chatter = "yeah I think we should get lunch"
+			var err error
+			out := captureStdout(t, func() { err = r.request(chatter, tt.from) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if skipped := strings.Contains(out, `Ignoring "`+chatter+`"`); skipped != tt.skipped {
+				t.Errorf("skipped = %v, want %v; output:\n%s", skipped, tt.skipped, out)
+			}
+			if asked := api.sent() != ""; asked == tt.skipped {
+				t.Errorf("model asked = %v, want %v", asked, !tt.skipped)
+			}
+		})
+	}
+}
+
+// captureStdout returns what f prints to standard output.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/resultcache"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+	"github.com/jerilseb/bash-generator/pkg/transcribe"
+)
+
+// resultCache returns the cache of transcripts and commands, whose results
+// are good for ttl.
+func resultCache(ttl time.Duration) *resultcache.Cache {
+	return &resultcache.Cache{Dir: filepath.Join(cacheDir(), "results"), TTL: ttl}
+}
+
+// transcriptKey returns the key the transcript of audio is cached under: the
+// audio, and the settings that decide what it is heard as. The prompt is
+// left out, as the shell history it may hold changes all the time.
+func (p *pipeline) transcriptKey(audio []byte, client *transcribe.Client) string {
+	parts := []any{audio, client.Provider, client.URL, client.Model, client.Language, client.Confidence}
+	if p.localWhisper != nil {
+		parts = append(parts, p.localWhisper.client.URL, p.localWhisper.client.Model)
+	}
+	key, err := resultcache.Key(parts...)
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// commandKey returns the key the command for req is cached under: the whole
+// request, context included, and where it goes.
+func (p *pipeline) commandKey(req generate.Request) string {
+	racers := make([]string, len(p.racers))
+	for i, r := range p.racers {
+		racers[i] = r.name
+	}
+	key, err := resultcache.Key(req, p.generator.Backend, p.generator.URL, p.generator.ModelFor(req), p.generator.PlainText, racers)
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// cachedResult decodes the result of kind cached under key into out, and
+// reports whether there was one. Without a cache there never is.
+func (p *pipeline) cachedResult(kind, key string, out any) bool {
+	if p.results == nil || key == "" {
+		return false
+	}
+	ok, err := p.results.Get(kind, key, out)
+	if err != nil {
+		slog.Warn("reading the result cache failed", "kind", kind, "err", err)
+		return false
+	}
+	if ok {
+		slog.Info("cached result used", "kind", kind, "key", key[:12])
+	}
+	return ok
+}
+
+// cacheResult keeps v as the result of kind under key, if there is a cache.
+// Failing to is logged, never fatal: the result is there either way.
+func (p *pipeline) cacheResult(kind, key string, v any) {
+	if p.results == nil || key == "" {
+		return
+	}
+	if err := p.results.Put(kind, key, v); err != nil {
+		slog.Warn("writing the result cache failed", "kind", kind, "err", err)
+	}
+}
+
+// cacheFlags are the flags of cache.
+type cacheFlags struct {
+	ttl     time.Duration
+	expired bool
+}
+
+func (f *cacheFlags) define(fs *flag.FlagSet, cfg *config) error {
+	ttl, err := cacheTTL(cfg)
+	if err != nil {
+		return err
+	}
+	fs.DurationVar(&f.ttl, "cache-ttl", ttl, "how long results are kept for")
+	fs.BoolVar(&f.expired, "expired", false, "with clear, only remove the results older than -cache-ttl")
+	return nil
+}
+
+// runCache shows what the result cache holds, or empties it.
+func runCache(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("cache", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %[1]s cache [-cache-ttl D] stats\n       %[1]s cache clear [-expired [-cache-ttl D]] [transcripts|commands]\n\n"+
+			"Transcripts and commands are cached with -cache-ttl, or cache_ttl in the\n"+
+			"config file; stats counts as expired what is older than that.\n", appName)
+		fs.PrintDefaults()
+	}
+	var flags cacheFlags
+	if err := flags.define(fs, cfg); err != nil {
+		return err
+	}
+	fs.Parse(args)
+
+	c := resultCache(flags.ttl)
+	switch fs.Arg(0) {
+	case "", "stats":
+		stats, err := c.Stats()
+		if err != nil {
+			return err
+		}
+		if flags.ttl > 0 {
+			fmt.Printf("Results are kept for %s in %s.\n\n", flags.ttl, c.Dir)
+		} else {
+			fmt.Printf("Results aren't cached; set -cache-ttl or cache_ttl to cache them in %s.\n\n", c.Dir)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tENTRIES\tEXPIRED\tHITS\tSIZE\tOLDEST")
+		for _, s := range stats {
+			oldest := "-"
+			if !s.Oldest.IsZero() {
+				oldest = s.Oldest.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.1f KB\t%s\n", s.Kind, s.Entries, s.Expired, s.Hits, float64(s.Bytes)/1000, oldest)
+		}
+		return w.Flush()
+	case "clear":
+		fs.Parse(fs.Args()[1:])
+		if flags.expired && flags.ttl <= 0 {
+			return errors.New("clear -expired needs a positive -cache-ttl or cache_ttl to tell what has expired")
+		}
+		c.TTL = flags.ttl
+		n, err := c.Clear(flags.expired, fs.Args()...)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Removed %d cached results.\n", n)
+		return nil
+	default:
+		fs.Usage()
+		os.Exit(2)
+		return nil
+	}
+}
+
+// cacheTTL returns the cache_ttl in cfg, or zero if it isn't set.
+func cacheTTL(cfg *config) (time.Duration, error) {
+	if cfg.CacheTTL == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(cfg.CacheTTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cache_ttl in config: %w", err)
+	}
+	return d, nil
+}
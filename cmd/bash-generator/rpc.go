@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// rpcMessage is a JSON-RPC 2.0 request, notification or response. Requests
+// without an ID are notifications and get no response.
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// rpcHandler answers a request. id is the request's ID, for notifications
+// about its progress.
+type rpcHandler func(ctx context.Context, id json.RawMessage, method string, params json.RawMessage) (any, *rpcError)
+
+// rpcConn serves JSON-RPC 2.0 over newline-delimited JSON, as the MCP and
+// editor servers do on stdin and stdout.
+type rpcConn struct {
+	handle rpcHandler
+	// cancelMethod is the notification that cancels a request, and
+	// cancelParam its parameter holding the ID of the request.
+	cancelMethod, cancelParam string
+
+	writeMu sync.Mutex
+	out     *json.Encoder
+
+	mu sync.Mutex
+	// inFlight cancels the requests being handled, by ID.
+	inFlight map[string]context.CancelFunc
+}
+
+func newRPCConn(w io.Writer, handle rpcHandler, cancelMethod, cancelParam string) *rpcConn {
+	return &rpcConn{
+		handle:       handle,
+		cancelMethod: cancelMethod,
+		cancelParam:  cancelParam,
+		out:          json.NewEncoder(w),
+		inFlight:     make(map[string]context.CancelFunc),
+	}
+}
+
+// serve reads newline-delimited messages from r until it is closed. Requests
+// are handled concurrently, so a slow generation doesn't hold up pings or
+// cancellations.
+func (c *rpcConn) serve(ctx context.Context, r io.Reader) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var msg rpcMessage
+			if err := json.Unmarshal(line, &msg); err != nil {
+				c.send(rpcMessage{ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+			} else {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					c.dispatch(ctx, msg)
+				}()
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *rpcConn) send(msg rpcMessage) {
+	msg.JSONRPC = "2.0"
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	// Encode writes the message and its newline in one go, and escapes
+	// newlines inside strings, so a message is always one line.
+	if err := c.out.Encode(msg); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write the response: %v\n", err)
+	}
+}
+
+// notify sends a notification to the client.
+func (c *rpcConn) notify(method string, params any) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write the notification: %v\n", err)
+		return
+	}
+	c.send(rpcMessage{Method: method, Params: data})
+}
+
+func (c *rpcConn) dispatch(ctx context.Context, msg rpcMessage) {
+	if len(msg.ID) == 0 {
+		c.received(msg)
+		return
+	}
+	if msg.Method == "" {
+		// A response to a request of ours; the server sends none.
+		return
+	}
+
+	id := string(msg.ID)
+	ctx, cancel := context.WithCancel(ctx)
+	c.mu.Lock()
+	c.inFlight[id] = cancel
+	c.mu.Unlock()
+
+	result, rpcErr := c.handle(ctx, msg.ID, msg.Method, msg.Params)
+	c.mu.Lock()
+	_, tracked := c.inFlight[id]
+	delete(c.inFlight, id)
+	c.mu.Unlock()
+	cancel()
+	if !tracked {
+		// The client cancelled the request and expects no response.
+		return
+	}
+	if rpcErr != nil {
+		c.send(rpcMessage{ID: msg.ID, Error: rpcErr})
+		return
+	}
+	c.send(rpcMessage{ID: msg.ID, Result: result})
+}
+
+// received handles a notification from the client. Only cancellation needs
+// doing anything.
+func (c *rpcConn) received(msg rpcMessage) {
+	if msg.Method != c.cancelMethod {
+		return
+	}
+	var params map[string]json.RawMessage
+	if json.Unmarshal(msg.Params, &params) != nil {
+		return
+	}
+	id := string(params[c.cancelParam])
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.inFlight[id]; ok {
+		delete(c.inFlight, id)
+		cancel()
+	}
+}
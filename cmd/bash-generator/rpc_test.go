@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// serveRPC serves input on a connection handled by handle, and returns the
+// messages written back, each of which must be a line of its own.
+func serveRPC(t *testing.T, handle rpcHandler, input string) []rpcMessage {
+	t.Helper()
+	var out bytes.Buffer
+	conn := newRPCConn(&out, handle, "notifications/cancelled", "requestId")
+	if err := conn.serve(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	var messages []rpcMessage
+	for _, line := range strings.SplitAfter(out.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			t.Errorf("message %q doesn't end its line", line)
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("message %q isn't JSON: %v", line, err)
+		}
+		if msg.JSONRPC != "2.0" {
+			t.Errorf("message %s has jsonrpc %q", line, msg.JSONRPC)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// rpcRoundTrip sends requests, one message each, and returns the responses
+// by ID.
+func rpcRoundTrip(t *testing.T, handle rpcHandler, requests ...string) map[string]rpcMessage {
+	t.Helper()
+	responses := map[string]rpcMessage{}
+	for _, msg := range serveRPC(t, handle, strings.Join(requests, "\n")+"\n") {
+		if len(msg.ID) > 0 {
+			responses[string(msg.ID)] = msg
+		}
+	}
+	return responses
+}
+
+// decodeResult decodes the result of msg into out.
+func decodeResult(t *testing.T, msg rpcMessage, out any) {
+	t.Helper()
+	if msg.Error != nil {
+		t.Fatalf("error %d: %s", msg.Error.Code, msg.Error.Message)
+	}
+	data, err := json.Marshal(msg.Result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// echo answers every request with its params, and "fail" with an error.
+func echo(_ context.Context, _ json.RawMessage, method string, params json.RawMessage) (any, *rpcError) {
+	switch method {
+	case "echo":
+		return params, nil
+	case "fail":
+		return nil, &rpcError{Code: editorFailed, Message: "failed"}
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: "unknown method " + method}
+	}
+}
+
+func TestRPCFraming(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		// want are the IDs answered, in order, and the text of the result
+		// or the code of the error each was answered with.
+		want []string
+	}{
+		{"one request", `{"jsonrpc": "2.0", "id": 1, "method": "echo", "params": "a"}` + "\n", []string{`1 "a"`}},
+		{"no final newline", `{"jsonrpc": "2.0", "id": 1, "method": "echo", "params": "a"}`, []string{`1 "a"`}},
+		{"CRLF", `{"jsonrpc": "2.0", "id": 1, "method": "echo", "params": "a"}` + "\r\n", []string{`1 "a"`}},
+		{"blank lines", "\n\n" + `{"jsonrpc": "2.0", "id": "x", "method": "echo", "params": 1}` + "\n  \n", []string{`"x" 1`}},
+		{"newline in a string", `{"jsonrpc": "2.0", "id": 1, "method": "echo", "params": "a\nb"}` + "\n", []string{`1 "a\nb"`}},
+		{"notification", `{"jsonrpc": "2.0", "method": "echo", "params": "a"}` + "\n", nil},
+		{"response from the client", `{"jsonrpc": "2.0", "id": 1, "result": {}}` + "\n", nil},
+		{"error", `{"jsonrpc": "2.0", "id": 2, "method": "fail"}` + "\n", []string{"2 -32000"}},
+		{"unknown method", `{"jsonrpc": "2.0", "id": 3, "method": "nope"}` + "\n", []string{"3 -32601"}},
+		{"not json", "this isn't json\n", []string{"null -32700"}},
+		{"truncated", `{"jsonrpc": "2.0", "id": 4, "method": "ec` + "\n", []string{"null -32700"}},
+		{"wrong types", `{"jsonrpc": "2.0", "id": 5, "method": 7}` + "\n", []string{"null -32700"}},
+		{"served on after malformed input", "{\n" + `{"jsonrpc": "2.0", "id": 6, "method": "echo", "params": true}` + "\n", []string{"null -32700", "6 true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, msg := range serveRPC(t, echo, tt.input) {
+				if msg.Error != nil {
+					got = append(got, string(msg.ID)+" "+strings.TrimSpace(string(mustJSON(t, msg.Error.Code))))
+				} else {
+					got = append(got, string(msg.ID)+" "+string(mustJSON(t, msg.Result)))
+				}
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("answered %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRPCCancel(t *testing.T) {
+	started := make(chan struct{})
+	slow := func(ctx context.Context, _ json.RawMessage, method string, _ json.RawMessage) (any, *rpcError) {
+		close(started)
+		<-ctx.Done()
+		return nil, &rpcError{Code: editorFailed, Message: "cancelled"}
+	}
+	r, w := io.Pipe()
+	var out bytes.Buffer
+	conn := newRPCConn(&out, slow, "notifications/cancelled", "requestId")
+	done := make(chan error)
+	go func() { done <- conn.serve(context.Background(), r) }()
+	w.Write([]byte(`{"jsonrpc": "2.0", "id": 9, "method": "generate"}` + "\n"))
+	<-started
+	w.Write([]byte(`{"jsonrpc": "2.0", "method": "notifications/cancelled", "params": {"requestId": 9}}` + "\n"))
+	w.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("a cancelled request was answered: %s", out.String())
+	}
+}
+
+func TestEditorServer(t *testing.T) {
+	api := newFakeAPI(t, "ls -la")
+	s := &editorServer{p: testPipeline(t, api)}
+	var out bytes.Buffer
+	s.conn = newRPCConn(&out, s.handle, "cancel", "id")
+	input := strings.Join([]string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "generate", "params": {"text": "list the files", "context": "$ make\nmake: *** No rule to make target"}}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "generate", "params": {"text": "  "}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "generate", "params": "list the files"}`,
+		`{"jsonrpc": "2.0", "id": 5, "method": "stop"}`,
+		`{"jsonrpc": "2.0", "id": 6, "method": "transcribe"}`,
+	}, "\n")
+	if err := s.conn.serve(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+
+	responses := map[string]rpcMessage{}
+	var progress []editorProgress
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var msg rpcMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("message %q isn't JSON: %v", line, err)
+		}
+		if msg.Method == "progress" {
+			var p editorProgress
+			json.Unmarshal(msg.Params, &p)
+			progress = append(progress, p)
+			continue
+		}
+		responses[string(msg.ID)] = msg
+	}
+
+	var initialized struct {
+		ProtocolVersion int `json:"protocolVersion"`
+	}
+	decodeResult(t, responses["1"], &initialized)
+	if initialized.ProtocolVersion != editorProtocolVersion {
+		t.Errorf("initialize = %+v", initialized)
+	}
+	var result editorResult
+	decodeResult(t, responses["2"], &result)
+	if result.Command != "ls -la" || result.Safety != "safe" {
+		t.Errorf("generate = %+v", result)
+	}
+	if sent := sentText(api.lastRequest(t)); !strings.Contains(sent, "No rule to make target") {
+		t.Errorf("the editor's context wasn't sent:\n%s", sent)
+	}
+	if len(progress) != 1 || string(progress[0].ID) != "2" || progress[0].Stage != stageGenerating {
+		t.Errorf("progress = %+v, want generating for request 2", progress)
+	}
+	for id, code := range map[string]int{"3": rpcInvalidParams, "4": rpcInvalidParams, "5": editorNoRecording, "6": rpcMethodNotFound} {
+		if err := responses[id].Error; err == nil || err.Code != code {
+			t.Errorf("response %s = %+v, want error %d", id, responses[id], code)
+		}
+	}
+}
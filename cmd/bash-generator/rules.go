@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// rulesFileName is the file in the root of a project with the user's
+	// rules for the commands generated in it.
+	rulesFileName = ".bashgen"
+	// maxRulesBytes caps the rules, which go with every request.
+	maxRulesBytes = 8 << 10
+)
+
+// loadProjectRules returns the rules in the .bashgen file of the current
+// project, see projectRoot, or "" if it has none. Lines starting with # are
+// comments. Rules that don't fit in maxRulesBytes are cut short.
+func loadProjectRules() (string, error) {
+	path := filepath.Join(projectRoot(), rulesFileName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the project rules: %w", err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+	}
+	rules := strings.TrimSpace(strings.Join(lines, "\n"))
+	if len(rules) > maxRulesBytes {
+		cut := strings.LastIndexByte(rules[:maxRulesBytes], '\n')
+		if cut < 0 {
+			cut = maxRulesBytes
+		}
+		fmt.Fprintf(os.Stderr, "Only the first %d bytes of %s are used.\n", cut, path)
+		rules = rules[:cut]
+	}
+	slog.Debug("project rules", "path", path, "bytes", len(rules))
+	return rules, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/capability"
+)
+
+// defaultSandboxImage is the image commands are previewed in. It has bash and
+// the coreutils, little else.
+const defaultSandboxImage = "debian:stable-slim"
+
+// sandbox previews commands in a throwaway container, with the current
+// directory mounted read-only and no network, so their effect can be seen
+// before running them for real.
+type sandbox struct {
+	// runtime is the path of docker, podman or another program taking the same arguments.
+	runtime string
+	image   string
+}
+
+// newSandbox finds the container runtime: the one configured, or else Podman
+// or Docker, whichever is installed.
+func newSandbox(runtime, image string) (*sandbox, error) {
+	var path string
+	var err error
+	if runtime != "" {
+		path, err = exec.LookPath(runtime)
+	} else {
+		path, err = capability.Require("sandbox")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if image == "" {
+		image = defaultSandboxImage
+	}
+	return &sandbox{runtime: path, image: image}, nil
+}
+
+// preview runs command in a new container and shows its output. Ctrl+C stops
+// the container rather than the program.
+func (s *sandbox) preview(command string) {
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to preview the command: %v\n", err)
+		return
+	}
+	name := fmt.Sprintf("%s-sandbox-%d-%d", appName, os.Getpid(), time.Now().UnixNano())
+	cmd := exec.Command(s.runtime, "run", "--rm", "--init", "--name", name,
+		"--network", "none",
+		"--volume", dir+":/work:ro", "--workdir", "/work",
+		s.image, "bash", "-c", command)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	defer signal.Stop(c)
+
+	fmt.Printf("\nPreview in %s with %s (read-only, no network; Ctrl+C to stop):\n\n", filepath.Base(s.runtime), s.image)
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr) && exitErr.ExitCode() >= 0:
+		// The runtime's own failures, e.g. an image that can't be pulled, exit with 125.
+		if exitErr.ExitCode() == 125 {
+			fmt.Printf("\nThe sandbox failed to start.\n")
+		} else {
+			fmt.Printf("\nThe command exited with status %d in the sandbox.\n", exitErr.ExitCode())
+		}
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Failed to preview the command: %v\n", err)
+	default:
+		fmt.Printf("\nThe command succeeded in the sandbox.\n")
+	}
+	// A container outlives its client if the client was killed.
+	if len(c) > 0 {
+		exec.Command(s.runtime, "rm", "--force", name).Run()
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/pkg/safety"
+)
+
+// writeScript saves a generated script to path and makes it executable, after
+// asking before overwriting an existing file. With edit it then opens the
+// script in the user's editor. It reports whether the script was written.
+func writeScript(ui io.Writer, input *lineReader, path, script string, notes []string, edit bool) (bool, error) {
+	if _, err := os.Stat(path); err == nil {
+		fmt.Fprintf(ui, "%s already exists. Overwrite it? (y/N): ", path)
+		response, err := input.ReadLine()
+		if err != nil {
+			return false, fmt.Errorf("failed to read user input: %w", err)
+		}
+		response = strings.ToLower(strings.TrimSpace(response))
+		if response != "y" && response != "yes" {
+			fmt.Fprintln(ui, "Script not written.")
+			return false, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	if err := os.WriteFile(path, []byte(script+"\n"), 0o755); err != nil {
+		return false, fmt.Errorf("failed to write script: %w", err)
+	}
+	// WriteFile keeps the mode of an existing file.
+	if err := os.Chmod(path, 0o755); err != nil {
+		return false, fmt.Errorf("failed to make the script executable: %w", err)
+	}
+
+	fmt.Fprintf(ui, "\nWrote %s (%d lines).\n", path, strings.Count(script, "\n")+1)
+	for _, note := range notes {
+		fmt.Fprintln(ui, note)
+	}
+	if verdict := safety.Check(script); verdict.Level > safety.Safe {
+		fmt.Fprintf(ui, "Warning (%s): this script %s.\n", verdict.Level, strings.Join(verdict.Reasons, ", "))
+	}
+	if edit {
+		if err := editFile(path); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
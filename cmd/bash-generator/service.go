@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/internal/capability"
+)
+
+// serviceName is the systemd user unit install-service writes.
+const serviceName = appName + ".service"
+
+// serviceUnit starts the daemon with the graphical session, which is what
+// gives it DISPLAY or WAYLAND_DISPLAY to register the hotkey with.
+const serviceUnit = `[Unit]
+Description=bash-generator daemon: speak a shell command from anywhere
+PartOf=graphical-session.target
+After=graphical-session.target
+
+[Service]
+ExecStart=%s
+Restart=on-failure
+
+[Install]
+WantedBy=graphical-session.target
+`
+
+// runInstallService installs the daemon as a systemd user service, started
+// with the serve flags in args, or removes it again with -uninstall. The flags
+// aren't parsed here, so serve's own can be passed as they are.
+func runInstallService(args []string) error {
+	uninstall := false
+	if len(args) > 0 {
+		switch args[0] {
+		case "-h", "-help", "--help":
+			fmt.Fprintf(os.Stderr, "Usage: %s install-service [serve flags]\n       %s install-service -uninstall\n", appName, appName)
+			fmt.Fprintf(os.Stderr, "Installs `%s serve` with the given flags as a systemd user service and starts it.\n", appName)
+			return nil
+		case "-uninstall", "--uninstall":
+			uninstall = true
+		}
+	}
+
+	if runtime.GOOS != "linux" {
+		return errors.New("install-service needs systemd, so it only works on Linux; start `" + appName + " serve` from a login item instead")
+	}
+	systemctl, err := capability.Require("systemd")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(filepath.Dir(configDir()), "systemd", "user", serviceName)
+
+	if uninstall {
+		if out, err := exec.Command(systemctl, "--user", "disable", "--now", serviceName).CombinedOutput(); err != nil {
+			return fmt.Errorf("systemctl disable failed: %s", strings.TrimSpace(string(out)))
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := exec.Command(systemctl, "--user", "daemon-reload").Run(); err != nil {
+			return fmt.Errorf("systemctl daemon-reload failed: %w", err)
+		}
+		fmt.Printf("Removed %s\n", path)
+		return nil
+	}
+
+	bin, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if bin, err = filepath.EvalSymlinks(bin); err != nil {
+		return err
+	}
+	words := []string{systemdQuote(bin), "serve"}
+	for _, arg := range args {
+		words = append(words, systemdQuote(arg))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(serviceUnit, strings.Join(words, " "))), 0o644); err != nil {
+		return err
+	}
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", serviceName}, {"restart", serviceName}} {
+		if out, err := exec.Command(systemctl, append([]string{"--user"}, args...)...).CombinedOutput(); err != nil {
+			return fmt.Errorf("systemctl %s failed: %s", args[0], strings.TrimSpace(string(out)))
+		}
+	}
+	fmt.Printf("Installed %s and started it.\n", path)
+	fmt.Printf("Logs: journalctl --user -u %s\n", serviceName)
+	return nil
+}
+
+// systemdQuote quotes a word of an ExecStart line. systemd expands % and $
+// itself, so those are escaped even in quotes.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// Limits on the output of earlier commands sent along with a request.
+const (
+	// maxSessionResults is how many of the latest commands' output is kept.
+	maxSessionResults = 3
+	// Long output is cut down to its first and last lines: listings are
+	// read from the top, errors from the bottom.
+	sessionHeadLines = 20
+	sessionTailLines = 20
+)
+
+// session remembers what the commands run in a repl printed, so the next
+// request can refer to it, as in "list the biggest directories" followed by
+// "delete the second one". Like all context, it is redacted when it is sent.
+type session struct {
+	// results holds the output of the latest commands, newest first.
+	results [][]string
+}
+
+// add remembers the output of a command that ran with exitCode.
+func (s *session) add(command string, exitCode int, out *outputCapture) {
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if out.total == 0 {
+		lines = []string{"(no output)"}
+	}
+	if omitted := len(lines) - sessionHeadLines - sessionTailLines; omitted > 0 {
+		note := fmt.Sprintf("(%d lines omitted)", omitted)
+		lines = append(append(lines[:sessionHeadLines:sessionHeadLines], note), lines[len(lines)-sessionTailLines:]...)
+	}
+	for i, line := range lines {
+		if len(line) > maxOutputLineLength {
+			lines[i] = line[:maxOutputLineLength] + "..."
+		}
+	}
+	result := append([]string{fmt.Sprintf("$ %s (exit status %d)", command, exitCode)}, lines...)
+	s.results = append([][]string{result}, s.results...)
+	if len(s.results) > maxSessionResults {
+		s.results = s.results[:maxSessionResults]
+	}
+}
+
+// segment returns the remembered output as context, newest first so it is
+// the last to be cut when the budget runs out. It has none if s is nil.
+func (s *session) segment() (generate.Segment, bool) {
+	if s == nil || len(s.results) == 0 {
+		return generate.Segment{}, false
+	}
+	seg := generate.Segment{Name: "session", Title: "Output of the commands run earlier in this session, latest first"}
+	for _, result := range s.results {
+		seg.Lines = append(seg.Lines, result...)
+	}
+	return seg, true
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// targetShell is a shell commands are generated for and run with.
+type targetShell struct {
+	name string
+	// title names the shell to the model.
+	title string
+	// command returns the process that runs line in the shell.
+	command func(line string) *exec.Cmd
+}
+
+var targetShells = []targetShell{
+	{name: "bash", title: "Bash", command: func(line string) *exec.Cmd { return exec.Command("bash", "-c", line) }},
+	{name: "powershell", title: "PowerShell", command: powershellCommand},
+	{name: "cmd", title: "Windows cmd.exe", command: cmdCommand},
+}
+
+// lookupShell finds a target shell by name; empty means the platform's default.
+func lookupShell(name string) (targetShell, error) {
+	if name == "" {
+		name = defaultShell
+	}
+	names := make([]string, len(targetShells))
+	for i, s := range targetShells {
+		if s.name == strings.ToLower(name) {
+			return s, nil
+		}
+		names[i] = s.name
+	}
+	return targetShell{}, fmt.Errorf("unknown shell %q (expected %s)", name, strings.Join(names, ", "))
+}
+
+// bash reports whether the shell is Bash, which the Bash-only features need.
+func (s targetShell) bash() bool {
+	return s.name == "bash"
+}
+
+// powershellCommand runs line in PowerShell 7 if it is installed, else in
+// Windows PowerShell.
+func powershellCommand(line string) *exec.Cmd {
+	program := "powershell"
+	if _, err := exec.LookPath("pwsh"); err == nil {
+		program = "pwsh"
+	}
+	return exec.Command(program, "-NoProfile", "-Command", line)
+}
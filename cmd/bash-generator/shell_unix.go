@@ -0,0 +1,31 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// defaultShell is what commands are generated for unless -shell says otherwise.
+const defaultShell = "bash"
+
+// terminalPath opens the terminal, whatever stdin is.
+const terminalPath = "/dev/tty"
+
+// shutdownSignals ask the program to stop.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// cmdCommand runs line in cmd.exe, as under Wine or WSL interop.
+func cmdCommand(line string) *exec.Cmd {
+	return exec.Command("cmd", "/C", line)
+}
+
+// editorCommand opens path in editor, which may carry arguments, e.g. "code --wait".
+func editorCommand(editor, path string) *exec.Cmd {
+	if editor == "" {
+		editor = "vi"
+	}
+	return exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+}
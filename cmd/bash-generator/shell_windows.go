@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// defaultShell is what commands are generated for unless -shell says otherwise.
+const defaultShell = "powershell"
+
+// terminalPath opens the terminal, whatever stdin is.
+const terminalPath = "CONIN$"
+
+// shutdownSignals ask the program to stop. Windows has no SIGTERM; Ctrl+C and
+// Ctrl+Break arrive as os.Interrupt.
+var shutdownSignals = []os.Signal{os.Interrupt}
+
+// cmdCommand runs line in cmd.exe. The command line is passed as it is, since
+// cmd.exe doesn't parse its arguments the way exec quotes them.
+func cmdCommand(line string) *exec.Cmd {
+	cmd := exec.Command("cmd.exe")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd.exe /S /C "` + line + `"`}
+	return cmd
+}
+
+// editorCommand opens path in editor, which may carry arguments, e.g. "code --wait".
+func editorCommand(editor, path string) *exec.Cmd {
+	if editor == "" {
+		editor = "notepad"
+	}
+	cmd := exec.Command("cmd.exe")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd.exe /S /C "` + editor + ` "` + path + `""`}
+	return cmd
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// shellInitScripts define a widget per shell that runs the generator in print
+// mode and inserts the command at the cursor, leaving it to the user to edit and run.
+// They also export the last command line and its exit status for the "last"
+// context source, before the next prompt so that running bash-generator itself
+// doesn't count.
+var shellInitScripts = map[string]string{
+	"zsh": `# bash-generator zsh integration
+# Add to ~/.zshrc:  eval "$({{.Bin}} init zsh)"
+_bash_generator_widget() {
+  local cmd
+  zle -I
+  cmd=$({{.Bin}} -print{{if .Args}} {{.Args}}{{end}} </dev/tty)
+  if [[ -n $cmd ]]; then
+    LBUFFER+=$cmd
+  fi
+  zle reset-prompt
+}
+zle -N _bash_generator_widget
+bindkey '{{.Key}}' _bash_generator_widget
+
+# Outside the line editor, put the command on the buffer stack instead.
+bash-generator-insert() {
+  local cmd
+  cmd=$({{.Bin}} -print{{if .Args}} {{.Args}}{{end}} "$@") && [[ -n $cmd ]] && print -z -- "$cmd"
+}
+
+# zsh-autosuggestions strategy offering commands you accepted through
+# bash-generator as ghost text. It runs after the default history strategy,
+# and asks "suggest -serve" if it is running, which saves starting a process.
+_zsh_autosuggest_strategy_bash_generator() {
+  typeset -g suggestion
+  if [[ -S {{.SuggestSocket}} && $1 != *$'\n'* ]] && zmodload zsh/net/socket 2>/dev/null && zsocket {{.SuggestSocket}} 2>/dev/null; then
+    local fd=$REPLY
+    print -r -u $fd -- "$PWD"$'\t'"$1"
+    IFS= read -r -t 1 -u $fd suggestion
+    exec {fd}>&-
+  else
+    suggestion=$({{.Bin}} suggest -- "$1" 2>/dev/null)
+  fi
+}
+if (( ! ${ZSH_AUTOSUGGEST_STRATEGY[(Ie)bash_generator]} )); then
+  ZSH_AUTOSUGGEST_STRATEGY=(${ZSH_AUTOSUGGEST_STRATEGY:-history} bash_generator)
+fi
+
+# Remember the last command and how it ended, for "-context last".
+_bash_generator_preexec() {
+  _bash_generator_pending=$1
+}
+_bash_generator_precmd() {
+  local exit_code=$?
+  if [[ -n $_bash_generator_pending ]]; then
+    export BASH_GENERATOR_LAST_COMMAND=$_bash_generator_pending BASH_GENERATOR_LAST_STATUS=$exit_code
+    _bash_generator_pending=
+  fi
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook preexec _bash_generator_preexec
+# First, so no other hook has changed $? yet.
+precmd_functions=(_bash_generator_precmd ${precmd_functions:#_bash_generator_precmd})
+`,
+	"bash": `# bash-generator bash integration
+# Add to ~/.bashrc:  eval "$({{.Bin}} init bash)"
+_bash_generator_readline() {
+  local cmd
+  cmd=$({{.Bin}} -print{{if .Args}} {{.Args}}{{end}} </dev/tty)
+  if [[ -n $cmd ]]; then
+    READLINE_LINE="${READLINE_LINE:0:$READLINE_POINT}${cmd}${READLINE_LINE:$READLINE_POINT}"
+    READLINE_POINT=$((READLINE_POINT + ${#cmd}))
+  fi
+}
+bind -x '"{{.Key}}": _bash_generator_readline'
+
+# Remember the last command and how it ended, for "-context last". It runs
+# first in PROMPT_COMMAND, so nothing has changed $? yet.
+_bash_generator_precmd() {
+  local exit_code=$? last
+  last=$(HISTTIMEFORMAT= builtin history 1)
+  [[ $last =~ ^\ *[0-9]+\*?\ +(.*)$ ]] || return
+  export BASH_GENERATOR_LAST_COMMAND=${BASH_REMATCH[1]} BASH_GENERATOR_LAST_STATUS=$exit_code
+}
+if [[ $PROMPT_COMMAND != *_bash_generator_precmd* ]]; then
+  PROMPT_COMMAND="_bash_generator_precmd${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`,
+	"fish": `# bash-generator fish integration
+# Add to ~/.config/fish/config.fish:  {{.Bin}} init fish | source
+function __bash_generator_insert
+    set -l cmd ({{.Bin}} -print{{if .Args}} {{.Args}}{{end}} </dev/tty | string collect)
+    if test -n "$cmd"
+        commandline -i -- $cmd
+    end
+    commandline -f repaint
+end
+bind {{.Key}} __bash_generator_insert
+
+# Remember the last command and how it ended, for "-context last".
+function __bash_generator_postexec --on-event fish_postexec
+    set -l last_status $status
+    set -gx BASH_GENERATOR_LAST_COMMAND $argv[1]
+    set -gx BASH_GENERATOR_LAST_STATUS $last_status
+end
+`,
+}
+
+// defaultWidgetKeys binds Alt+G in each shell's key syntax.
+var defaultWidgetKeys = map[string]string{
+	"zsh":  "^[g",
+	"bash": `\eg`,
+	"fish": `\eg`,
+}
+
+// initFlags are the flags of init.
+type initFlags struct {
+	key   string
+	extra string
+}
+
+func (f *initFlags) define(fs *flag.FlagSet) {
+	fs.StringVar(&f.key, "key", "", "key binding in the shell's own syntax (default Alt+G)")
+	fs.StringVar(&f.extra, "args", "", "extra flags passed to the generator, e.g. \"-context dir\"")
+}
+
+func runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	var flags initFlags
+	flags.define(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s init [-key binding] [-args flags] zsh|bash|fish\n", appName)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	shell := fs.Arg(0)
+	script, ok := shellInitScripts[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q (expected zsh, bash or fish)", shell)
+	}
+	if flags.key == "" {
+		flags.key = defaultWidgetKeys[shell]
+	}
+
+	bin, err := os.Executable()
+	if err != nil {
+		bin = appName
+	}
+
+	tmpl := template.Must(template.New(shell).Parse(script))
+	return tmpl.Execute(os.Stdout, struct {
+		Bin, Key, Args, SuggestSocket string
+	}{
+		Bin:           shellQuote(bin),
+		Key:           flags.key,
+		Args:          flags.extra,
+		SuggestSocket: shellQuote(suggestSocketPath()),
+	})
+}
+
+// shellQuote quotes s for POSIX shells and fish.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/capability"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+	"github.com/jerilseb/bash-generator/pkg/safety"
+	"github.com/jerilseb/bash-generator/pkg/speech"
+)
+
+// What -speak reads aloud.
+const (
+	speakExplanation = "explanation"
+	speakCommand     = "command"
+)
+
+// Speech engines.
+const (
+	engineLocal  = "local"
+	engineOpenAI = "openai"
+)
+
+// speakMode is the value of -speak, which works as a bool flag reading the
+// explanation, or takes what to read, as in -speak=command.
+type speakMode string
+
+func (m *speakMode) String() string {
+	if m == nil {
+		return ""
+	}
+	return string(*m)
+}
+
+func (m *speakMode) Set(v string) error {
+	switch v {
+	case "true":
+		*m = speakExplanation
+	case "false":
+		*m = ""
+	default:
+		*m = speakMode(v)
+	}
+	return nil
+}
+
+func (m *speakMode) IsBoolFlag() bool { return true }
+
+// speaker reads generated commands aloud, with a local speech synthesizer or
+// the speech endpoint next to the transcription endpoint.
+type speaker struct {
+	mode string
+	// synthesizer is the path of say or espeak, for the local engine.
+	synthesizer string
+	voice       string
+	// client speaks for the OpenAI engine, whose audio player is player.
+	client  *speech.Client
+	player  string
+	timeout time.Duration
+
+	// playing is what is being read aloud, if anything; cleanup removes
+	// the audio it plays, if any.
+	playing *exec.Cmd
+	cleanup func()
+}
+
+// newSpeaker returns a speaker reading what mode asks for with engine: local,
+// openai, or empty for a local synthesizer if one is installed and the API
+// otherwise.
+func newSpeaker(mode, engine string, cfg *config, ep *apiEndpoint, timeout time.Duration) (*speaker, error) {
+	switch mode {
+	case speakExplanation, speakCommand:
+	default:
+		return nil, fmt.Errorf("unknown -speak mode %q (expected explanation or command)", mode)
+	}
+	s := &speaker{mode: mode, voice: cfg.SpeechVoice, timeout: timeout}
+	switch engine {
+	case "":
+		if path, ok := capability.Lookup("speech").Path(); ok {
+			s.synthesizer = path
+			return s, nil
+		}
+	case engineLocal:
+		path, err := capability.Require("speech")
+		if err != nil {
+			return nil, err
+		}
+		s.synthesizer = path
+		return s, nil
+	case engineOpenAI:
+	default:
+		return nil, fmt.Errorf("unknown speech engine %q (expected local or openai)", engine)
+	}
+
+	player, err := capability.Require("audio-player")
+	if err != nil {
+		return nil, err
+	}
+	speechURL, err := ep.speechURL()
+	if err != nil {
+		return nil, err
+	}
+	s.player = player
+	s.client = &speech.Client{URL: speechURL, Model: cfg.SpeechModel, Voice: cfg.SpeechVoice, Header: ep.header()}
+	if s.client.Model == "" {
+		s.client.Model = speech.DefaultModel
+	}
+	if s.client.Voice == "" {
+		s.client.Voice = speech.DefaultVoice
+	}
+	return s, nil
+}
+
+// speechURL returns the URL of the speech endpoint that sits next to the
+// transcription endpoint, as it does on OpenAI.
+func (ep *apiEndpoint) speechURL() (string, error) {
+	if ep.Azure {
+		return "", errors.New("speaking with the openai engine isn't supported with Azure OpenAI; set speech_engine to local")
+	}
+	const transcriptions = "/audio/transcriptions"
+	u, err := url.Parse(ep.TranscriptionURL)
+	if err != nil || !strings.HasSuffix(u.Path, transcriptions) {
+		return "", fmt.Errorf("can't tell the speech endpoint from the transcription URL %s; it should end in %s", ep.TranscriptionURL, transcriptions)
+	}
+	u.Path = strings.TrimSuffix(u.Path, transcriptions) + "/audio/speech"
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// speak reads generated aloud with -speak. Failing to is only reported, as the
+// command is shown anyway.
+func (p *pipeline) speak(ctx context.Context, generated *generate.Response) {
+	if p.speaker == nil {
+		return
+	}
+	if err := p.speaker.speak(ctx, generated, checkCommand(generated)); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the command aloud: %v\n", err)
+	}
+}
+
+// speak starts reading generated aloud, stopping whatever was still being
+// read, and returns without waiting for it to finish. Commands that are
+// risky to run come with a warning, as the user may not be looking.
+func (s *speaker) speak(ctx context.Context, generated *generate.Response, verdict safety.Verdict) error {
+	text := generated.Explanation
+	if s.mode == speakCommand || text == "" {
+		text = speakableCommand(generated.Command)
+	}
+	if verdict.Level > safety.Safe {
+		text = strings.TrimRight(text, ". ") + ". Careful: this command " + strings.Join(verdict.Reasons, ", ") + "."
+	}
+	return s.say(ctx, text)
+}
+
+// say starts reading text aloud, stopping whatever was still being read, and
+// returns without waiting for it to finish.
+func (s *speaker) say(ctx context.Context, text string) error {
+	s.stop()
+	if s.client == nil {
+		var args []string
+		if s.voice != "" {
+			args = append(args, "-v", s.voice)
+		}
+		// Both say and espeak read stdin when given no text, which keeps
+		// text starting with a dash from being taken for an option.
+		cmd := exec.Command(s.synthesizer, args...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		s.playing = cmd
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	audio, err := s.client.Speak(ctx, text)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("speech timed out after %s (see -timeout)", s.timeout)
+	}
+	if err != nil {
+		return err
+	}
+	// Not every player reads stdin, afplay in particular, so the audio is
+	// played from a file.
+	base, err := tempDir()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp(base, "speech-")
+	if err != nil {
+		return err
+	}
+	s.cleanup = func() { os.RemoveAll(dir) }
+	path := filepath.Join(dir, "speech.wav")
+	if err := os.WriteFile(path, audio, 0o600); err != nil {
+		s.stop()
+		return err
+	}
+	args := []string{path}
+	if filepath.Base(s.player) == "ffplay" {
+		args = []string{"-nodisp", "-autoexit", "-loglevel", "quiet", path}
+	}
+	cmd := exec.Command(s.player, args...)
+	if err := cmd.Start(); err != nil {
+		s.stop()
+		return err
+	}
+	s.playing = cmd
+	return nil
+}
+
+// wait waits until what is being read aloud is finished. A nil speaker has
+// nothing to wait for.
+func (s *speaker) wait() {
+	if s == nil {
+		return
+	}
+	if s.playing != nil {
+		s.playing.Wait()
+		s.playing = nil
+	}
+	if s.cleanup != nil {
+		s.cleanup()
+		s.cleanup = nil
+	}
+}
+
+// stop cuts off what is being read aloud.
+func (s *speaker) stop() {
+	if s.playing != nil {
+		s.playing.Process.Kill()
+	}
+	s.wait()
+}
+
+// speakableReplacer spells out the shell operators speech synthesizers would
+// otherwise skip or read as punctuation, and drops the quotes nobody reads
+// out. Longer operators come first, as the replacer tries them in order.
+var speakableReplacer = strings.NewReplacer(
+	"2>&1", " including errors ",
+	"&&", " and then ",
+	"||", " or else ",
+	">>", " appending to ",
+	"|", " piped to ",
+	">", " into ",
+	"<", " from ",
+	";", ", then ",
+	"~/", "home slash ",
+	"*", " star ",
+	"$", " dollar ",
+	"\"", "",
+	"'", "",
+)
+
+// speakableCommand returns command the way it would be read out to someone.
+func speakableCommand(command string) string {
+	return strings.Join(strings.Fields(speakableReplacer.Replace(command)), " ")
+}
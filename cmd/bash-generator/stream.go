@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/jerilseb/bash-generator/pkg/record"
+	"github.com/jerilseb/bash-generator/pkg/transcribe"
+)
+
+// streamingTranscript sends a recording to a Realtime API session while it is
+// being made, for -stream.
+type streamingTranscript struct {
+	session   *transcribe.Session
+	resampler *record.Resampler
+	model     string
+}
+
+// startStream opens a transcription session for audio captured with opts.
+func (p *pipeline) startStream(ctx context.Context, opts record.Options) *streamingTranscript {
+	rt := *p.realtime
+	rt.Prompt = transcriptionPrompt(p.vocabulary, p.promptHistory)
+	return &streamingTranscript{
+		session:   rt.Start(ctx),
+		resampler: record.NewResampler(opts.Channels, opts.SampleRate, transcribe.RealtimeSampleRate),
+		model:     rt.Model,
+	}
+}
+
+// onChunk is passed to Recorder.RecordFunc. Sending happens in the background.
+func (s *streamingTranscript) onChunk(chunk []int16) {
+	s.session.Append(s.resampler.Resample(chunk))
+}
+
+// text returns the transcript so far.
+func (s *streamingTranscript) text() string {
+	return s.session.Text()
+}
+
+func (s *streamingTranscript) close() {
+	s.session.Close()
+}
+
+// finishStream waits for the rest of the transcript of rec, which was streamed
+// while it was recorded. Callers fall back to uploading rec if it fails.
+func (p *pipeline) finishStream(ctx context.Context, s *streamingTranscript, rec *record.Recording) (string, error) {
+	defer p.timing.since(phaseTranscribe, time.Now())
+	if p.saveAudio != "" {
+		audio, err := p.encode(rec)
+		if err != nil {
+			return "", err
+		}
+		if err := p.save(audio); err != nil {
+			return "", err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	text, err := s.session.Finish(ctx)
+	if err != nil {
+		return "", err
+	}
+	p.recordTranscription(s.model, rec.Duration())
+	return text, nil
+}
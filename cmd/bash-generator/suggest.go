@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/history"
+	"github.com/jerilseb/bash-generator/internal/snippets"
+)
+
+// maxSuggestLength keeps suggestions to commands that fit on a prompt line.
+const maxSuggestLength = 500
+
+// suggestFlags are the flags of suggest.
+type suggestFlags struct {
+	serve  bool
+	socket string
+}
+
+func (f *suggestFlags) define(fs *flag.FlagSet) {
+	fs.BoolVar(&f.serve, "serve", false, "keep running and answer shell plugins over a Unix socket, one prefix per line, without starting a process per keystroke")
+	fs.StringVar(&f.socket, "socket", suggestSocketPath(), "path of the Unix socket to listen on with -serve")
+}
+
+// runSuggest prints the most recent accepted command that starts with the given
+// prefix. It backs the zsh-autosuggestions strategy emitted by `init zsh`, so it
+// must stay fast and quiet: no output at all means no suggestion. With -serve
+// it answers the same question over a Unix socket instead, see serveSuggestions.
+func runSuggest(args []string) error {
+	fs := flag.NewFlagSet("suggest", flag.ExitOnError)
+	var flags suggestFlags
+	flags.define(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s suggest <prefix>\n       %s suggest -serve [-socket path]\n", appName, appName)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if flags.serve {
+		return serveSuggestions(flags.socket)
+	}
+	prefix := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(prefix) == "" {
+		return nil
+	}
+
+	entries, err := historyStore().Load()
+	if err != nil {
+		return err
+	}
+	// Aliases only add suggestions, so a broken aliases file doesn't stop them.
+	aliases, _ := snippetStore().Load()
+	dir, _ := os.Getwd()
+	if suggestion := suggest(entries, aliases, prefix, dir); suggestion != "" {
+		fmt.Fprintln(os.Stdout, suggestion)
+	}
+	return nil
+}
+
+// suggest returns the most recent accepted command in entries that starts
+// with prefix, or failing that the command of an alias that does, or "".
+// Commands from the repository dir is in win over more recent ones from
+// elsewhere.
+func suggest(entries []history.Entry, aliases []snippets.Snippet, prefix, dir string) string {
+	if strings.TrimSpace(prefix) == "" {
+		return ""
+	}
+	matches := func(command string) bool {
+		return command != prefix && strings.HasPrefix(command, prefix) &&
+			!strings.ContainsRune(command, '\n') && len(command) <= maxSuggestLength
+	}
+	root, inRepo := "", false
+	if dir != "" {
+		root, inRepo = gitRootOf(dir)
+	}
+	for _, here := range []bool{true, false} {
+		if here && !inRepo {
+			continue
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			if here && !e.InProject(root) {
+				continue
+			}
+			if e.Accepted && matches(e.Command) {
+				return e.Command
+			}
+		}
+	}
+	for _, a := range aliases {
+		if matches(a.Command) {
+			return a.Command
+		}
+	}
+	return ""
+}
+
+// suggestSource keeps the history and aliases in memory for suggest -serve,
+// reading them again when their files change.
+type suggestSource struct {
+	mu                   sync.Mutex
+	entries              []history.Entry
+	aliases              []snippets.Snippet
+	historyMod, aliasMod fileVersion
+}
+
+// fileVersion tells whether a file changed since it was read.
+type fileVersion struct {
+	mod  time.Time
+	size int64
+}
+
+func versionOf(path string) fileVersion {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileVersion{}
+	}
+	return fileVersion{mod: info.ModTime(), size: info.Size()}
+}
+
+// suggest answers a request of suggest -serve.
+func (s *suggestSource) suggest(prefix, dir string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := historyStore()
+	if v := versionOf(h.Path); v != s.historyMod {
+		entries, err := h.Load()
+		if err != nil {
+			slog.Warn("history unreadable", "err", err)
+		} else {
+			s.entries, s.historyMod = entries, v
+		}
+	}
+	a := snippetStore()
+	if v := versionOf(a.Path); v != s.aliasMod {
+		aliases, err := a.Load()
+		if err != nil {
+			slog.Warn("aliases unreadable", "err", err)
+		} else {
+			s.aliases, s.aliasMod = aliases, v
+		}
+	}
+	return suggest(s.entries, s.aliases, prefix, dir)
+}
+
+// serveSuggestions answers suggestion requests on a Unix socket until
+// interrupted. A request is a line with the directory the shell is in, a tab
+// and the prefix typed so far; the answer is a line with the suggestion, empty
+// for none. A connection may carry any number of requests. The API is never
+// called, and only the user can connect.
+func serveSuggestions(socket string) error {
+	ln, err := listenUnix(socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+	ctx, stop := signal.NotifyContext(context.Background(), shutdownSignals...)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving suggestions on %s\n", socket)
+	src := &suggestSource{}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			sc := bufio.NewScanner(conn)
+			for sc.Scan() {
+				dir, prefix, ok := strings.Cut(sc.Text(), "\t")
+				if !ok {
+					dir, prefix = "", dir
+				}
+				if _, err := fmt.Fprintln(conn, src.suggest(prefix, dir)); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
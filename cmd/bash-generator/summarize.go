@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// summarizeMinLines is how long output must be before a summary is offered.
+	summarizeMinLines = 20
+	// Only the start and the end of long output are sent, where the headers and
+	// the final errors usually are.
+	summaryHeadBytes = 4 << 10
+	summaryTailBytes = 12 << 10
+)
+
+// outputCapture keeps the start and the end of everything written to it.
+type outputCapture struct {
+	head    bytes.Buffer
+	tail    []byte
+	total   int
+	newline int
+}
+
+func (c *outputCapture) Write(p []byte) (int, error) {
+	c.total += len(p)
+	c.newline += bytes.Count(p, []byte("\n"))
+	rest := p
+	if n := summaryHeadBytes - c.head.Len(); n > 0 {
+		n = min(n, len(rest))
+		c.head.Write(rest[:n])
+		rest = rest[n:]
+	}
+	c.tail = append(c.tail, rest...)
+	if len(c.tail) > 2*summaryTailBytes {
+		c.tail = append([]byte{}, c.tail[len(c.tail)-summaryTailBytes:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the captured output, with a marker where the middle was dropped.
+func (c *outputCapture) String() string {
+	tail := c.tail
+	if len(tail) > summaryTailBytes {
+		tail = tail[len(tail)-summaryTailBytes:]
+	}
+	omitted := c.total - c.head.Len() - len(tail)
+	if omitted <= 0 {
+		return c.head.String() + string(tail)
+	}
+	return fmt.Sprintf("%s\n[... %d bytes omitted ...]\n%s", c.head.String(), omitted, tail)
+}
+
+// offerSummary asks whether the output of a long command should be summarized
+// and prints the summary. Failures are reported but never fatal.
+func offerSummary(p *pipeline, input *lineReader, command string, out *outputCapture) {
+	if out.newline < summarizeMinLines {
+		return
+	}
+	fmt.Printf("\nSummarize the output? (y/N): ")
+	response, err := input.ReadLine()
+	if err != nil {
+		return
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	if response != "y" && response != "yes" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	summary, err := p.generator.Summarize(ctx, command, p.redactor.Redact(out.String()))
+	if err != nil {
+		fmt.Printf("Failed to summarize the output: %v\n", err)
+		return
+	}
+	p.recordChat(summary.Model, summary.Usage)
+	fmt.Printf("\n%s\n", summary.Text)
+}
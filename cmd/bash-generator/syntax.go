@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/jerilseb/bash-generator/internal/shell"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// syntaxAttempts is how many times the model is asked to correct a command
+// Bash can't parse before it is given up on.
+const syntaxAttempts = 2
+
+// errInvalidSyntax is returned when the model keeps answering with commands
+// Bash can't parse.
+var errInvalidSyntax = errors.New("the generated command isn't valid Bash")
+
+// bashSyntax parses command as Bash, running nothing, and returns what is
+// wrong with it, or "" if nothing. A here-document left open, which Bash only
+// warns about, counts as wrong too.
+func bashSyntax(command string) string {
+	if _, err := shell.Parse(command); err != nil {
+		return shell.Problem(err)
+	}
+	return ""
+}
+
+// checkSyntax makes sure resp holds a command Bash can parse. If it doesn't,
+// the model is told what is wrong and asked again, up to syntaxAttempts
+// times, and a command that is still broken is rejected rather than shown.
+func (p *pipeline) checkSyntax(ctx context.Context, text string, history []generate.Turn, resp *generate.Response) (*generate.Response, error) {
+	for attempt := 0; ; attempt++ {
+		problem := bashSyntax(resp.Command)
+		if problem == "" {
+			return resp, nil
+		}
+		slog.Warn("invalid syntax", "problem", problem, "attempt", attempt+1)
+		if attempt == syntaxAttempts {
+			return nil, fmt.Errorf("%w: %s", errInvalidSyntax, problem)
+		}
+		request := fmt.Sprintf("Bash can't parse that command: %s. Answer with the same command, its syntax fixed: "+
+			"balanced quotes, brackets and keywords, and here-documents that end with their delimiter.", problem)
+		turns := append(history[:len(history):len(history)], generate.Turn{Request: text, Command: resp.Command})
+		var err error
+		if resp, err = p.complete(ctx, request, turns); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBashSyntax(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		// problem is part of what is found wrong; empty if nothing is.
+		problem string
+	}{
+		{"simple", "ls -la", ""},
+		{"pipeline", "ps aux | grep -v grep | awk '{print $2}'", ""},
+		{"heredoc", "cat > notes.txt <<EOF\nThis is a note\nEOF", ""},
+		{"indented heredoc", "cat <<-EOF\n\thello\n\tEOF", ""},
+		{"loop", "for f in *.log; do gzip \"$f\"; done", ""},
+		{"placeholders", "ssh <user>@<host> 'df -h'", ""},
+		{"process substitution", "diff <(sort a.txt) <(sort b.txt)", ""},
+		{"unclosed heredoc", "cat > notes.txt <<EOF\nThis is a note", "here-document"},
+		{"heredoc delimiter indented", "cat > notes.txt <<EOF\nThis is a note\n  EOF", "here-document"},
+		{"unclosed single quote", "echo 'hello", "quote"},
+		{"unclosed double quote", `grep "foo *.txt`, "quote"},
+		{"unclosed substitution", "echo $(date", "("},
+		{"missing done", "for f in *; do echo $f", "done"},
+		{"missing fi", "if [ -f x ]; then rm x", "fi"},
+		{"stray done", "ls; done", "done"},
+		{"dangling pipe", "ls |", "|"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := bashSyntax(tt.command)
+			switch {
+			case tt.problem == "" && problem != "":
+				t.Errorf("bashSyntax(%q) = %q, want no problem", tt.command, problem)
+			case tt.problem != "" && !strings.Contains(problem, tt.problem):
+				t.Errorf("bashSyntax(%q) = %q, want a problem mentioning %q", tt.command, problem, tt.problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// termView redraws a block of lines in place, for output that changes while
+// the user watches. Lines are cut to the terminal width, as a wrapped line
+// would throw off the cursor movement, and end in \r\n so they also line up
+// while the terminal is in raw mode.
+type termView struct {
+	f *os.File
+	// drawn is the number of lines currently on screen.
+	drawn int
+}
+
+// newTermView returns a view drawing on f, or false if f isn't a terminal.
+func newTermView(f *os.File) (*termView, bool) {
+	if !term.IsTerminal(int(f.Fd())) {
+		return nil, false
+	}
+	return &termView{f: f}, true
+}
+
+func (v *termView) width() int {
+	w, _, err := term.GetSize(int(v.f.Fd()))
+	if err != nil || w <= 0 {
+		return 80
+	}
+	return w
+}
+
+// draw replaces what was drawn before with lines.
+func (v *termView) draw(lines []string) {
+	width := v.width()
+	var b strings.Builder
+	b.WriteString("\r")
+	if v.drawn > 1 {
+		fmt.Fprintf(&b, "\x1b[%dA", v.drawn-1)
+	}
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("\x1b[2K")
+		b.WriteString(truncateRunes(line, width-1))
+	}
+	// Clear what is left of a taller previous frame.
+	b.WriteString("\x1b[J")
+	v.f.WriteString(b.String())
+	v.drawn = max(len(lines), 1)
+}
+
+// clear removes the view from the screen.
+func (v *termView) clear() {
+	v.draw([]string{""})
+	v.drawn = 0
+}
+
+// truncateRunes cuts s to at most n runes.
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// wrapTail wraps s into lines of at most width runes and returns the last n of
+// them, marking the start with an ellipsis if anything was cut.
+func wrapTail(s string, width, n int) []string {
+	runes := []rune(s)
+	var lines []string
+	for len(runes) > width {
+		lines = append(lines, string(runes[:width]))
+		runes = runes[width:]
+	}
+	lines = append(lines, string(runes))
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+		lines[0] = "…" + string([]rune(lines[0])[1:])
+	}
+	return lines
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/usage"
+)
+
+// Phases of a run, in the order they happen.
+const (
+	phaseRecord     = "record"
+	phaseEncode     = "encode"
+	phaseTranscribe = "transcribe"
+	phaseGenerate   = "generate"
+)
+
+var phases = []string{phaseRecord, phaseEncode, phaseTranscribe, phaseGenerate}
+
+// timing adds up how long the phases of the current run took. Only the time
+// spent waiting counts: the parts of a long recording transcribed while it
+// went on don't.
+type timing struct {
+	mu     sync.Mutex
+	phases map[string]time.Duration
+}
+
+// add adds d to phase.
+func (t *timing) add(phase string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.phases == nil {
+		t.phases = make(map[string]time.Duration)
+	}
+	t.phases[phase] += d
+}
+
+// since adds the time since start to phase, as in defer t.since(phase, time.Now()).
+func (t *timing) since(phase string, start time.Time) {
+	t.add(phase, time.Since(start))
+}
+
+// take returns the phases timed since it was last called.
+func (t *timing) take() map[string]time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	phases := t.phases
+	t.phases = nil
+	return phases
+}
+
+// finishRun adds the phases of the run that just ended to the usage log, for
+// stats, and with -timing prints them to w. Failing to log them is reported
+// but never fatal.
+func (p *pipeline) finishRun(w io.Writer) {
+	timed := p.timing.take()
+	if len(timed) == 0 {
+		return
+	}
+	if p.showTiming {
+		fmt.Fprintln(w, formatTiming(timed))
+	}
+	c := usage.Call{Time: time.Now(), Kind: usage.Run, Phases: make(map[string]float64, len(timed))}
+	for phase, d := range timed {
+		c.Phases[phase] = d.Seconds()
+	}
+	if err := usageStore().Append(c); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save usage: %v\n", err)
+	}
+}
+
+// formatTiming returns the phases that were timed in one line, in order:
+// record 6.2s | encode 38ms | transcribe 1.9s | generate 1.1s.
+func formatTiming(timed map[string]time.Duration) string {
+	var parts []string
+	for _, phase := range phases {
+		if d, ok := timed[phase]; ok {
+			parts = append(parts, phase+" "+formatPhase(d))
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+// formatPhase rounds d to what is worth reading: milliseconds below a second,
+// tenths of a second above.
+func formatPhase(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+// phaseStats are the durations of a phase over many runs.
+type phaseStats struct {
+	phase          string
+	runs           int
+	median, slow90 time.Duration
+}
+
+// addUpTiming returns the median and 90th percentile duration of each phase
+// over the runs among calls, in the order of phases.
+func addUpTiming(calls []usage.Call) []phaseStats {
+	byPhase := make(map[string][]time.Duration)
+	for _, c := range calls {
+		if c.Kind != usage.Run {
+			continue
+		}
+		for phase, seconds := range c.Phases {
+			byPhase[phase] = append(byPhase[phase], time.Duration(seconds*float64(time.Second)))
+		}
+	}
+	var stats []phaseStats
+	for _, phase := range phases {
+		ds := byPhase[phase]
+		if len(ds) == 0 {
+			continue
+		}
+		slices.Sort(ds)
+		stats = append(stats, phaseStats{
+			phase:  phase,
+			runs:   len(ds),
+			median: ds[len(ds)/2],
+			slow90: ds[(len(ds)*9)/10],
+		})
+	}
+	return stats
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/internal/capability"
+)
+
+// tmuxFlag is the value of -tmux, which works as a bool flag or takes the
+// pane to type into, as in -tmux=work:1.2.
+type tmuxFlag struct {
+	set    bool
+	target string
+}
+
+func (f *tmuxFlag) String() string {
+	if f == nil || !f.set {
+		return ""
+	}
+	return f.target
+}
+
+func (f *tmuxFlag) Set(v string) error {
+	switch v {
+	case "true":
+		f.set = true
+	case "false":
+		f.set, f.target = false, ""
+	default:
+		f.set, f.target = true, v
+	}
+	return nil
+}
+
+func (f *tmuxFlag) IsBoolFlag() bool { return true }
+
+// tmux runs a tmux command and returns its output.
+func tmux(stdin string, args ...string) (string, error) {
+	path, err := capability.Require("tmux")
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("tmux: %s", msg)
+		}
+		return "", fmt.Errorf("tmux: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// resolveTmuxPane returns the ID of the pane target refers to. Besides tmux's
+// own target syntax (an index like 2 or 1.2, session:window.pane, a window
+// name, %id or {last}), a target may be a pane title. Without a target, it is
+// the pane used before this one inside tmux, and the active pane outside.
+func resolveTmuxPane(target string) (string, error) {
+	if _, err := tmux("", "has-session"); err != nil {
+		var missing *capability.MissingError
+		if errors.As(err, &missing) {
+			return "", err
+		}
+		return "", fmt.Errorf("no tmux session is running (%w)", err)
+	}
+	if target == "" && os.Getenv("TMUX") != "" {
+		// This pane is busy with us; the command is meant for the one before.
+		target = "{last}"
+	}
+	args := []string{"display-message", "-p"}
+	if target != "" {
+		args = append(args, "-t", target)
+	}
+	id, err := tmux("", append(args, "#{pane_id}")...)
+	if err == nil && id != "" {
+		return id, nil
+	}
+	if err == nil {
+		// Some versions of tmux print nothing for targets that don't exist.
+		err = errors.New("no such pane")
+	}
+
+	panes, listErr := tmux("", "list-panes", "-a", "-F", "#{pane_id}\t#{pane_title}")
+	if listErr != nil {
+		return "", err
+	}
+	var matches []string
+	for _, line := range strings.Split(panes, "\n") {
+		if id, title, ok := strings.Cut(line, "\t"); ok && title == target {
+			matches = append(matches, id)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no tmux pane %q: %w", target, err)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%d tmux panes are titled %q; use an index like 1.2 instead", len(matches), target)
+	}
+}
+
+// sendToTmux types command into a tmux pane without pressing Enter, so it can
+// be reviewed there, and returns the pane's ID. Commands of several lines are
+// pasted, so shells with bracketed paste don't run them line by line.
+func sendToTmux(target, command string) (string, error) {
+	pane, err := resolveTmuxPane(target)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(command, "\n") {
+		_, err = tmux("", "send-keys", "-t", pane, "-l", command)
+		return pane, err
+	}
+	const buffer = appName
+	if _, err := tmux(command, "load-buffer", "-b", buffer, "-"); err != nil {
+		return "", err
+	}
+	_, err = tmux("", "paste-buffer", "-p", "-d", "-b", buffer, "-t", pane)
+	return pane, err
+}
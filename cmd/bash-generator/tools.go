@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/internal/programs"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// checkTools looks for programs the generated command runs that aren't
+// installed, according to the tool check mode, which works like the lint
+// mode, and returns notes about them. In fix mode the model gets one chance to
+// do without them, and resp is replaced by its answer.
+func (p *pipeline) checkTools(ctx context.Context, text string, history []generate.Turn, resp *generate.Response) []string {
+	if p.toolMode == lintOff || !p.shell.bash() || p.script {
+		return nil
+	}
+	missing := programs.Missing(resp.Command)
+	if len(missing) > 0 && p.toolMode == lintFix {
+		request := fmt.Sprintf("These programs that command runs aren't installed on this machine: %s. "+
+			"Rewrite it using only programs that are installed, without changing what it does.", strings.Join(missing, ", "))
+		turns := append(history[:len(history):len(history)], generate.Turn{Request: text, Command: resp.Command})
+		fixed, err := p.complete(ctx, request, turns)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to fix the command: %v\n", err)
+		} else if remaining := programs.Missing(fixed.Command); len(remaining) < len(missing) {
+			*resp = *fixed
+			missing = remaining
+		}
+	}
+
+	notes := make([]string, len(missing))
+	for i, name := range missing {
+		notes[i] = fmt.Sprintf("%s is not installed", name)
+		if install := programs.InstallCommand(name); install != "" {
+			notes[i] += fmt.Sprintf(" (install it with: %s)", install)
+		}
+	}
+	return notes
+}
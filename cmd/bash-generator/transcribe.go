@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+// uploadFormats are the file types OpenAI's transcription API accepts, by extension.
+var uploadFormats = []string{"flac", "m4a", "mp3", "mp4", "mpeg", "mpga", "oga", "ogg", "wav", "webm"}
+
+// transcribeFlags are the flags of transcribe.
+type transcribeFlags struct {
+	opts    *options
+	command bool
+}
+
+func (f *transcribeFlags) define(fs *flag.FlagSet, cfg *config) error {
+	var err error
+	if f.opts, err = addPipelineFlags(fs, cfg); err != nil {
+		return err
+	}
+	fs.BoolVar(&f.command, "command", false, "also generate a command; it goes to stdout and the transcript to stderr")
+	return nil
+}
+
+// runTranscribe transcribes an existing audio file, e.g. a dictation recorded
+// on a phone, and optionally generates a command from it.
+func runTranscribe(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("transcribe", flag.ExitOnError)
+	var flags transcribeFlags
+	if err := flags.define(fs, cfg); err != nil {
+		return err
+	}
+	opts := flags.opts
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s transcribe [flags] FILE\n", appName)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	p, err := newPipeline(opts)
+	if err != nil {
+		return err
+	}
+	if opts.ShowCost {
+		defer func() { printUsage(os.Stderr, p.takeUsage()) }()
+	}
+	audio, filename, length, err := p.loadAudioFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	text, err := p.upload(ctx, audio, filename, length)
+	if err != nil {
+		return err
+	}
+	text = strings.TrimSpace(text)
+	if !flags.command {
+		fmt.Println(text)
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, text)
+	generated, err := p.generate(ctx, text, spokenRequest, nil)
+	if err != nil {
+		return err
+	}
+	recordHistory(newHistoryEntry(text, generated.Command))
+	fmt.Println(generated.Command)
+	return nil
+}
+
+// loadAudioFile reads the audio file at path for upload, see prepareAudio.
+func (p *pipeline) loadAudioFile(path string) (io.Reader, string, time.Duration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	return p.prepareAudio(data, path)
+}
+
+// prepareAudio returns the audio file data, named path, for upload, with the
+// file name to upload it under and, for WAV files, its length. A WAV file the
+// endpoint wouldn't take, because of its format or its size, is converted like
+// a recording; other files are sent as they are.
+func (p *pipeline) prepareAudio(data []byte, path string) (io.Reader, string, time.Duration, error) {
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	accepted := uploadFormats
+	if len(p.transcriber.Formats) > 0 {
+		accepted = nil
+		for _, f := range p.transcriber.Formats {
+			if enc, ok := record.Encoders[f]; ok {
+				accepted = append(accepted, strings.TrimPrefix(enc.Ext(), "."))
+			}
+		}
+	}
+	tooLarge := p.transcriber.MaxUploadSize > 0 && int64(len(data)) > p.transcriber.MaxUploadSize
+	if slices.Contains(accepted, format) && !tooLarge {
+		var length time.Duration
+		if format == "wav" {
+			if rec, err := record.ReadWAV(bytes.NewReader(data)); err == nil {
+				length = rec.Duration()
+			}
+		}
+		return bytes.NewReader(data), filepath.Base(path), length, nil
+	}
+
+	if format != "wav" {
+		if tooLarge {
+			return nil, "", 0, fmt.Errorf("%s is %.1f MB, more than the transcription endpoint accepts; convert it to FLAC, Opus or 16-bit WAV first", path, float64(len(data))/1e6)
+		}
+		return nil, "", 0, fmt.Errorf("the transcription endpoint doesn't accept %q files (only %s); convert it to 16-bit WAV first", format, strings.Join(accepted, ", "))
+	}
+	rec, err := record.ReadWAV(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	audio, err := p.encode(rec)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + p.encoder.Ext()
+	return audio, name, rec.Duration(), nil
+}
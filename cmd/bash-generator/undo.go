@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/history"
+	"github.com/jerilseb/bash-generator/internal/undo"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+	"github.com/jerilseb/bash-generator/pkg/safety"
+)
+
+// undoFor returns a command that reverses the command of entry, which is about
+// to run: the inverse the built-in rules know of, or else the model's, as long
+// as the command is still the one the model meant it for.
+func undoFor(entry history.Entry, generated *generate.Response, shell targetShell) string {
+	if shell.bash() {
+		if inverse := undo.Inverse(entry.Command, entry.Dir); inverse != "" {
+			return inverse
+		}
+	}
+	// Placeholders filled in the command are still open in the model's undo.
+	if entry.Edited || entry.Command != generated.Command || len(generate.FindPlaceholders(generated.Undo)) > 0 {
+		return ""
+	}
+	return generated.Undo
+}
+
+// undoFlags are the flags of undo.
+type undoFlags struct {
+	printOnly bool
+	auditPath string
+	auditKey  string
+}
+
+func (f *undoFlags) define(fs *flag.FlagSet, cfg *config) {
+	fs.BoolVar(&f.printOnly, "print", false, "print the command that undoes the last one instead of offering to run it")
+	fs.StringVar(&f.auditPath, "audit-log", cfg.AuditLog, "also append the command to this audit log")
+	fs.StringVar(&f.auditKey, "audit-key", cfg.AuditKey, "file with a key to sign the records of the audit log with")
+}
+
+// runUndo offers to reverse the last command that was run, in the directory
+// it ran in. Running undo again goes further back.
+func runUndo(args []string) error {
+	fs := flag.NewFlagSet("undo", flag.ExitOnError)
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	var flags undoFlags
+	flags.define(fs, cfg)
+	fs.Parse(args)
+	if err := setupAudit(flags.auditPath, flags.auditKey); err != nil {
+		return err
+	}
+	shell, err := lookupShell(cfg.Shell)
+	if err != nil {
+		return err
+	}
+	entries, err := historyStore().Load()
+	if err != nil {
+		return err
+	}
+	last, ok := lastUndoable(entries)
+	if !ok {
+		return errors.New("there is no command left to undo")
+	}
+	if last.Undo == "" {
+		return fmt.Errorf("there's no known way to undo the last command run: %s", last.Command)
+	}
+	if flags.printOnly {
+		fmt.Println(last.Undo)
+		return nil
+	}
+
+	fmt.Printf("Last command run, in %s on %s:\n\n%s\n", last.Dir, last.Time.Local().Format("2006-01-02 15:04"), last.Command)
+	var notes []string
+	if last.ExitCode != nil && *last.ExitCode != 0 {
+		notes = append(notes, fmt.Sprintf("It failed (exit status %d), so it may have changed less than the undo expects.", *last.ExitCode))
+	}
+	fmt.Print("\nTo undo it:\n")
+	at := last.Time
+	entry := history.Entry{Time: time.Now(), Transcript: "undo: " + last.Transcript, Command: last.Undo, Dir: last.Dir, Project: last.Project, UndoOf: &at}
+	run, err := reviewCommand(newLineReader(os.Stdin), &entry, notes, safety.Check(entry.Command), false, false, nil, nil)
+	if err != nil {
+		return err
+	}
+	if !run {
+		recordHistory(entry)
+		fmt.Println("Command not executed.")
+		return nil
+	}
+
+	entry.Accepted = true
+	fmt.Println()
+	cmd := shell.command(entry.Command)
+	cmd.Dir = entry.Dir
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	exitCode := cmd.ProcessState.ExitCode()
+	entry.ExitCode = &exitCode
+	recordHistory(entry)
+	if err != nil {
+		return fmt.Errorf("failed to execute command: %w", err)
+	}
+	return nil
+}
+
+// lastUndoable returns the latest entry of a command that was run and hasn't
+// been undone yet. Commands run by undo are skipped, so undoing again goes
+// further back instead of redoing.
+func lastUndoable(entries []history.Entry) (history.Entry, bool) {
+	undone := make(map[time.Time]bool)
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		switch {
+		case e.UndoOf != nil:
+			if e.ExitCode != nil && *e.ExitCode == 0 {
+				undone[e.UndoOf.UTC()] = true
+			}
+		case e.ExitCode != nil && !undone[e.Time.UTC()]:
+			return e, true
+		}
+	}
+	return history.Entry{}, false
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/history"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+func TestUndoFor(t *testing.T) {
+	bash, powershell := targetShells[0], targetShells[1]
+	dir := t.TempDir()
+	tests := []struct {
+		name      string
+		entry     history.Entry
+		generated generate.Response
+		shell     targetShell
+		want      string
+	}{
+		{
+			name:      "built-in rule",
+			entry:     history.Entry{Command: "mkdir build", Dir: dir},
+			generated: generate.Response{Command: "mkdir build", Undo: "rm -rf build"},
+			shell:     bash,
+			want:      "rmdir -- build",
+		},
+		{
+			name:      "model's undo",
+			entry:     history.Entry{Command: "systemctl --user start backup", Dir: dir},
+			generated: generate.Response{Command: "systemctl --user start backup", Undo: "systemctl --user stop backup"},
+			shell:     bash,
+			want:      "systemctl --user stop backup",
+		},
+		{
+			name:      "only the model's for other shells",
+			entry:     history.Entry{Command: "mkdir build", Dir: dir},
+			generated: generate.Response{Command: "mkdir build", Undo: "Remove-Item build"},
+			shell:     powershell,
+			want:      "Remove-Item build",
+		},
+		{
+			name:      "edited command",
+			entry:     history.Entry{Command: "systemctl --user start backup-daily", Dir: dir, Edited: true},
+			generated: generate.Response{Command: "systemctl --user start backup", Undo: "systemctl --user stop backup"},
+			shell:     bash,
+		},
+		{
+			name:      "filled placeholders",
+			entry:     history.Entry{Command: "systemctl --user start backup", Dir: dir},
+			generated: generate.Response{Command: "systemctl --user start <unit>", Undo: "systemctl --user stop <unit>"},
+			shell:     bash,
+		},
+		{
+			name:      "placeholders left in the undo",
+			entry:     history.Entry{Command: "docker run -d nginx", Dir: dir},
+			generated: generate.Response{Command: "docker run -d nginx", Undo: "docker rm -f <container>"},
+			shell:     bash,
+		},
+		{
+			name:      "none known",
+			entry:     history.Entry{Command: "rm -rf build", Dir: dir},
+			generated: generate.Response{Command: "rm -rf build"},
+			shell:     bash,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := undoFor(tt.entry, &tt.generated, tt.shell); got != tt.want {
+				t.Errorf("undoFor = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastUndoable(t *testing.T) {
+	at := func(minute int) time.Time { return time.Date(2026, 10, 1, 12, minute, 0, 0, time.UTC) }
+	status := func(code int) *int { return &code }
+	ran := func(minute int, command string) history.Entry {
+		return history.Entry{Time: at(minute), Command: command, Undo: "undo " + command, ExitCode: status(0)}
+	}
+	// undid is an undo of the entry at minute of, which exited with code,
+	// or wasn't run if code is nil.
+	undid := func(minute, of int, code *int) history.Entry {
+		t := at(of)
+		return history.Entry{Time: at(minute), Command: "undo", UndoOf: &t, ExitCode: code}
+	}
+	tests := []struct {
+		name    string
+		entries []history.Entry
+		// want is the command of the entry to undo; empty if there is none.
+		want string
+	}{
+		{"empty", nil, ""},
+		{"last run", []history.Entry{ran(1, "a"), ran(2, "b")}, "b"},
+		{"not run", []history.Entry{ran(1, "a"), {Time: at(2), Command: "b", Undo: "undo b"}}, "a"},
+		{"failed", []history.Entry{ran(1, "a"), {Time: at(2), Command: "b", ExitCode: status(1)}}, "b"},
+		{"undone", []history.Entry{ran(1, "a"), ran(2, "b"), undid(3, 2, status(0))}, "a"},
+		{"undone twice", []history.Entry{ran(1, "a"), ran(2, "b"), undid(3, 2, status(0)), undid(4, 1, status(0))}, ""},
+		{"undo failed", []history.Entry{ran(1, "a"), ran(2, "b"), undid(3, 2, status(1))}, "b"},
+		{"undo declined", []history.Entry{ran(1, "a"), ran(2, "b"), undid(3, 2, nil)}, "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := lastUndoable(tt.entries)
+			if ok != (tt.want != "") || got.Command != tt.want {
+				t.Errorf("lastUndoable = %q, %v; want %q", got.Command, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunUndo(t *testing.T) {
+	dir := t.TempDir()
+	for _, env := range []string{"HOME", "XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_STATE_HOME"} {
+		t.Setenv(env, dir)
+	}
+	status := 0
+	store := historyStore()
+
+	if err := runUndo([]string{"-print"}); err == nil || !strings.Contains(err.Error(), "no command left to undo") {
+		t.Errorf("undo of an empty history = %v, want an error", err)
+	}
+
+	if err := store.Append(history.Entry{Time: time.Now(), Command: "rm -rf build", Dir: dir, Accepted: true, ExitCode: &status}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runUndo([]string{"-print"}); err == nil || !strings.Contains(err.Error(), "no known way to undo") {
+		t.Errorf("undo of a command without an undo = %v, want an error", err)
+	}
+
+	if err := store.Append(history.Entry{Time: time.Now(), Command: "mkdir out", Undo: "rmdir -- out", Dir: dir, Accepted: true, ExitCode: &status}); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	out := captureStdout(t, func() { err = runUndo([]string{"-print"}) })
+	if err != nil || out != "rmdir -- out\n" {
+		t.Errorf("undo -print = %q, %v; want the stored undo", out, err)
+	}
+}
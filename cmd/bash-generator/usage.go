@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/usage"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// recordTranscription notes a transcription of audio of the given length, zero
+// if it isn't known.
+func (p *pipeline) recordTranscription(model string, length time.Duration) {
+	p.recordUsage(usage.Call{Kind: usage.Transcription, Model: model, AudioSeconds: length.Seconds()})
+}
+
+// recordChat notes a chat completion.
+func (p *pipeline) recordChat(model string, u generate.Usage) {
+	p.recordUsage(usage.Call{Kind: usage.Chat, Model: model, PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens})
+}
+
+// recordUsage adds c to the calls of the current run and to the usage log.
+// Failing to log it is reported but never fatal.
+func (p *pipeline) recordUsage(c usage.Call) {
+	c.Time = time.Now()
+	p.usageMu.Lock()
+	p.calls = append(p.calls, c)
+	p.usageMu.Unlock()
+	if err := usageStore().Append(c); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save usage: %v\n", err)
+	}
+}
+
+// takeUsage returns the calls made since it was last called.
+func (p *pipeline) takeUsage() []usage.Call {
+	p.usageMu.Lock()
+	defer p.usageMu.Unlock()
+	calls := p.calls
+	p.calls = nil
+	return calls
+}
+
+// usageTotal adds up the calls made to one model.
+type usageTotal struct {
+	kind, model      string
+	calls            int
+	audio            time.Duration
+	promptTokens     int
+	completionTokens int
+	cost             float64
+	// unknown counts the calls whose cost isn't known.
+	unknown int
+}
+
+// addUpUsage totals calls per model, in the order the models were first used.
+func addUpUsage(calls []usage.Call) []*usageTotal {
+	var totals []*usageTotal
+	byModel := make(map[[2]string]*usageTotal)
+	for _, c := range calls {
+		if c.Kind == usage.Run {
+			continue
+		}
+		key := [2]string{c.Kind, c.Model}
+		t := byModel[key]
+		if t == nil {
+			t = &usageTotal{kind: c.Kind, model: c.Model}
+			byModel[key] = t
+			totals = append(totals, t)
+		}
+		t.calls++
+		t.audio += c.Audio()
+		t.promptTokens += c.PromptTokens
+		t.completionTokens += c.CompletionTokens
+		usd, known := c.Cost()
+		t.cost += usd
+		if !known {
+			t.unknown++
+		}
+	}
+	return totals
+}
+
+// formatCost formats a cost in USD, saying so if part of it is unknown.
+func formatCost(usd float64, unknown bool) string {
+	switch {
+	case unknown && usd == 0:
+		return "unknown"
+	case unknown:
+		return fmt.Sprintf("$%.4f + unknown", usd)
+	default:
+		return fmt.Sprintf("$%.4f", usd)
+	}
+}
+
+// printUsage writes what calls cost, one line per model, for -cost.
+func printUsage(w io.Writer, calls []usage.Call) {
+	if len(calls) == 0 {
+		return
+	}
+	var total float64
+	unknown := false
+	fmt.Fprintln(w)
+	for _, t := range addUpUsage(calls) {
+		what := fmt.Sprintf("%d prompt and %d completion tokens", t.promptTokens, t.completionTokens)
+		if t.kind == usage.Transcription {
+			what = fmt.Sprintf("%.1fs of audio", t.audio.Seconds())
+			if t.audio == 0 {
+				what = "audio of unknown length"
+			}
+		}
+		fmt.Fprintf(w, "Cost: %s, %s: %s\n", t.model, what, formatCost(t.cost, t.unknown > 0))
+		total += t.cost
+		unknown = unknown || t.unknown > 0
+	}
+	fmt.Fprintf(w, "Cost: total %s\n", formatCost(total, unknown))
+}
+
+// statsFlags are the flags of stats.
+type statsFlags struct {
+	days   int
+	socket string
+}
+
+func (f *statsFlags) define(fs *flag.FlagSet) {
+	fs.IntVar(&f.days, "days", 30, "how many days back to add up usage for; 0 for everything")
+	fs.StringVar(&f.socket, "socket", socketPath(), "path of the daemon's Unix socket")
+}
+
+// runStats adds up the API calls of the last days from the usage log, and
+// shows the resource usage of the daemon if one is running.
+func runStats(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	var flags statsFlags
+	flags.define(fs)
+	fs.Parse(args)
+
+	var since time.Time
+	period := "so far"
+	if flags.days > 0 {
+		since = time.Now().AddDate(0, 0, -flags.days)
+		period = fmt.Sprintf("in the last %d days", flags.days)
+	}
+	calls, err := usageStore().Load(since)
+	if err != nil {
+		return err
+	}
+
+	totals := addUpUsage(calls)
+	if len(totals) == 0 {
+		fmt.Printf("No API calls %s.\n", period)
+	} else {
+		fmt.Printf("API calls %s (estimated from list prices):\n\n", period)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MODEL\tCALLS\tAUDIO\tPROMPT TOKENS\tCOMPLETION TOKENS\tCOST")
+		var total float64
+		unknown := false
+		for _, t := range totals {
+			audio, prompt, completion := "-", "-", "-"
+			if t.kind == usage.Transcription {
+				audio = t.audio.Round(time.Second).String()
+			} else {
+				prompt, completion = fmt.Sprint(t.promptTokens), fmt.Sprint(t.completionTokens)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", t.model, t.calls, audio, prompt, completion, formatCost(t.cost, t.unknown > 0))
+			total += t.cost
+			unknown = unknown || t.unknown > 0
+		}
+		fmt.Fprintf(w, "total\t\t\t\t\t%s\n", formatCost(total, unknown))
+		w.Flush()
+	}
+
+	if cfg.MonthlyBudget > 0 {
+		spent, err := monthSpend(time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\nThis month: $%.2f of the $%.2f budget (%.0f%%).\n", spent, cfg.MonthlyBudget, 100*spent/cfg.MonthlyBudget)
+	}
+
+	if stats := addUpTiming(calls); len(stats) > 0 {
+		fmt.Printf("\nTime per phase %s:\n\n", period)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PHASE\tRUNS\tMEDIAN\t90TH PERCENTILE")
+		for _, s := range stats {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", s.phase, s.runs, formatPhase(s.median), formatPhase(s.slow90))
+		}
+		w.Flush()
+	}
+
+	// The daemon is optional; when none is running there is nothing more to show.
+	if resp, err := sendDaemonRequest(flags.socket, daemonRequest{Action: "stats"}); err == nil && resp.Stats != nil {
+		fmt.Printf("\nDaemon:\n\n")
+		printDaemonStats(resp)
+	}
+	return nil
+}
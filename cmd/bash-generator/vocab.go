@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultVocabulary are tool names Whisper tends to mishear as English words
+// ("grep" as "grab", "kubectl" as "cube control").
+var defaultVocabulary = []string{
+	"grep", "awk", "sed", "xargs", "chmod", "chown", "systemctl", "journalctl",
+	"kubectl", "docker", "tar", "rsync", "ssh", "curl", "jq", "git", "sudo",
+	"ls", "du", "df", "pwd", "mkdir", "rm", "cd", "ps", "lsof", "htop", "fzf",
+}
+
+// maxPromptLength keeps the prompt within the 224 tokens Whisper looks at.
+const maxPromptLength = 600
+
+// maxPromptHistory is how many recent commands are mined for tool names.
+const maxPromptHistory = 20
+
+// loadVocabulary returns the built-in vocabulary extended with the words from
+// the config file and from vocab.txt (one word or phrase per line, # comments).
+func loadVocabulary(cfg *config) ([]string, error) {
+	words := append(append([]string{}, defaultVocabulary...), cfg.Vocabulary...)
+
+	f, err := os.Open(filepath.Join(configDir(), vocabFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return words, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	return words, scanner.Err()
+}
+
+// transcriptionPrompt builds the Whisper prompt from the vocabulary and,
+// optionally, the programs used in recent shell commands. Later words win when
+// the prompt has to be cut, so history comes first and user-supplied words last.
+func transcriptionPrompt(vocab []string, withHistory bool) string {
+	var words []string
+	if withHistory {
+		if recent, err := collectShellHistory(); err == nil {
+			if len(recent) > maxPromptHistory {
+				recent = recent[:maxPromptHistory]
+			}
+			for _, cmd := range recent {
+				if fields := strings.Fields(cmd); len(fields) > 0 {
+					words = append(words, filepath.Base(fields[0]))
+				}
+			}
+		}
+	}
+	words = append(words, vocab...)
+
+	seen := make(map[string]bool)
+	var unique []string
+	for i := len(words) - 1; i >= 0; i-- {
+		if w := words[i]; !seen[w] {
+			seen[w] = true
+			unique = append(unique, w)
+		}
+	}
+	// unique is newest first; keep as many as fit, then restore the original order.
+	var kept []string
+	length := 0
+	for _, w := range unique {
+		if length+len(w)+2 > maxPromptLength {
+			break
+		}
+		length += len(w) + 2
+		kept = append(kept, w)
+	}
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	return strings.Join(kept, ", ")
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/jerilseb/bash-generator/internal/history"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+	"github.com/jerilseb/bash-generator/pkg/record"
+	"github.com/jerilseb/bash-generator/pkg/safety"
+)
+
+// voiceAnswer is what was said back to a command with listen -confirm.
+type voiceAnswer int
+
+const (
+	answerUnclear voiceAnswer = iota
+	answerRun
+	answerCancel
+	answerExplain
+)
+
+// voiceGrammar is the phrases each answer is spotted by. Cancelling comes
+// first, so "no, don't run it" isn't taken for running it.
+var voiceGrammar = []struct {
+	answer  voiceAnswer
+	phrases []string
+}{
+	{answerCancel, []string{"cancel", "no", "nope", "stop", "don't", "do not", "never mind", "nevermind", "forget it", "abort"}},
+	{answerExplain, []string{"explain", "what does it do", "what does that do", "what's that", "why"}},
+	{answerRun, []string{"run it", "run", "yes", "yeah", "yep", "go", "go ahead", "do it", "execute", "okay", "ok", "sure"}},
+}
+
+const (
+	// maxAnswerWords is the most words an answer may have. Anything longer
+	// is taken for talk that wasn't meant as one, and isn't acted on.
+	maxAnswerWords = 5
+	// voiceAttempts is how many unclear answers, or none, are asked again
+	// before the command is dropped.
+	voiceAttempts = 3
+)
+
+// parseVoiceAnswer spots the answer in a transcript of what was said.
+func parseVoiceAnswer(transcript string) voiceAnswer {
+	// Transcripts may spell "don't" with a typographic apostrophe.
+	transcript = strings.ReplaceAll(strings.ToLower(transcript), "’", "'")
+	words := strings.FieldsFunc(transcript, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	if len(words) == 0 || len(words) > maxAnswerWords {
+		return answerUnclear
+	}
+	said := " " + strings.Join(words, " ") + " "
+	for _, g := range voiceGrammar {
+		for _, phrase := range g.phrases {
+			if strings.Contains(said, " "+phrase+" ") {
+				return g.answer
+			}
+		}
+	}
+	return answerUnclear
+}
+
+// listenForAnswer records what is said next, without waiting for the wake
+// word, up to the first pause. It returns nil if nothing was said.
+func (l *wakeListener) listenForAnswer(ctx context.Context, recorder microphone) (*record.Recording, error) {
+	done := make(chan struct{})
+	var once sync.Once
+	l.stop = func() { once.Do(func() { close(done) }) }
+	defer context.AfterFunc(ctx, l.stop)()
+	l.wake()
+	_, err := recorder.RecordFunc(done, l.onChunk)
+	l.stop()
+	if err != nil {
+		return nil, err
+	}
+	return l.take(), nil
+}
+
+// confirmByVoice asks to run generated, which was made for text, and
+// listens for "run it", "cancel" or "explain", so that the command can be
+// run without touching the keyboard. Dangerous commands are never run this
+// way. Failures are reported and listening for the wake word goes on.
+func confirmByVoice(ctx context.Context, p *pipeline, text string, generated *generate.Response, listen func() (*record.Recording, error)) {
+	entry := newHistoryEntry(text, generated.Command)
+	defer func() { recordHistory(entry) }()
+	if verdict := checkCommand(generated); verdict.Level == safety.Dangerous {
+		p.say(ctx, "This command is dangerous, so it can't be run by voice. Run it from the keyboard if you're sure.")
+		return
+	}
+
+	var explanation string
+	for tries := 0; tries < voiceAttempts && ctx.Err() == nil; {
+		p.say(ctx, "Run it, cancel, or explain?")
+		rec, err := listen()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to record the answer: %v\n", err)
+			return
+		}
+		answer := answerUnclear
+		if rec != nil {
+			said, err := p.transcribe(ctx, rec)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to transcribe the answer: %v\n", err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "> %s\n", strings.TrimSpace(said))
+			answer = parseVoiceAnswer(said)
+		}
+
+		switch answer {
+		case answerRun:
+			runConfirmed(ctx, p, &entry, generated)
+			return
+		case answerCancel:
+			p.say(ctx, "Cancelled.")
+			return
+		case answerExplain:
+			if explanation == "" {
+				if explanation, err = p.explain(ctx, generated.Command); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to explain the command: %v\n", err)
+					explanation = generated.Explanation
+				}
+			}
+			if explanation != "" {
+				p.say(ctx, explanation)
+			}
+		default:
+			tries++
+		}
+	}
+	if ctx.Err() == nil {
+		p.say(ctx, "Didn't get an answer, so the command wasn't run.")
+	}
+}
+
+// runConfirmed runs the command of entry, confirmed by voice, and says how it
+// went. The command has no input, as nobody is at the keyboard.
+func runConfirmed(ctx context.Context, p *pipeline, entry *history.Entry, generated *generate.Response) {
+	entry.Accepted = true
+	entry.Undo = undoFor(*entry, generated, p.shell)
+	cmd := p.shell.command(entry.Command)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	err := cmd.Run()
+	if cmd.ProcessState == nil {
+		fmt.Fprintf(os.Stderr, "Failed to run the command: %v\n", err)
+		return
+	}
+	exitCode := cmd.ProcessState.ExitCode()
+	entry.ExitCode = &exitCode
+	if exitCode != 0 {
+		p.say(ctx, fmt.Sprintf("The command failed with exit status %d.", exitCode))
+		return
+	}
+	p.say(ctx, "Done.")
+}
+
+// explain asks the model what command does, part by part.
+func (p *pipeline) explain(ctx context.Context, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	explanation, err := p.generator.Explain(ctx, command)
+	if err != nil {
+		return "", err
+	}
+	p.recordChat(explanation.Model, explanation.Usage)
+	return explanation.Text, nil
+}
+
+// say shows text on stderr and, with -speak, reads it aloud and waits for it
+// to finish, so that it isn't recorded as the answer.
+func (p *pipeline) say(ctx context.Context, text string) {
+	fmt.Fprintln(os.Stderr, text)
+	if p.speaker == nil {
+		return
+	}
+	if err := p.speaker.say(ctx, text); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read it aloud: %v\n", err)
+		return
+	}
+	p.speaker.wait()
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jerilseb/bash-generator/internal/effects"
+)
+
+// printEffects shows what command would do if it were run, with -what-if:
+// the files it reads, writes and deletes, its use of the network and the
+// privileges it gains.
+func printEffects(w io.Writer, command string) {
+	summary := effects.Analyze(command).Summary()
+	if len(summary) == 0 {
+		fmt.Fprintln(w, "What if: this command touches no files, needs no network and gains no privileges, as far as can be told.")
+		return
+	}
+	fmt.Fprintln(w, "What if: this command")
+	for _, s := range summary {
+		fmt.Fprintf(w, "  %s\n", s)
+	}
+}
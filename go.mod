@@ -1,19 +1,22 @@
-module bash-generator
+module github.com/jerilseb/bash-generator
 
 go 1.23.2
 
 require (
 	github.com/briandowns/spinner v1.23.1
-	github.com/go-audio/audio v1.0.0
-	github.com/go-audio/wav v1.1.0
 	github.com/gordonklaus/portaudio v0.0.0-20230709114228-aafa478834f5
+	github.com/klauspost/compress v1.17.11
+	github.com/pkoukk/tiktoken-go v0.1.8
+	github.com/pkoukk/tiktoken-go-loader v0.0.2
+	golang.org/x/sys v0.26.0
+	golang.org/x/term v0.25.0
+	mvdan.cc/sh/v3 v3.10.0
 )
 
 require (
+	github.com/dlclark/regexp2 v1.10.0 // indirect
 	github.com/fatih/color v1.7.0 // indirect
-	github.com/go-audio/riff v1.0.0 // indirect
+	github.com/google/uuid v1.3.0 // indirect
 	github.com/mattn/go-colorable v0.1.2 // indirect
 	github.com/mattn/go-isatty v0.0.8 // indirect
-	golang.org/x/sys v0.0.0-20220412211240-33da011f77ad // indirect
-	golang.org/x/term v0.1.0 // indirect
 )
@@ -0,0 +1,212 @@
+// Package audit keeps an append-only JSON Lines log of the commands generated
+// and run, with who ran them where, for teams sharing a machine. Each record
+// holds the hash of the one before it, so records taken out or changed show
+// up, and with a key it is signed as well.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Record is one command.
+type Record struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user"`
+	Host       string    `json:"host"`
+	Dir        string    `json:"dir,omitempty"`
+	Transcript string    `json:"transcript"`
+	Command    string    `json:"command"`
+	// Edited is set when the user changed the generated command.
+	Edited bool `json:"edited,omitempty"`
+	// Accepted is set when the user confirmed the command.
+	Accepted bool `json:"accepted"`
+	// ExitCode is the exit status of the command, if it was run.
+	ExitCode *int `json:"exit_code,omitempty"`
+	// Prev is the SHA-256 of the line before this one, empty for the first.
+	Prev string `json:"prev,omitempty"`
+	// Sig is the HMAC-SHA256 of the record without Sig, under the log's key.
+	Sig string `json:"sig,omitempty"`
+}
+
+// Log is an audit log file.
+type Log struct {
+	Path string
+	// Key signs the records; none are signed without one.
+	Key []byte
+}
+
+// Append adds r to the end of the log, chained to the record before it, and
+// creates the log if needed. The file is locked while the last record is
+// read, so processes appending at once keep the chain intact.
+func (l *Log) Append(r Record) (err error) {
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	// Closing can fail to write the record too, so its error counts.
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	if err := lock(f); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", l.Path, err)
+	}
+	defer unlock(f)
+
+	last, err := lastLine(f)
+	if err != nil {
+		return err
+	}
+	r.Prev, r.Sig = "", ""
+	if last != nil {
+		r.Prev = lineHash(last)
+	}
+	if l.Key != nil {
+		if r.Sig, err = sign(r, l.Key); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Load returns all records, oldest first. A missing file is an empty log.
+func (l *Log) Load() ([]Record, error) {
+	f, err := os.Open(l.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []Record
+	err = scan(f, func(n int, line []byte) error {
+		var r Record
+		if err := json.Unmarshal(line, &r); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		records = append(records, r)
+		return nil
+	})
+	return records, err
+}
+
+// Verify checks that every record of the log follows the one before it and,
+// with the key, that it is signed with it. It returns how many records there
+// are, and what is wrong with the first one that fails.
+func (l *Log) Verify() (int, error) {
+	f, err := os.Open(l.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var count int
+	var prev []byte
+	err = scan(f, func(n int, line []byte) error {
+		var r Record
+		if err := json.Unmarshal(line, &r); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		want := ""
+		if prev != nil {
+			want = lineHash(prev)
+		}
+		if r.Prev != want {
+			return fmt.Errorf("line %d doesn't follow the line before it: a record was changed, removed or added", n)
+		}
+		if l.Key != nil {
+			sig, err := sign(r, l.Key)
+			if err != nil {
+				return err
+			}
+			if r.Sig == "" {
+				return fmt.Errorf("line %d isn't signed", n)
+			}
+			if !hmac.Equal([]byte(sig), []byte(r.Sig)) {
+				return fmt.Errorf("line %d isn't signed with this key", n)
+			}
+		}
+		prev = append(prev[:0], line...)
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// scan calls f with each line of r that isn't blank, counting from 1.
+func scan(r io.Reader, f func(n int, line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			if err := f(n, line); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// lastLine returns the last line of f that isn't blank, or nil if there is
+// none. Only the end of the file is read.
+func lastLine(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	for chunk := int64(4096); ; chunk *= 2 {
+		start := max(size-chunk, 0)
+		buf := make([]byte, size-start)
+		if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+			return nil, err
+		}
+		buf = bytes.TrimRight(buf, " \t\r\n")
+		if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+			return bytes.TrimSpace(buf[i+1:]), nil
+		}
+		if start == 0 {
+			if len(buf) == 0 {
+				return nil, nil
+			}
+			return bytes.TrimSpace(buf), nil
+		}
+	}
+}
+
+func lineHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// sign returns the signature of r, made over its JSON without Sig.
+func sign(r Record, key []byte) (string, error) {
+	r.Sig = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
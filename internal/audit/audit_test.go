@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendVerify(t *testing.T) {
+	l := &Log{Path: filepath.Join(t.TempDir(), "audit", "log.jsonl"), Key: []byte("secret")}
+	for _, command := range []string{"ls -la", "df -h", "rm -rf build"} {
+		if err := l.Append(Record{Time: time.Now(), User: "me", Command: command, Accepted: true}); err != nil {
+			t.Fatalf("Append(%q) = %v", command, err)
+		}
+	}
+	records, err := l.Load()
+	if err != nil || len(records) != 3 || records[2].Command != "rm -rf build" {
+		t.Fatalf("Load = %+v, %v; want the three records in order", records, err)
+	}
+	if records[0].Prev != "" || records[1].Prev == "" || records[2].Sig == "" {
+		t.Errorf("records aren't chained and signed: %+v", records)
+	}
+	if n, err := l.Verify(); n != 3 || err != nil {
+		t.Errorf("Verify = %d, %v; want 3, nil", n, err)
+	}
+	if n, err := (&Log{Path: l.Path, Key: []byte("other")}).Verify(); err == nil {
+		t.Errorf("Verify with another key = %d, nil; want an error", n)
+	}
+
+	data, err := os.ReadFile(l.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	tests := []struct {
+		name    string
+		changed string
+	}{
+		{"changed", strings.Replace(string(data), "df -h", "df -H", 1)},
+		{"removed", lines[0] + lines[2]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := &Log{Path: filepath.Join(t.TempDir(), "log.jsonl"), Key: l.Key}
+			if err := os.WriteFile(tampered.Path, []byte(tt.changed), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := tampered.Verify(); err == nil {
+				t.Errorf("Verify of a %s log = %d, nil; want an error", tt.name, n)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Package capability keeps track of the optional external programs features
+// depend on, so a missing program disables a feature with a clear message
+// instead of failing somewhere in the middle of a run.
+package capability
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Capability is something a feature needs from the system.
+type Capability struct {
+	Name string
+	// Feature describes what is disabled without the capability.
+	Feature string
+	// Programs are alternatives; any one of them on PATH is enough.
+	Programs []string
+	// Hint tells the user how to get one of the programs.
+	Hint string
+}
+
+// Registry lists every optional capability.
+var Registry = []Capability{
+	{Name: "opus", Feature: "Opus audio uploads", Programs: []string{"opusenc"}, Hint: "install opus-tools"},
+	{Name: "shellcheck", Feature: "linting generated commands with -lint", Programs: []string{"shellcheck"}, Hint: "install shellcheck"},
+	{Name: "clipboard", Feature: "copying commands to the system clipboard", Programs: []string{"pbcopy", "wl-copy", "xclip", "xsel", "clip"}, Hint: "install wl-clipboard or xclip; -copy falls back to OSC 52"},
+	{Name: "sandbox", Feature: "previewing commands in a container with -sandbox", Programs: []string{"podman", "docker"}, Hint: "install Podman or Docker"},
+	{Name: "tmux", Feature: "typing commands into a tmux pane with -tmux", Programs: []string{"tmux"}, Hint: "install tmux"},
+	{Name: "keyring", Feature: "storing API keys with auth login", Programs: []string{"security", "secret-tool"}, Hint: "install libsecret-tools; otherwise keys come from the environment"},
+	{Name: "wakeword", Feature: "hands-free requests with listen", Programs: []string{"bash-generator-wakeword"}, Hint: "install openwakeword and put contrib/wakeword/bash-generator-wakeword on PATH, or set wake_word_detector"},
+	{Name: "speech", Feature: "reading commands aloud with -speak, without the API", Programs: []string{"say", "espeak-ng", "espeak"}, Hint: "install espeak-ng, or set speech_engine to openai"},
+	{Name: "audio-player", Feature: "playing speech from the API with -speak", Programs: []string{"afplay", "paplay", "aplay", "ffplay"}, Hint: "install pulseaudio-utils, alsa-utils or ffmpeg, or espeak-ng to speak without the API"},
+	{Name: "hotkey", Feature: "registering a global hotkey with serve -hotkey", Programs: []string{"skhd", "swaymsg", "hyprctl", "xbindkeys"}, Hint: "install xbindkeys on X11 or skhd on macOS; sway and Hyprland need no extra program"},
+	{Name: "typing", Feature: "typing commands into the focused window with serve -hotkey", Programs: []string{"osascript", "wtype", "xdotool", "ydotool"}, Hint: "install wtype on Wayland or xdotool on X11; the command goes to the clipboard otherwise"},
+	{Name: "notify", Feature: "desktop notifications with serve -hotkey", Programs: []string{"osascript", "notify-send"}, Hint: "install libnotify-bin"},
+	{Name: "systemd", Feature: "running the daemon as a service with install-service", Programs: []string{"systemctl"}, Hint: "start bash-generator serve from your desktop's autostart instead"},
+	{Name: "fzf", Feature: "choosing among earlier commands with -picker fzf", Programs: []string{"fzf"}, Hint: "install fzf"},
+	{Name: "rofi", Feature: "choosing among earlier commands with -picker rofi", Programs: []string{"rofi"}, Hint: "install rofi"},
+	{Name: "dmenu", Feature: "choosing among earlier commands with -picker dmenu", Programs: []string{"dmenu"}, Hint: "install dmenu (suckless-tools)"},
+	{Name: "capture", Feature: "recording in builds without cgo", Programs: []string{"bash-generator-capture"}, Hint: "install it next to bash-generator or set BASH_GENERATOR_CAPTURE"},
+}
+
+// MissingError reports a capability none of whose programs are installed.
+type MissingError struct {
+	Capability Capability
+}
+
+func (e *MissingError) Error() string {
+	c := e.Capability
+	msg := fmt.Sprintf("%s is disabled because %s is missing", c.Feature, strings.Join(c.Programs, " or "))
+	if c.Hint != "" {
+		msg += " (" + c.Hint + ")"
+	}
+	return msg
+}
+
+// Lookup finds a capability by name. It panics on unknown names, which are programming errors.
+func Lookup(name string) Capability {
+	for _, c := range Registry {
+		if c.Name == name {
+			return c
+		}
+	}
+	panic("capability: unknown capability " + name)
+}
+
+// Path returns the first of the capability's programs found on PATH.
+func (c Capability) Path() (string, bool) {
+	for _, p := range c.Programs {
+		if path, err := exec.LookPath(p); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// Require returns the path of the program providing name, or a *MissingError.
+func Require(name string) (string, error) {
+	c := Lookup(name)
+	if path, ok := c.Path(); ok {
+		return path, nil
+	}
+	return "", &MissingError{Capability: c}
+}
@@ -0,0 +1,302 @@
+// Package capture records audio in a separate helper process, so the main
+// binary can be built without cgo and the helper swapped per platform.
+//
+// The protocol runs over the helper's stdin and stdout. The helper first
+// writes one JSON line describing the opened stream, or why it couldn't be
+// opened. It then reads commands, one per line: "start" begins a recording and
+// "stop" ends it. While recording it writes frames of a type byte, a 4-byte
+// little-endian payload length and the payload: 'a' for a chunk of 16-bit
+// little-endian samples, then 'd' when the recording is done or 'e' with a
+// message if it failed. The helper exits when its stdin is closed.
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jerilseb/bash-generator/pkg/record"
+)
+
+// Frame types.
+const (
+	frameAudio = 'a'
+	frameDone  = 'd'
+	frameError = 'e'
+)
+
+// maxFrame bounds the payload length read from the helper, so a confused
+// helper can't make the reader allocate unbounded memory.
+const maxFrame = 1 << 24
+
+// header is the first line the helper writes.
+type header struct {
+	Channels       int    `json:"channels,omitempty"`
+	SampleRate     int    `json:"sample_rate,omitempty"`
+	FramesPerChunk int    `json:"frames_per_chunk,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// Device is what the helper records from; *record.Recorder implements it.
+type Device interface {
+	Options() record.Options
+	RecordFunc(stop <-chan struct{}, onChunk func(chunk []int16)) (*record.Recording, error)
+}
+
+// Fail tells the other side that the device couldn't be opened. The helper
+// should exit after calling it.
+func Fail(out io.Writer, err error) error {
+	return json.NewEncoder(out).Encode(header{Error: err.Error()})
+}
+
+// Serve runs the helper side of the protocol for dev until in is closed.
+func Serve(in io.Reader, out io.Writer, dev Device) error {
+	opts := dev.Options()
+	if err := json.NewEncoder(out).Encode(header{
+		Channels:       opts.Channels,
+		SampleRate:     opts.SampleRate,
+		FramesPerChunk: opts.FramesPerChunk,
+	}); err != nil {
+		return err
+	}
+
+	commands := make(chan string)
+	go func() {
+		defer close(commands)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			commands <- strings.TrimSpace(scanner.Text())
+		}
+	}()
+
+	for command := range commands {
+		// A stray "stop" arrives when a recording failed before it was stopped.
+		if command != "start" {
+			continue
+		}
+		stop := make(chan struct{})
+		result := make(chan error, 1)
+		go func() {
+			_, err := dev.RecordFunc(stop, func(chunk []int16) {
+				// A failed write means the other side has gone; closing stdin will end the loop.
+				writeFrame(out, frameAudio, encodeSamples(chunk))
+			})
+			result <- err
+		}()
+
+		var err error
+		open := true
+		select {
+		case _, open = <-commands:
+			close(stop)
+			err = <-result
+		case err = <-result:
+		}
+		if err != nil {
+			err = writeFrame(out, frameError, []byte(err.Error()))
+		} else {
+			err = writeFrame(out, frameDone, nil)
+		}
+		if err != nil || !open {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper is a running capture helper. Only one recording may run at a time.
+type Helper struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	opts   record.Options
+
+	mu sync.Mutex
+}
+
+// Start runs the helper at path and waits for it to open the input device.
+func Start(path string, opts record.Options) (*Helper, error) {
+	cmd := exec.Command(path,
+		"-channels", strconv.Itoa(opts.Channels),
+		"-channel", strconv.Itoa(opts.Channel),
+		"-rate", strconv.Itoa(opts.SampleRate),
+		"-frames", strconv.Itoa(opts.FramesPerChunk))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start capture helper: %w", err)
+	}
+
+	h := &Helper{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}
+	line, err := h.stdout.ReadBytes('\n')
+	var hdr header
+	if err == nil {
+		err = json.Unmarshal(line, &hdr)
+	}
+	switch {
+	case err != nil:
+		err = fmt.Errorf("capture helper failed to start: %w", err)
+	case hdr.Error == record.ErrNoInputDevice.Error():
+		// Kept recognizable across the process boundary.
+		err = record.ErrNoInputDevice
+	case hdr.Error != "":
+		err = errors.New(hdr.Error)
+	}
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	h.opts = record.Options{
+		Channels:       hdr.Channels,
+		SampleRate:     hdr.SampleRate,
+		FramesPerChunk: hdr.FramesPerChunk,
+		// The limit is kept here rather than in the helper.
+		MaxDuration: opts.MaxDuration,
+	}
+	return h, nil
+}
+
+// InputDevices runs the helper at path with -list, for the input devices it
+// can record from.
+func InputDevices(path string) ([]record.Device, error) {
+	cmd := exec.Command(path, "-list")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, fmt.Errorf("capture helper failed: %w", err)
+	}
+	var devices []record.Device
+	if err := json.Unmarshal(out, &devices); err != nil {
+		return nil, fmt.Errorf("capture helper listed devices in an unknown format: %w", err)
+	}
+	return devices, nil
+}
+
+// Options returns the capture parameters of the helper's stream.
+func (h *Helper) Options() record.Options {
+	return h.opts
+}
+
+// Record captures audio until stop is closed, or until the recording reaches
+// the MaxDuration the helper was started with, and returns everything that was recorded.
+func (h *Helper) Record(stop <-chan struct{}) (*record.Recording, error) {
+	return h.RecordFunc(stop, nil)
+}
+
+// RecordFunc is like Record but also hands every chunk to onChunk as it arrives,
+// like record.Recorder.RecordFunc.
+func (h *Helper) RecordFunc(stop <-chan struct{}, onChunk func(chunk []int16)) (*record.Recording, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, err := io.WriteString(h.stdin, "start\n"); err != nil {
+		return nil, fmt.Errorf("failed to start recording: %w", err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	full := make(chan struct{})
+	go func() {
+		select {
+		case <-stop:
+		case <-full:
+		case <-done:
+			return
+		}
+		io.WriteString(h.stdin, "stop\n")
+	}()
+
+	rec := &record.Recording{Channels: h.opts.Channels, SampleRate: h.opts.SampleRate}
+	limit := h.opts.MaxSamples()
+	for {
+		kind, payload, err := readFrame(h.stdout)
+		if err != nil {
+			return nil, fmt.Errorf("error reading from capture helper: %w", err)
+		}
+		switch kind {
+		case frameAudio:
+			// Chunks still arriving after the limit was reached are dropped.
+			if rec.Truncated {
+				continue
+			}
+			chunk := decodeSamples(payload)
+			rec.Samples = append(rec.Samples, chunk...)
+			if onChunk != nil {
+				onChunk(chunk)
+			}
+			if limit > 0 && len(rec.Samples) >= limit {
+				rec.Samples, rec.Truncated = rec.Samples[:limit], true
+				close(full)
+			}
+		case frameDone:
+			return rec, nil
+		case frameError:
+			return nil, errors.New(string(payload))
+		default:
+			return nil, fmt.Errorf("capture helper sent an unknown frame %q", kind)
+		}
+	}
+}
+
+// Close stops the helper.
+func (h *Helper) Close() error {
+	h.stdin.Close()
+	return h.cmd.Wait()
+}
+
+func writeFrame(w io.Writer, kind byte, payload []byte) error {
+	buf := make([]byte, 5+len(payload))
+	buf[0] = kind
+	binary.LittleEndian.PutUint32(buf[1:5], uint32(len(payload)))
+	copy(buf[5:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var head [5]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.LittleEndian.Uint32(head[1:])
+	if n > maxFrame {
+		return 0, nil, fmt.Errorf("frame of %d bytes is too large", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return head[0], payload, nil
+}
+
+func encodeSamples(samples []int16) []byte {
+	buf := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(buf[2*i:], uint16(s))
+	}
+	return buf
+}
+
+func decodeSamples(buf []byte) []int16 {
+	samples := make([]int16, len(buf)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(buf[2*i:]))
+	}
+	return samples
+}
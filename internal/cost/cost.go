@@ -0,0 +1,82 @@
+// Package cost estimates what API calls cost, from built-in list prices.
+package cost
+
+import (
+	"strings"
+	"time"
+)
+
+// ChatPrice is the price of a chat model in USD per million tokens.
+type ChatPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// ChatPrices holds list prices of common chat models; programs may add their
+// own or override them. Dated snapshots such as
+// gpt-4o-2024-08-06 are priced like the model whose name they start with.
+var ChatPrices = map[string]ChatPrice{
+	"gpt-4o":        {Input: 2.50, Output: 10.00},
+	"gpt-4o-mini":   {Input: 0.15, Output: 0.60},
+	"gpt-4-turbo":   {Input: 10.00, Output: 30.00},
+	"gpt-4":         {Input: 30.00, Output: 60.00},
+	"gpt-3.5-turbo": {Input: 0.50, Output: 1.50},
+
+	"claude-sonnet-4-5": {Input: 3.00, Output: 15.00},
+	"claude-haiku-4-5":  {Input: 1.00, Output: 5.00},
+	"claude-opus-4-1":   {Input: 15.00, Output: 75.00},
+	"gemini-2.5-flash":  {Input: 0.30, Output: 2.50},
+	"gemini-2.5-pro":    {Input: 1.25, Output: 10.00},
+}
+
+// TranscriptionPrices holds the price of transcription models in USD per minute of audio.
+var TranscriptionPrices = map[string]float64{
+	"whisper-1":              0.006,
+	"gpt-4o-transcribe":      0.006,
+	"gpt-4o-mini-transcribe": 0.003,
+}
+
+// Chat returns the cost of a chat completion. Unknown models cost nothing.
+func Chat(model string, promptTokens, completionTokens int) float64 {
+	p, ok := lookup(ChatPrices, model)
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*p.Input + float64(completionTokens)*p.Output) / 1e6
+}
+
+// Transcription returns the cost of transcribing d of audio. Unknown models cost nothing.
+func Transcription(model string, d time.Duration) float64 {
+	perMinute, ok := lookup(TranscriptionPrices, model)
+	if !ok {
+		return 0
+	}
+	return d.Minutes() * perMinute
+}
+
+// ChatPriced reports whether the price of a chat model is known.
+func ChatPriced(model string) bool {
+	_, ok := lookup(ChatPrices, model)
+	return ok
+}
+
+// TranscriptionPriced reports whether the price of a transcription model is known.
+func TranscriptionPriced(model string) bool {
+	_, ok := lookup(TranscriptionPrices, model)
+	return ok
+}
+
+// lookup finds the price for model, falling back to the longest known prefix.
+func lookup[T any](prices map[string]T, model string) (T, bool) {
+	if p, ok := prices[model]; ok {
+		return p, true
+	}
+	var best string
+	for name := range prices {
+		if strings.HasPrefix(model, name+"-") && len(name) > len(best) {
+			best = name
+		}
+	}
+	p, ok := prices[best]
+	return p, ok && best != ""
+}
@@ -0,0 +1,437 @@
+package effects
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/internal/programs"
+)
+
+// harmless are the files redirections go to that aren't files on disk.
+var harmless = []string{"/dev/null", "/dev/stdin", "/dev/stdout", "/dev/stderr", "/dev/tty"}
+
+// systemDirs hold programs known by name when they are given by path, like /bin/rm.
+var systemDirs = []string{"/bin", "/sbin", "/usr/bin", "/usr/sbin", "/usr/local/bin"}
+
+// elevating are the programs that run commands with other privileges.
+var elevating = map[string]bool{"sudo": true, "doas": true, "su": true, "pkexec": true, "runuser": true}
+
+// networked are the programs that always use the network.
+var networked = map[string]bool{}
+
+// reader is a program that reads the files it is given. argOptions are its
+// options that take an argument; if pattern is set, its first operand is a
+// pattern or program rather than a file, unless given with patternOptions.
+// dir is set for those that read the current directory if given no files.
+type reader struct {
+	argOptions     string
+	pattern        bool
+	patternOptions []string
+	dir            bool
+}
+
+var readers = map[string]reader{
+	"head": {argOptions: "n c lines bytes"},
+	"tail": {argOptions: "n c lines bytes"},
+	"sort": {argOptions: "k t S T key field-separator"},
+	"grep": {argOptions: "e f m A B C regexp file max-count", pattern: true, patternOptions: []string{"e", "f", "regexp", "file"}},
+	"rg":   {argOptions: "e f m A B C g t T regexp file max-count glob type", pattern: true, patternOptions: []string{"e", "f", "regexp", "file"}, dir: true},
+	"ls":   {argOptions: "I w T hide ignore width tabsize", dir: true},
+	"du":   {argOptions: "d B t max-depth block-size threshold exclude", dir: true},
+	"tree": {argOptions: "L P I o", dir: true},
+	"awk":  {argOptions: "F v f", pattern: true, patternOptions: []string{"f"}},
+	"jq":   {argOptions: "arg argjson slurpfile rawfile indent", pattern: true},
+}
+
+// fetchers are the package managers and other tools that use the network
+// for some of their subcommands, listed here.
+var fetchers = map[string][]string{
+	"apt":     {"install", "update", "upgrade", "full-upgrade", "dist-upgrade", "download", "source"},
+	"apt-get": {"install", "update", "upgrade", "dist-upgrade", "download", "source"},
+	"dnf":     {"install", "update", "upgrade", "download", "makecache", "check-update", "search"},
+	"yum":     {"install", "update", "upgrade", "download", "makecache", "check-update", "search"},
+	"zypper":  {"install", "in", "update", "up", "refresh", "ref", "dist-upgrade", "dup"},
+	"brew":    {"install", "update", "upgrade", "fetch", "tap", "reinstall", "search"},
+	"pip":     {"install", "download", "search"},
+	"pip3":    {"install", "download", "search"},
+	"npm":     {"install", "i", "add", "ci", "update", "publish", "view", "search", "exec"},
+	"yarn":    {"add", "install", "upgrade", "up", "dlx"},
+	"pnpm":    {"add", "install", "i", "update", "up", "dlx"},
+	"cargo":   {"install", "build", "fetch", "update", "publish", "add"},
+	"go":      {"get", "install", "mod"},
+	"gem":     {"install", "update", "fetch"},
+	"snap":    {"install", "refresh", "download"},
+	"flatpak": {"install", "update"},
+	"docker":  {"pull", "push", "login", "build", "run", "search"},
+	"podman":  {"pull", "push", "login", "build", "run", "search"},
+}
+
+// setuid matches chmod modes that set the setuid or setgid bit.
+var setuid = regexp.MustCompile(`^([ugoa]*\+[rwxXt]*s|[0-7]?[2-7][0-7]{3})$`)
+
+// remotePath matches [user@]host:path operands of scp and rsync.
+var remotePath = regexp.MustCompile(`^([^/@:]+@)?[^/:]+:`)
+
+func init() {
+	for _, name := range strings.Fields(`ssh scp sftp rsync nc ncat netcat telnet ftp ping ping6 dig nslookup host whois
+		traceroute mosh curl wget http https xh aws gcloud az gh kubectl helm npx`) {
+		networked[name] = true
+	}
+	for _, name := range strings.Fields(`cat less more tac nl wc uniq file stat cmp diff md5sum sha1sum sha256sum
+		sha512sum xxd od strings base64 zcat bat`) {
+		readers[name] = reader{}
+	}
+	readers["egrep"], readers["fgrep"] = readers["grep"], readers["grep"]
+}
+
+// command adds the effects of c.
+func (e *Effects) command(c programs.Command) {
+	for _, r := range c.Redirects {
+		switch {
+		case slices.Contains(harmless, r.Target.Value):
+		case strings.HasPrefix(r.Op, "<"):
+			add(&e.Reads, r.Target.Value)
+		default:
+			add(&e.Writes, r.Target.Value)
+		}
+	}
+	args, wrappedBy := c.Unwrap()
+	for _, w := range wrappedBy {
+		if elevating[w] {
+			add(&e.Privileges, w)
+		}
+	}
+	if len(args) == 0 {
+		return
+	}
+	name := args[0].Value
+	if !args[0].Literal {
+		add(&e.Unknown, name)
+		return
+	}
+	if strings.Contains(name, "/") {
+		if !slices.Contains(systemDirs, path.Dir(name)) {
+			add(&e.Unknown, name)
+			return
+		}
+		name = path.Base(name)
+	}
+	e.program(name, args[1:], slices.Contains(wrappedBy, "xargs"))
+}
+
+// program adds the effects of running name with args. With xargs, more
+// operands come from standard input.
+func (e *Effects) program(name string, args []programs.Word, xargs bool) {
+	if networked[name] {
+		add(&e.Network, name)
+	}
+	if elevating[name] {
+		add(&e.Privileges, name)
+	}
+	// operands are the paths given, and those read by xargs.
+	operands := func(ops []string) []string {
+		if xargs {
+			return append(ops, "paths from standard input")
+		}
+		return ops
+	}
+
+	switch name {
+	case "rm", "rmdir", "unlink", "shred":
+		ops, _ := parse(args, "n s iterations size")
+		add(&e.Deletes, operands(ops)...)
+	case "find":
+		e.find(args)
+	case "cp", "mv", "install", "ln":
+		ops, opts := parse(args, "t S m o g target-directory suffix mode owner group")
+		dest, ok := option(opts, "t", "target-directory")
+		if !ok && len(ops) > 1 {
+			dest, ops = ops[len(ops)-1], ops[:len(ops)-1]
+		} else if !ok && name == "ln" && len(ops) == 1 {
+			dest = path.Base(ops[0])
+		}
+		switch name {
+		case "cp", "install":
+			add(&e.Reads, operands(ops)...)
+		case "mv":
+			add(&e.Writes, operands(ops)...)
+		}
+		add(&e.Writes, dest)
+	case "touch", "mkdir", "truncate", "tee":
+		ops, _ := parse(args, "m s r t d mode size reference date")
+		add(&e.Writes, operands(ops)...)
+	case "chmod", "chown", "chgrp":
+		ops, opts := parse(args, "reference")
+		if _, ok := opts["reference"]; !ok && len(ops) > 0 {
+			if name == "chmod" && setuid.MatchString(ops[0]) {
+				add(&e.Privileges, "chmod "+ops[0])
+			}
+			ops = ops[1:]
+		}
+		add(&e.Writes, operands(ops)...)
+	case "dd":
+		for _, a := range args {
+			if f, ok := strings.CutPrefix(a.Value, "if="); ok {
+				add(&e.Reads, f)
+			} else if f, ok := strings.CutPrefix(a.Value, "of="); ok {
+				add(&e.Writes, f)
+			}
+		}
+	case "sed":
+		ops, opts := parse(args, "e f l expression file line-length")
+		if _, ok := option(opts, "e", "f", "expression", "file"); !ok && len(ops) > 0 {
+			ops = ops[1:]
+		}
+		if _, ok := option(opts, "i", "in-place"); ok {
+			add(&e.Writes, operands(ops)...)
+		} else {
+			add(&e.Reads, operands(ops)...)
+		}
+	case "tar":
+		e.tar(args)
+	case "unzip":
+		ops, opts := parse(args, "d x")
+		if len(ops) > 0 {
+			add(&e.Reads, ops[0])
+		}
+		dir, ok := opts["d"]
+		if !ok {
+			dir = "."
+		}
+		add(&e.Writes, dir)
+	case "zip":
+		ops, _ := parse(args, "b n t x i")
+		if len(ops) > 0 {
+			add(&e.Writes, ops[0])
+			add(&e.Reads, ops[1:]...)
+		}
+	case "curl":
+		e.curl(args)
+	case "wget":
+		ops, opts := parse(args, "O P o a i U T t output-document directory-prefix output-file append-output input-file user-agent timeout tries")
+		if out, ok := option(opts, "O", "output-document"); ok {
+			add(&e.Writes, out)
+			break
+		}
+		dir, ok := option(opts, "P", "directory-prefix")
+		for _, u := range ops {
+			if ok {
+				add(&e.Writes, path.Join(dir, urlFile(u)))
+			} else {
+				add(&e.Writes, urlFile(u))
+			}
+		}
+	case "scp", "rsync":
+		ops, _ := parse(args, "e P i o F l c J S rsh")
+		if len(ops) < 2 {
+			break
+		}
+		for _, src := range ops[:len(ops)-1] {
+			if !remotePath.MatchString(src) {
+				add(&e.Reads, src)
+			}
+		}
+		if dest := ops[len(ops)-1]; !remotePath.MatchString(dest) {
+			add(&e.Writes, dest)
+		}
+	case "git":
+		e.git(args)
+	case "pacman":
+		_, opts := parse(args, "")
+		if _, ok := option(opts, "S", "y", "sync", "refresh"); ok {
+			add(&e.Network, name)
+		}
+	case "bash", "sh", "zsh", "dash", "ksh":
+		ops, opts := parse(args, "c o O")
+		if script, ok := opts["c"]; ok {
+			e.merge(Analyze(script))
+		} else if len(ops) > 0 {
+			add(&e.Unknown, ops[0])
+		} else {
+			add(&e.Unknown, "a script from standard input")
+		}
+	case "source", ".":
+		if ops, _ := parse(args, ""); len(ops) > 0 {
+			add(&e.Unknown, ops[0])
+		}
+	case "eval":
+		add(&e.Unknown, "eval")
+	default:
+		if subcommands, ok := fetchers[name]; ok {
+			ops, _ := parse(args, "")
+			if len(ops) > 0 && slices.Contains(subcommands, ops[0]) || len(ops) == 0 && name == "yarn" {
+				add(&e.Network, name)
+			}
+			break
+		}
+		r, ok := readers[name]
+		if !ok {
+			break
+		}
+		ops, opts := parse(args, r.argOptions)
+		if _, given := option(opts, r.patternOptions...); r.pattern && !given && len(ops) > 0 {
+			ops = ops[1:]
+		}
+		if _, recursive := option(opts, "r", "R", "recursive"); len(ops) == 0 && (recursive || r.dir) {
+			ops = []string{"."}
+		}
+		add(&e.Reads, operands(ops)...)
+	}
+}
+
+// find adds the effects of find, including those of the commands it runs
+// with -exec on the files it finds.
+func (e *Effects) find(args []programs.Word) {
+	for len(args) > 0 && slices.Contains([]string{"-H", "-L", "-P"}, args[0].Value) {
+		args = args[1:]
+	}
+	var roots []string
+	for len(args) > 0 && !strings.HasPrefix(args[0].Value, "-") && args[0].Value != "(" && args[0].Value != "!" {
+		roots = append(roots, args[0].Value)
+		args = args[1:]
+	}
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	found := "files found in " + strings.Join(roots, ", ")
+	deletes := false
+	for i := 0; i < len(args); i++ {
+		switch args[i].Value {
+		case "-delete":
+			deletes = true
+		case "-exec", "-execdir", "-ok", "-okdir":
+			var words []programs.Word
+			for i++; i < len(args) && args[i].Value != ";" && args[i].Value != "+"; i++ {
+				w := args[i]
+				if w.Value == "{}" {
+					w = programs.Word{Value: found, Literal: true}
+				}
+				words = append(words, w)
+			}
+			e.command(programs.Command{Words: words})
+		}
+	}
+	if deletes {
+		add(&e.Deletes, found)
+	} else {
+		add(&e.Reads, roots...)
+	}
+}
+
+// tar adds the effects of creating, extracting or listing an archive.
+func (e *Effects) tar(args []programs.Word) {
+	// The options may come first without a dash, as in tar czf.
+	if len(args) > 0 && args[0].Literal && !strings.HasPrefix(args[0].Value, "-") {
+		args = append([]programs.Word{{Value: "-" + args[0].Value, Literal: true}}, args[1:]...)
+	}
+	ops, opts := parse(args, "f C T X b file directory files-from exclude-from")
+	archive, _ := option(opts, "f", "file")
+	dir, ok := option(opts, "C", "directory")
+	if !ok {
+		dir = "."
+	}
+	switch {
+	case has(opts, "c", "r", "u", "create", "append", "update"):
+		add(&e.Writes, archive)
+		add(&e.Reads, ops...)
+	case has(opts, "x", "extract", "get"):
+		add(&e.Reads, archive)
+		add(&e.Writes, dir)
+	case has(opts, "t", "list"):
+		add(&e.Reads, archive)
+	}
+}
+
+func has(options map[string]string, names ...string) bool {
+	_, ok := option(options, names...)
+	return ok
+}
+
+// curl adds the files curl writes and uploads.
+func (e *Effects) curl(args []programs.Word) {
+	ops, opts := parse(args, `o T d H X u A e b c F x m w K output upload-file data data-binary data-raw
+		data-urlencode header request user user-agent referer cookie cookie-jar form proxy max-time
+		connect-timeout retry write-out config`)
+	if out, ok := option(opts, "o", "output"); ok {
+		add(&e.Writes, out)
+	} else if has(opts, "O", "remote-name") {
+		for _, u := range ops {
+			add(&e.Writes, urlFile(u))
+		}
+	}
+	if f, ok := option(opts, "T", "upload-file"); ok {
+		add(&e.Reads, f)
+	}
+	for _, name := range []string{"d", "data", "data-binary", "data-urlencode", "F", "form"} {
+		if _, f, ok := strings.Cut(opts[name], "@"); ok {
+			add(&e.Reads, strings.SplitN(f, ";", 2)[0])
+		}
+	}
+	if jar, ok := option(opts, "c", "cookie-jar"); ok {
+		add(&e.Writes, jar)
+	}
+}
+
+// git adds the effects of a git subcommand.
+func (e *Effects) git(args []programs.Word) {
+	for len(args) > 0 && strings.HasPrefix(args[0].Value, "-") {
+		if slices.Contains([]string{"-C", "-c", "--git-dir", "--work-tree"}, args[0].Value) && len(args) > 1 {
+			args = args[1:]
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return
+	}
+	sub, args := args[0].Value, args[1:]
+	ops, opts := parse(args, "b o c j u branch origin depth config jobs reference upload-pack filter")
+	switch sub {
+	case "clone":
+		add(&e.Network, "git clone")
+		switch {
+		case len(ops) > 1:
+			add(&e.Writes, ops[1])
+		case len(ops) == 1:
+			// The repository's name, from a URL or host:path.
+			repo := strings.TrimRight(ops[0], "/")
+			add(&e.Writes, strings.TrimSuffix(repo[strings.LastIndexAny(repo, "/:")+1:], ".git"))
+		}
+	case "fetch", "pull", "push", "ls-remote":
+		add(&e.Network, "git "+sub)
+		if sub == "pull" {
+			add(&e.Writes, "the working tree")
+		}
+	case "submodule":
+		if len(ops) > 0 && ops[0] == "update" {
+			add(&e.Network, "git submodule")
+		}
+	case "clean":
+		if !has(opts, "n", "dry-run") {
+			add(&e.Deletes, "untracked files")
+		}
+	case "rm":
+		if !has(opts, "cached", "n", "dry-run") {
+			add(&e.Deletes, ops...)
+		}
+	case "mv":
+		add(&e.Writes, ops...)
+	case "checkout", "switch", "restore", "merge", "rebase", "stash":
+		add(&e.Writes, "the working tree")
+	case "reset":
+		if has(opts, "hard") {
+			add(&e.Writes, "the working tree")
+		}
+	}
+}
+
+// urlFile returns the name of the file a download from rawURL is saved as.
+func urlFile(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		return "index.html"
+	}
+	return path.Base(u.Path)
+}
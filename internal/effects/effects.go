@@ -0,0 +1,147 @@
+// Package effects works out what a Bash command would do before it is run:
+// the files it reads, writes and deletes, whether it reaches out over the
+// network and whether it gains privileges.
+//
+// Like the safety checks, this is a heuristic. The command is parsed, not
+// run, so only the programs below are understood, and paths that depend on
+// the environment or on what other commands print are shown as written.
+package effects
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/internal/programs"
+)
+
+// Effects is what a command would do.
+type Effects struct {
+	Reads   []string
+	Writes  []string
+	Deletes []string
+	// Network lists the programs that would use the network.
+	Network []string
+	// Privileges lists how the command gains privileges, like sudo.
+	Privileges []string
+	// Unknown lists the scripts and commands whose effects can't be told,
+	// like ./deploy.sh or eval.
+	Unknown []string
+}
+
+// Analyze works out the effects of command.
+func Analyze(command string) Effects {
+	var e Effects
+	for _, c := range programs.Commands(command) {
+		e.command(c)
+	}
+	return e
+}
+
+// Summary describes the effects as phrases, like "deletes build/", that
+// follow "this command". Long lists of paths are cut short. It is empty if
+// the command does none of these things.
+func (e Effects) Summary() []string {
+	var s []string
+	if len(e.Reads) > 0 {
+		s = append(s, "reads "+list(e.Reads))
+	}
+	if len(e.Writes) > 0 {
+		s = append(s, "writes "+list(e.Writes))
+	}
+	if len(e.Deletes) > 0 {
+		s = append(s, "deletes "+list(e.Deletes))
+	}
+	if len(e.Network) > 0 {
+		s = append(s, "uses the network ("+strings.Join(e.Network, ", ")+")")
+	}
+	if len(e.Privileges) > 0 {
+		s = append(s, "gains privileges ("+strings.Join(e.Privileges, ", ")+")")
+	}
+	if len(e.Unknown) > 0 {
+		s = append(s, "runs "+list(e.Unknown)+", which could do anything")
+	}
+	return s
+}
+
+// maxListed is how many items of each kind Summary names.
+const maxListed = 5
+
+func list(items []string) string {
+	if len(items) <= maxListed {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(items[:maxListed], ", "), len(items)-maxListed)
+}
+
+// add adds the items list doesn't have yet.
+func add(list *[]string, items ...string) {
+	for _, item := range items {
+		if item != "" && item != "-" && !slices.Contains(*list, item) {
+			*list = append(*list, item)
+		}
+	}
+}
+
+func (e *Effects) merge(o Effects) {
+	add(&e.Reads, o.Reads...)
+	add(&e.Writes, o.Writes...)
+	add(&e.Deletes, o.Deletes...)
+	add(&e.Network, o.Network...)
+	add(&e.Privileges, o.Privileges...)
+	add(&e.Unknown, o.Unknown...)
+}
+
+// parse splits args into operands and options. argOptions lists the options
+// that take an argument, by letter or long name, like "o output". Options
+// given together, like -rf, are split up, and everything after -- is an
+// operand. The options map to their arguments, or "" if they take none.
+func parse(args []programs.Word, argOptions string) (operands []string, options map[string]string) {
+	takes := strings.Fields(argOptions)
+	options = make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		w := args[i].Value
+		switch {
+		case w == "--":
+			for _, a := range args[i+1:] {
+				operands = append(operands, a.Value)
+			}
+			return operands, options
+		case strings.HasPrefix(w, "--"):
+			name, value, ok := strings.Cut(w[2:], "=")
+			if !ok && slices.Contains(takes, name) && i+1 < len(args) {
+				i++
+				value = args[i].Value
+			}
+			options[name] = value
+		case strings.HasPrefix(w, "-") && len(w) > 1 && args[i].Literal:
+			for j := 1; j < len(w); j++ {
+				name := w[j : j+1]
+				if !slices.Contains(takes, name) {
+					options[name] = ""
+					continue
+				}
+				value := w[j+1:]
+				if value == "" && i+1 < len(args) {
+					i++
+					value = args[i].Value
+				}
+				options[name] = value
+				break
+			}
+		default:
+			operands = append(operands, w)
+		}
+	}
+	return operands, options
+}
+
+// option returns the argument of the first of names given, and whether one was.
+func option(options map[string]string, names ...string) (string, bool) {
+	for _, name := range names {
+		if v, ok := options[name]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,54 @@
+package effects
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		command string
+		want    Effects
+	}{
+		{"echo hi", Effects{}},
+		{"rm -rf build 'my dir'", Effects{Deletes: []string{"build", "my dir"}}},
+		{"sort < in.txt > out.txt 2>/dev/null", Effects{Reads: []string{"in.txt"}, Writes: []string{"out.txt"}}},
+		{"cat <<EOF > notes.txt\nrm -rf /\nEOF", Effects{Writes: []string{"notes.txt"}}},
+		{"echo $(cat secret.txt) >> log", Effects{Reads: []string{"secret.txt"}, Writes: []string{"log"}}},
+		{"while read -r f; do rm \"$f\"; done < list.txt", Effects{Reads: []string{"list.txt"}, Deletes: []string{`"$f"`}}},
+		{"curl -o page.html https://example.com", Effects{Writes: []string{"page.html"}, Network: []string{"curl"}}},
+		{"sudo tee /etc/hosts < hosts", Effects{Reads: []string{"hosts"}, Writes: []string{"/etc/hosts"}, Privileges: []string{"sudo"}}},
+		{"./deploy.sh && eval \"$cmd\"", Effects{Unknown: []string{"./deploy.sh", "eval"}}},
+		{"rm -rf <dir>", Effects{Deletes: []string{"<dir>"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := Analyze(tt.command); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Analyze(%q) =\n%+v\nwant\n%+v", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeedsRoot(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"ls /etc", nil},
+		{"echo 127.0.0.1 box >> /etc/hosts", []string{"writes /etc/hosts"}},
+		{"sudo echo 127.0.0.1 box >> /etc/hosts", []string{"writes /etc/hosts"}},
+		{"sudo apt install jq", nil},
+		{"apt install jq", []string{"changes the installed packages with apt"}},
+		{"systemctl --user restart app", nil},
+		{"systemctl restart nginx", []string{"changes system services with systemctl"}},
+		{"bash -c 'rm /usr/local/bin/tool'", []string{"deletes /usr/local/bin/tool"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := NeedsRoot(tt.command); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NeedsRoot(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package effects
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/jerilseb/bash-generator/internal/programs"
+)
+
+// rootDirs are the directories only root may change, but for userDirs.
+var rootDirs = []string{"/etc", "/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/boot", "/opt", "/root", "/srv", "/sys", "/proc", "/var", "/dev"}
+
+// userDirs are the places in rootDirs that anyone may change.
+var userDirs = []string{"/var/tmp", "/dev/shm", "/dev/fd"}
+
+// packageManagers map package managers to the subcommands that change the
+// installed packages.
+var packageManagers = map[string][]string{
+	"apt":      {"install", "reinstall", "remove", "purge", "autoremove", "update", "upgrade", "full-upgrade", "dist-upgrade"},
+	"apt-get":  {"install", "reinstall", "remove", "purge", "autoremove", "update", "upgrade", "dist-upgrade", "build-dep"},
+	"aptitude": {"install", "reinstall", "remove", "purge", "update", "upgrade", "safe-upgrade", "full-upgrade"},
+	"dnf":      {"install", "reinstall", "remove", "erase", "upgrade", "update", "downgrade", "autoremove", "distro-sync", "groupinstall"},
+	"yum":      {"install", "reinstall", "remove", "erase", "upgrade", "update", "downgrade", "autoremove", "groupinstall"},
+	"zypper":   {"install", "in", "remove", "rm", "update", "up", "dist-upgrade", "dup", "refresh", "ref"},
+	"apk":      {"add", "del", "update", "upgrade", "fix"},
+	"snap":     {"install", "remove", "refresh", "revert", "enable", "disable"},
+}
+
+// serviceVerbs are the systemctl subcommands that change the system, as
+// opposed to those that only show it, like status.
+var serviceVerbs = []string{"start", "stop", "restart", "try-restart", "reload", "reload-or-restart", "kill",
+	"enable", "disable", "reenable", "mask", "unmask", "preset", "link", "revert", "edit", "set-property",
+	"set-default", "isolate", "reset-failed", "daemon-reload", "daemon-reexec",
+	"reboot", "poweroff", "halt", "suspend", "hibernate", "kexec"}
+
+// rootPrograms are the programs that need root whatever they are asked to
+// do, with what they are for.
+var rootPrograms = map[string]string{}
+
+func init() {
+	for _, name := range strings.Fields("useradd userdel usermod groupadd groupdel groupmod chpasswd newusers visudo vipw") {
+		rootPrograms[name] = "manages users and groups"
+	}
+	for _, name := range strings.Fields("iptables ip6tables nft ufw firewall-cmd") {
+		rootPrograms[name] = "changes the firewall"
+	}
+	for _, name := range strings.Fields("fdisk sfdisk gdisk parted mkswap swapon swapoff wipefs cryptsetup losetup pvcreate vgcreate lvcreate lvextend lvremove") {
+		rootPrograms[name] = "works on disks and partitions"
+	}
+	for _, name := range strings.Fields("insmod rmmod update-grub grub-install grub-mkconfig update-initramfs mkinitcpio dracut ldconfig") {
+		rootPrograms[name] = "changes how the system boots"
+	}
+	for _, name := range strings.Fields("reboot shutdown poweroff halt") {
+		rootPrograms[name] = "reboots or shuts down the machine"
+	}
+	rootPrograms["chown"] = "changes who owns files"
+}
+
+// NeedsRoot tells why command would need to be run as root, if it seems to:
+// the system files it changes and the programs it runs that only root may
+// run the way they are used here, like apt install. Commands run with sudo
+// or the like already have root, but the redirections to and from them don't.
+func NeedsRoot(command string) []string {
+	var reasons []string
+	for _, c := range programs.Commands(command) {
+		args, wrappedBy := c.Unwrap()
+		elevated := slices.ContainsFunc(wrappedBy, func(w string) bool { return elevating[w] })
+		var e Effects
+		if elevated {
+			e.command(programs.Command{Redirects: c.Redirects})
+		} else {
+			e.command(c)
+			if len(args) > 0 && args[0].Literal {
+				add(&reasons, rootProgram(path.Base(args[0].Value), args[1:])...)
+			}
+		}
+		for _, p := range e.Writes {
+			if systemPath(p) {
+				add(&reasons, "writes "+p)
+			}
+		}
+		for _, p := range e.Deletes {
+			if systemPath(p) {
+				add(&reasons, "deletes "+p)
+			}
+		}
+	}
+	return reasons
+}
+
+// systemPath reports whether only root may change p.
+func systemPath(p string) bool {
+	if !strings.HasPrefix(p, "/") || slices.Contains(harmless, p) {
+		return false
+	}
+	under := func(dirs []string) bool {
+		return slices.ContainsFunc(dirs, func(dir string) bool { return p == dir || strings.HasPrefix(p, dir+"/") })
+	}
+	return under(rootDirs) && !under(userDirs)
+}
+
+// rootProgram returns why running name with args needs root, if it does.
+func rootProgram(name string, args []programs.Word) []string {
+	if reason, ok := rootPrograms[name]; ok {
+		return []string{reason + " with " + name}
+	}
+	if strings.HasPrefix(name, "mkfs") {
+		return []string{"makes a filesystem with " + name}
+	}
+	ops, opts := parse(args, "")
+	switch name {
+	case "bash", "sh", "zsh", "dash", "ksh":
+		if _, opts := parse(args, "c o O"); opts["c"] != "" {
+			return NeedsRoot(opts["c"])
+		}
+	case "systemctl":
+		_, user := option(opts, "user")
+		if !user && len(ops) > 0 && slices.Contains(serviceVerbs, ops[0]) {
+			return []string{"changes system services with systemctl"}
+		}
+	case "service":
+		if len(ops) > 1 && slices.Contains([]string{"start", "stop", "restart", "reload", "force-reload"}, ops[1]) {
+			return []string{"changes system services with service"}
+		}
+	case "pacman":
+		// -S only changes anything without the options that make it a query.
+		_, remove := option(opts, "R", "U", "remove", "upgrade")
+		_, sync := option(opts, "S", "sync")
+		_, query := option(opts, "s", "i", "l", "g", "p", "search", "info", "list", "groups", "print")
+		if remove || sync && !query {
+			return []string{"changes the installed packages with pacman"}
+		}
+	case "dpkg":
+		if _, ok := option(opts, "i", "r", "P", "install", "remove", "purge", "configure", "unpack"); ok {
+			return []string{"changes the installed packages with dpkg"}
+		}
+	case "rpm":
+		_, query := option(opts, "q", "query", "V", "verify")
+		if _, ok := option(opts, "i", "U", "F", "e", "install", "upgrade", "freshen", "erase"); ok && !query {
+			return []string{"changes the installed packages with rpm"}
+		}
+	case "mount", "umount":
+		if _, all := option(opts, "a", "all"); all || len(ops) > 0 {
+			return []string{"mounts and unmounts filesystems"}
+		}
+	case "modprobe":
+		if _, dry := option(opts, "n", "dry-run", "c", "showconfig"); !dry && len(ops) > 0 {
+			return []string{"loads kernel modules with modprobe"}
+		}
+	case "sysctl":
+		_, write := option(opts, "w", "write", "p", "load", "system")
+		if write || slices.ContainsFunc(ops, func(op string) bool { return strings.Contains(op, "=") }) {
+			return []string{"changes kernel settings with sysctl"}
+		}
+	case "passwd":
+		if len(ops) > 0 {
+			return []string{"changes another user's password"}
+		}
+	case "hostnamectl", "timedatectl", "localectl":
+		if len(ops) > 0 && strings.HasPrefix(ops[0], "set-") {
+			return []string{"changes system settings with " + name}
+		}
+	default:
+		if subcommands, ok := packageManagers[name]; ok && len(ops) > 0 && slices.Contains(subcommands, ops[0]) {
+			return []string{"changes the installed packages with " + name}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// csvHeader names the columns entries are exported to CSV with.
+var csvHeader = []string{"time", "request", "command", "accepted", "exit_code", "edited", "dir", "project", "undo", "undo_of"}
+
+// WriteJSON writes entries one JSON object per line, as the history file
+// keeps them.
+func WriteJSON(w io.Writer, entries []Entry) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadJSON reads entries written by WriteJSON, or a JSON array of them.
+func ReadJSON(r io.Reader) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, fmt.Errorf("invalid history: %w", err)
+		}
+		return entries, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("invalid history entry on line %d: %w", n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// WriteCSV writes entries as CSV with a header row. Times are in RFC 3339
+// with nanoseconds, so they read back exactly.
+func WriteCSV(w io.Writer, entries []Entry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		exitCode, undoOf := "", ""
+		if e.ExitCode != nil {
+			exitCode = strconv.Itoa(*e.ExitCode)
+		}
+		if e.UndoOf != nil {
+			undoOf = e.UndoOf.Format(time.RFC3339Nano)
+		}
+		record := []string{
+			e.Time.Format(time.RFC3339Nano), e.Transcript, e.Command, strconv.FormatBool(e.Accepted),
+			exitCode, strconv.FormatBool(e.Edited), e.Dir, e.Project, e.Undo, undoOf,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads entries written by WriteCSV. Columns are found by the names
+// in the header, so they may come in any order; time and command are required.
+func ReadCSV(r io.Reader) ([]Entry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	column := make(map[string]int)
+	for i, name := range header {
+		column[name] = i
+	}
+	for _, name := range []string{"time", "command"} {
+		if _, ok := column[name]; !ok {
+			return nil, fmt.Errorf("invalid CSV: no %s column", name)
+		}
+	}
+
+	var entries []Entry
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		field := func(name string) string {
+			if i, ok := column[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		line, _ := cr.FieldPos(0)
+		e := Entry{Transcript: field("request"), Command: field("command"), Dir: field("dir"), Project: field("project"), Undo: field("undo")}
+		if e.Time, err = time.Parse(time.RFC3339Nano, field("time")); err != nil {
+			return nil, fmt.Errorf("invalid time on line %d: %w", line, err)
+		}
+		e.Accepted, _ = strconv.ParseBool(field("accepted"))
+		e.Edited, _ = strconv.ParseBool(field("edited"))
+		if s := field("exit_code"); s != "" {
+			code, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exit code on line %d: %w", line, err)
+			}
+			e.ExitCode = &code
+		}
+		if s := field("undo_of"); s != "" {
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid undo_of on line %d: %w", line, err)
+			}
+			e.UndoOf = &t
+		}
+		entries = append(entries, e)
+	}
+}
+
+// Merge adds the entries the history doesn't have yet, going by their time
+// and command, and rewrites it in time order. It returns how many were added.
+// The file is replaced in one go, so a failure leaves it as it was.
+func (s *Store) Merge(entries []Entry) (int, error) {
+	existing, err := s.Load()
+	if err != nil {
+		return 0, err
+	}
+	key := func(e Entry) string { return e.Time.UTC().Format(time.RFC3339Nano) + "\x00" + e.Command }
+	seen := make(map[string]bool, len(existing))
+	for _, e := range existing {
+		seen[key(e)] = true
+	}
+	merged := existing
+	for _, e := range entries {
+		if !seen[key(e)] {
+			seen[key(e)] = true
+			merged = append(merged, e)
+		}
+	}
+	added := len(merged) - len(existing)
+	if added == 0 {
+		return 0, nil
+	}
+	slices.SortStableFunc(merged, func(a, b Entry) int { return a.Time.Compare(b.Time) })
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	if err := WriteJSON(w, merged); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(f.Name(), s.Path); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
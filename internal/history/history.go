@@ -0,0 +1,94 @@
+// Package history stores every generated command in an append-only JSON Lines file.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Entry is one generated command.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Transcript string    `json:"transcript"`
+	Command    string    `json:"command"`
+	Dir        string    `json:"dir,omitempty"`
+	// Project is the root of the git repository Dir is in, if any.
+	Project string `json:"project,omitempty"`
+	// Edited is set when the user changed the generated command; Command is the edited version.
+	Edited bool `json:"edited,omitempty"`
+	// Accepted is set when the user confirmed the command.
+	Accepted bool `json:"accepted"`
+	// ExitCode is the exit status when the command was run by the tool.
+	ExitCode *int `json:"exit_code,omitempty"`
+	// Undo is a command that reverses the command, if one is known.
+	Undo string `json:"undo,omitempty"`
+	// UndoOf is the time of the entry this one undid, for commands run by undo.
+	UndoOf *time.Time `json:"undo_of,omitempty"`
+}
+
+// InProject reports whether the entry was generated in the git repository at root.
+// Entries recorded before projects were tracked are matched by their directory.
+func (e Entry) InProject(root string) bool {
+	if e.Project != "" {
+		return e.Project == root
+	}
+	rel, err := filepath.Rel(root, e.Dir)
+	return e.Dir != "" && err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// Store is a history file.
+type Store struct {
+	Path string
+}
+
+// Append adds e to the end of the history, creating the file if needed.
+func (s *Store) Append(e Entry) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	// A single write keeps concurrent appends from interleaving lines.
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Load returns all entries, oldest first. A missing file is an empty history.
+// Lines that fail to parse are skipped so one corrupt line doesn't lose the rest.
+func (s *Store) Load() ([]Entry, error) {
+	f, err := os.Open(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,172 @@
+package history
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShellFormat is a way shells keep their history files.
+type ShellFormat int
+
+// Shell history formats.
+const (
+	// Bash writes "#<unix time>" before each command when HISTTIMEFORMAT is
+	// set, and reads those lines as timestamps either way.
+	Bash ShellFormat = iota
+	// ZshExtended is zsh's EXTENDED_HISTORY: ": <unix time>:<duration>;<command>",
+	// with the newlines in a command escaped with a backslash.
+	ZshExtended
+	// Zsh is zsh's history without timestamps, one command per line.
+	Zsh
+)
+
+var (
+	zshExtendedLine = regexp.MustCompile(`^: (\d+):\d+;`)
+	bashTimestamp   = regexp.MustCompile(`^#(\d+)\s*$`)
+)
+
+// ShellCommand is a command as kept in a shell history file.
+type ShellCommand struct {
+	Time    time.Time
+	Command string
+}
+
+// FormatShellHistory writes cmds in format. Zsh has no timestamps to write.
+func FormatShellHistory(format ShellFormat, cmds []ShellCommand) []byte {
+	var b bytes.Buffer
+	for _, c := range cmds {
+		switch format {
+		case ZshExtended:
+			fmt.Fprintf(&b, ": %d:0;%s\n", c.Time.Unix(), strings.ReplaceAll(c.Command, "\n", "\\\n"))
+		case Zsh:
+			fmt.Fprintf(&b, "%s\n", strings.ReplaceAll(c.Command, "\n", "\\\n"))
+		default:
+			fmt.Fprintf(&b, "#%d\n%s\n", c.Time.Unix(), c.Command)
+		}
+	}
+	return b.Bytes()
+}
+
+// DetectShellFormat works out the format of the history file data, going by
+// zshName, whether the file is zsh's, when the data has no timestamps to tell.
+func DetectShellFormat(data []byte, zshName bool) ShellFormat {
+	for _, line := range strings.Split(string(data), "\n") {
+		if zshExtendedLine.MatchString(line) {
+			return ZshExtended
+		}
+		if bashTimestamp.MatchString(line) {
+			return Bash
+		}
+	}
+	switch {
+	case zshName && len(bytes.TrimSpace(data)) == 0:
+		return ZshExtended
+	case zshName:
+		return Zsh
+	default:
+		return Bash
+	}
+}
+
+// shellRecord is one command in a history file, as it was written there.
+type shellRecord struct {
+	unix    int64
+	raw     string
+	command string
+}
+
+// MergeShellHistory adds cmds to the history file data, which is in format,
+// and returns the result. Commands already there at the same time are left
+// out, so merging twice adds nothing. The commands are put in time order
+// among the others; without timestamps, as with Zsh, they go at the end.
+// What was in the file is kept byte for byte.
+func MergeShellHistory(data []byte, format ShellFormat, cmds []ShellCommand) (merged []byte, added int) {
+	records := parseShellHistory(string(data), format)
+	seen := make(map[string]bool)
+	for _, r := range records {
+		seen[strconv.FormatInt(r.unix, 10)+"\x00"+r.command] = true
+	}
+	for _, c := range cmds {
+		key := strconv.FormatInt(c.Time.Unix(), 10) + "\x00" + c.Command
+		if format == Zsh {
+			key = "0\x00" + c.Command
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		raw := string(FormatShellHistory(format, []ShellCommand{c}))
+		unix := c.Time.Unix()
+		if format == Zsh {
+			unix = 0
+		}
+		records = append(records, shellRecord{unix: unix, raw: raw, command: c.Command})
+		added++
+	}
+	slices.SortStableFunc(records, func(a, b shellRecord) int { return cmp.Compare(a.unix, b.unix) })
+
+	var b strings.Builder
+	for _, r := range records {
+		b.WriteString(r.raw)
+	}
+	return []byte(b.String()), added
+}
+
+// parseShellHistory splits a history file into its commands. Commands
+// without a timestamp of their own take the one before them.
+func parseShellHistory(data string, format ShellFormat) []shellRecord {
+	lines := strings.SplitAfter(data, "\n")
+	if n := len(lines); n > 0 && lines[n-1] == "" {
+		lines = lines[:n-1]
+	}
+	var records []shellRecord
+	var unix int64
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		r := shellRecord{unix: unix, raw: line}
+		switch format {
+		case Bash:
+			m := bashTimestamp.FindStringSubmatch(strings.TrimRight(line, "\n"))
+			if m == nil {
+				// A line on its own, from before timestamps were kept.
+				r.command = strings.TrimRight(line, "\n")
+				break
+			}
+			unix, _ = strconv.ParseInt(m[1], 10, 64)
+			r.unix = unix
+			// The command is every line up to the next timestamp.
+			var command []string
+			for i+1 < len(lines) && !bashTimestamp.MatchString(strings.TrimRight(lines[i+1], "\n")) {
+				i++
+				r.raw += lines[i]
+				command = append(command, strings.TrimRight(lines[i], "\n"))
+			}
+			r.command = strings.Join(command, "\n")
+		default:
+			if m := zshExtendedLine.FindStringSubmatch(line); m != nil {
+				unix, _ = strconv.ParseInt(m[1], 10, 64)
+				r.unix = unix
+				line = line[len(m[0]):]
+			}
+			command := strings.TrimRight(line, "\n")
+			// Newlines in the command are escaped with a backslash.
+			for strings.HasSuffix(command, "\\") && i+1 < len(lines) {
+				i++
+				r.raw += lines[i]
+				command = command[:len(command)-1] + "\n" + strings.TrimRight(lines[i], "\n")
+			}
+			r.command = command
+		}
+		if !strings.HasSuffix(r.raw, "\n") {
+			r.raw += "\n"
+		}
+		records = append(records, r)
+	}
+	return records
+}
@@ -0,0 +1,133 @@
+// Package metrics aggregates usage, latency and cost figures in memory and
+// periodically exports them to a statsd or OTLP/HTTP endpoint.
+package metrics
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyBounds are the upper bounds, in milliseconds, of the latency histogram buckets.
+var LatencyBounds = []float64{50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000}
+
+// Histogram is a cumulative latency distribution.
+type Histogram struct {
+	Count uint64
+	Sum   float64 // milliseconds
+	// Buckets[i] counts observations <= LatencyBounds[i]; the last element counts the rest.
+	Buckets []uint64
+}
+
+// Snapshot is a point-in-time copy of all cumulative values.
+type Snapshot struct {
+	Start      time.Time
+	Time       time.Time
+	Counters   map[string]float64
+	Histograms map[string]Histogram
+}
+
+// Registry collects metrics. It is safe for concurrent use.
+type Registry struct {
+	mu         sync.Mutex
+	start      time.Time
+	counters   map[string]float64
+	histograms map[string]*Histogram
+}
+
+// New returns an empty registry.
+func New() *Registry {
+	return &Registry{
+		start:      time.Now(),
+		counters:   make(map[string]float64),
+		histograms: make(map[string]*Histogram),
+	}
+}
+
+// Add increases the counter name by v.
+func (r *Registry) Add(name string, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[name] += v
+}
+
+// Observe records a latency sample for the histogram name.
+func (r *Registry) Observe(name string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.histograms[name]
+	if !ok {
+		h = &Histogram{Buckets: make([]uint64, len(LatencyBounds)+1)}
+		r.histograms[name] = h
+	}
+	ms := float64(d) / float64(time.Millisecond)
+	h.Count++
+	h.Sum += ms
+	i := sort.SearchFloat64s(LatencyBounds, ms)
+	h.Buckets[i]++
+}
+
+// Snapshot returns a copy of the current values.
+func (r *Registry) Snapshot() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := Snapshot{
+		Start:      r.start,
+		Time:       time.Now(),
+		Counters:   make(map[string]float64, len(r.counters)),
+		Histograms: make(map[string]Histogram, len(r.histograms)),
+	}
+	for k, v := range r.counters {
+		s.Counters[k] = v
+	}
+	for k, h := range r.histograms {
+		c := *h
+		c.Buckets = append([]uint64(nil), h.Buckets...)
+		s.Histograms[k] = c
+	}
+	return s
+}
+
+// Exporter sends snapshots to a metrics backend.
+type Exporter interface {
+	Export(s Snapshot) error
+}
+
+// NewExporter returns an exporter for endpoint: statsd://host:port for statsd
+// over UDP, or an http(s) URL of an OTLP/HTTP collector.
+func NewExporter(endpoint, prefix string) (Exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metrics endpoint: %w", err)
+	}
+	switch u.Scheme {
+	case "statsd", "udp":
+		return newStatsdExporter(u.Host, prefix)
+	case "http", "https":
+		return newOTLPExporter(u, prefix), nil
+	default:
+		return nil, fmt.Errorf("unsupported metrics endpoint %q (use statsd://host:port or http(s)://collector:4318)", endpoint)
+	}
+}
+
+// Run exports a snapshot of r every interval until stop is closed, then exports a final one.
+// Export errors are passed to onError, which may be nil.
+func (r *Registry) Run(exp Exporter, interval time.Duration, stop <-chan struct{}, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			if err := exp.Export(r.Snapshot()); err != nil && onError != nil {
+				onError(err)
+			}
+			return
+		}
+		if err := exp.Export(r.Snapshot()); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// otlpExporter posts cumulative metrics to an OTLP/HTTP collector using the JSON encoding.
+type otlpExporter struct {
+	url    string
+	prefix string
+	client *http.Client
+}
+
+func newOTLPExporter(u *url.URL, prefix string) *otlpExporter {
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+	return &otlpExporter{url: u.String(), prefix: prefix, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type otlpAttribute struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+type otlpDataPoint struct {
+	StartTimeUnixNano string    `json:"startTimeUnixNano"`
+	TimeUnixNano      string    `json:"timeUnixNano"`
+	AsDouble          *float64  `json:"asDouble,omitempty"`
+	Count             string    `json:"count,omitempty"`
+	Sum               *float64  `json:"sum,omitempty"`
+	BucketCounts      []string  `json:"bucketCounts,omitempty"`
+	ExplicitBounds    []float64 `json:"explicitBounds,omitempty"`
+}
+
+type otlpMetric struct {
+	Name      string         `json:"name"`
+	Unit      string         `json:"unit,omitempty"`
+	Sum       *otlpSum       `json:"sum,omitempty"`
+	Histogram *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpHistogram struct {
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+}
+
+// aggregationCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE in the OTLP protocol.
+const aggregationCumulative = 2
+
+func (e *otlpExporter) name(metric string) string {
+	if e.prefix == "" {
+		return metric
+	}
+	return e.prefix + "." + metric
+}
+
+func (e *otlpExporter) Export(s Snapshot) error {
+	start := strconv.FormatInt(s.Start.UnixNano(), 10)
+	now := strconv.FormatInt(s.Time.UnixNano(), 10)
+
+	var metrics []otlpMetric
+	for _, name := range sortedKeys(s.Counters) {
+		v := s.Counters[name]
+		metrics = append(metrics, otlpMetric{
+			Name: e.name(name),
+			Sum: &otlpSum{
+				AggregationTemporality: aggregationCumulative,
+				IsMonotonic:            true,
+				DataPoints:             []otlpDataPoint{{StartTimeUnixNano: start, TimeUnixNano: now, AsDouble: &v}},
+			},
+		})
+	}
+	for _, name := range sortedKeys(s.Histograms) {
+		h := s.Histograms[name]
+		sum := h.Sum
+		buckets := make([]string, len(h.Buckets))
+		for i, b := range h.Buckets {
+			buckets[i] = strconv.FormatUint(b, 10)
+		}
+		metrics = append(metrics, otlpMetric{
+			Name: e.name(name),
+			Unit: "ms",
+			Histogram: &otlpHistogram{
+				AggregationTemporality: aggregationCumulative,
+				DataPoints: []otlpDataPoint{{
+					StartTimeUnixNano: start,
+					TimeUnixNano:      now,
+					Count:             strconv.FormatUint(h.Count, 10),
+					Sum:               &sum,
+					BucketCounts:      buckets,
+					ExplicitBounds:    LatencyBounds,
+				}},
+			},
+		})
+	}
+
+	host, _ := os.Hostname()
+	payload := map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource": map[string]any{"attributes": []otlpAttribute{
+				{Key: "service.name", Value: map[string]string{"stringValue": "bash-generator"}},
+				{Key: "host.name", Value: map[string]string{"stringValue": host}},
+			}},
+			"scopeMetrics": []any{map[string]any{
+				"scope":   map[string]string{"name": "bash-generator"},
+				"metrics": metrics,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("OTLP export failed: %d - %s", resp.StatusCode, string(responseBody))
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
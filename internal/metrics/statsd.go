@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// statsdExporter sends the change since the previous export: counters as
+// counts, histograms as the number of samples and their mean.
+type statsdExporter struct {
+	conn   net.Conn
+	prefix string
+	last   Snapshot
+}
+
+func newStatsdExporter(addr, prefix string) (*statsdExporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open statsd connection: %w", err)
+	}
+	return &statsdExporter{conn: conn, prefix: prefix}, nil
+}
+
+func (e *statsdExporter) name(metric string) string {
+	if e.prefix == "" {
+		return metric
+	}
+	return e.prefix + "." + metric
+}
+
+func (e *statsdExporter) Export(s Snapshot) error {
+	var lines []string
+	for name, v := range s.Counters {
+		if delta := v - e.last.Counters[name]; delta != 0 {
+			lines = append(lines, fmt.Sprintf("%s:%g|c", e.name(name), delta))
+		}
+	}
+	for name, h := range s.Histograms {
+		prev := e.last.Histograms[name]
+		n := h.Count - prev.Count
+		if n == 0 {
+			continue
+		}
+		mean := (h.Sum - prev.Sum) / float64(n)
+		lines = append(lines,
+			fmt.Sprintf("%s.count:%d|c", e.name(name), n),
+			fmt.Sprintf("%s.mean:%g|ms", e.name(name), mean))
+	}
+	e.last = s
+	sort.Strings(lines)
+
+	// Keep datagrams well below the typical 1432 byte safe UDP payload.
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if buf.Len()+len(line)+1 > 1400 {
+			if _, err := e.conn.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+		buf.WriteString(strings.ReplaceAll(line, " ", "_"))
+		buf.WriteByte('\n')
+	}
+	if buf.Len() > 0 {
+		_, err := e.conn.Write(buf.Bytes())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+// Package models manages the files local speech-to-text and language model
+// backends need: a registry of known models, a shared on-disk cache, and
+// verified downloads.
+package models
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Kinds of model files.
+const (
+	KindWhisper = "whisper" // whisper.cpp ggml model
+	KindVosk    = "vosk"    // Vosk model directory, distributed as a zip
+	KindGGUF    = "gguf"    // llama.cpp compatible language model
+)
+
+// Model describes a downloadable model.
+type Model struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	URL  string `json:"url"`
+	// SHA256 pins the checksum of the download. SHA1 may pin it instead, for
+	// models whose publisher only gives that, as whisper.cpp does. A model
+	// without either can't be downloaded.
+	SHA256 string `json:"sha256,omitempty"`
+	SHA1   string `json:"sha1,omitempty"`
+}
+
+// Builtin lists the models known out of the box. The whisper.cpp checksums
+// are the ones published in its models/README.md.
+var Builtin = []Model{
+	{Name: "whisper-tiny.en", Kind: KindWhisper, URL: "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-tiny.en.bin", SHA1: "c78c86eb1a8faa21b369bcd33207cc90d64ae9df"},
+	{Name: "whisper-base.en", Kind: KindWhisper, URL: "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-base.en.bin", SHA1: "137c40403d78fd54d454da0f9bd998f78703390c"},
+	{Name: "whisper-small.en", Kind: KindWhisper, URL: "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-small.en.bin", SHA1: "db8a495a91d927739e50b3fc1cc4c6b8f6c2d022"},
+	{Name: "whisper-base", Kind: KindWhisper, URL: "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-base.bin", SHA1: "465707469ff3a37a2b9b8d8f89f2f99de7299dac"},
+	{Name: "whisper-small", Kind: KindWhisper, URL: "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-small.bin", SHA1: "55356645c2b361a969dfd0ef2c5a50d530afd8d5"},
+}
+
+// Cache is a directory of downloaded models shared by all backends.
+type Cache struct {
+	Dir string
+	// Models is the registry: Builtin plus any user-defined models.
+	Models []Model
+	// Progress, if set, is called while downloading with bytes done and total (-1 if unknown).
+	Progress func(name string, done, total int64)
+	// HTTPClient is used for downloads, which fail without one. It decides
+	// where they may go, through a proxy or only to this machine.
+	HTTPClient *http.Client
+}
+
+// Lookup finds a model by name. User-defined models shadow built-in ones.
+func (c *Cache) Lookup(name string) (Model, bool) {
+	for i := len(c.Models) - 1; i >= 0; i-- {
+		if c.Models[i].Name == name {
+			return c.Models[i], true
+		}
+	}
+	return Model{}, false
+}
+
+// Path returns where m is stored: a file, or a directory for Vosk models.
+func (c *Cache) Path(m Model) string {
+	name := m.Name
+	if m.Kind != KindVosk {
+		name += filepath.Ext(strings.SplitN(m.URL, "?", 2)[0])
+	}
+	return filepath.Join(c.Dir, m.Kind, name)
+}
+
+// Installed reports whether m is in the cache.
+func (c *Cache) Installed(m Model) bool {
+	_, err := os.Stat(c.Path(m))
+	return err == nil
+}
+
+// Ensure returns the path of the named model, downloading it first if it is
+// not cached yet. Backends call this so models are fetched lazily on first use.
+func (c *Cache) Ensure(ctx context.Context, name string) (string, error) {
+	m, ok := c.Lookup(name)
+	if !ok {
+		return "", fmt.Errorf("unknown model %q (see `models list`)", name)
+	}
+	if c.Installed(m) {
+		return c.Path(m), nil
+	}
+	if err := c.Pull(ctx, m); err != nil {
+		return "", err
+	}
+	return c.Path(m), nil
+}
+
+// Pull downloads m into the cache, replacing any existing copy. The download
+// is written to a temporary file and only moved into place once its checksum
+// has been verified against the one pinned in m.
+func (c *Cache) Pull(ctx context.Context, m Model) error {
+	if m.SHA256 == "" && m.SHA1 == "" {
+		return fmt.Errorf("no checksum pinned for %s; add its \"sha256\" to the model definition", m.Name)
+	}
+	if c.HTTPClient == nil {
+		return fmt.Errorf("failed to download %s: no HTTP client", m.Name)
+	}
+	dest := c.Path(m)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.URL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", m.Name, err)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", m.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", m.Name, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+m.Name+"-*.partial")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h256, h1 := sha256.New(), sha1.New()
+	var body io.Reader = resp.Body
+	if c.Progress != nil {
+		body = &progressReader{r: resp.Body, total: resp.ContentLength, report: func(done, total int64) { c.Progress(m.Name, done, total) }}
+	}
+	if _, err := io.Copy(io.MultiWriter(tmp, h256, h1), body); err != nil {
+		return fmt.Errorf("failed to download %s: %w", m.Name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	for _, sum := range []struct{ pinned, got string }{
+		{m.SHA256, hex.EncodeToString(h256.Sum(nil))},
+		{m.SHA1, hex.EncodeToString(h1.Sum(nil))},
+	} {
+		if sum.pinned != "" && !strings.EqualFold(sum.pinned, sum.got) {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", m.Name, strings.ToLower(sum.pinned), sum.got)
+		}
+	}
+
+	if err := c.Remove(m); err != nil {
+		return err
+	}
+	if m.Kind == KindVosk {
+		return unzipModel(tmp.Name(), dest)
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// Remove deletes m from the cache. Removing a model that isn't cached is not an error.
+func (c *Cache) Remove(m Model) error {
+	err := os.RemoveAll(c.Path(m))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Size returns the disk usage of a cached model.
+func (c *Cache) Size(m Model) int64 {
+	var size int64
+	filepath.Walk(c.Path(m), func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// Sorted returns the registry sorted by kind and name, without shadowed duplicates.
+func (c *Cache) Sorted() []Model {
+	byName := make(map[string]Model)
+	for _, m := range c.Models {
+		byName[m.Name] = m
+	}
+	out := make([]Model, 0, len(byName))
+	for _, m := range byName {
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// unzipModel extracts a zip archive into dest, flattening a single top-level directory.
+func unzipModel(archive, dest string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	prefix := commonRoot(zr.File)
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(f.Name, prefix)
+		if name == "" {
+			continue
+		}
+		target := filepath.Join(dest, filepath.FromSlash(name))
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path in archive: %s", f.Name)
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0o700); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+			return err
+		}
+		if err := extractFile(f, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractFile(f *zip.File, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// commonRoot returns "dir/" if every entry of the archive lives under dir.
+func commonRoot(files []*zip.File) string {
+	var root string
+	for _, f := range files {
+		first, _, found := strings.Cut(f.Name, "/")
+		if !found {
+			return ""
+		}
+		if root == "" {
+			root = first
+		} else if first != root {
+			return ""
+		}
+	}
+	if root == "" {
+		return ""
+	}
+	return root + "/"
+}
+
+type progressReader struct {
+	r      io.Reader
+	done   int64
+	total  int64
+	report func(done, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	p.report(p.done, p.total)
+	return n, err
+}
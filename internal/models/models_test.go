@@ -0,0 +1,113 @@
+package models
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPull(t *testing.T) {
+	const body = "ggml model weights"
+	sum256 := sha256.Sum256([]byte(body))
+	sum1 := sha1.Sum([]byte(body))
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// A checksum the server claims must not stand in for a pinned one.
+		w.Header().Set("X-Linked-Etag", `"`+hex.EncodeToString(sum256[:])+`"`)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		model   Model
+		wantErr string
+		// fetched is set if the model must have been requested from the server.
+		fetched bool
+	}{
+		{"sha256", Model{SHA256: strings.ToUpper(hex.EncodeToString(sum256[:]))}, "", true},
+		{"sha1", Model{SHA1: hex.EncodeToString(sum1[:])}, "", true},
+		{"both", Model{SHA256: hex.EncodeToString(sum256[:]), SHA1: hex.EncodeToString(sum1[:])}, "", true},
+		{"sha256 mismatch", Model{SHA256: strings.Repeat("0", 64)}, "checksum mismatch", true},
+		{"sha1 mismatch", Model{SHA256: hex.EncodeToString(sum256[:]), SHA1: strings.Repeat("0", 40)}, "checksum mismatch", true},
+		{"unpinned", Model{}, "no checksum pinned", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			m := tt.model
+			m.Name, m.Kind, m.URL = "test", KindWhisper, srv.URL+"/ggml-test.bin"
+			c := &Cache{Dir: t.TempDir(), Models: []Model{m}, HTTPClient: srv.Client()}
+			err := c.Pull(context.Background(), m)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Pull = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Pull = %v, want an error with %q", err, tt.wantErr)
+			}
+			if fetched := requests.Load() > 0; fetched != tt.fetched {
+				t.Errorf("fetched = %v, want %v", fetched, tt.fetched)
+			}
+			data, err := os.ReadFile(c.Path(m))
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Errorf("%s was cached despite the error", c.Path(m))
+				}
+				return
+			}
+			if string(data) != body {
+				t.Errorf("cached %q, %v; want %q", data, err, body)
+			}
+		})
+	}
+
+	t.Run("no client", func(t *testing.T) {
+		m := Model{Name: "test", Kind: KindWhisper, URL: srv.URL + "/ggml-test.bin", SHA256: hex.EncodeToString(sum256[:])}
+		c := &Cache{Dir: t.TempDir(), Models: []Model{m}}
+		if err := c.Pull(context.Background(), m); err == nil {
+			t.Error("Pull without an HTTP client = nil, want an error")
+		}
+	})
+}
+
+func TestEnsure(t *testing.T) {
+	const body = "ggml model weights"
+	sum := sha256.Sum256([]byte(body))
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	m := Model{Name: "test", Kind: KindWhisper, URL: srv.URL + "/ggml-test.bin", SHA256: hex.EncodeToString(sum[:])}
+	c := &Cache{Dir: t.TempDir(), Models: []Model{m}, HTTPClient: srv.Client()}
+	for i := 0; i < 2; i++ {
+		path, err := c.Ensure(context.Background(), "test")
+		if err != nil || path != c.Path(m) {
+			t.Fatalf("Ensure = %q, %v; want %q", path, err, c.Path(m))
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("downloaded %d times, want once", n)
+	}
+	if _, err := c.Ensure(context.Background(), "other"); err == nil {
+		t.Error("Ensure of an unknown model = nil, want an error")
+	}
+}
+
+func TestBuiltinPinned(t *testing.T) {
+	for _, m := range Builtin {
+		if len(m.SHA256) != 64 && len(m.SHA1) != 40 {
+			t.Errorf("%s has no pinned checksum", m.Name)
+		}
+	}
+}
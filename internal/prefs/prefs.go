@@ -0,0 +1,118 @@
+// Package prefs keeps notes about a project's conventions, learned from the
+// edits the user makes to generated commands, so later prompts can follow them.
+package prefs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxNotes caps the notes kept per project; the oldest are dropped first.
+const MaxNotes = 20
+
+// maxChange is the longest replacement worth remembering. Longer edits are
+// rewrites of the command rather than a convention.
+const maxChange = 60
+
+// Store is the notes file of one project.
+type Store struct {
+	Path string
+}
+
+type file struct {
+	Project string   `json:"project"`
+	Notes   []string `json:"notes"`
+}
+
+// Load returns the notes, oldest first. A missing file has no notes.
+func (s *Store) Load() ([]string, error) {
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return f.Notes, nil
+}
+
+// Add records note for project, moving it to the end if it is already known.
+func (s *Store) Add(project, note string) error {
+	f, err := s.read()
+	if err != nil {
+		return err
+	}
+	f.Project = project
+	notes := []string{}
+	for _, n := range f.Notes {
+		if n != note {
+			notes = append(notes, n)
+		}
+	}
+	notes = append(notes, note)
+	if len(notes) > MaxNotes {
+		notes = notes[len(notes)-MaxNotes:]
+	}
+	f.Notes = notes
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.Path, data, 0o600)
+}
+
+func (s *Store) read() (*file, error) {
+	f := &file{}
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("invalid notes file %s: %w", s.Path, err)
+	}
+	return f, nil
+}
+
+// Distill turns the user's edit of a generated command into a short note, e.g.
+// "Use `docker compose` instead of `docker-compose`". It compares the commands
+// word by word and only reports small, local changes; ok is false when there
+// is nothing worth remembering.
+func Distill(generated, edited string) (note string, ok bool) {
+	a, b := strings.Fields(generated), strings.Fields(edited)
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	removed := strings.Join(a[prefix:len(a)-suffix], " ")
+	added := strings.Join(b[prefix:len(b)-suffix], " ")
+	if removed == added || len(removed) > maxChange || len(added) > maxChange {
+		return "", false
+	}
+	var change string
+	switch {
+	case removed == "":
+		change = fmt.Sprintf("include `%s`", added)
+	case added == "":
+		change = fmt.Sprintf("don't use `%s`", removed)
+	default:
+		change = fmt.Sprintf("use `%s` instead of `%s`", added, removed)
+	}
+	// A change to the first word is a choice of tool; anything else is about how
+	// that tool is used, so name it.
+	if prefix > 0 {
+		return fmt.Sprintf("With `%s`, %s", a[0], change), true
+	}
+	return strings.ToUpper(change[:1]) + change[1:], true
+}
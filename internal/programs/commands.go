@@ -0,0 +1,246 @@
+package programs
+
+import (
+	"slices"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/jerilseb/bash-generator/internal/shell"
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// Command is a simple command: the words it is run with, its name first, and
+// the files it is redirected to or from. The name comes after the wrappers
+// that run it, like sudo, which are words of the command too.
+type Command struct {
+	Words     []Word
+	Redirects []Redirect
+}
+
+// Word is a word of a command. Value has the quotes removed, unless the word
+// has expansions, like "$HOME/notes", whose value is only known at run time;
+// then Value is the word as written and Literal is false.
+type Word struct {
+	Value   string
+	Literal bool
+}
+
+// Redirect is a redirection to or from a file, like > out.txt.
+type Redirect struct {
+	// Op is the operator: <, >, >>, &>, >| and so on, without the file
+	// descriptor number.
+	Op     string
+	Target Word
+}
+
+// Commands returns the simple commands command is made of, in the order they
+// start, those in command substitutions included. A redirection of a compound
+// command, like a while loop, makes a command with no words.
+func Commands(command string) []Command {
+	cmds, _ := parse(command)
+	return cmds
+}
+
+// parse returns the simple commands command is made of and the functions and
+// aliases it defines.
+func parse(command string) (cmds []Command, defined map[string]bool) {
+	defined = map[string]bool{}
+	f, err := shell.Parse(command)
+	if err != nil {
+		return nil, defined
+	}
+	p := &parser{src: command, placeholders: generate.PlaceholderIndex(command)}
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.Stmt:
+			var c Command
+			switch x := n.Cmd.(type) {
+			case *syntax.CallExpr:
+				for _, arg := range x.Args {
+					if w, ok := p.word(arg); ok {
+						c.Words = append(c.Words, w)
+					}
+				}
+				if len(c.Words) > 0 && c.Words[0].Value == "alias" {
+					for _, w := range c.Words[1:] {
+						if name, _, found := strings.Cut(w.Value, "="); found {
+							defined[name] = true
+						}
+					}
+				}
+			case *syntax.DeclClause:
+				c.Words = append(c.Words, Word{Value: x.Variant.Value, Literal: true})
+				for _, a := range x.Args {
+					c.Words = append(c.Words, p.assign(a))
+				}
+			}
+			for _, r := range n.Redirs {
+				if r, ok := p.redirect(r); ok {
+					c.Redirects = append(c.Redirects, r)
+				}
+			}
+			if len(c.Words) > 0 || len(c.Redirects) > 0 {
+				cmds = append(cmds, c)
+			}
+		case *syntax.FuncDecl:
+			defined[n.Name.Value] = true
+		}
+		return true
+	})
+	return cmds, defined
+}
+
+// parser turns the words of a parsed command into Words.
+type parser struct {
+	src string
+	// placeholders are where the placeholders in src are, as found by
+	// generate.PlaceholderIndex. A word with one is only known once it is
+	// filled in.
+	placeholders [][]int
+}
+
+// text returns node as written.
+func (p *parser) text(node syntax.Node) string {
+	return p.src[node.Pos().Offset():node.End().Offset()]
+}
+
+// word returns w as a Word. It is false for a process substitution, like
+// <(sort a), which is a command of its own rather than a word.
+func (p *parser) word(w *syntax.Word) (Word, bool) {
+	if len(w.Parts) == 1 {
+		if _, ok := w.Parts[0].(*syntax.ProcSubst); ok {
+			return Word{}, false
+		}
+	}
+	start, end := int(w.Pos().Offset()), int(w.End().Offset())
+	for _, m := range p.placeholders {
+		if m[0] < end && m[1] > start {
+			return Word{Value: p.text(w)}, true
+		}
+	}
+	var b strings.Builder
+	for _, part := range w.Parts {
+		switch x := part.(type) {
+		case *syntax.Lit:
+			b.WriteString(unescape(x.Value, ""))
+		case *syntax.SglQuoted:
+			if x.Dollar {
+				return Word{Value: p.text(w)}, true
+			}
+			b.WriteString(x.Value)
+		case *syntax.DblQuoted:
+			for _, inner := range x.Parts {
+				lit, ok := inner.(*syntax.Lit)
+				if !ok {
+					return Word{Value: p.text(w)}, true
+				}
+				b.WriteString(unescape(lit.Value, "$`\"\\"))
+			}
+		default:
+			return Word{Value: p.text(w)}, true
+		}
+	}
+	return Word{Value: b.String(), Literal: true}, true
+}
+
+// unescape removes the backslashes from s, which escape the next character if
+// it is in only, or any character if only is empty. A backslash before a
+// newline continues the line and goes with the newline.
+func unescape(s, only string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			next := s[i+1]
+			if next == '\n' {
+				i++
+				continue
+			}
+			if only == "" || strings.IndexByte(only, next) >= 0 {
+				i++
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// assign returns an argument of declare, export and the like as a Word.
+func (p *parser) assign(a *syntax.Assign) Word {
+	switch {
+	case a.Naked && a.Value != nil:
+		w, _ := p.word(a.Value)
+		return w
+	case a.Naked:
+		return Word{Value: a.Name.Value, Literal: true}
+	case a.Value == nil:
+		return Word{Value: p.text(a), Literal: a.Array == nil}
+	}
+	w, _ := p.word(a.Value)
+	if !w.Literal {
+		return Word{Value: p.text(a)}
+	}
+	return Word{Value: p.src[a.Pos().Offset():a.Value.Pos().Offset()] + w.Value, Literal: true}
+}
+
+// redirect returns r as a Redirect, if it is to or from a file. Here-documents
+// and here-strings aren't, and neither are duplicated file descriptors, like
+// >&2.
+func (p *parser) redirect(r *syntax.Redirect) (Redirect, bool) {
+	switch r.Op {
+	case syntax.Hdoc, syntax.DashHdoc, syntax.WordHdoc:
+		return Redirect{}, false
+	}
+	target, ok := p.word(r.Word)
+	if !ok {
+		return Redirect{}, false
+	}
+	if (r.Op == syntax.DplIn || r.Op == syntax.DplOut) && (target.Value == "-" || isDigits(target.Value)) {
+		return Redirect{}, false
+	}
+	return Redirect{Op: r.Op.String(), Target: target}, true
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// Unwrap returns the command's name and arguments, past the wrappers that
+// run it, and the names of those wrappers, in order. env's assignments are
+// skipped too.
+func (c Command) Unwrap() (args []Word, wrappedBy []string) {
+	words := c.Words
+	for len(words) > 0 && words[0].Literal {
+		name := words[0].Value
+		options, ok := wrappers[name]
+		if !ok {
+			break
+		}
+		wrappedBy = append(wrappedBy, name)
+		words = words[1:]
+		skip := 0
+		if takesOperand[name] {
+			skip = 1
+		}
+	operands:
+		for len(words) > 0 {
+			w := words[0].Value
+			switch {
+			case strings.HasPrefix(w, "-") && len(w) > 1:
+				if slices.Contains(options, w) {
+					skip++
+				}
+			case skip > 0:
+				skip--
+			case assignment.MatchString(w):
+			default:
+				break operands
+			}
+			words = words[1:]
+		}
+	}
+	return words, wrappedBy
+}
@@ -0,0 +1,59 @@
+package programs
+
+import "os/exec"
+
+// managers are the package managers install commands are suggested for, the
+// system's own before Homebrew, which may be installed next to them.
+var managers = []struct {
+	program string
+	install string
+}{
+	{"apt-get", "sudo apt install"},
+	{"dnf", "sudo dnf install"},
+	{"yum", "sudo yum install"},
+	{"pacman", "sudo pacman -S"},
+	{"zypper", "sudo zypper install"},
+	{"apk", "sudo apk add"},
+	{"brew", "brew install"},
+}
+
+// packages names the package providing a program, per package manager, where
+// that isn't the program's own name. "*" is for the other managers.
+var packages = map[string]map[string]string{
+	"7z":         {"apt-get": "p7zip-full", "*": "p7zip"},
+	"ag":         {"apt-get": "silversearcher-ag", "*": "the_silver_searcher"},
+	"aws":        {"*": "awscli"},
+	"convert":    {"dnf": "ImageMagick", "yum": "ImageMagick", "*": "imagemagick"},
+	"dig":        {"apt-get": "dnsutils", "apk": "bind-tools", "pacman": "bind", "brew": "bind", "*": "bind-utils"},
+	"fd":         {"apt-get": "fd-find", "dnf": "fd-find", "*": "fd"},
+	"ffprobe":    {"*": "ffmpeg"},
+	"http":       {"*": "httpie"},
+	"magick":     {"dnf": "ImageMagick", "yum": "ImageMagick", "*": "imagemagick"},
+	"nc":         {"apt-get": "netcat-openbsd", "dnf": "nmap-ncat", "yum": "nmap-ncat", "pacman": "openbsd-netcat", "*": "netcat"},
+	"nslookup":   {"apt-get": "dnsutils", "apk": "bind-tools", "pacman": "bind", "brew": "bind", "*": "bind-utils"},
+	"pdftotext":  {"apt-get": "poppler-utils", "dnf": "poppler-utils", "yum": "poppler-utils", "*": "poppler"},
+	"rg":         {"*": "ripgrep"},
+	"shellcheck": {"dnf": "ShellCheck", "yum": "ShellCheck", "*": "shellcheck"},
+	"sqlite3":    {"apt-get": "sqlite3", "*": "sqlite"},
+	"xxd":        {"apt-get": "xxd", "dnf": "vim-common", "yum": "vim-common", "*": "vim"},
+}
+
+// InstallCommand suggests the command that installs program with the
+// package manager of this machine, or returns "" if it knows none.
+func InstallCommand(program string) string {
+	for _, m := range managers {
+		if _, err := exec.LookPath(m.program); err != nil {
+			continue
+		}
+		name := program
+		if names, ok := packages[program]; ok {
+			if n, ok := names[m.program]; ok {
+				name = n
+			} else if n, ok := names["*"]; ok {
+				name = n
+			}
+		}
+		return m.install + " " + name
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+// Package programs finds the programs a Bash command runs, so ones that aren't
+// installed can be pointed out before the command fails halfway through, and
+// the simple commands it is made of, with their arguments and redirections.
+//
+// The command is parsed as Bash, so quoting, command substitutions, compound
+// commands, redirections and here-documents are followed, but not aliases or
+// functions from the user's shell, and words it can't know until run time,
+// like "$tool", are skipped. A command Bash can't parse runs nothing.
+package programs
+
+import (
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// builtins are the Bash builtins, which are never on PATH.
+var builtins = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`
+		. : alias bg bind break builtin caller cd command compgen complete compopt continue declare
+		dirs disown echo enable eval exec exit export false fc fg getopts hash help history jobs kill
+		let local logout mapfile popd printf pushd pwd read readarray readonly return set shift shopt
+		source suspend test [ times trap true type typeset ulimit umask unalias unset wait`) {
+		builtins[name] = true
+	}
+}
+
+// wrappers run the command that follows them. The value lists the options
+// that take an argument, so it isn't mistaken for the command.
+var wrappers = map[string][]string{
+	"builtin": nil,
+	"command": nil,
+	"doas":    {"-u", "-C"},
+	"env":     {"-u", "-C", "-S"},
+	"exec":    {"-a"},
+	"ionice":  {"-c", "-n", "-p"},
+	"nice":    {"-n"},
+	"nohup":   nil,
+	"stdbuf":  {"-i", "-o", "-e"},
+	"sudo":    {"-u", "-g", "-C", "-D", "-h", "-p", "-r", "-t", "-U"},
+	"time":    {"-f", "-o"},
+	"timeout": {"-k", "-s"},
+	"watch":   {"-n", "-d"},
+	"xargs":   {"-a", "-d", "-E", "-I", "-L", "-n", "-P", "-s"},
+}
+
+// takesOperand lists wrappers with an operand before the command.
+var takesOperand = map[string]bool{"timeout": true}
+
+var assignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\[[^]]*\])?\+?=`)
+
+// Invoked returns the programs command runs, each once, in the order they
+// first appear. Builtins, keywords and functions the command defines are left
+// out, and so are programs given by path.
+func Invoked(command string) []string {
+	cmds, defined := parse(command)
+	var names []string
+	for _, c := range cmds {
+		args, wrappedBy := c.Unwrap()
+		found := wrappedBy
+		if len(args) > 0 && args[0].Literal && !strings.Contains(args[0].Value, "/") {
+			found = append(found, args[0].Value)
+		}
+		for _, name := range found {
+			if name != "" && !builtins[name] && !defined[name] && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// Missing returns the programs command runs that aren't on PATH.
+func Missing(command string) []string {
+	var missing []string
+	for _, name := range Invoked(command) {
+		if _, err := exec.LookPath(name); err != nil {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,92 @@
+package programs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInvoked(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"ls -la | grep foo", []string{"ls", "grep"}},
+		{"cd /tmp && echo hi; pwd", nil},
+		{"sudo -u bob apt install jq", []string{"sudo", "apt"}},
+		{"timeout 5 curl -s example.com", []string{"timeout", "curl"}},
+		{"env FOO=1 BAR=2 python3 app.py", []string{"env", "python3"}},
+		{"exec nginx -g 'daemon off;'", []string{"nginx"}},
+		{"FOO=1 make build", []string{"make"}},
+		{"echo $(date +%s) `hostname`", []string{"date", "hostname"}},
+		{"diff <(sort a.txt) <(sort b.txt)", []string{"diff", "sort"}},
+		{"./deploy.sh && /usr/bin/env", nil},
+		{"$tool --version", nil},
+		{"greet() { figlet hi; }; greet", []string{"figlet"}},
+		{"function greet { figlet hi; }\ngreet", []string{"figlet"}},
+		{"alias ll='ls -la'; ll", nil},
+		{"if [[ -f x ]]; then rsync a b; fi", []string{"rsync"}},
+		{"for f in *.png; do convert \"$f\" \"${f%.png}.jpg\"; done", []string{"convert"}},
+		{"case $1 in start) systemctl start app;; stop) systemctl stop app;; esac", []string{"systemctl"}},
+		{"while read -r line; do jq . <<< \"$line\"; done < in.json", []string{"jq"}},
+		{"cat <<EOF\nrm -rf /\nEOF", []string{"cat"}},
+		{"cat <<EOF\ntoday is $(date)\nEOF", []string{"cat", "date"}},
+		{"echo 'ls; rm -rf /'", nil},
+		{"(( n++ )) && export PATH=$PATH:~/bin", nil},
+		{"time make -j8", []string{"make"}},
+		{"scp <file> <user>@<host>:", []string{"scp"}},
+		{"echo 'unclosed", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := Invoked(tt.command); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Invoked(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommands(t *testing.T) {
+	lit := func(s string) Word { return Word{Value: s, Literal: true} }
+	tests := []struct {
+		command string
+		want    []Command
+	}{
+		{"rm -rf 'my dir' build\\ out", []Command{{Words: []Word{lit("rm"), lit("-rf"), lit("my dir"), lit("build out")}}}},
+		{`cp "$HOME/notes" "a \"b\""`, []Command{{Words: []Word{lit("cp"), {Value: `"$HOME/notes"`}, lit(`a "b"`)}}}},
+		{"sort < in.txt 2>/dev/null >> out.txt", []Command{{
+			Words:     []Word{lit("sort")},
+			Redirects: []Redirect{{Op: "<", Target: lit("in.txt")}, {Op: ">", Target: lit("/dev/null")}, {Op: ">>", Target: lit("out.txt")}},
+		}}},
+		{"make >&2 2>&1 &> build.log", []Command{{Words: []Word{lit("make")}, Redirects: []Redirect{{Op: "&>", Target: lit("build.log")}}}}},
+		{"echo $(cat a) > b", []Command{
+			{Words: []Word{lit("echo"), {Value: "$(cat a)"}}, Redirects: []Redirect{{Op: ">", Target: lit("b")}}},
+			{Words: []Word{lit("cat"), lit("a")}},
+		}},
+		{"while read l; do echo $l; done < list.txt", []Command{
+			{Redirects: []Redirect{{Op: "<", Target: lit("list.txt")}}},
+			{Words: []Word{lit("read"), lit("l")}},
+			{Words: []Word{lit("echo"), {Value: "$l"}}},
+		}},
+		{"export EDITOR=vim PATH=$PATH:/opt", []Command{{Words: []Word{lit("export"), lit("EDITOR=vim"), {Value: "PATH=$PATH:/opt"}}}}},
+		{"cp <src> /tmp", []Command{{Words: []Word{lit("cp"), {Value: "<src>"}, lit("/tmp")}}}},
+		{"if true; then", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := Commands(tt.command); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Commands(%q) =\n%+v\nwant\n%+v", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	c := Commands("sudo -u root nice -n 5 env LANG=C timeout 10 tar xzf a.tgz")[0]
+	args, wrappedBy := c.Unwrap()
+	if want := []string{"sudo", "nice", "env", "timeout"}; !reflect.DeepEqual(wrappedBy, want) {
+		t.Errorf("wrappedBy = %q, want %q", wrappedBy, want)
+	}
+	if len(args) != 3 || args[0].Value != "tar" {
+		t.Errorf("args = %+v, want tar and its arguments", args)
+	}
+}
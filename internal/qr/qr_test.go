@@ -0,0 +1,141 @@
+package qr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The symbols in testdata were made with Kazuhiko Arase's QRCode library, at
+// level M with the mask that scores lowest under the penalty rules of
+// ISO/IEC 18004, and drawn a row per line with # for dark modules.
+func TestEncodeGolden(t *testing.T) {
+	tests := []struct {
+		file    string
+		data    string
+		version int
+	}{
+		{"empty.txt", "", 1},
+		{"ls.txt", "ls -la", 1},
+		// The most byte mode holds at version 1, and one more.
+		{"git-status.txt", "git status -sb", 1},
+		{"docker-ps.txt", "docker ps -a -q", 2},
+		{"repeated.txt", strings.Repeat("a", 100), 6},
+		// The first version with version information, filled to the brim.
+		{"find.txt", `find . -type f -name '*.log' -mtime +7 -exec gzip {} \; && du -sh . && ls -la | sort -k5 -n | tail -n 9 | awk '{print $9}'`, 7},
+		// The first version with a 16-bit length, and blocks of two lengths.
+		{"gofmt.txt", `for f in $(git ls-files '*.go'); do gofmt -l "$f"; done | xargs -r sed -i 's/interface{}/any/g' && go build ./... && go vet ./... && go test -race -count=1 ./... 2>&1 | tee /tmp/test.log | grep -E '^(FAIL|ok)'`, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			golden, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := strings.Fields(string(golden))
+			c, err := Encode([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size := 4*tt.version + 17; c.Size != size || len(want) != size {
+				t.Fatalf("size = %d, want %d (version %d)", c.Size, size, tt.version)
+			}
+			for y, row := range want {
+				var got strings.Builder
+				for x := 0; x < c.Size; x++ {
+					if c.Dark(x, y) {
+						got.WriteByte('#')
+					} else {
+						got.WriteByte('.')
+					}
+				}
+				if got.String() != row {
+					t.Errorf("row %d:\n got %s\nwant %s", y, got.String(), row)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeVersion(t *testing.T) {
+	// The byte mode capacities of level M around the boundaries.
+	tests := []struct {
+		bytes   int
+		version int
+	}{
+		{0, 1},
+		{14, 1},
+		{15, 2},
+		{26, 2},
+		{27, 3},
+		{180, 9},
+		// From version 10 on, the length takes 16 bits rather than 8.
+		{181, 10},
+		{213, 10},
+		{214, 11},
+		{2331, 40},
+	}
+	for _, tt := range tests {
+		c, err := Encode([]byte(strings.Repeat("a", tt.bytes)))
+		if err != nil {
+			t.Errorf("Encode of %d bytes: %v", tt.bytes, err)
+			continue
+		}
+		if want := 4*tt.version + 17; c.Size != want {
+			t.Errorf("Encode of %d bytes is %d modules wide, want %d (version %d)", tt.bytes, c.Size, want, tt.version)
+		}
+	}
+	if _, err := Encode(make([]byte, 2332)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Encode of 2332 bytes = %v, want ErrTooLong", err)
+	}
+}
+
+func TestEncodeMask(t *testing.T) {
+	// The mask is chosen for the lowest penalty, and the first of equals.
+	for _, data := range []string{"", "ls -la", "git status -sb", strings.Repeat("\x00", 100), strings.Repeat("\xff", 100)} {
+		c, err := Encode([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chosen := c.mask()
+		c.applyMask(chosen) // XOR again to undo
+		best, bestPenalty := -1, 0
+		for mask := 0; mask < 8; mask++ {
+			c.applyMask(mask)
+			c.drawFormatBits(mask)
+			if p := c.penalty(); best < 0 || p < bestPenalty {
+				best, bestPenalty = mask, p
+			}
+			c.applyMask(mask)
+		}
+		if chosen != best {
+			t.Errorf("Encode(%q) chose mask %d, want %d", data, chosen, best)
+		}
+	}
+}
+
+// mask reads the mask of c back from its format information.
+func (c *Code) mask() int {
+	bits := 0
+	for i := 0; i <= 5; i++ {
+		if c.modules[i][8] {
+			bits |= 1 << i
+		}
+	}
+	for i, y := range []int{7, 8} {
+		if c.modules[y][8] {
+			bits |= 1 << (6 + i)
+		}
+	}
+	if c.modules[8][7] {
+		bits |= 1 << 8
+	}
+	for i := 9; i < 15; i++ {
+		if c.modules[8][14-i] {
+			bits |= 1 << i
+		}
+	}
+	return (bits ^ 0x5412) >> 10 & 7
+}
@@ -0,0 +1,96 @@
+// Package redact masks credentials, such as API keys, tokens and passwords, in
+// text that is about to leave the machine.
+package redact
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Mask replaces what a rule matches.
+const Mask = "[REDACTED]"
+
+// secretGroup names the part of a rule's match that is masked, when only part
+// of it is the credential: the value of key=value, but not the key.
+const secretGroup = "secret"
+
+// DefaultRules match credentials that commonly show up in shell history,
+// directory listings and command output.
+var DefaultRules = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b[a-z0-9_.-]*(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|credentials?)[a-z0-9_.-]*["']?\s*[:=]\s*["']?(?P<secret>[^\s"',;]+)`),
+	regexp.MustCompile(`(?i)--(?:password|token|api-key|secret)\s+(?P<secret>[^\s"']+)`),
+	regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]{8,}`),
+	regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.-]*://[^/\s:@]+:(?P<secret>[^/\s@]+)@`),
+	regexp.MustCompile(`\b(sk|pk|rk)-[A-Za-z0-9_-]{16,}\b`),
+	regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{20,}\b`),
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{20,}\b`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`),
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+}
+
+// Redactor masks whatever its rules match.
+type Redactor struct {
+	rules []*regexp.Regexp
+}
+
+// New returns a redactor with DefaultRules and the given extra rules.
+func New(extra ...*regexp.Regexp) *Redactor {
+	return &Redactor{rules: append(append([]*regexp.Regexp{}, DefaultRules...), extra...)}
+}
+
+// LoadRules reads a rules file: one regular expression per line, in Go's
+// syntax, with blank lines and lines starting with # skipped. A rule masks
+// all of its match, or only its group named secret if it has one.
+func LoadRules(path string) ([]*regexp.Regexp, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []*regexp.Regexp
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		rules = append(rules, re)
+	}
+	return rules, scanner.Err()
+}
+
+// Redact returns s with everything the rules match replaced by Mask.
+func (r *Redactor) Redact(s string) string {
+	for _, re := range r.rules {
+		group := re.SubexpIndex(secretGroup)
+		if group < 0 {
+			s = re.ReplaceAllLiteralString(s, Mask)
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+			start, end := m[2*group], m[2*group+1]
+			if start < 0 {
+				continue
+			}
+			b.WriteString(s[last:start])
+			b.WriteString(Mask)
+			last = end
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s
+}
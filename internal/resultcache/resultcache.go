@@ -0,0 +1,235 @@
+// Package resultcache keeps the results of API calls on disk for a while,
+// under a hash of everything that went into them, so a call made again with
+// the same input is answered at once and for free.
+package resultcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Kinds of results, each kept in a directory of its own.
+const (
+	// Transcripts are keyed by the audio and the transcription settings.
+	Transcripts = "transcripts"
+	// Commands are keyed by the whole generation request and the model.
+	Commands = "commands"
+)
+
+// Kinds lists the kinds of results.
+var Kinds = []string{Transcripts, Commands}
+
+// entry is the file a result is kept in.
+type entry struct {
+	Created time.Time       `json:"created"`
+	Hits    int             `json:"hits,omitempty"`
+	Value   json.RawMessage `json:"value"`
+}
+
+// Cache is a directory of results, one file each.
+type Cache struct {
+	Dir string
+	// TTL is how long a result is good for after it was stored. Entries are
+	// judged by the TTL in force when they are read, so shortening it
+	// expires older ones at once.
+	TTL time.Duration
+}
+
+// Key hashes parts, which are encoded as JSON, into a key.
+func Key(parts ...any) (string, error) {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, p := range parts {
+		if err := enc.Encode(p); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *Cache) path(kind, key string) string {
+	return filepath.Join(c.Dir, kind, key+".json")
+}
+
+// Get decodes the result of kind stored under key into out, and reports
+// whether there was one that hasn't expired. Expired results are removed.
+func (c *Cache) Get(kind, key string, out any) (bool, error) {
+	path := c.path(kind, key)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil || time.Since(e.Created) > c.TTL {
+		os.Remove(path)
+		return false, nil
+	}
+	if err := json.Unmarshal(e.Value, out); err != nil {
+		os.Remove(path)
+		return false, nil
+	}
+	// Counting the hit is only for the stats; losing it doesn't matter.
+	e.Hits++
+	c.write(path, e)
+	return true, nil
+}
+
+// Put stores v as the result of kind under key.
+func (c *Cache) Put(kind, key string, v any) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	path := c.path(kind, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return c.write(path, entry{Created: time.Now().UTC(), Value: value})
+}
+
+// write replaces the file at path with e in one go, so a result being read
+// at the same time is never seen half written.
+func (c *Cache) write(path string, e entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Stats describes the results of one kind.
+type Stats struct {
+	Kind string
+	// Entries counts the results, Expired those of them past the TTL.
+	Entries, Expired int
+	// Hits is how often the results still kept were used again.
+	Hits int
+	// Bytes is the size of their files.
+	Bytes int64
+	// Oldest is when the oldest result that hasn't expired was stored.
+	Oldest time.Time
+}
+
+// Stats returns the stats of each kind of result, in the order of Kinds.
+func (c *Cache) Stats() ([]Stats, error) {
+	var all []Stats
+	for _, kind := range Kinds {
+		s := Stats{Kind: kind}
+		err := c.walk(kind, func(path string, e *entry, size int64) error {
+			s.Entries++
+			s.Bytes += size
+			if e == nil {
+				s.Expired++
+				return nil
+			}
+			s.Hits += e.Hits
+			if time.Since(e.Created) > c.TTL {
+				s.Expired++
+			} else if s.Oldest.IsZero() || e.Created.Before(s.Oldest) {
+				s.Oldest = e.Created
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, s)
+	}
+	return all, nil
+}
+
+// Clear removes the results of the given kinds, all of them if none are
+// given, or with expiredOnly just those past the TTL. It returns how many it
+// removed. Without a positive TTL nothing can be told to have expired, so
+// expiredOnly is an error then rather than a way to remove everything.
+func (c *Cache) Clear(expiredOnly bool, kinds ...string) (int, error) {
+	if expiredOnly && c.TTL <= 0 {
+		return 0, errors.New("results only expire with a positive TTL")
+	}
+	if len(kinds) == 0 {
+		kinds = Kinds
+	}
+	removed := 0
+	for _, kind := range kinds {
+		if !slices.Contains(Kinds, kind) {
+			return removed, fmt.Errorf("unknown kind of result %q (expected %s)", kind, strings.Join(Kinds, " or "))
+		}
+		err := c.walk(kind, func(path string, e *entry, _ int64) error {
+			if expiredOnly && e != nil && time.Since(e.Created) <= c.TTL {
+				return nil
+			}
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			removed++
+			return nil
+		})
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// walk calls fn with every result of kind, and the size of its file. The
+// entry is nil if the file can't be parsed, which counts as expired.
+func (c *Cache) walk(kind string, fn func(path string, e *entry, size int64) error) error {
+	dir := filepath.Join(c.Dir, kind)
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		var e *entry
+		if data, err := os.ReadFile(path); err == nil {
+			var parsed entry
+			if json.Unmarshal(data, &parsed) == nil {
+				e = &parsed
+			}
+		}
+		if err := fn(path, e, info.Size()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package resultcache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// age backdates the result of kind under key by d.
+func age(t *testing.T, c *Cache, kind, key string, d time.Duration) {
+	t.Helper()
+	path := c.path(kind, key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		t.Fatal(err)
+	}
+	e.Created = e.Created.Add(-d)
+	if err := c.write(path, e); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPutGet(t *testing.T) {
+	c := &Cache{Dir: t.TempDir(), TTL: time.Hour}
+	key, err := Key("audio", 16000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := Key("audio", 8000); other == key {
+		t.Fatal("Key ignores its parts")
+	}
+	var got string
+	if ok, err := c.Get(Transcripts, key, &got); ok || err != nil {
+		t.Fatalf("Get before Put = %v, %v; want false, nil", ok, err)
+	}
+	if err := c.Put(Transcripts, key, "list the files"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if ok, err := c.Get(Transcripts, key, &got); !ok || err != nil || got != "list the files" {
+			t.Fatalf("Get = %v, %v, %q; want the transcript", ok, err, got)
+		}
+	}
+	if ok, _ := c.Get(Commands, key, &got); ok {
+		t.Error("Get of another kind found the transcript")
+	}
+	stats, err := c.Stats()
+	if err != nil || stats[0].Entries != 1 || stats[0].Hits != 2 || stats[1].Entries != 0 {
+		t.Errorf("Stats = %+v, %v; want one transcript used twice", stats, err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	c := &Cache{Dir: t.TempDir(), TTL: time.Hour}
+	if err := c.Put(Commands, "old", "ls"); err != nil {
+		t.Fatal(err)
+	}
+	age(t, c, Commands, "old", 2*time.Hour)
+	stats, err := c.Stats()
+	if err != nil || stats[1].Entries != 1 || stats[1].Expired != 1 {
+		t.Errorf("Stats = %+v, %v; want one expired command", stats, err)
+	}
+	var got string
+	if ok, err := c.Get(Commands, "old", &got); ok || err != nil {
+		t.Errorf("Get of an expired result = %v, %v; want false, nil", ok, err)
+	}
+	if _, err := os.Stat(c.path(Commands, "old")); !os.IsNotExist(err) {
+		t.Errorf("the expired result wasn't removed: %v", err)
+	}
+
+	// The TTL in force when a result is read decides.
+	if err := c.Put(Commands, "recent", "ls"); err != nil {
+		t.Fatal(err)
+	}
+	age(t, c, Commands, "recent", 10*time.Minute)
+	c.TTL = 5 * time.Minute
+	if ok, _ := c.Get(Commands, "recent", &got); ok {
+		t.Error("Get after shortening the TTL found the result")
+	}
+
+	// A file that can't be parsed is as good as expired.
+	if err := os.WriteFile(c.path(Commands, "broken"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.Get(Commands, "broken", &got); ok || err != nil {
+		t.Errorf("Get of a broken result = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	c := &Cache{Dir: t.TempDir(), TTL: time.Hour}
+	for _, v := range []string{"ls", "ls -la"} {
+		if err := c.Put(Commands, "key", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got string
+	if ok, _ := c.Get(Commands, "key", &got); !ok || got != "ls -la" {
+		t.Errorf("Get = %v, %q; want the result put last", ok, got)
+	}
+
+	// A write that can't be completed leaves no temporary file behind.
+	if err := os.Mkdir(c.path(Commands, "dir"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(c.path(Commands, "dir"), "x"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(Commands, "dir", "ls"); err == nil {
+		t.Error("Put over a directory = nil, want an error")
+	}
+	files, err := os.ReadDir(filepath.Join(c.Dir, Commands))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if filepath.Ext(f.Name()) == ".tmp" {
+			t.Errorf("%s was left behind", f.Name())
+		}
+	}
+}
+
+func TestClear(t *testing.T) {
+	fill := func(t *testing.T) *Cache {
+		c := &Cache{Dir: t.TempDir(), TTL: time.Hour}
+		for _, kind := range Kinds {
+			for _, key := range []string{"old", "recent"} {
+				if err := c.Put(kind, key, key); err != nil {
+					t.Fatal(err)
+				}
+			}
+			age(t, c, kind, "old", 2*time.Hour)
+		}
+		return c
+	}
+	count := func(t *testing.T, c *Cache, kind string) int {
+		files, err := os.ReadDir(filepath.Join(c.Dir, kind))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(files)
+	}
+
+	tests := []struct {
+		name        string
+		expiredOnly bool
+		kinds       []string
+		removed     int
+		// left is how many transcripts and commands are left.
+		left [2]int
+	}{
+		{"all", false, nil, 4, [2]int{0, 0}},
+		{"one kind", false, []string{Commands}, 2, [2]int{2, 0}},
+		{"expired", true, nil, 2, [2]int{1, 1}},
+		{"expired of one kind", true, []string{Transcripts}, 1, [2]int{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fill(t)
+			n, err := c.Clear(tt.expiredOnly, tt.kinds...)
+			if n != tt.removed || err != nil {
+				t.Fatalf("Clear = %d, %v; want %d, nil", n, err, tt.removed)
+			}
+			if left := [2]int{count(t, c, Transcripts), count(t, c, Commands)}; left != tt.left {
+				t.Errorf("left %v, want %v", left, tt.left)
+			}
+		})
+	}
+
+	t.Run("expired without a TTL", func(t *testing.T) {
+		c := fill(t)
+		c.TTL = 0
+		if n, err := c.Clear(true); err == nil || n != 0 {
+			t.Errorf("Clear = %d, %v; want an error", n, err)
+		}
+		if left := count(t, c, Transcripts) + count(t, c, Commands); left != 4 {
+			t.Errorf("left %d results, want all 4", left)
+		}
+	})
+	t.Run("unknown kind", func(t *testing.T) {
+		if _, err := fill(t).Clear(false, "audio"); err == nil {
+			t.Error("Clear of an unknown kind = nil, want an error")
+		}
+	})
+}
@@ -0,0 +1,180 @@
+// Package retry provides an http.RoundTripper that retries transient failures
+// (timeouts, dropped connections, 429 and 5xx responses) with exponential backoff.
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Defaults used when the corresponding Transport field is zero.
+const (
+	DefaultBaseDelay = 500 * time.Millisecond
+	DefaultMaxDelay  = 20 * time.Second
+	// DefaultMaxRetryAfter is the longest Retry-After worth waiting for; a server
+	// asking for more is treated as a final answer.
+	DefaultMaxRetryAfter = time.Minute
+)
+
+// Transport retries requests sent through Base. Request bodies must be
+// rewindable (http.NewRequest sets GetBody for bytes and strings readers).
+type Transport struct {
+	// Base sends the requests; http.DefaultTransport if nil.
+	Base http.RoundTripper
+	// Attempts is the total number of tries per request; 1 or less disables retries.
+	Attempts      int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	MaxRetryAfter time.Duration
+	// OnRetry, if set, is called before waiting for the next attempt.
+	OnRetry func(req *http.Request, attempt int, wait time.Duration, reason string)
+}
+
+// ExhaustedError is returned when a request still failed after the last attempt.
+type ExhaustedError struct {
+	Attempts int
+	Reason   string
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("giving up after %d attempts: %s", e.Attempts, e.Reason)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, err := base.RoundTrip(req)
+		reason, retryAfter, retryable := classify(resp, err)
+		canRetry := retryable && (req.Body == nil || req.GetBody != nil)
+		if !canRetry || t.Attempts <= 1 {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt)
+		if retryAfter > 0 {
+			if retryAfter > t.maxRetryAfter() {
+				reason += fmt.Sprintf(", server asked to wait %s", retryAfter.Round(time.Second))
+				return nil, closeAndFail(resp, attempt, reason)
+			}
+			wait = retryAfter
+		}
+		if attempt >= t.Attempts {
+			return nil, closeAndFail(resp, attempt, reason)
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		if t.OnRetry != nil {
+			t.OnRetry(req, attempt, wait, reason)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// classify decides whether a result is worth retrying, and how long the server asked us to wait.
+func classify(resp *http.Response, err error) (reason string, retryAfter time.Duration, retryable bool) {
+	if err != nil {
+		var netErr net.Error
+		switch {
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return "request timed out", 0, true
+		case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED),
+			errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			return "connection failed: " + err.Error(), 0, true
+		}
+		return "", 0, false
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		reason = "rate limited (429)"
+	case resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented:
+		reason = fmt.Sprintf("server error (%s)", resp.Status)
+	default:
+		return "", 0, false
+	}
+	return reason, parseRetryAfter(resp.Header), true
+}
+
+// parseRetryAfter reads Retry-After (seconds or an HTTP date) or OpenAI's retry-after-ms.
+func parseRetryAfter(h http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(h.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// backoff doubles the delay with every attempt, with jitter so clients that
+// failed together don't retry together.
+func (t *Transport) backoff(attempt int) time.Duration {
+	base, limit := t.BaseDelay, t.MaxDelay
+	if base <= 0 {
+		base = DefaultBaseDelay
+	}
+	if limit <= 0 {
+		limit = DefaultMaxDelay
+	}
+	d := base << (attempt - 1)
+	if d > limit || d <= 0 {
+		d = limit
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (t *Transport) maxRetryAfter() time.Duration {
+	if t.MaxRetryAfter > 0 {
+		return t.MaxRetryAfter
+	}
+	return DefaultMaxRetryAfter
+}
+
+// closeAndFail releases resp and reports that the request is not retried any further.
+// The start of the response body is kept in the message, as it usually says what went wrong.
+func closeAndFail(resp *http.Response, attempts int, reason string) error {
+	if resp != nil {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		if msg := strings.TrimSpace(string(body)); msg != "" {
+			reason += " - " + msg
+		}
+	}
+	return &ExhaustedError{Attempts: attempts, Reason: reason}
+}
@@ -0,0 +1,245 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// reply is what fakeTransport answers an attempt with.
+type reply struct {
+	status int
+	header http.Header
+	body   string
+	err    error
+}
+
+// fakeTransport answers the attempts with its replies in turn, and records
+// the bodies it was sent.
+type fakeTransport struct {
+	replies []reply
+	bodies  []string
+}
+
+func (f *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		body, _ := io.ReadAll(req.Body)
+		f.bodies = append(f.bodies, string(body))
+	} else {
+		f.bodies = append(f.bodies, "")
+	}
+	r := f.replies[min(len(f.bodies), len(f.replies))-1]
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &http.Response{
+		StatusCode: r.status,
+		Status:     http.StatusText(r.status),
+		Header:     r.header,
+		Body:       io.NopCloser(strings.NewReader(r.body)),
+		Request:    req,
+	}, nil
+}
+
+func retryAfter(v string) http.Header {
+	return http.Header{"Retry-After": {v}}
+}
+
+func TestTransport(t *testing.T) {
+	ok := reply{status: http.StatusOK, body: "done"}
+	unavailable := reply{status: http.StatusServiceUnavailable, body: "overloaded"}
+	tests := []struct {
+		name     string
+		attempts int
+		replies  []reply
+		// tries is how many attempts are made.
+		tries int
+		// status is that of the response returned, or 0 if an error is.
+		status int
+		// err is part of the error returned.
+		err string
+		// waits are the waits asked for by Retry-After; nil if backoff decides.
+		waits []time.Duration
+	}{
+		{name: "success", attempts: 3, replies: []reply{ok}, tries: 1, status: 200},
+		{name: "recovers", attempts: 3, replies: []reply{unavailable, unavailable, ok}, tries: 3, status: 200},
+		{name: "exhausted", attempts: 3, replies: []reply{unavailable}, tries: 3, err: "giving up after 3 attempts: server error (Service Unavailable) - overloaded"},
+		{name: "retries disabled", attempts: 1, replies: []reply{unavailable, ok}, tries: 1, status: 503},
+		{name: "client error", attempts: 3, replies: []reply{{status: http.StatusBadRequest}, ok}, tries: 1, status: 400},
+		{name: "not implemented", attempts: 3, replies: []reply{{status: http.StatusNotImplemented}, ok}, tries: 1, status: 501},
+		{name: "connection reset", attempts: 3, replies: []reply{{err: syscall.ECONNRESET}, ok}, tries: 2, status: 200},
+		{name: "timeout", attempts: 3, replies: []reply{{err: os.ErrDeadlineExceeded}, ok}, tries: 2, status: 200},
+		{name: "other error", attempts: 3, replies: []reply{{err: errors.New("no such host")}, ok}, tries: 1, err: "no such host"},
+		{
+			name:     "retry after seconds",
+			attempts: 3,
+			replies:  []reply{{status: http.StatusTooManyRequests, header: retryAfter("0.02")}, ok},
+			tries:    2,
+			status:   200,
+			waits:    []time.Duration{20 * time.Millisecond},
+		},
+		{
+			name:     "retry after milliseconds",
+			attempts: 3,
+			replies:  []reply{{status: http.StatusTooManyRequests, header: http.Header{"Retry-After-Ms": {"15"}, "Retry-After": {"30"}}}, ok},
+			tries:    2,
+			status:   200,
+			waits:    []time.Duration{15 * time.Millisecond},
+		},
+		{
+			name:     "retry after too long",
+			attempts: 3,
+			replies:  []reply{{status: http.StatusTooManyRequests, header: retryAfter("120")}, ok},
+			tries:    1,
+			err:      "giving up after 1 attempts: rate limited (429), server asked to wait 2m0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := &fakeTransport{replies: tt.replies}
+			var waits []time.Duration
+			tr := &Transport{
+				Base:      base,
+				Attempts:  tt.attempts,
+				BaseDelay: time.Millisecond,
+				OnRetry: func(req *http.Request, attempt int, wait time.Duration, reason string) {
+					waits = append(waits, wait)
+				},
+			}
+			req, err := http.NewRequest(http.MethodPost, "http://api.example/v1", strings.NewReader("payload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := tr.RoundTrip(req)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			switch {
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("RoundTrip = %v, want an error with %q", err, tt.err)
+			case tt.err == "" && err != nil:
+				t.Errorf("RoundTrip = %v", err)
+			case tt.err == "" && resp.StatusCode != tt.status:
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if len(base.bodies) != tt.tries {
+				t.Errorf("tried %d times, want %d", len(base.bodies), tt.tries)
+			}
+			for i, body := range base.bodies {
+				if body != "payload" {
+					t.Errorf("attempt %d sent %q, want the whole body", i+1, body)
+				}
+			}
+			if len(waits) != max(tt.tries-1, 0) {
+				t.Errorf("OnRetry was called %d times, want %d", len(waits), tt.tries-1)
+			}
+			if tt.waits != nil && !equalDurations(waits, tt.waits) {
+				t.Errorf("waited %v, want %v", waits, tt.waits)
+			}
+		})
+	}
+}
+
+func equalDurations(a, b []time.Duration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTransportCancel(t *testing.T) {
+	base := &fakeTransport{replies: []reply{{status: http.StatusServiceUnavailable}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tr := &Transport{
+		Base:      base,
+		Attempts:  5,
+		BaseDelay: time.Hour,
+		MaxDelay:  time.Hour,
+		// Cancel while the transport waits for the next attempt.
+		OnRetry: func(*http.Request, int, time.Duration, string) { cancel() },
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://api.example/v1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := tr.RoundTrip(req)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("RoundTrip = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RoundTrip kept waiting after the context was cancelled")
+	}
+	if len(base.bodies) != 1 {
+		t.Errorf("tried %d times, want once", len(base.bodies))
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"none", http.Header{}, 0},
+		{"seconds", retryAfter("2"), 2 * time.Second},
+		{"fraction", retryAfter("1.5"), 1500 * time.Millisecond},
+		{"milliseconds", http.Header{"Retry-After-Ms": {"250"}}, 250 * time.Millisecond},
+		{"zero", retryAfter("0"), 0},
+		{"negative", retryAfter("-3"), 0},
+		{"garbage", retryAfter("soon"), 0},
+		{"past date", retryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header); got != tt.want {
+			t.Errorf("%s: parseRetryAfter(%v) = %v, want %v", tt.name, tt.header, got, tt.want)
+		}
+	}
+
+	at := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(retryAfter(at)); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("parseRetryAfter(%s) = %v, want about an hour", at, got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tr := &Transport{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		limit   time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{9, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if d := tr.backoff(tt.attempt); d < tt.limit/2 || d > tt.limit {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.attempt, d, tt.limit/2, tt.limit)
+			}
+		}
+	}
+	// The delay doubles until it overflows, which must not make it negative.
+	if d := tr.backoff(80); d < 500*time.Millisecond || d > time.Second {
+		t.Errorf("backoff(80) = %v, want it capped at a second", d)
+	}
+}
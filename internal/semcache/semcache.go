@@ -0,0 +1,101 @@
+// Package semcache stores the embeddings of past requests, so a new request
+// that means the same as an earlier one can be answered with the command the
+// user settled on then, without asking the model again.
+package semcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Vector is the embedding of the transcript of one history entry.
+type Vector struct {
+	// Time identifies the history entry.
+	Time  time.Time `json:"time"`
+	Model string    `json:"model"`
+	// Data holds the embedding as little-endian float32s, which JSON carries
+	// as base64 at a fraction of the size of a list of numbers.
+	Data []byte `json:"embedding"`
+}
+
+// NewVector returns the vector of the entry at t, embedded with model.
+func NewVector(t time.Time, model string, embedding []float32) Vector {
+	data := make([]byte, 4*len(embedding))
+	for i, f := range embedding {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(f))
+	}
+	return Vector{Time: t.UTC(), Model: model, Data: data}
+}
+
+// Embedding returns the embedding of the vector.
+func (v Vector) Embedding() []float32 {
+	embedding := make([]float32, len(v.Data)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(v.Data[4*i:]))
+	}
+	return embedding
+}
+
+// Store is an append-only JSON Lines file of vectors.
+type Store struct {
+	Path string
+}
+
+// Load returns the embeddings made with model, by the UTC time of their
+// entries. A missing file has none; lines that fail to parse are skipped.
+func (s *Store) Load(model string) (map[time.Time][]float32, error) {
+	embeddings := make(map[time.Time][]float32)
+	f, err := os.Open(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return embeddings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var v Vector
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil || v.Model != model {
+			continue
+		}
+		embeddings[v.Time.UTC()] = v.Embedding()
+	}
+	return embeddings, scanner.Err()
+}
+
+// Append adds vectors to the end of the file, creating it if needed.
+func (s *Store) Append(vectors ...Vector) error {
+	if len(vectors) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return err
+	}
+	var data []byte
+	for _, v := range vectors {
+		line, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// A single write keeps concurrent appends from interleaving lines.
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,34 @@
+// Package shell parses Bash commands, for the checks that look at what a
+// command is made of before it is run. Parsing runs and expands nothing.
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// Parse parses command as Bash. Placeholders, like <host>, which would read as
+// redirections, are parsed as words instead; the positions in the result are
+// those in command all the same.
+func Parse(command string) (*syntax.File, error) {
+	masked := []byte(command)
+	for _, m := range generate.PlaceholderIndex(command) {
+		masked[m[0]], masked[m[1]-1] = '_', '_'
+	}
+	return syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(bytes.NewReader(masked), "")
+}
+
+// Problem describes what err, returned by Parse, found wrong, like "line 2:
+// unclosed here-document 'EOF'".
+func Problem(err error) string {
+	var parseErr syntax.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Sprintf("line %d: %s", parseErr.Pos.Line(), parseErr.Text)
+	}
+	return err.Error()
+}
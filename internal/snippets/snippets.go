@@ -0,0 +1,226 @@
+// Package snippets keeps the commands the user has set up for phrases they
+// say often, which are used as they are instead of asking a model.
+package snippets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/jerilseb/bash-generator/pkg/generate"
+)
+
+// FuzzySimilarity is how close in spelling a request has to come to a phrase
+// to count as it: "show the disk usage" is close enough to "show disk usage",
+// "deploy testing" isn't to "deploy staging".
+const FuzzySimilarity = 0.75
+
+// Snippet is a command template for a phrase. Both may hold placeholders,
+// like <tag>: the words a placeholder in Phrase stands for fill in the one of
+// the same name in Command, and the rest are asked for.
+type Snippet struct {
+	Phrase  string `json:"phrase"`
+	Command string `json:"command"`
+}
+
+// Store is the snippets file.
+type Store struct {
+	Path string
+}
+
+type file struct {
+	Snippets []Snippet `json:"snippets"`
+}
+
+// Load returns the snippets in the order they were added. A missing file has none.
+func (s *Store) Load() ([]Snippet, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid snippets file %s: %w", s.Path, err)
+	}
+	return f.Snippets, nil
+}
+
+// Add adds sn, in place of the snippet for the same phrase if there is one.
+func (s *Store) Add(sn Snippet) error {
+	snippets, err := s.Load()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i, old := range snippets {
+		if Normalize(old.Phrase) == Normalize(sn.Phrase) {
+			snippets[i], replaced = sn, true
+		}
+	}
+	if !replaced {
+		snippets = append(snippets, sn)
+	}
+	return s.write(snippets)
+}
+
+// Remove removes the snippet for phrase, reporting whether there was one.
+func (s *Store) Remove(phrase string) (bool, error) {
+	snippets, err := s.Load()
+	if err != nil {
+		return false, err
+	}
+	var kept []Snippet
+	for _, sn := range snippets {
+		if Normalize(sn.Phrase) != Normalize(phrase) {
+			kept = append(kept, sn)
+		}
+	}
+	if len(kept) == len(snippets) {
+		return false, nil
+	}
+	return true, s.write(kept)
+}
+
+func (s *Store) write(snippets []Snippet) error {
+	if snippets == nil {
+		snippets = []Snippet{}
+	}
+	// The file is for people to read and edit too, so placeholders stay <tag>
+	// rather than \u003ctag\u003e.
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(file{Snippets: snippets}); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.Path, b.Bytes(), 0o600)
+}
+
+// Match is a snippet found for a request.
+type Match struct {
+	Snippet Snippet
+	// Values are what the placeholders in the phrase stood for in the request.
+	Values map[string]string
+	// Exact is false for a phrase the request only came close to.
+	Exact bool
+}
+
+// Find returns the snippet for text: the first whose phrase it is, ignoring
+// case and punctuation, or else the one it comes closest to in spelling, at
+// FuzzySimilarity or closer. Phrases with placeholders only match exactly.
+// It returns nil if there is none.
+func Find(snippets []Snippet, text string) *Match {
+	for _, sn := range snippets {
+		if values, ok := matchPhrase(sn.Phrase, text); ok {
+			return &Match{Snippet: sn, Values: values, Exact: true}
+		}
+	}
+	var best *Match
+	bestSimilarity := FuzzySimilarity
+	norm := Normalize(text)
+	for _, sn := range snippets {
+		if HasPlaceholders(sn.Phrase) {
+			continue
+		}
+		if s := similarity(norm, Normalize(sn.Phrase)); s >= bestSimilarity {
+			best, bestSimilarity = &Match{Snippet: sn}, s
+		}
+	}
+	return best
+}
+
+// HasPlaceholders reports whether phrase has placeholders to fill in.
+func HasPlaceholders(phrase string) bool {
+	return len(generate.FindPlaceholders(phrase)) > 0
+}
+
+// Normalize lowercases text and reduces it to its words, separated by single
+// spaces.
+func Normalize(text string) string {
+	return strings.Join(words(strings.ToLower(text)), " ")
+}
+
+func words(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) })
+}
+
+// separator is what may come between the words of a phrase, and around it.
+const separator = `[^\pL\pN]`
+
+// matchPhrase reports whether text is phrase, and what its placeholders
+// stand for. A placeholder takes one or more words, as they were said.
+func matchPhrase(phrase, text string) (map[string]string, bool) {
+	var parts, names []string
+	last := 0
+	for _, m := range generate.PlaceholderIndex(phrase) {
+		for _, w := range words(phrase[last:m[0]]) {
+			parts = append(parts, regexp.QuoteMeta(w))
+		}
+		parts = append(parts, `(.+?)`)
+		names = append(names, phrase[m[2]:m[3]])
+		last = m[1]
+	}
+	for _, w := range words(phrase[last:]) {
+		parts = append(parts, regexp.QuoteMeta(w))
+	}
+	if len(parts) == 0 {
+		return nil, false
+	}
+	re, err := regexp.Compile(`(?i)^` + separator + `*` + strings.Join(parts, separator+`+`) + separator + `*$`)
+	if err != nil {
+		return nil, false
+	}
+	m := re.FindStringSubmatch(strings.TrimSpace(text))
+	if m == nil {
+		return nil, false
+	}
+	values := make(map[string]string, len(names))
+	for i, name := range names {
+		// The same placeholder twice has to stand for the same words.
+		if v, ok := values[name]; ok && v != m[i+1] {
+			return nil, false
+		}
+		values[name] = m[i+1]
+	}
+	return values, true
+}
+
+// similarity is one minus the edit distance between a and b, in runes, over
+// the length of the longer one.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	n := max(len(ra), len(rb))
+	if n == 0 {
+		return 1
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(n)
+}
@@ -0,0 +1,226 @@
+package spoken
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// language holds the words a language speaks symbols and numbers with.
+type language struct {
+	// symbols maps the names of symbols, of one or two words, to them.
+	symbols map[string]string
+	// units are the numbers below 100 that don't end in 0, and 10.
+	units map[string]int
+	tens  map[string]int
+	// hundreds are whole hundreds said as one word.
+	hundreds map[string]int
+	hundred  []string
+	thousand []string
+	// and are the words that may join the parts of a number, as in "one
+	// hundred and five".
+	and []string
+	// point are the words between the parts of a decimal or an address.
+	point []string
+	// teensAfter are the tens a teen adds to, as in the French soixante-dix.
+	teensAfter []int
+	// timesTens are the tens that four multiplies, as in quatre-vingts.
+	timesTens []int
+	// compounds split numbers said as one word into their parts.
+	compounds []func(word string) []string
+	// triggers are words a number said in a single word is turned into
+	// digits after, like port.
+	triggers map[string]bool
+	// counted are words a number said in a single word is turned into
+	// digits before, like megabytes.
+	counted map[string]bool
+	// particles are the words, like "of", that a path never starts with, as
+	// in "the end of slash var slash log".
+	particles map[string]bool
+}
+
+// set returns a set of words.
+func set(words string) map[string]bool {
+	s := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		s[w] = true
+	}
+	return s
+}
+
+// numbered returns words mapped to their place in the list, plus start.
+func numbered(start int, words string) map[string]int {
+	m := make(map[string]int)
+	for i, w := range strings.Fields(words) {
+		for _, spelling := range strings.Split(w, "/") {
+			m[spelling] = start + i
+		}
+	}
+	return m
+}
+
+// byTen returns words mapped to 20, 30 and so on.
+func byTen(words string) map[string]int {
+	m := make(map[string]int)
+	for i, w := range strings.Fields(words) {
+		for _, spelling := range strings.Split(w, "/") {
+			m[spelling] = 20 + 10*i
+		}
+	}
+	return m
+}
+
+var english = &language{
+	symbols: map[string]string{
+		"dash": "-", "hyphen": "-", "minus": "-", "slash": "/", "forward slash": "/", "tilde": "~",
+		"dot": ".", "underscore": "_", "star": "*", "asterisk": "*", "colon": ":",
+	},
+	units:    numbered(0, "zero one two three four five six seven eight nine ten eleven twelve thirteen fourteen fifteen sixteen seventeen eighteen nineteen"),
+	tens:     byTen("twenty thirty forty fifty sixty seventy eighty ninety"),
+	hundred:  []string{"hundred"},
+	thousand: []string{"thousand"},
+	and:      []string{"and"},
+	point:    []string{"point", "dot"},
+	triggers: set("port ports pid line chmod mode version signal timeout depth level number"),
+	counted: set("files lines bytes kilobytes megabytes gigabytes terabytes kb mb gb tb k m g megs gigs " +
+		"days hours minutes seconds weeks months years percent times characters columns processes entries results commits"),
+	particles: set("a an the of in into to from at on onto for with under inside and or than as by is"),
+}
+
+// germanCompound splits a number written as one word, like
+// zweihundertfünfundzwanzig, into its parts, tens before units.
+var germanCompound = regexp.MustCompile(`^(.*?tausend)?(.*?hundert)?(?:(.+?)und)?(.*)$`)
+
+var languages = map[string]*language{
+	"de": {
+		symbols: map[string]string{
+			"strich": "-", "bindestrich": "-", "minus": "-", "schrägstrich": "/", "tilde": "~",
+			"punkt": ".", "unterstrich": "_", "stern": "*", "sternchen": "*", "doppelpunkt": ":",
+		},
+		units:    numbered(0, "null eins/ein/eine zwei drei vier fünf sechs sieben acht neun zehn elf zwölf dreizehn vierzehn fünfzehn sechzehn siebzehn achtzehn neunzehn"),
+		tens:     byTen("zwanzig dreißig/dreissig vierzig fünfzig sechzig siebzig achtzig neunzig"),
+		hundred:  []string{"hundert"},
+		thousand: []string{"tausend"},
+		point:    []string{"komma", "punkt"},
+		compounds: []func(string) []string{func(word string) []string {
+			m := germanCompound.FindStringSubmatch(word)
+			if m == nil {
+				return nil
+			}
+			var parts []string
+			for _, scale := range []struct{ part, word string }{{m[1], "tausend"}, {m[2], "hundert"}} {
+				if scale.part != "" {
+					if n := strings.TrimSuffix(scale.part, scale.word); n != "" {
+						parts = append(parts, n)
+					}
+					parts = append(parts, scale.word)
+				}
+			}
+			if m[4] != "" {
+				parts = append(parts, m[4])
+			}
+			if m[3] != "" {
+				parts = append(parts, m[3])
+			}
+			return parts
+		}},
+		triggers:  set("port ports zeile version signal timeout tiefe"),
+		counted:   set("dateien zeilen bytes kilobyte megabyte gigabyte terabyte kb mb gb tage tagen stunden minuten sekunden wochen monate monaten jahre jahren prozent mal zeichen spalten prozesse einträge commits"),
+		particles: set("in im ins nach von vom aus auf an am der die das den dem des ein eine mit unter zu zum zur und oder als"),
+	},
+	"es": {
+		symbols: map[string]string{
+			"guion": "-", "guión": "-", "menos": "-", "guion bajo": "_", "guión bajo": "_", "barra": "/", "diagonal": "/",
+			"tilde": "~", "virgulilla": "~", "punto": ".", "asterisco": "*", "dos puntos": ":",
+		},
+		units: mapsConcat(
+			numbered(0, "cero uno/un/una dos tres cuatro cinco seis siete ocho nueve diez once doce trece catorce quince dieciséis/dieciseis diecisiete dieciocho diecinueve"),
+			numbered(21, "veintiuno/veintiún/veintiun veintidós/veintidos veintitrés/veintitres veinticuatro veinticinco veintiséis/veintiseis veintisiete veintiocho veintinueve"),
+		),
+		tens:      byTen("veinte treinta cuarenta cincuenta sesenta setenta ochenta noventa"),
+		hundreds:  mapsConcat(map[string]int{"cien": 100, "ciento": 100, "quinientos": 500, "quinientas": 500}, hundredsOf("doscientos trescientos cuatrocientos _ seiscientos setecientos ochocientos novecientos")),
+		thousand:  []string{"mil"},
+		and:       []string{"y"},
+		point:     []string{"punto", "coma"},
+		triggers:  set("puerto puertos línea linea versión version señal"),
+		counted:   set("archivos ficheros líneas lineas bytes kilobytes megas megabytes gigas gigabytes kb mb gb días dias horas minutos segundos semanas meses años veces caracteres columnas procesos commits"),
+		particles: set("en de del a al el la los las un una con desde hasta y o que"),
+	},
+	"fr": {
+		symbols: map[string]string{
+			"tiret": "-", "moins": "-", "tiret bas": "_", "underscore": "_", "slash": "/", "barre oblique": "/",
+			"tilde": "~", "point": ".", "étoile": "*", "astérisque": "*", "deux points": ":",
+		},
+		units: mapsConcat(
+			numbered(0, "zéro/zero un/une deux trois quatre cinq six sept huit neuf dix onze douze treize quatorze quinze seize"),
+			numbered(17, "dix-sept dix-huit dix-neuf"),
+		),
+		tens:       map[string]int{"vingt": 20, "vingts": 20, "trente": 30, "quarante": 40, "cinquante": 50, "soixante": 60},
+		hundred:    []string{"cent", "cents"},
+		thousand:   []string{"mille"},
+		and:        []string{"et"},
+		point:      []string{"virgule", "point"},
+		teensAfter: []int{60, 80},
+		timesTens:  []int{20},
+		compounds: []func(string) []string{func(word string) []string {
+			parts := strings.Split(word, "-")
+			// dix-sept and the like are teens of their own, as in
+			// soixante-dix-sept.
+			for i := 0; i+1 < len(parts); i++ {
+				if parts[i] == "dix" && slices.Contains([]string{"sept", "huit", "neuf"}, parts[i+1]) {
+					parts = slices.Replace(parts, i, i+2, "dix-"+parts[i+1])
+				}
+			}
+			return parts
+		}},
+		triggers:  set("port ports ligne version signal"),
+		counted:   set("fichiers lignes octets ko mo go kilooctets mégaoctets megaoctets gigaoctets mégas gigas jours heures minutes secondes semaines mois ans fois caractères colonnes processus commits"),
+		particles: set("dans de du des à au aux le la les un une avec sur sous vers et ou que"),
+	},
+}
+
+// hundredsOf returns the words mapped to 200, 300 and so on; _ skips one.
+func hundredsOf(words string) map[string]int {
+	m := make(map[string]int)
+	for i, w := range strings.Fields(words) {
+		if w != "_" {
+			m[w] = 200 + 100*i
+			m[strings.TrimSuffix(w, "os")+"as"] = 200 + 100*i
+		}
+	}
+	return m
+}
+
+func mapsConcat[V any](ms ...map[string]V) map[string]V {
+	all := make(map[string]V)
+	for _, m := range ms {
+		maps.Copy(all, m)
+	}
+	return all
+}
+
+// languageFor returns English together with the language with the code lang,
+// if it is known.
+func languageFor(lang string) *language {
+	other, ok := languages[strings.ToLower(lang)]
+	if !ok || lang == "en" {
+		return english
+	}
+	return &language{
+		symbols:    mapsConcat(english.symbols, other.symbols),
+		units:      mapsConcat(english.units, other.units),
+		tens:       mapsConcat(english.tens, other.tens),
+		hundreds:   mapsConcat(english.hundreds, other.hundreds),
+		hundred:    slices.Concat(english.hundred, other.hundred),
+		thousand:   slices.Concat(english.thousand, other.thousand),
+		and:        slices.Concat(english.and, other.and),
+		point:      slices.Concat(english.point, other.point),
+		teensAfter: other.teensAfter,
+		timesTens:  other.timesTens,
+		compounds:  other.compounds,
+		triggers:   mapsConcat(english.triggers, other.triggers),
+		counted:    mapsConcat(english.counted, other.counted),
+		particles:  mapsConcat(english.particles, other.particles),
+	}
+}
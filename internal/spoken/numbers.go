@@ -0,0 +1,193 @@
+package spoken
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// kind is the part a number word plays in a number.
+type kind int
+
+const (
+	none kind = iota
+	// unit is 0 to 9.
+	unit
+	// teen is any other number below 100 that doesn't end in 0, like 15.
+	teen
+	// tens is 20, 30 and so on up to 90.
+	tens
+	// hundred multiplies what came before by 100.
+	hundred
+	// hundreds is a whole number of hundreds said as one word, like the
+	// Spanish doscientos.
+	hundreds
+	// thousand multiplies what came before by 1000.
+	thousand
+	// whole is a number said as one word, like the German fünfundzwanzig.
+	whole
+)
+
+// value returns what word stands for in a number.
+func (l *language) value(word string) (int, kind, bool) {
+	if v, ok := l.units[word]; ok {
+		if v >= 10 {
+			return v, teen, true
+		}
+		return v, unit, true
+	}
+	if v, ok := l.tens[word]; ok {
+		return v, tens, true
+	}
+	if v, ok := l.hundreds[word]; ok {
+		return v, hundreds, true
+	}
+	switch {
+	case slices.Contains(l.hundred, word):
+		return 100, hundred, true
+	case slices.Contains(l.thousand, word):
+		return 1000, thousand, true
+	}
+	for _, split := range l.compounds {
+		if parts := split(word); len(parts) > 1 {
+			toks := make([]token, len(parts))
+			for i, p := range parts {
+				toks[i] = token{word: p, lower: p}
+			}
+			if digits, n := l.number(toks); n == len(toks) {
+				if v, err := strconv.Atoi(digits); err == nil {
+					return v, whole, true
+				}
+			}
+		}
+	}
+	return 0, none, false
+}
+
+// numberState is a number being read: total holds the thousands, cur what
+// came after them.
+type numberState struct {
+	total, cur int
+	last       kind
+}
+
+// continues reports whether a word of kind k worth v adds to the number
+// rather than starting one of its own, as five does after twenty but not
+// after seven.
+func (l *language) continues(s numberState, k kind, v int) bool {
+	afterScale := (s.last == hundred || s.last == hundreds || s.last == thousand) && s.cur%100 == 0
+	switch k {
+	case unit:
+		return s.last == tens && s.cur%10 == 0 || afterScale
+	case teen:
+		return afterScale || s.last == tens && slices.Contains(l.teensAfter, s.cur%100)
+	case tens:
+		return afterScale || s.last == unit && slices.Contains(l.timesTens, v) && s.cur%100 == 4
+	case hundred:
+		return (s.last == unit || s.last == teen) && s.cur > 0 && s.cur < 100
+	case hundreds:
+		return s.last == thousand && s.cur == 0
+	case thousand:
+		return s.last != none && s.last != thousand
+	case whole:
+		return s.last == thousand && s.cur == 0 && v < 1000 || afterScale && v < 100
+	}
+	return false
+}
+
+// add adds a word of kind k worth v to s, which it continues.
+func (s *numberState) add(k kind, v int) {
+	switch {
+	case k == hundred:
+		s.cur *= 100
+	case k == thousand:
+		s.total += max(s.cur, 1) * 1000
+		s.cur = 0
+	case k == tens && s.last == unit:
+		// quatre-vingts, the only tens that multiply.
+		s.cur += 4*v - 4
+	default:
+		s.cur += v
+	}
+	s.last = k
+}
+
+// number reads the number spoken at the start of toks and returns it as
+// digits, with how many words it took; none if it doesn't start with one.
+// Numbers said one after the other run together, as when reading out a port
+// or an address: "eighty eighty" is 8080, "seven five five" is 755 and "one
+// two seven dot zero dot zero dot one" is 127.0.0.1.
+func (l *language) number(toks []token) (string, int) {
+	var digits strings.Builder
+	var s numberState
+	used := 0
+	flush := func() {
+		if s.last != none {
+			digits.WriteString(strconv.Itoa(s.total + s.cur))
+		}
+		s = numberState{}
+	}
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		v, k, ok := l.value(t.lower)
+		if !ok {
+			if s.last == none || i+1 >= len(toks) || toks[i-1].punct != "" || t.punct != "" {
+				break
+			}
+			nv, nk, nok := l.value(toks[i+1].lower)
+			switch {
+			case nok && slices.Contains(l.and, t.lower) && l.continues(s, nk, nv):
+				continue
+			case nok && slices.Contains(l.point, t.lower) && nk != hundred && nk != thousand:
+				flush()
+				digits.WriteString(".")
+				continue
+			}
+			break
+		}
+		if i > 0 && toks[i-1].punct != "" {
+			break
+		}
+		if s.last != none && !l.continues(s, k, v) {
+			flush()
+		}
+		if s.last == none && (k == hundred || k == thousand) {
+			s.cur, s.last = v, k
+			if k == thousand {
+				s.total, s.cur = v, 0
+			}
+		} else {
+			s.add(k, v)
+		}
+		used = i + 1
+	}
+	if used == 0 {
+		return "", 0
+	}
+	flush()
+	return strings.TrimRight(digits.String(), "."), used
+}
+
+// startsNumber reports whether toks start with a number.
+func (l *language) startsNumber(toks []token) bool {
+	_, n := l.number(toks)
+	return n > 0
+}
+
+// convert reports whether the n words at the start of toks, the number
+// digits, should be replaced by it, given out, what came before. Numbers of
+// more than one word always are, and so are those of one word above nine,
+// but "one" in "delete this one" is left alone: a single digit only when it
+// follows a word like port or a flag, or comes before a unit like megabytes.
+func (l *language) convert(out, toks []token, n int, digits string) bool {
+	if _, k, _ := l.value(toks[0].lower); n > 1 || k != unit {
+		return true
+	}
+	if len(out) > 0 {
+		prev := out[len(out)-1]
+		if l.triggers[strings.ToLower(prev.word)] || strings.HasPrefix(prev.word, "-") && len(prev.word) > 1 {
+			return prev.punct == ""
+		}
+	}
+	return n < len(toks) && toks[n-1].punct == "" && l.counted[toks[n].lower]
+}
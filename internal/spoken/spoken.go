@@ -0,0 +1,238 @@
+// Package spoken turns the spoken forms of the flags, paths, symbols and
+// numbers in a dictated request into what they stand for, so "dash r f"
+// reaches the model as -rf, "tilde slash downloads" as ~/Downloads and "port
+// eighty eighty" as port 8080.
+package spoken
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Normalize returns text with the spoken forms in it replaced, or text as it
+// is if it has none. English is always understood, and so is the language
+// with the ISO-639-1 code lang if it is German, Spanish or French.
+func Normalize(text, lang string) string {
+	l := languageFor(lang)
+	toks := tokenize(text)
+	var out []token
+	changed := false
+	for i := 0; i < len(toks); {
+		if t, n := l.flag(toks[i:]); n > 0 {
+			out = append(out, t)
+			i += n
+			changed = true
+			continue
+		}
+		if t, n := l.path(toks[i:]); n > 0 {
+			out = append(out, t)
+			i += n
+			changed = true
+			continue
+		}
+		if digits, n := l.number(toks[i:]); n > 0 && l.convert(out, toks[i:], n, digits) {
+			out = append(out, token{word: digits, punct: toks[i+n-1].punct})
+			i += n
+			changed = true
+			continue
+		}
+		out = append(out, toks[i])
+		i++
+	}
+	if !changed {
+		return text
+	}
+	words := make([]string, len(out))
+	for i, t := range out {
+		words[i] = t.word + t.punct
+	}
+	return strings.Join(words, " ")
+}
+
+// token is a word of the request, with the punctuation after it apart.
+type token struct {
+	word  string
+	lower string
+	punct string
+}
+
+// tokenize splits text into words, keeping the punctuation at the end of a
+// word apart from it.
+func tokenize(text string) []token {
+	var toks []token
+	for _, field := range strings.Fields(text) {
+		word := strings.TrimRightFunc(field, func(r rune) bool { return strings.ContainsRune(",.;:!?", r) })
+		if word == "" {
+			word = field
+		}
+		toks = append(toks, token{word: word, lower: strings.ToLower(word), punct: field[len(word):]})
+	}
+	return toks
+}
+
+// symbol returns the symbol spoken at the start of toks, like "/" for
+// "forward slash", and how many words it took.
+func (l *language) symbol(toks []token) (string, int) {
+	if len(toks) > 1 && toks[0].punct == "" {
+		if s, ok := l.symbols[toks[0].lower+" "+toks[1].lower]; ok {
+			return s, 2
+		}
+	}
+	if len(toks) > 0 {
+		if s, ok := l.symbols[toks[0].lower]; ok {
+			return s, 1
+		}
+	}
+	return "", 0
+}
+
+// flag reads a flag spoken at the start of toks: a dash and letters spelled
+// out ("dash r f" is -rf), a dash and a number ("dash nine" is -9), or two
+// dashes and a word ("dash dash force" is --force).
+func (l *language) flag(toks []token) (token, int) {
+	s, n := l.symbol(toks)
+	if s != "-" || toks[n-1].punct != "" {
+		return token{}, 0
+	}
+	if s, m := l.symbol(toks[n:]); s == "-" && n+m < len(toks) && toks[n+m-1].punct == "" {
+		next := toks[n+m]
+		if isWord(next.word) {
+			return token{word: "--" + strings.ToLower(next.word), punct: next.punct}, n + m + 1
+		}
+		return token{}, 0
+	}
+	if digits, m := l.number(toks[n:]); m > 0 {
+		return token{word: "-" + digits, punct: toks[n+m-1].punct}, n + m
+	}
+	var letters string
+	var punct string
+	i := n
+	for ; i < len(toks) && spelled(toks[i].word); i++ {
+		letters += toks[i].word
+		punct = toks[i].punct
+		if punct != "" && punct != "," {
+			i++
+			break
+		}
+	}
+	if letters == "" {
+		return token{}, 0
+	}
+	// Transcripts spell letters out in capitals; a single one may well
+	// mean the capital, like ls -R.
+	if len([]rune(letters)) > 1 && strings.ToUpper(letters) == letters {
+		letters = strings.ToLower(letters)
+	}
+	if punct == "," {
+		punct = ""
+	}
+	return token{word: "-" + letters, punct: punct}, i
+}
+
+// spelled reports whether word is letters spelled out: a single letter, or a
+// few in capitals like "RF".
+func spelled(word string) bool {
+	runes := []rune(word)
+	if len(runes) == 0 || len(runes) > 4 {
+		return false
+	}
+	for _, r := range runes {
+		if !unicode.IsLetter(r) || len(runes) > 1 && !unicode.IsUpper(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isWord reports whether word is letters, digits and dashes only.
+func isWord(word string) bool {
+	return word != "" && strings.IndexFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	}) < 0
+}
+
+// homeDirs are the directories in the home directory that are spelled with a
+// capital, for "tilde slash downloads".
+var homeDirs = map[string]string{
+	"desktop": "Desktop", "documents": "Documents", "downloads": "Downloads", "music": "Music",
+	"pictures": "Pictures", "public": "Public", "templates": "Templates", "videos": "Videos",
+}
+
+// path reads a path, glob, file name or host and port spoken at the start of
+// toks, words and symbols taking turns: "tilde slash downloads" is
+// ~/Downloads, "star dot log" is *.log and "localhost colon eighty eighty" is
+// localhost:8080. It has to start with a symbol, or with a word that isn't
+// a particle like "of" and a slash, a colon and a number or a dot and a known
+// extension. A dot outside of a path only joins a short extension, so "dot
+// files" stays as it is.
+func (l *language) path(toks []token) (token, int) {
+	first, n := l.symbol(toks)
+	switch first {
+	case "~", "/", "*":
+	case ".":
+		if next, _ := l.symbol(toks[n:]); next != "/" && next != "." && !(n < len(toks) && extension(toks[n].lower)) {
+			return token{}, 0
+		}
+	case "":
+		if !isWord(toks[0].word) || toks[0].punct != "" || len(toks) < 3 || l.particles[toks[0].lower] {
+			return token{}, 0
+		}
+		s, m := l.symbol(toks[1:])
+		switch {
+		case s == "/" || s == ":" && l.startsNumber(toks[1+m:]):
+		case s == "." && 1+m < len(toks) && extensions[toks[1+m].lower]:
+		default:
+			return token{}, 0
+		}
+	default:
+		return token{}, 0
+	}
+
+	var b strings.Builder
+	i, wordNext := 0, true
+	punct := ""
+	for i < len(toks) && punct == "" {
+		if s, m := l.symbol(toks[i:]); m > 0 {
+			if s == "-" && b.Len() == 0 {
+				break
+			}
+			b.WriteString(s)
+			i += m
+			punct = toks[i-1].punct
+			wordNext = true
+			continue
+		}
+		if !wordNext {
+			break
+		}
+		if digits, m := l.number(toks[i:]); m > 0 {
+			b.WriteString(digits)
+			i += m
+		} else if isWord(toks[i].word) {
+			word := toks[i].word
+			if dir, ok := homeDirs[toks[i].lower]; ok && b.String() == "~/" {
+				word = dir
+			}
+			b.WriteString(word)
+			i++
+		} else {
+			break
+		}
+		punct = toks[i-1].punct
+		wordNext = false
+	}
+	if i < 2 && first != "/" {
+		return token{}, 0
+	}
+	return token{word: b.String(), punct: punct}, i
+}
+
+// extensions are the file extensions a word and a dot before them make a
+// file name with, as in "notes dot txt".
+var extensions = set("txt log md csv json yaml yml toml xml ini conf cfg sh bash py go js ts rs c h cpp java rb php sql html css " +
+	"tar gz tgz bz2 xz zip 7z deb rpm iso img png jpg jpeg gif svg pdf mp3 mp4 mkv wav flac bak tmp old lock pem key crt")
+
+// extension reports whether word could be a file extension, like txt or gz.
+func extension(word string) bool {
+	return len(word) >= 1 && len(word) <= 4 && isWord(word) && !strings.Contains(word, "-")
+}
@@ -0,0 +1,84 @@
+package spoken
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		text, lang string
+		want       string
+	}{
+		// Flags.
+		{"remove it with dash r f", "en", "remove it with -rf"},
+		{"list with dash l a", "en", "list with -la"},
+		{"Dash R F.", "en", "-rf."},
+		{"ls dash R", "en", "ls -R"},
+		{"kill dash nine the process", "en", "kill -9 the process"},
+		{"head dash n five", "en", "head -n 5"},
+		{"push with dash dash force", "en", "push with --force"},
+		{"tiret tiret force", "fr", "--force"},
+
+		// Paths, globs, file names and hosts.
+		{"go to tilde slash downloads", "en", "go to ~/Downloads"},
+		{"slash etc slash hosts", "en", "/etc/hosts"},
+		{"the end of slash var slash log", "en", "the end of /var/log"},
+		{"copy it to slash", "en", "copy it to /"},
+		{"compress star dot log", "en", "compress *.log"},
+		{"open notes dot txt", "en", "open notes.txt"},
+		{"chmod seven five five script dot sh", "en", "chmod 755 script.sh"},
+		{"connect to localhost colon eighty eighty", "en", "connect to localhost:8080"},
+		{"busca en barra var barra log", "es", "busca en /var/log"},
+
+		// Numbers.
+		{"serve on port eighty eighty", "en", "serve on port 8080"},
+		{"port five", "en", "port 5"},
+		{"ping one two seven dot zero dot zero dot one", "en", "ping 127.0.0.1"},
+		{"version two point five", "en", "version 2.5"},
+		{"files larger than one hundred megabytes", "en", "files larger than 100 megabytes"},
+		{"files larger than five megabytes", "en", "files larger than 5 megabytes"},
+		{"find files modified in the last seven days", "en", "find files modified in the last 7 days"},
+		{"show the last twenty lines", "en", "show the last 20 lines"},
+		{"the first ten entries", "en", "the first 10 entries"},
+		{"nine hundred ninety nine", "en", "999"},
+		{"two thousand and twenty four", "en", "2024"},
+		{"twenty twenty four", "en", "2024"},
+		{"zeige die letzten zwanzig zeilen", "de", "zeige die letzten 20 zeilen"},
+		{"port achtzig achtzig", "de", "port 8080"},
+		{"zweihundertfünfundzwanzig dateien", "de", "225 dateien"},
+		{"puerto ocho mil", "es", "puerto 8000"},
+		{"últimas doscientas líneas", "es", "últimas 200 líneas"},
+		{"port quatre-vingt-dix", "fr", "port 90"},
+		{"ligne quatre-vingts", "fr", "ligne 80"},
+		{"soixante-dix-sept fichiers", "fr", "77 fichiers"},
+
+		// What must be left alone.
+		{"", "en", ""},
+		{"tail the log file", "en", "tail the log file"},
+		{"what time is it", "en", "what time is it"},
+		{"delete this one", "en", "delete this one"},
+		{"move it to the other one", "en", "move it to the other one"},
+		{"I have one question", "en", "I have one question"},
+		{"read chapter one", "en", "read chapter one"},
+		{"one more time", "en", "one more time"},
+		{"list files, then one by one delete them", "en", "list files, then one by one delete them"},
+		{"show my dot files", "en", "show my dot files"},
+		{"use a dash of salt", "en", "use a dash of salt"},
+		{"dash", "en", "dash"},
+		{"dash dash", "en", "dash dash"},
+		{"zero", "en", "zero"},
+		{"cats and dogs", "en", "cats and dogs"},
+		{"copy a to b", "en", "copy a to b"},
+		{"grep for the word port", "en", "grep for the word port"},
+		{"es gibt ein Problem", "de", "es gibt ein Problem"},
+		{"eins nach dem anderen", "de", "eins nach dem anderen"},
+		{"un fichier", "fr", "un fichier"},
+		// Only English and the language asked for are understood.
+		{"zwanzig zeilen", "en", "zwanzig zeilen"},
+		{"zwanzig zeilen", "xx", "zwanzig zeilen"},
+		{"puerto ocho mil", "de", "puerto ocho mil"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.text, tt.lang); got != tt.want {
+			t.Errorf("Normalize(%q, %q) = %q, want %q", tt.text, tt.lang, got, tt.want)
+		}
+	}
+}
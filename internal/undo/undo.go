@@ -0,0 +1,521 @@
+// Package undo works out commands that reverse what a Bash command did, so a
+// command run by mistake can be taken back.
+//
+// Only single simple commands with known effects are handled: moving, copying
+// and linking files, creating files and directories, changing permissions,
+// extracting archives and the common git operations. The inverse depends on
+// the files the command is about to touch, so it has to be worked out before
+// the command runs. Anything that would overwrite or delete data has no
+// inverse, as the data can't be brought back.
+package undo
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Inverse returns a command that reverses command when run in dir, the
+// directory command is run in, or "" if it knows none.
+func Inverse(command, dir string) string {
+	words, ok := split(command)
+	if !ok || len(words) == 0 {
+		return ""
+	}
+	sudo := false
+	if words[0] == "sudo" && len(words) > 1 && !strings.HasPrefix(words[1], "-") {
+		sudo, words = true, words[1:]
+	}
+	inv := inverter{dir: dir}
+	var commands []string
+	switch words[0] {
+	case "mv":
+		commands = inv.mv(words[1:])
+	case "cp":
+		commands = inv.cp(words[1:])
+	case "mkdir":
+		commands = inv.mkdir(words[1:])
+	case "touch":
+		commands = inv.touch(words[1:])
+	case "ln":
+		commands = inv.ln(words[1:])
+	case "chmod":
+		commands = inv.chmod(words[1:])
+	case "tar", "unzip", "git":
+		if sudo {
+			return ""
+		}
+		switch words[0] {
+		case "tar":
+			commands = inv.tar(words[1:])
+		case "unzip":
+			commands = inv.unzip(words[1:])
+		case "git":
+			commands = inv.git(words[1:])
+		}
+	}
+	if len(commands) == 0 {
+		return ""
+	}
+	if sudo {
+		for i := range commands {
+			commands[i] = "sudo " + commands[i]
+		}
+	}
+	return strings.Join(commands, " && ")
+}
+
+// inverter works out inverses against the files in dir.
+type inverter struct {
+	dir string
+}
+
+// path resolves name against the directory the command runs in.
+func (inv inverter) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(inv.dir, name)
+}
+
+// exists reports whether name exists; a dangling symbolic link does.
+func (inv inverter) exists(name string) bool {
+	_, err := os.Lstat(inv.path(name))
+	return err == nil
+}
+
+// isDir reports whether name is a directory, or a link to one.
+func (inv inverter) isDir(name string) bool {
+	fi, err := os.Stat(inv.path(name))
+	return err == nil && fi.IsDir()
+}
+
+// mv moves the files back, unless one was moved over an existing file.
+func (inv inverter) mv(args []string) []string {
+	operands, ok := options(args, "finuv", nil)
+	if !ok || len(operands) < 2 {
+		return nil
+	}
+	targets, ok := inv.targets(operands)
+	if !ok {
+		return nil
+	}
+	var commands []string
+	for i, src := range operands[:len(operands)-1] {
+		if !inv.exists(src) {
+			return nil
+		}
+		commands = append(commands, "mv -- "+quote(targets[i])+" "+quote(src))
+	}
+	slices.Reverse(commands)
+	return commands
+}
+
+// cp removes the copies, unless one overwrote an existing file.
+func (inv inverter) cp(args []string) []string {
+	operands, ok := options(args, "aprRvL", map[string]bool{"--archive": true, "--recursive": true})
+	if !ok || len(operands) < 2 {
+		return nil
+	}
+	targets, ok := inv.targets(operands)
+	if !ok {
+		return nil
+	}
+	for _, src := range operands[:len(operands)-1] {
+		if !inv.exists(src) {
+			return nil
+		}
+	}
+	return []string{"rm -r -- " + quoteAll(targets)}
+}
+
+// targets returns where the sources among operands end up when moved, copied
+// or linked to the last operand. It fails if any of them exists already.
+func (inv inverter) targets(operands []string) ([]string, bool) {
+	sources, dest := operands[:len(operands)-1], operands[len(operands)-1]
+	intoDir := inv.isDir(dest)
+	if len(sources) > 1 && !intoDir {
+		return nil, false
+	}
+	var targets []string
+	for _, src := range sources {
+		target := dest
+		if intoDir {
+			target = filepath.Join(dest, filepath.Base(src))
+		}
+		if inv.exists(target) {
+			return nil, false
+		}
+		targets = append(targets, target)
+	}
+	return targets, true
+}
+
+// mkdir removes the directories it creates, parents included, deepest first.
+func (inv inverter) mkdir(args []string) []string {
+	parents := false
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		parents = parents || arg == "--parents" || !strings.HasPrefix(arg, "--") && strings.HasPrefix(arg, "-") && strings.Contains(arg, "p")
+	}
+	operands, ok := options(args, "pv", map[string]bool{"--parents": true}, "-m")
+	if !ok || len(operands) == 0 {
+		return nil
+	}
+	var created []string
+	for _, name := range operands {
+		name = filepath.Clean(name)
+		if !parents {
+			if inv.exists(name) {
+				return nil
+			}
+			created = append(created, name)
+			continue
+		}
+		for p := name; p != "." && p != "/" && !inv.exists(p) && !slices.Contains(created, p); p = filepath.Dir(p) {
+			created = append(created, p)
+		}
+	}
+	if len(created) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(created, func(a, b string) int { return strings.Count(b, "/") - strings.Count(a, "/") })
+	return []string{"rmdir -- " + quoteAll(created)}
+}
+
+// touch removes the files it creates. Touching existing files only changes
+// their times, which isn't worth undoing.
+func (inv inverter) touch(args []string) []string {
+	operands, ok := options(args, "am", nil)
+	if !ok {
+		return nil
+	}
+	var created []string
+	for _, name := range operands {
+		if !inv.exists(name) {
+			created = append(created, name)
+		}
+	}
+	if len(created) == 0 {
+		return nil
+	}
+	return []string{"rm -- " + quoteAll(created)}
+}
+
+// ln removes the link, unless it replaced an existing file.
+func (inv inverter) ln(args []string) []string {
+	operands, ok := options(args, "sv", map[string]bool{"--symbolic": true})
+	if !ok || len(operands) == 0 {
+		return nil
+	}
+	if len(operands) == 1 {
+		operands = append(operands, ".")
+	}
+	targets, ok := inv.targets(operands)
+	if !ok {
+		return nil
+	}
+	return []string{"rm -- " + quoteAll(targets)}
+}
+
+// chmod restores the modes the files have now.
+func (inv inverter) chmod(args []string) []string {
+	operands, ok := options(args, "v", nil)
+	if !ok || len(operands) < 2 {
+		return nil
+	}
+	var modes []string
+	files := map[string][]string{}
+	for _, name := range operands[1:] {
+		fi, err := os.Stat(inv.path(name))
+		if err != nil {
+			return nil
+		}
+		mode := octal(fi.Mode())
+		if files[mode] == nil {
+			modes = append(modes, mode)
+		}
+		files[mode] = append(files[mode], name)
+	}
+	var commands []string
+	for _, mode := range modes {
+		commands = append(commands, "chmod "+mode+" -- "+quoteAll(files[mode]))
+	}
+	return commands
+}
+
+// octal formats the permission bits of mode for chmod.
+func octal(mode fs.FileMode) string {
+	bits := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return fmt.Sprintf("%o", bits)
+}
+
+// tar removes what the archive extracts. Directories that held files before
+// stay, as only empty ones are removed.
+func (inv inverter) tar(args []string) []string {
+	var archive, into string
+	extract := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		// The first argument may be a cluster of options without a dash, e.g. xzf.
+		cluster := strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") || i == 0 && !strings.HasPrefix(arg, "-")
+		switch {
+		case arg == "--extract" || arg == "--get":
+			extract = true
+		case arg == "--file" || arg == "--directory":
+			if i+1 == len(args) {
+				return nil
+			}
+			i++
+			if arg == "--file" {
+				archive = args[i]
+			} else {
+				into = args[i]
+			}
+		case strings.HasPrefix(arg, "--file="):
+			archive = strings.TrimPrefix(arg, "--file=")
+		case strings.HasPrefix(arg, "--directory="):
+			into = strings.TrimPrefix(arg, "--directory=")
+		case arg == "-v" || arg == "--verbose" || arg == "--gzip" || arg == "--bzip2" || arg == "--xz" || arg == "--zstd":
+		case cluster:
+			for _, letter := range strings.TrimPrefix(arg, "-") {
+				switch letter {
+				case 'x':
+					extract = true
+				case 'f', 'C':
+					if i+1 == len(args) {
+						return nil
+					}
+					i++
+					if letter == 'f' {
+						archive = args[i]
+					} else {
+						into = args[i]
+					}
+				case 'v', 'z', 'j', 'J', 'a':
+				default:
+					return nil
+				}
+			}
+		default:
+			// Extracting only some members.
+			return nil
+		}
+	}
+	if !extract || archive == "" || archive == "-" || !inv.exists(archive) {
+		return nil
+	}
+	return []string{removeListed(into, "tar -tf "+quote(inv.path(archive)))}
+}
+
+// unzip removes what the archive extracts, like tar.
+func (inv inverter) unzip(args []string) []string {
+	var archive, into string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-d":
+			if i+1 == len(args) {
+				return nil
+			}
+			i++
+			into = args[i]
+		case arg == "-q" || arg == "-o" || arg == "-n":
+		case strings.HasPrefix(arg, "-") || archive != "":
+			return nil
+		default:
+			archive = arg
+		}
+	}
+	if archive == "" || !inv.exists(archive) {
+		return nil
+	}
+	return []string{removeListed(into, "unzip -Z1 "+quote(inv.path(archive)))}
+}
+
+// removeListed returns a command that removes the files list prints, relative
+// to dir, contents before the directories holding them.
+func removeListed(dir, list string) string {
+	command := list + " | sort -r | tr '\\n' '\\0' | xargs -0 rm -df --"
+	if dir != "" && dir != "." {
+		command = "cd " + quote(dir) + " && " + command
+	}
+	return command
+}
+
+// git undoes local repository changes; anything that talks to a remote, or
+// discards work, has no inverse.
+func (inv inverter) git(args []string) []string {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return nil
+	}
+	verb, args := args[0], args[1:]
+	switch verb {
+	case "add":
+		operands, ok := options(args, "Av", map[string]bool{"--all": true})
+		if !ok {
+			return nil
+		}
+		if len(operands) == 0 {
+			if len(args) == 0 {
+				return nil
+			}
+			return []string{"git restore --staged :/"}
+		}
+		return []string{"git restore --staged -- " + quoteAll(operands)}
+	case "commit":
+		if slices.Contains(args, "--amend") {
+			return []string{"git reset --soft HEAD@{1}"}
+		}
+		return []string{"git reset --soft HEAD~1"}
+	case "checkout", "switch":
+		if len(args) < 2 || !(verb == "checkout" && args[0] == "-b" || verb == "switch" && args[0] == "-c") {
+			return nil
+		}
+		return []string{"git switch -", "git branch -D " + quote(args[1])}
+	case "branch", "tag":
+		if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+			return nil
+		}
+		return []string{"git " + verb + " -d " + quote(args[0])}
+	case "stash":
+		if len(args) > 0 && args[0] != "push" {
+			return nil
+		}
+		return []string{"git stash pop"}
+	case "mv":
+		operands, ok := options(args, "v", nil)
+		if !ok || len(operands) != 2 || inv.exists(operands[1]) {
+			return nil
+		}
+		return []string{"git mv -- " + quote(operands[1]) + " " + quote(operands[0])}
+	case "rm":
+		if len(args) < 2 || args[0] != "--cached" {
+			return nil
+		}
+		operands, ok := options(args[1:], "r", nil)
+		if !ok {
+			return nil
+		}
+		return []string{"git add -- " + quoteAll(operands)}
+	}
+	return nil
+}
+
+// options splits args into options and operands, and returns the operands.
+// It fails on options other than the single letters in letters, the long ones
+// in long, and the ones in withArg, which take the next argument.
+func options(args []string, letters string, long map[string]bool, withArg ...string) ([]string, bool) {
+	var operands []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return append(operands, args[i+1:]...), true
+		case slices.Contains(withArg, arg):
+			i++
+		case strings.HasPrefix(arg, "--"):
+			if !long[arg] {
+				return nil, false
+			}
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			for _, letter := range arg[1:] {
+				if !strings.ContainsRune(letters, letter) {
+					return nil, false
+				}
+			}
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	return operands, true
+}
+
+// split breaks a simple command into words, following quotes and escapes.
+// Anything that needs the shell to be understood, like expansions, globs,
+// redirections and lists, makes it fail.
+func split(command string) ([]string, bool) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		case c == '\\':
+			if i+1 == len(command) || command[i+1] == '\n' {
+				return nil, false
+			}
+			i++
+			word.WriteByte(command[i])
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, false
+			}
+			word.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			for i++; ; i++ {
+				if i == len(command) || strings.IndexByte("$`", command[i]) >= 0 {
+					return nil, false
+				}
+				if command[i] == '"' {
+					break
+				}
+				if command[i] == '\\' && i+1 < len(command) && strings.IndexByte("\"\\$`", command[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(command[i])
+			}
+		case strings.IndexByte("\n;|&<>()$`*?[]{}~#", c) >= 0:
+			return nil, false
+		default:
+			word.WriteByte(c)
+		}
+		inWord = true
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, true
+}
+
+var plain = regexp.MustCompile(`^[A-Za-z0-9_./:=@%+,-]+$`)
+
+// quote quotes s for Bash, if it needs to be.
+func quote(s string) string {
+	if plain.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// quoteAll quotes each of words and joins them with spaces.
+func quoteAll(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = quote(w)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,124 @@
+package undo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInverse(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "it's.txt", "archive.tar.gz", "archive.zip"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "script.sh"), nil, 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		command string
+		// want is the inverse, with $DIR for dir; empty if there is none.
+		want string
+	}{
+		{"mv a.txt c.txt", "mv -- c.txt a.txt"},
+		{"mv -v a.txt docs", "mv -- docs/a.txt a.txt"},
+		{"mv a.txt b.txt docs", "mv -- docs/b.txt b.txt && mv -- docs/a.txt a.txt"},
+		{`mv "it's.txt" 'new name.txt'`, `mv -- 'new name.txt' 'it'\''s.txt'`},
+		{"sudo mv a.txt c.txt", "sudo mv -- c.txt a.txt"},
+		{"cp -r docs backup", "rm -r -- backup"},
+		{"cp a.txt b.txt docs", "rm -r -- docs/a.txt docs/b.txt"},
+		{"mkdir new", "rmdir -- new"},
+		{"mkdir -p docs/new/deeper", "rmdir -- docs/new/deeper docs/new"},
+		{"mkdir -p -m 700 top/sub", "rmdir -- top/sub top"},
+		{"touch a.txt new.txt", "rm -- new.txt"},
+		{"ln -s a.txt link", "rm -- link"},
+		{"chmod +x script.sh", "chmod 640 -- script.sh"},
+		{"chmod 600 script.sh a.txt", "chmod 640 -- script.sh && chmod 644 -- a.txt"},
+		{"tar xzf archive.tar.gz", `tar -tf $DIR/archive.tar.gz | sort -r | tr '\n' '\0' | xargs -0 rm -df --`},
+		{"tar -xvf archive.tar.gz -C docs", `cd docs && tar -tf $DIR/archive.tar.gz | sort -r | tr '\n' '\0' | xargs -0 rm -df --`},
+		{"tar --extract --file=archive.tar.gz", `tar -tf $DIR/archive.tar.gz | sort -r | tr '\n' '\0' | xargs -0 rm -df --`},
+		{"unzip -q archive.zip -d docs", `cd docs && unzip -Z1 $DIR/archive.zip | sort -r | tr '\n' '\0' | xargs -0 rm -df --`},
+		{"git add a.txt b.txt", "git restore --staged -- a.txt b.txt"},
+		{"git add -A", "git restore --staged :/"},
+		{"git commit -m 'Fix it'", "git reset --soft HEAD~1"},
+		{"git commit --amend --no-edit", "git reset --soft HEAD@{1}"},
+		{"git checkout -b feature", "git switch - && git branch -D feature"},
+		{"git switch -c feature", "git switch - && git branch -D feature"},
+		{"git branch feature", "git branch -d feature"},
+		{"git tag v1.0", "git tag -d v1.0"},
+		{"git stash", "git stash pop"},
+		{"git mv a.txt c.txt", "git mv -- c.txt a.txt"},
+		{"git rm --cached a.txt", "git add -- a.txt"},
+
+		// Nothing that can't be taken back.
+		{"", ""},
+		{"ls -la", ""},
+		{"rm a.txt", ""},
+		{"sed -i s/a/b/ a.txt", ""},
+		{"mv a.txt b.txt", ""},
+		{"mv missing.txt c.txt", ""},
+		{"mv a.txt b.txt c.txt", ""},
+		{"mv --backup a.txt c.txt", ""},
+		{"cp a.txt b.txt", ""},
+		{"ln -sf a.txt b.txt", ""},
+		{"mkdir docs", ""},
+		{"mkdir -p docs", ""},
+		{"touch a.txt", ""},
+		{"chmod +x missing.sh", ""},
+		{"chmod -R 755 docs", ""},
+		{"tar czf out.tar.gz docs", ""},
+		{"tar xzf archive.tar.gz some/member", ""},
+		{"tar xf missing.tar", ""},
+		{"tar xf -", ""},
+		{"sudo tar xf archive.tar.gz", ""},
+		{"unzip missing.zip", ""},
+		{"git", ""},
+		{"git push", ""},
+		{"git reset --hard", ""},
+		{"git branch -D feature", ""},
+		{"git stash drop", ""},
+		{"git rm a.txt", ""},
+		{"git mv a.txt b.txt", ""},
+		// Anything the shell would have to expand or join.
+		{"mv *.txt docs", ""},
+		{"mv a.txt ~/c.txt", ""},
+		{"mv $FILE c.txt", ""},
+		{`mv "$FILE" c.txt`, ""},
+		{"mv a.txt c.txt && ls", ""},
+		{"mv a.txt c.txt; ls", ""},
+		{"mv a.txt c.txt > log", ""},
+		{"mv $(ls) docs", ""},
+		{"mv 'a.txt c.txt", ""},
+	}
+	for _, tt := range tests {
+		want := strings.ReplaceAll(tt.want, "$DIR", dir)
+		if got := Inverse(tt.command, dir); got != want {
+			t.Errorf("Inverse(%q) = %q, want %q", tt.command, got, want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"mv  a   b", []string{"mv", "a", "b"}},
+		{`mv 'a b' "c d"`, []string{"mv", "a b", "c d"}},
+		{`mv a\ b c`, []string{"mv", "a b", "c"}},
+		{`echo "say \"hi\""`, []string{"echo", `say "hi"`}},
+		{`mv ''`, []string{"mv", ""}},
+	}
+	for _, tt := range tests {
+		got, ok := split(tt.command)
+		if !ok || strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("split(%q) = %q, %v; want %q", tt.command, got, ok, tt.want)
+		}
+	}
+}
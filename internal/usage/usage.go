@@ -0,0 +1,105 @@
+// Package usage logs the API calls that cost money in an append-only JSON
+// Lines file, so what they cost can be added up later, along with how long
+// each run took.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jerilseb/bash-generator/internal/cost"
+)
+
+// Kinds of calls.
+const (
+	Transcription = "transcription"
+	Chat          = "chat"
+	// Run isn't an API call but a whole run of the pipeline, with the time
+	// each of its phases took.
+	Run = "run"
+)
+
+// Call is one API call. Prices aren't stored; they are looked up when the cost
+// is needed, so correcting a price table corrects past costs too.
+type Call struct {
+	Time  time.Time `json:"time"`
+	Kind  string    `json:"kind"`
+	Model string    `json:"model,omitempty"`
+	// AudioSeconds is the length of the audio of a transcription, zero if it isn't known.
+	AudioSeconds     float64 `json:"audio_seconds,omitempty"`
+	PromptTokens     int     `json:"prompt_tokens,omitempty"`
+	CompletionTokens int     `json:"completion_tokens,omitempty"`
+	// Phases holds how many seconds each phase of a Run took.
+	Phases map[string]float64 `json:"phases,omitempty"`
+}
+
+// Audio returns the length of the transcribed audio.
+func (c Call) Audio() time.Duration {
+	return time.Duration(c.AudioSeconds * float64(time.Second))
+}
+
+// Cost returns the estimated cost of the call in USD, and whether the price of
+// the model, and for transcriptions the length of the audio, is known.
+func (c Call) Cost() (float64, bool) {
+	if c.Kind == Transcription {
+		return cost.Transcription(c.Model, c.Audio()), cost.TranscriptionPriced(c.Model) && c.AudioSeconds > 0
+	}
+	return cost.Chat(c.Model, c.PromptTokens, c.CompletionTokens), cost.ChatPriced(c.Model)
+}
+
+// Store is a usage log.
+type Store struct {
+	Path string
+}
+
+// Append adds c to the end of the log, creating the file if needed.
+func (s *Store) Append(c Call) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	// A single write keeps concurrent appends, e.g. from the daemon, from interleaving lines.
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Load returns the calls made at or after since, oldest first. A missing file
+// is an empty log, and lines that fail to parse are skipped.
+func (s *Store) Load(since time.Time) ([]Call, error) {
+	f, err := os.Open(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var calls []Call
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var c Call
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			continue
+		}
+		if !c.Time.Before(since) {
+			calls = append(calls, c)
+		}
+	}
+	return calls, scanner.Err()
+}
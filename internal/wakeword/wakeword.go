@@ -0,0 +1,127 @@
+// Package wakeword runs a local wake-word engine in a separate process, so
+// engines like openWakeWord or Porcupine can be used without linking them.
+//
+// The protocol is deliberately minimal: the detector reads 16-bit
+// little-endian mono samples at SampleRate from its stdin and writes one line
+// to its stdout each time it hears the wake word, typically the name of the
+// word. It exits when its stdin is closed. Anything it writes to stderr is
+// passed through.
+package wakeword
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SampleRate is the rate detectors take audio at; wake-word models are
+// trained on 16 kHz speech.
+const SampleRate = 16000
+
+// backlog is how many chunks may wait for the detector before chunks are
+// dropped, so a slow detector never holds up the recording.
+const backlog = 64
+
+// Detector is a running wake-word detector.
+type Detector struct {
+	cmd        *exec.Cmd
+	audio      chan []byte
+	detections chan string
+	// quit is closed by Close, done once the detector has exited.
+	quit, done chan struct{}
+	err        error
+}
+
+// Start runs the detector command, the program and its arguments.
+func Start(command []string) (*Detector, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no wake-word detector given")
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start the wake-word detector: %w", err)
+	}
+
+	d := &Detector{
+		cmd:        cmd,
+		audio:      make(chan []byte, backlog),
+		detections: make(chan string),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go func() {
+		defer stdin.Close()
+		for chunk := range d.audio {
+			// A failed write means the detector has exited; the reader below reports it.
+			if _, err := stdin.Write(chunk); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		defer close(d.detections)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if word := strings.TrimSpace(scanner.Text()); word != "" {
+				select {
+				case d.detections <- word:
+				case <-d.quit:
+				}
+			}
+		}
+		// Drain the pipe so the detector can exit, then reap it.
+		io.Copy(io.Discard, stdout)
+		d.err = cmd.Wait()
+		close(d.done)
+	}()
+	return d, nil
+}
+
+// Write hands the detector a chunk of audio, mono at SampleRate. It never
+// blocks; if the detector falls behind, the chunk is dropped.
+func (d *Detector) Write(samples []int16) {
+	buf := make([]byte, 0, 2*len(samples))
+	for _, s := range samples {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(s))
+	}
+	select {
+	case d.audio <- buf:
+	default:
+	}
+}
+
+// Detections delivers a line each time the wake word is heard. It is closed
+// when the detector exits, after which Err tells why.
+func (d *Detector) Detections() <-chan string {
+	return d.detections
+}
+
+// Err returns how the detector exited, once Detections is closed.
+func (d *Detector) Err() error {
+	<-d.done
+	if d.err != nil {
+		return fmt.Errorf("the wake-word detector failed: %w", d.err)
+	}
+	return fmt.Errorf("the wake-word detector exited")
+}
+
+// Close stops the detector and waits for it to exit. Write must not be called
+// after it.
+func (d *Detector) Close() {
+	close(d.quit)
+	close(d.audio)
+	<-d.done
+}
@@ -0,0 +1,115 @@
+// Package embed turns text into embedding vectors using an OpenAI-compatible
+// embeddings endpoint, such as OpenAI's or a local server like Ollama.
+package embed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+)
+
+// Defaults for the OpenAI embeddings API.
+const (
+	DefaultURL   = "https://api.openai.com/v1/embeddings"
+	DefaultModel = "text-embedding-3-small"
+)
+
+// Client sends text to an embeddings endpoint.
+type Client struct {
+	// URL is the full URL of the embeddings endpoint.
+	URL   string
+	Model string
+	// Dimensions shortens the vectors, for models that support it such as
+	// OpenAI's text-embedding-3 models; the model's own size if zero.
+	Dimensions int
+	// Header is added to every request, typically carrying the Authorization or api-key header.
+	Header http.Header
+	// HTTPClient is used to send requests; http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+type embeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed returns the embeddings of texts, in the same order.
+func (c *Client) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(embeddingRequest{Model: c.Model, Input: texts, Dimensions: c.Dimensions})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.Header {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("non-200 status code: %d - %s", resp.StatusCode, string(responseBody))
+	}
+	var result embeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode embeddings: %w", err)
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding for input %d of %d", d.Index, len(texts))
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	for i, v := range vectors {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("no embedding for input %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// Similarity returns the cosine similarity of a and b: 1 for vectors pointing
+// the same way, 0 for unrelated ones. Vectors of different lengths, which
+// come from different models, have none.
+func Similarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
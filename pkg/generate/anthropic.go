@@ -0,0 +1,103 @@
+package generate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Defaults for Anthropic's Messages API.
+const (
+	DefaultAnthropicURL   = "https://api.anthropic.com/v1/messages"
+	DefaultAnthropicModel = "claude-sonnet-4-5"
+)
+
+// anthropicVersion is sent as the anthropic-version header unless the client's Header sets one.
+const anthropicVersion = "2023-06-01"
+
+// anthropicMaxTokens caps answers of requests without a limit of their own; the
+// API requires one, and this one fits a long script.
+const anthropicMaxTokens = 4096
+
+type anthropicRequest struct {
+	Model       string              `json:"model"`
+	System      string              `json:"system,omitempty"`
+	Messages    []map[string]string `json:"messages"`
+	MaxTokens   int                 `json:"max_tokens"`
+	Temperature float64             `json:"temperature"`
+	Tools       []anthropicTool     `json:"tools,omitempty"`
+	ToolChoice  map[string]string   `json:"tool_choice,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// chatAnthropic sends messages to the Messages API, which takes the system
+// prompt as a separate field rather than as messages. Structured answers are
+// the input of a tool the model has to call.
+func (c *Client) chatAnthropic(ctx context.Context, model string, messages []map[string]string, temperature float64, maxTokens int, structured bool) (string, Usage, error) {
+	system, conversation := splitSystem(messages)
+	payload := anthropicRequest{
+		Model:       model,
+		System:      system,
+		Messages:    conversation,
+		MaxTokens:   anthropicMaxTokens,
+		Temperature: temperature,
+	}
+	if maxTokens > 0 {
+		payload.MaxTokens = maxTokens
+	}
+	if structured {
+		payload.Tools = []anthropicTool{{Name: answerTool, Description: "Give the answer", InputSchema: answerSchema(false)}}
+		payload.ToolChoice = map[string]string{"type": "tool", "name": answerTool}
+	}
+	var resp anthropicResponse
+	if err := c.post(ctx, c.URL, payload, &resp); err != nil {
+		return "", Usage{}, err
+	}
+	usage := Usage{PromptTokens: resp.Usage.InputTokens, CompletionTokens: resp.Usage.OutputTokens}
+	var text strings.Builder
+	for _, block := range resp.Content {
+		switch {
+		case block.Type == "tool_use" && block.Name == answerTool:
+			return string(block.Input), usage, nil
+		case block.Type == "text":
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", Usage{}, fmt.Errorf("no text returned from the Messages API")
+	}
+	return text.String(), usage, nil
+}
+
+// splitSystem separates the system messages, joined into one prompt, from the conversation.
+func splitSystem(messages []map[string]string) (string, []map[string]string) {
+	var system []string
+	var conversation []map[string]string
+	for _, m := range messages {
+		if m["role"] == "system" {
+			system = append(system, m["content"])
+		} else {
+			conversation = append(conversation, m)
+		}
+	}
+	return strings.Join(system, "\n\n"), conversation
+}
@@ -0,0 +1,68 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Segment is one source of extra information injected into the prompt.
+type Segment struct {
+	Name  string
+	Title string
+	Lines []string
+}
+
+// FitContext renders segments into a single prompt block that fits within budget tokens.
+// Segments are filled in the order given: each one takes as many lines as still fit,
+// so earlier (higher priority) segments can starve later ones but never the other way round.
+// Every line is passed through SanitizeContextLine and each segment is enclosed in
+// <context> tags, which ContextPreamble tells the model to treat as data.
+func FitContext(model string, segments []Segment, budget int) string {
+	var b strings.Builder
+	remaining := budget
+	for _, seg := range segments {
+		header := fmt.Sprintf("<context source=%q>\n%s:\n", seg.Name, seg.Title)
+		footer := "</context>\n"
+		cost := CountTokens(model, header+footer)
+		if cost >= remaining {
+			break
+		}
+		var kept []string
+		used := cost
+		for _, line := range seg.Lines {
+			line = SanitizeContextLine(line)
+			n := CountTokens(model, line+"\n")
+			if used+n > remaining {
+				break
+			}
+			used += n
+			kept = append(kept, line)
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		if len(kept) < len(seg.Lines) {
+			kept = append(kept, fmt.Sprintf("... (%d more omitted)", len(seg.Lines)-len(kept)))
+		}
+		b.WriteString(header)
+		b.WriteString(strings.Join(kept, "\n"))
+		b.WriteString("\n")
+		b.WriteString(footer)
+		b.WriteString("\n")
+		remaining -= used
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// ContextBudget clamps the requested budget so that the system prompt, the
+// user's request, and the reply always fit in the model's context window.
+func ContextBudget(model string, requested int, fixedPrompt string, replyTokens int) int {
+	available := ContextWindow(model) - CountTokens(model, fixedPrompt) - 3*TokensPerMessage - replyTokens
+	if requested > available {
+		requested = available
+	}
+	if requested < 0 {
+		return 0
+	}
+	return requested
+}
@@ -0,0 +1,22 @@
+package generate
+
+// Domains, see Request.Domain.
+const (
+	Kubernetes = "k8s"
+	Docker     = "docker"
+	Git        = "git"
+)
+
+// DomainPrompts are added to the system prompt of requests about one tool,
+// keyed by domain.
+var DomainPrompts = map[string]string{
+	Kubernetes: "The requests are about the Kubernetes cluster the user works with. " +
+		"Answer with kubectl, or helm for charts, using the resource names listed in the context exactly. " +
+		"Leave out --context and --namespace unless the request is about another context or namespace than the current one",
+	Docker: "The requests are about Docker containers, images, volumes and networks. " +
+		"Answer with docker, refer to containers and images by the names listed in the context, " +
+		"and use docker compose when the current directory has a compose file",
+	Git: "The requests are about the Git repository in the current directory. " +
+		"Answer with git, or gh for GitHub pull requests and issues, using the branch, remote and file names shown in the context exactly. " +
+		"Don't rewrite history that has been pushed, or discard uncommitted changes, unless the request says so",
+}
@@ -0,0 +1,39 @@
+package generate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// StatusError is returned when the API answers with a status other than 200
+// OK, so callers can tell rate limits and server errors from other failures.
+type StatusError struct {
+	StatusCode int
+	// Message is the error message from the response body, which OpenAI,
+	// Anthropic and Gemini all put in error.message, or else the body itself.
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("non-200 status code: %d - %s", e.StatusCode, e.Message)
+}
+
+// RateLimited reports whether the request was turned away for going over a rate limit or quota.
+func (e *StatusError) RateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// newStatusError returns the error for a response with status code and body.
+func newStatusError(code int, body []byte) *StatusError {
+	var r struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &r); err == nil && r.Error.Message != "" {
+		return &StatusError{StatusCode: code, Message: r.Error.Message}
+	}
+	return &StatusError{StatusCode: code, Message: strings.TrimSpace(string(body))}
+}
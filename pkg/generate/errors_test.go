@@ -0,0 +1,103 @@
+package generate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend Backend
+		status  int
+		header  http.Header
+		body    string
+		// message is the StatusError's message; empty if the error isn't one.
+		message     string
+		rateLimited bool
+	}{
+		{
+			name:    "openai error",
+			status:  http.StatusUnauthorized,
+			body:    `{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error"}}`,
+			message: "Incorrect API key provided",
+		},
+		{
+			name:    "anthropic error",
+			backend: Anthropic,
+			status:  http.StatusBadRequest,
+			body:    `{"type": "error", "error": {"type": "invalid_request_error", "message": "max_tokens: field required"}}`,
+			message: "max_tokens: field required",
+		},
+		{
+			name:    "gemini error",
+			backend: Gemini,
+			status:  http.StatusForbidden,
+			body:    `{"error": {"code": 403, "message": "API key not valid", "status": "PERMISSION_DENIED"}}`,
+			message: "API key not valid",
+		},
+		{
+			name:        "rate limited",
+			status:      http.StatusTooManyRequests,
+			header:      http.Header{"Retry-After": {"20"}},
+			body:        `{"error": {"message": "Rate limit reached for gpt-4o-mini"}}`,
+			message:     "Rate limit reached for gpt-4o-mini",
+			rateLimited: true,
+		},
+		{
+			name:    "not json",
+			status:  http.StatusBadGateway,
+			body:    "<html><body>502 Bad Gateway</body></html>\n",
+			message: "<html><body>502 Bad Gateway</body></html>",
+		},
+		{
+			name:    "json without a message",
+			status:  http.StatusInternalServerError,
+			body:    `{"detail": "internal error"}`,
+			message: `{"detail": "internal error"}`,
+		},
+		{
+			name:   "truncated answer",
+			status: http.StatusOK,
+			body:   `{"choices": [{"message": {"content": "ls -`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for key, values := range tt.header {
+					w.Header()[key] = values
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+			c := &Client{Backend: tt.backend, URL: srv.URL, Model: "test-model", PlainText: true}
+			_, err := c.Generate(context.Background(), Request{Text: "list the files"})
+			if err == nil {
+				t.Fatal("Generate succeeded")
+			}
+			var status *StatusError
+			if !errors.As(err, &status) {
+				if tt.message != "" {
+					t.Fatalf("Generate error = %v, want a StatusError", err)
+				}
+				if !strings.Contains(err.Error(), "failed to decode") {
+					t.Errorf("Generate error = %v, want a decoding error", err)
+				}
+				return
+			}
+			if tt.message == "" {
+				t.Fatalf("Generate error = %v, want a decoding error", err)
+			}
+			if status.StatusCode != tt.status || status.Message != tt.message || status.RateLimited() != tt.rateLimited {
+				t.Errorf("StatusError = %+v (rate limited %v), want %d %q (rate limited %v)", *status, status.RateLimited(), tt.status, tt.message, tt.rateLimited)
+			}
+		})
+	}
+}
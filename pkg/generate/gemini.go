@@ -0,0 +1,82 @@
+package generate
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Defaults for the Gemini API.
+const (
+	DefaultGeminiURL   = "https://generativelanguage.googleapis.com/v1beta/models"
+	DefaultGeminiModel = "gemini-2.5-flash"
+)
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent  `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent `json:"contents"`
+	GenerationConfig  struct {
+		Temperature      float64        `json:"temperature"`
+		MaxOutputTokens  int            `json:"maxOutputTokens,omitempty"`
+		ResponseMimeType string         `json:"responseMimeType,omitempty"`
+		ResponseSchema   map[string]any `json:"responseSchema,omitempty"`
+	} `json:"generationConfig"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+// chatGemini sends messages to the generateContent method of model. Gemini
+// calls the assistant "model" and takes the system prompt separately.
+func (c *Client) chatGemini(ctx context.Context, model string, messages []map[string]string, temperature float64, maxTokens int, structured bool) (string, Usage, error) {
+	system, conversation := splitSystem(messages)
+	var payload geminiRequest
+	if system != "" {
+		payload.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: system}}}
+	}
+	for _, m := range conversation {
+		role := "user"
+		if m["role"] == "assistant" {
+			role = "model"
+		}
+		payload.Contents = append(payload.Contents, geminiContent{Role: role, Parts: []geminiPart{{Text: m["content"]}}})
+	}
+	payload.GenerationConfig.Temperature = temperature
+	payload.GenerationConfig.MaxOutputTokens = maxTokens
+	if structured {
+		payload.GenerationConfig.ResponseMimeType = "application/json"
+		payload.GenerationConfig.ResponseSchema = answerSchema(true)
+	}
+
+	endpoint := strings.TrimRight(c.URL, "/") + "/" + url.PathEscape(model) + ":generateContent"
+	var resp geminiResponse
+	if err := c.post(ctx, endpoint, payload, &resp); err != nil {
+		return "", Usage{}, err
+	}
+	if len(resp.Candidates) == 0 {
+		return "", Usage{}, fmt.Errorf("no candidates returned from the Gemini API")
+	}
+	var text strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+	}
+	usage := Usage{PromptTokens: resp.UsageMetadata.PromptTokenCount, CompletionTokens: resp.UsageMetadata.CandidatesTokenCount}
+	return text.String(), usage, nil
+}
@@ -0,0 +1,370 @@
+// Package generate turns natural language requests into Bash commands using an
+// OpenAI-compatible chat completions endpoint, Anthropic's Messages API or the
+// Gemini API.
+package generate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Defaults for the OpenAI chat completions API.
+const (
+	DefaultURL   = "https://api.openai.com/v1/chat/completions"
+	DefaultModel = "gpt-4o-mini"
+)
+
+// SystemPrompt instructs the model how to answer.
+const SystemPrompt = "You convert natural language instructions into a single valid Bash command. Print the command in plain text without any formatting"
+
+// ShellPrompt returns the system prompt for a single command in shell, e.g.
+// "PowerShell"; for Bash, or no shell, that is SystemPrompt.
+func ShellPrompt(shell string) string {
+	if shell == "" || shell == "Bash" {
+		return SystemPrompt
+	}
+	return "You convert natural language instructions into a single valid " + shell + " command. Print the command in plain text without any formatting"
+}
+
+// ScriptPrompt instructs the model to write a complete script instead of a single command.
+const ScriptPrompt = "You convert natural language instructions into a complete Bash script. " +
+	"Start with a #!/usr/bin/env bash shebang and set -euo pipefail, " +
+	"parse command line arguments where the task has inputs, with a usage message for -h, " +
+	"and comment each step. Print only the script, without any formatting"
+
+// ReplyTokenReserve is kept free in the context window for the model's answer.
+const ReplyTokenReserve = 512
+
+// ScriptReplyTokenReserve is the reserve for answers to Script requests.
+const ScriptReplyTokenReserve = 2048
+
+// Request describes a single command generation.
+type Request struct {
+	// Text is the user's instruction, e.g. a transcript.
+	Text string
+	// Context is optional information about the user's environment, see FitContext.
+	Context string
+	// Examples are earlier requests and the commands the user settled on,
+	// oldest first. They are sent ahead of History as few-shot examples, so the
+	// model picks up the user's preferred tools and naming.
+	Examples []Turn
+	// History holds earlier exchanges of the same session, oldest first, so
+	// follow-ups like "now gzip that" can refer to them.
+	History []Turn
+	// Model overrides the client's model when set.
+	Model string
+	// Temperature is the sampling temperature; zero gives the most deterministic answers.
+	Temperature float64
+	// MaxTokens caps the length of the answer; zero leaves it to the API.
+	MaxTokens int
+	// Script asks for a complete script, see ScriptPrompt, rather than a single command.
+	Script bool
+	// Shell names the shell the command is for, see ShellPrompt; Bash if empty.
+	// Scripts are always Bash scripts.
+	Shell string
+	// Placeholders asks for placeholders in place of values the model would
+	// have to guess, see PlaceholderPrompt.
+	Placeholders bool
+	// Domain narrows requests down to one tool, such as Kubernetes, and adds
+	// its entry of DomainPrompts to the system prompt; none if empty.
+	Domain string
+	// Rules are the user's instructions for the project they work in, like
+	// the tools it uses, added to the system prompt after RulesPrompt.
+	Rules string
+}
+
+// Turn is one earlier exchange of a session.
+type Turn struct {
+	Request string
+	Command string
+}
+
+// Backend is the kind of API a Client talks to.
+type Backend string
+
+// Supported backends.
+const (
+	OpenAI    Backend = "openai"
+	Anthropic Backend = "anthropic"
+	Gemini    Backend = "gemini"
+)
+
+// Client sends generation requests to a chat endpoint.
+type Client struct {
+	// Backend selects the API; OpenAI if empty.
+	Backend Backend
+	// URL is the full URL of the chat completions or messages endpoint. For
+	// Gemini it is the models collection; the model name and method are appended.
+	URL string
+	// Model is the default model for requests that don't set one.
+	Model string
+	// Header is added to every request, typically carrying the Authorization or api-key header.
+	Header http.Header
+	// HTTPClient is used to send requests; http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// PlainText asks for commands as plain text, for servers that don't
+	// support structured output. Otherwise answers follow a JSON schema, and
+	// come with an explanation and the model's view of the risks.
+	PlainText bool
+}
+
+// NewClient returns a client for the OpenAI API authenticated with apiKey.
+func NewClient(apiKey string) *Client {
+	return &Client{
+		URL:    DefaultURL,
+		Model:  DefaultModel,
+		Header: http.Header{"Authorization": {"Bearer " + apiKey}},
+	}
+}
+
+// chatRequest is the JSON structure we send to the Chat Completion endpoint.
+type chatRequest struct {
+	Model          string              `json:"model"`
+	Messages       []map[string]string `json:"messages"`
+	Temperature    float64             `json:"temperature"`
+	MaxTokens      int                 `json:"max_tokens,omitempty"`
+	ResponseFormat map[string]any      `json:"response_format,omitempty"`
+}
+
+// chatResponse is a partial structure for the response from the Chat Completion endpoint.
+type chatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage Usage `json:"usage"`
+}
+
+// Usage is the token accounting reported by the endpoint.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// Response is the result of a generation.
+type Response struct {
+	Command string
+	// Explanation says briefly what the command does. Danger is the model's
+	// own view of its risk, safe, caution or dangerous, and NeedsSudo whether
+	// it needs root privileges. They are empty for PlainText clients.
+	Explanation string
+	Danger      string
+	NeedsSudo   bool
+	// Undo is the model's idea of a command reversing Command, if it has one.
+	// It is empty for PlainText clients.
+	Undo string
+	// Placeholders names the placeholders in Command, for Placeholders
+	// requests, see FindPlaceholders.
+	Placeholders []string
+	// Model is the model the request was sent to.
+	Model string
+	Usage Usage
+}
+
+// ModelFor returns the model that will be used for req.
+func (c *Client) ModelFor(req Request) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	if c.Model != "" {
+		return c.Model
+	}
+	return DefaultModelFor(c.Backend)
+}
+
+// DefaultModelFor returns the model used with backend when none is configured.
+func DefaultModelFor(backend Backend) string {
+	switch backend {
+	case Anthropic:
+		return DefaultAnthropicModel
+	case Gemini:
+		return DefaultGeminiModel
+	default:
+		return DefaultModel
+	}
+}
+
+// RequestPrompt returns the system prompt req is sent with.
+func RequestPrompt(req Request) string {
+	var prompt string
+	switch {
+	case req.Script:
+		prompt = ScriptPrompt
+	case req.Placeholders:
+		prompt = ShellPrompt(req.Shell) + ". " + PlaceholderPrompt
+	default:
+		prompt = ShellPrompt(req.Shell)
+	}
+	if domain := DomainPrompts[req.Domain]; domain != "" {
+		prompt += ". " + domain
+	}
+	if req.Rules != "" {
+		prompt += ".\n\n" + RulesPrompt + ":\n\n" + req.Rules
+	}
+	return prompt
+}
+
+// Generate returns the command the model produced for req.
+func (c *Client) Generate(ctx context.Context, req Request) (*Response, error) {
+	system := RequestPrompt(req)
+	messages := []map[string]string{
+		{
+			"role":    "system",
+			"content": system,
+		},
+	}
+	if req.Context != "" {
+		messages = append(messages, map[string]string{
+			"role":    "system",
+			"content": ContextPreamble + req.Context,
+		})
+	}
+	for _, turn := range slices.Concat(req.Examples, req.History) {
+		messages = append(messages,
+			map[string]string{"role": "user", "content": turn.Request},
+			map[string]string{"role": "assistant", "content": turn.Command},
+		)
+	}
+	messages = append(messages, map[string]string{
+		"role":    "user",
+		"content": req.Text,
+	})
+
+	model := c.ModelFor(req)
+	content, usage, err := c.chat(ctx, model, messages, req.Temperature, req.MaxTokens, !c.PlainText)
+	if err != nil {
+		return nil, err
+	}
+	a, structured := answer{Command: content}, false
+	if !c.PlainText {
+		a, structured = parseAnswer(content)
+	}
+	// The command field of a structured answer holds nothing but the command,
+	// so only a fence is taken off it; the guesses about what is commentary
+	// are for answers in plain text.
+	clean := CleanCommand
+	if structured {
+		clean = func(s string, _ bool) string { return fenced(s) }
+	}
+	resp := &Response{
+		Command:     clean(a.Command, req.Script),
+		Explanation: a.Explanation,
+		Danger:      a.DangerLevel,
+		NeedsSudo:   a.NeedsSudo,
+		Undo:        clean(a.Undo, false),
+		Model:       model,
+		Usage:       usage,
+	}
+	if req.Placeholders && !req.Script {
+		// Only placeholders that are in the command count.
+		found := FindPlaceholders(resp.Command)
+		for _, name := range a.Placeholders {
+			if name = strings.Trim(name, "<>"); slices.Contains(found, name) && !slices.Contains(resp.Placeholders, name) {
+				resp.Placeholders = append(resp.Placeholders, name)
+			}
+		}
+		if len(resp.Placeholders) == 0 {
+			resp.Placeholders = found
+		}
+	}
+	return resp, nil
+}
+
+// chat sends messages, each with a role of system, user or assistant, to the
+// model and returns its answer, of at most maxTokens tokens unless that is
+// zero. If structured is set, the answer is JSON
+// following answerSchema.
+func (c *Client) chat(ctx context.Context, model string, messages []map[string]string, temperature float64, maxTokens int, structured bool) (string, Usage, error) {
+	switch c.Backend {
+	case "", OpenAI:
+		return c.chatOpenAI(ctx, model, messages, temperature, maxTokens, structured)
+	case Anthropic:
+		return c.chatAnthropic(ctx, model, messages, temperature, maxTokens, structured)
+	case Gemini:
+		return c.chatGemini(ctx, model, messages, temperature, maxTokens, structured)
+	default:
+		return "", Usage{}, fmt.Errorf("unknown backend %q", c.Backend)
+	}
+}
+
+// chatOpenAI sends messages to the chat completions endpoint and returns the first choice.
+func (c *Client) chatOpenAI(ctx context.Context, model string, messages []map[string]string, temperature float64, maxTokens int, structured bool) (string, Usage, error) {
+	payload := chatRequest{
+		Model:       model,
+		Messages:    messages,
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
+	}
+	if structured {
+		payload.ResponseFormat = map[string]any{
+			"type":        "json_schema",
+			"json_schema": map[string]any{"name": answerTool, "strict": true, "schema": answerSchema(false)},
+		}
+	}
+	var chatResp chatResponse
+	if err := c.post(ctx, c.URL, payload, &chatResp); err != nil {
+		return "", Usage{}, err
+	}
+	if len(chatResp.Choices) == 0 {
+		return "", Usage{}, fmt.Errorf("no choices returned from chat completion")
+	}
+	return chatResp.Choices[0].Message.Content, chatResp.Usage, nil
+}
+
+// post sends payload as JSON to url with the client's headers and decodes the response into out.
+func (c *Client) post(ctx context.Context, url string, payload, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, "POST", url, bytes.NewReader(body), out)
+}
+
+// send makes a request with the client's headers and decodes the JSON
+// response into out.
+func (c *Client) send(ctx context.Context, method, url string, body io.Reader, out any) error {
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	for key, values := range c.Header {
+		for _, v := range values {
+			httpReq.Header.Add(key, v)
+		}
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if c.Backend == Anthropic && httpReq.Header.Get("anthropic-version") == "" {
+		httpReq.Header.Set("anthropic-version", anthropicVersion)
+	}
+
+	resp, err := c.httpClient().Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return newStatusError(resp.StatusCode, responseBody)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode the response from %s: %w", url, err)
+	}
+	return nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,109 @@
+package generate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name      string
+		plainText bool
+		req       Request
+		// content is what the model answers with.
+		content string
+		want    Response
+	}{
+		{
+			name:    "structured",
+			req:     Request{Text: "list the files"},
+			content: `{"command": "ls -la", "explanation": "Lists the files", "danger_level": "safe", "needs_sudo": false, "placeholders": [], "undo": ""}`,
+			want:    Response{Command: "ls -la", Explanation: "Lists the files", Danger: "safe"},
+		},
+		{
+			name:    "structured heredoc",
+			req:     Request{Text: "write a note"},
+			content: `{"command": "cat > notes.txt <<EOF\nThis is a note\nEOF", "explanation": "Writes a note", "danger_level": "caution", "needs_sudo": false, "placeholders": [], "undo": "rm notes.txt"}`,
+			want:    Response{Command: "cat > notes.txt <<EOF\nThis is a note\nEOF", Explanation: "Writes a note", Danger: "caution", Undo: "rm notes.txt"},
+		},
+		{
+			name:    "structured quoted path",
+			req:     Request{Text: "run my app"},
+			content: `{"command": "\"/opt/My App/run.sh\"", "explanation": "Runs the app", "danger_level": "safe", "needs_sudo": false, "placeholders": [], "undo": ""}`,
+			want:    Response{Command: `"/opt/My App/run.sh"`, Explanation: "Runs the app", Danger: "safe"},
+		},
+		{
+			name:    "structured placeholders",
+			req:     Request{Text: "log in to the server", Placeholders: true},
+			content: `{"command": "ssh <user>@<host>", "explanation": "Logs in", "danger_level": "safe", "needs_sudo": false, "placeholders": ["user", "<host>", "port"], "undo": ""}`,
+			want:    Response{Command: "ssh <user>@<host>", Explanation: "Logs in", Danger: "safe", Placeholders: []string{"user", "host"}},
+		},
+		{
+			name:    "schema ignored",
+			req:     Request{Text: "list the files"},
+			content: "```bash\nls -la\n```\nThis lists the files.",
+			want:    Response{Command: "ls -la"},
+		},
+		{
+			name:      "plain text",
+			plainText: true,
+			req:       Request{Text: "list the files"},
+			content:   "Here's the command:\n$ ls -la\nThis lists all files, hidden ones too.",
+			want:      Response{Command: "ls -la"},
+		},
+		{
+			name:      "plain text heredoc",
+			plainText: true,
+			req:       Request{Text: "write a note"},
+			content:   "cat > notes.txt <<EOF\nThis is a note\nEOF",
+			want:      Response{Command: "cat > notes.txt <<EOF\nThis is a note\nEOF"},
+		},
+		{
+			name:      "plain text script",
+			plainText: true,
+			req:       Request{Text: "back up my home", Script: true},
+			content:   "```bash\n#!/usr/bin/env bash\nset -euo pipefail\ntar czf home.tgz ~\n```",
+			want:      Response{Command: "#!/usr/bin/env bash\nset -euo pipefail\ntar czf home.tgz ~"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req chatRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatal(err)
+				}
+				if structured := req.ResponseFormat != nil; structured == tt.plainText {
+					t.Errorf("response_format sent = %v, want %v", structured, !tt.plainText)
+				}
+				if n := len(req.Messages); n < 2 || req.Messages[0]["role"] != "system" || req.Messages[n-1]["content"] != tt.req.Text {
+					t.Errorf("messages = %v", req.Messages)
+				}
+				var resp chatResponse
+				resp.Choices = make([]struct {
+					Message struct {
+						Content string `json:"content"`
+					} `json:"message"`
+				}, 1)
+				resp.Choices[0].Message.Content = tt.content
+				resp.Usage = Usage{PromptTokens: 100, CompletionTokens: 20}
+				json.NewEncoder(w).Encode(resp)
+			}))
+			defer srv.Close()
+			c := &Client{URL: srv.URL, Model: "test-model", PlainText: tt.plainText}
+			resp, err := c.Generate(context.Background(), tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			want.Model, want.Usage = "test-model", Usage{PromptTokens: 100, CompletionTokens: 20}
+			if !reflect.DeepEqual(*resp, want) {
+				t.Errorf("Generate = %+v, want %+v", *resp, want)
+			}
+		})
+	}
+}
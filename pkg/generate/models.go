@@ -0,0 +1,89 @@
+package generate
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Models lists the models the client's API offers, sorted by name. The list
+// is fetched from the models endpoint next to the client's URL, so it only
+// works for URLs ending like the default ones.
+func (c *Client) Models(ctx context.Context) ([]string, error) {
+	var names []string
+	switch c.Backend {
+	case "", OpenAI:
+		base, ok := strings.CutSuffix(c.URL, "/chat/completions")
+		if !ok {
+			return nil, fmt.Errorf("can't tell the models endpoint from the chat URL %s; it should end in /chat/completions", c.URL)
+		}
+		var resp struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		}
+		if err := c.send(ctx, "GET", base+"/models", nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, m := range resp.Data {
+			names = append(names, m.ID)
+		}
+	case Anthropic:
+		base, ok := strings.CutSuffix(c.URL, "/messages")
+		if !ok {
+			return nil, fmt.Errorf("can't tell the models endpoint from the messages URL %s; it should end in /messages", c.URL)
+		}
+		// The list is paged; after_id continues it.
+		query := url.Values{"limit": {"1000"}}
+		for {
+			var resp struct {
+				Data []struct {
+					ID string `json:"id"`
+				} `json:"data"`
+				HasMore bool   `json:"has_more"`
+				LastID  string `json:"last_id"`
+			}
+			if err := c.send(ctx, "GET", base+"/models?"+query.Encode(), nil, &resp); err != nil {
+				return nil, err
+			}
+			for _, m := range resp.Data {
+				names = append(names, m.ID)
+			}
+			if !resp.HasMore || resp.LastID == "" {
+				break
+			}
+			query.Set("after_id", resp.LastID)
+		}
+	case Gemini:
+		// The client's URL is the models collection itself. It includes
+		// embedding models and the like, which can't generate commands.
+		query := url.Values{"pageSize": {"1000"}}
+		for {
+			var resp struct {
+				Models []struct {
+					Name    string   `json:"name"`
+					Methods []string `json:"supportedGenerationMethods"`
+				} `json:"models"`
+				NextPageToken string `json:"nextPageToken"`
+			}
+			if err := c.send(ctx, "GET", strings.TrimRight(c.URL, "/")+"?"+query.Encode(), nil, &resp); err != nil {
+				return nil, err
+			}
+			for _, m := range resp.Models {
+				if slices.Contains(m.Methods, "generateContent") {
+					names = append(names, strings.TrimPrefix(m.Name, "models/"))
+				}
+			}
+			if resp.NextPageToken == "" {
+				break
+			}
+			query.Set("pageToken", resp.NextPageToken)
+		}
+	default:
+		return nil, fmt.Errorf("unknown backend %q", c.Backend)
+	}
+	slices.Sort(names)
+	return names, nil
+}
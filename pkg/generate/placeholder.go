@@ -0,0 +1,34 @@
+package generate
+
+import (
+	"regexp"
+	"slices"
+)
+
+// PlaceholderPrompt is added to the system prompt for Placeholders requests.
+const PlaceholderPrompt = "Never guess values the request doesn't give and the context doesn't show, " +
+	"such as host names, user names, ports, paths or passwords: write a placeholder instead, " +
+	"a short lowercase name in angle brackets like <remote-host> or <port>, " +
+	"using the same placeholder wherever the same value is needed"
+
+// placeholder matches the placeholders described by PlaceholderPrompt. The
+// name must follow the bracket directly, which redirections rarely do.
+var placeholder = regexp.MustCompile(`<([a-z][a-z0-9]*(?:[-_][a-z0-9]+)*)>`)
+
+// FindPlaceholders returns the names of the placeholders in command, each
+// once, in the order they first appear.
+func FindPlaceholders(command string) []string {
+	var names []string
+	for _, m := range placeholder.FindAllStringSubmatch(command, -1) {
+		if !slices.Contains(names, m[1]) {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// PlaceholderIndex returns where the placeholders in command are: for each,
+// the start and end offsets of the placeholder followed by those of its name.
+func PlaceholderIndex(command string) [][]int {
+	return placeholder.FindAllStringSubmatchIndex(command, -1)
+}
@@ -0,0 +1,7 @@
+package generate
+
+// RulesPrompt introduces the rules of a project, see Request.Rules. Unlike the
+// context, they come from the user, so they are followed.
+const RulesPrompt = "The user wrote down rules for the commands of the project they work in, " +
+	"such as the tools it uses and notes on its environment. " +
+	"Follow them unless the request says otherwise"
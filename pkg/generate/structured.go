@@ -0,0 +1,79 @@
+package generate
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// answerTool names the schema, and the tool Anthropic's models are made to
+// call with the answer.
+const answerTool = "answer"
+
+// answer is a structured answer, see answerSchema.
+type answer struct {
+	Command      string   `json:"command"`
+	Explanation  string   `json:"explanation"`
+	DangerLevel  string   `json:"danger_level"`
+	NeedsSudo    bool     `json:"needs_sudo"`
+	Placeholders []string `json:"placeholders"`
+	Undo         string   `json:"undo"`
+}
+
+// answerSchema returns the JSON schema of answers. Gemini takes a subset of
+// OpenAPI schemas instead, with upper case type names and no
+// additionalProperties.
+func answerSchema(gemini bool) map[string]any {
+	typ := func(name string) string {
+		if gemini {
+			return strings.ToUpper(name)
+		}
+		return name
+	}
+	schema := map[string]any{
+		"type": typ("object"),
+		"properties": map[string]any{
+			"command": map[string]any{
+				"type":        typ("string"),
+				"description": "The command, exactly as it is to be typed, without Markdown",
+			},
+			"explanation": map[string]any{
+				"type":        typ("string"),
+				"description": "One short sentence on what the command does",
+			},
+			"danger_level": map[string]any{
+				"type":        typ("string"),
+				"enum":        []string{"safe", "caution", "dangerous"},
+				"description": "caution if the command changes or deletes anything, dangerous if it can destroy data or make the system unusable",
+			},
+			"needs_sudo": map[string]any{
+				"type":        typ("boolean"),
+				"description": "Whether the command needs root privileges to work",
+			},
+			"placeholders": map[string]any{
+				"type":        typ("array"),
+				"items":       map[string]any{"type": typ("string")},
+				"description": "The names of the <placeholders> in the command, without the angle brackets; empty if there are none",
+			},
+			"undo": map[string]any{
+				"type":        typ("string"),
+				"description": "A command that reverses what the command changes, e.g. moving files back; empty if it changes nothing, or destroys data that can't be brought back",
+			},
+		},
+		"required": []string{"command", "explanation", "danger_level", "needs_sudo", "placeholders", "undo"},
+	}
+	if !gemini {
+		schema["additionalProperties"] = false
+	}
+	return schema
+}
+
+// parseAnswer decodes a structured answer, and reports whether it was one.
+// Servers that ignore the schema answer in plain text, which is taken as the
+// command.
+func parseAnswer(content string) (answer, bool) {
+	var a answer
+	if err := json.Unmarshal([]byte(fenced(content)), &a); err != nil || a.Command == "" {
+		return answer{Command: content}, false
+	}
+	return a, true
+}
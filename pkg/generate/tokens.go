@@ -0,0 +1,74 @@
+package generate
+
+import (
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// Context window sizes (in tokens) for the chat models we know about.
+// Unknown models fall back to defaultContextWindow.
+var modelContextWindows = map[string]int{
+	"gpt-4o":        128000,
+	"gpt-4o-mini":   128000,
+	"gpt-4-turbo":   128000,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+
+	"claude-sonnet-4-5": 200000,
+	"claude-haiku-4-5":  200000,
+	"claude-opus-4-1":   200000,
+	"gemini-2.5-flash":  1048576,
+	"gemini-2.5-pro":    1048576,
+}
+
+const defaultContextWindow = 8192
+
+// TokensPerMessage is the fixed overhead the chat format adds to every message.
+const TokensPerMessage = 4
+
+var (
+	tokenizerMu sync.Mutex
+	tokenizers  = make(map[string]*tiktoken.Tiktoken)
+)
+
+func init() {
+	// Use the BPE ranks embedded in the binary instead of downloading them at runtime.
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// CountTokens returns the number of tokens text occupies for the given model.
+// If no tokenizer is available it falls back to the usual ~4 characters per token estimate.
+func CountTokens(model, text string) int {
+	enc := tokenizer(model)
+	if enc == nil {
+		return (len(text) + 3) / 4
+	}
+	return len(enc.Encode(text, nil, nil))
+}
+
+func tokenizer(model string) *tiktoken.Tiktoken {
+	tokenizerMu.Lock()
+	defer tokenizerMu.Unlock()
+	if enc, ok := tokenizers[model]; ok {
+		return enc
+	}
+	enc, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		enc, err = tiktoken.GetEncoding("o200k_base")
+	}
+	if err != nil {
+		enc = nil
+	}
+	tokenizers[model] = enc
+	return enc
+}
+
+// ContextWindow returns the context window size of model.
+func ContextWindow(model string) int {
+	if n, ok := modelContextWindows[model]; ok {
+		return n
+	}
+	return defaultContextWindow
+}
@@ -0,0 +1,203 @@
+//go:build cgo
+
+package record
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// Init initializes the audio subsystem. It must be called before Open, and
+// Terminate must be called once recording is no longer needed.
+func Init() error {
+	if err := portaudio.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize portaudio: %w", err)
+	}
+	return nil
+}
+
+// Terminate releases the audio subsystem.
+func Terminate() error {
+	return portaudio.Terminate()
+}
+
+// Recorder reads 16-bit samples from an open input stream.
+type Recorder struct {
+	stream      *portaudio.Stream
+	in          []int16
+	channels    int
+	sampleRate  int
+	maxDuration time.Duration
+	// channel is the input channel recorded on its own into mono, counting
+	// from 1; all of them if zero.
+	channel int
+	mono    []int16
+}
+
+// Open opens an input stream on the default device with DefaultOptions.
+func Open() (*Recorder, error) {
+	return OpenWith(DefaultOptions)
+}
+
+// OpenWith opens an input stream on the default device. The stream only
+// captures while Record is running, so an open Recorder costs nothing when idle.
+// Without an input device it returns ErrNoInputDevice, rather than the error
+// PortAudio gives when opening a stream on no device.
+//
+// Devices that don't support the requested sample rate or channel count, as
+// some USB interfaces only record at 48 kHz in stereo or with all their
+// inputs at once, are opened at their own rate and with as many channels as
+// they need instead; Options reports what was opened, and Recording.ForSpeech
+// mixes the channels down and converts the result for upload.
+func OpenWith(opts Options) (*Recorder, error) {
+	dev, err := portaudio.DefaultInputDevice()
+	if errors.Is(err, portaudio.NoDefaultInputDevice) || err == nil && dev.MaxInputChannels == 0 {
+		return nil, ErrNoInputDevice
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the default input device: %w", err)
+	}
+	if opts.Channel < 0 || opts.Channel > dev.MaxInputChannels {
+		return nil, fmt.Errorf("the input device %s has channels 1 to %d, not %d", dev.Name, dev.MaxInputChannels, opts.Channel)
+	}
+
+	var firstErr error
+	want := max(opts.Channels, opts.Channel)
+	for _, channels := range uniqueInts(want, min(max(want, 2), dev.MaxInputChannels), dev.MaxInputChannels) {
+		for _, rate := range uniqueInts(opts.SampleRate, int(dev.DefaultSampleRate), 48000, 44100, SpeechSampleRate) {
+			r := &Recorder{
+				in:          make([]int16, opts.FramesPerChunk*channels),
+				channels:    channels,
+				sampleRate:  rate,
+				maxDuration: opts.MaxDuration,
+				channel:     opts.Channel,
+			}
+			if r.channel > 0 {
+				r.mono = make([]int16, opts.FramesPerChunk)
+			}
+			r.stream, err = portaudio.OpenDefaultStream(channels, 0, float64(rate), opts.FramesPerChunk, r.in)
+			if err == nil {
+				return r, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			if !errors.Is(err, portaudio.InvalidSampleRate) && !errors.Is(err, portaudio.InvalidChannelCount) {
+				return nil, fmt.Errorf("failed to open audio stream: %w", err)
+			}
+		}
+	}
+	return nil, fmt.Errorf("failed to open audio stream at any sample rate the device supports: %w", firstErr)
+}
+
+// InputDevices lists the devices that can record. Init must have been called.
+func InputDevices() ([]Device, error) {
+	devs, err := portaudio.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audio devices: %w", err)
+	}
+	// Without a default device, none is marked.
+	def, _ := portaudio.DefaultInputDevice()
+	var inputs []Device
+	for _, dev := range devs {
+		if dev.MaxInputChannels == 0 {
+			continue
+		}
+		d := Device{
+			Name:       dev.Name,
+			Channels:   dev.MaxInputChannels,
+			SampleRate: int(dev.DefaultSampleRate),
+		}
+		if dev.HostApi != nil {
+			d.HostAPI = dev.HostApi.Name
+		}
+		d.Default = dev == def
+		inputs = append(inputs, d)
+	}
+	return inputs, nil
+}
+
+// uniqueInts returns the positive values of v in order, without repeats.
+func uniqueInts(v ...int) []int {
+	var out []int
+	for _, n := range v {
+		if n > 0 && !slices.Contains(out, n) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// Close closes the input stream.
+func (r *Recorder) Close() error {
+	return r.stream.Close()
+}
+
+// Options returns the capture parameters of the stream. Channels is the
+// number of channels in the recordings, which is one when a single channel is
+// recorded.
+func (r *Recorder) Options() Options {
+	channels := r.channels
+	if r.channel > 0 {
+		channels = 1
+	}
+	return Options{Channels: channels, SampleRate: r.sampleRate, FramesPerChunk: len(r.in) / r.channels, MaxDuration: r.maxDuration}
+}
+
+// Record captures audio until stop is closed, or until the recording reaches
+// the MaxDuration it was opened with, and returns everything that was recorded.
+func (r *Recorder) Record(stop <-chan struct{}) (*Recording, error) {
+	return r.RecordFunc(stop, nil)
+}
+
+// RecordFunc is like Record but also hands every chunk to onChunk as soon as it
+// is captured, e.g. to show a level meter. The chunk is only valid during the
+// call, and onChunk must return quickly so no audio is dropped.
+func (r *Recorder) RecordFunc(stop <-chan struct{}, onChunk func(chunk []int16)) (*Recording, error) {
+	if err := r.stream.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start audio stream: %w", err)
+	}
+
+	o := r.Options()
+	rec := &Recording{Channels: o.Channels, SampleRate: r.sampleRate}
+	limit := o.MaxSamples()
+	finish := func() (*Recording, error) {
+		if err := r.stream.Stop(); err != nil {
+			return nil, fmt.Errorf("failed to stop audio stream: %w", err)
+		}
+		return rec, nil
+	}
+	for {
+		if limit > 0 && len(rec.Samples) >= limit {
+			rec.Samples, rec.Truncated = rec.Samples[:limit], true
+			return finish()
+		}
+		select {
+		case <-stop:
+			return finish()
+		default:
+		}
+		// Read blocks until a full chunk is available, so this loop sleeps between chunks.
+		if err := r.stream.Read(); err != nil && err != io.EOF {
+			r.stream.Stop()
+			return nil, fmt.Errorf("error reading from audio stream: %w", err)
+		}
+		// Append the current chunk to the recording
+		chunk := r.in
+		if r.channel > 0 {
+			chunk = r.mono
+			for i := range chunk {
+				chunk[i] = r.in[i*r.channels+r.channel-1]
+			}
+		}
+		rec.Samples = append(rec.Samples, chunk...)
+		if onChunk != nil {
+			onChunk(chunk)
+		}
+	}
+}
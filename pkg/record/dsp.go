@@ -0,0 +1,207 @@
+package record
+
+import (
+	"math"
+	"math/cmplx"
+	"slices"
+	"time"
+)
+
+// Denoising settings.
+const (
+	// denoiseWindow is the length of the analysis window; 32 ms resolves
+	// speech harmonics while following syllables.
+	denoiseWindow = 32 * time.Millisecond
+	// noisePercentile picks the noise level of each frequency from the
+	// quieter frames, which in a spoken request are the pauses.
+	noisePercentile = 0.2
+	// oversubtraction removes a little more than the estimated noise, as the
+	// estimate is an average and the noise isn't.
+	oversubtraction = 2.0
+	// gateFloor is the least a frequency is turned down by, so speech that
+	// drowns in the noise is muffled rather than cut off.
+	gateFloor = 0.1
+	// minNoiseFrames is how much audio, in windows, is needed to tell the
+	// noise apart from speech.
+	minNoiseFrames = 16
+)
+
+// Gain settings.
+const (
+	// SpeechLevel is the level, in dBFS, AutoGain brings speech to.
+	SpeechLevel = -18.0
+	// maxAutoGain caps AutoGain, in dB, so a recording of silence isn't
+	// turned into a recording of hiss.
+	maxAutoGain = 30.0
+	// limiterKnee is where the limiter starts to compress peaks, as a
+	// fraction of full scale.
+	limiterKnee = 0.8
+)
+
+// Denoise returns the recording with steady background noise, like fans,
+// hum and hiss, turned down by a spectral gate. The noise is measured from the
+// recording itself, so it needs a second or so of audio with pauses in it;
+// shorter recordings are returned as is. Recordings with more than one
+// channel are mixed down to mono for speech first, see ForSpeech.
+func (rec *Recording) Denoise() *Recording {
+	if rec.Channels != 1 {
+		rec = rec.ForSpeech()
+	}
+	n := 1
+	for time.Duration(n)*time.Second < denoiseWindow*time.Duration(rec.SampleRate) {
+		n *= 2
+	}
+	hop := n / 2
+	frames := (len(rec.Samples) - n) / hop
+	if frames < minNoiseFrames {
+		return rec
+	}
+
+	// A periodic Hann window, applied as its square root before and after,
+	// adds up to exactly one where the halves of the windows overlap.
+	window := make([]float64, n)
+	for i := range window {
+		window[i] = math.Sqrt(0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n)))
+	}
+	bins := n/2 + 1
+	spectra := make([][]complex128, frames)
+	for f := range spectra {
+		buf := make([]complex128, n)
+		for i := range buf {
+			buf[i] = complex(float64(rec.Samples[f*hop+i])*window[i], 0)
+		}
+		fft(buf, false)
+		spectra[f] = buf
+	}
+
+	noise := make([]float64, bins)
+	power := make([]float64, frames)
+	for b := range noise {
+		for f, spectrum := range spectra {
+			power[f] = real(spectrum[b])*real(spectrum[b]) + imag(spectrum[b])*imag(spectrum[b])
+		}
+		slices.Sort(power)
+		// The power of noise in a frequency is spread exponentially around
+		// its mean, which is the percentile over -ln(1-percentile).
+		noise[b] = power[int(noisePercentile*float64(frames))] / -math.Log(1-noisePercentile)
+	}
+
+	out := make([]float64, len(rec.Samples))
+	gains := make([]float64, bins)
+	for f, spectrum := range spectra {
+		for b := range bins {
+			p := real(spectrum[b])*real(spectrum[b]) + imag(spectrum[b])*imag(spectrum[b])
+			g := gateFloor
+			if p > 0 {
+				g = math.Sqrt(max((p-oversubtraction*noise[b])/p, gateFloor*gateFloor))
+			}
+			// Following the previous frame halfway keeps the gate from
+			// fluttering, which would sound like chirps.
+			if f > 0 {
+				g = (g + gains[b]) / 2
+			}
+			gains[b] = g
+			spectrum[b] *= complex(g, 0)
+			if b > 0 && b < n/2 {
+				spectrum[n-b] = cmplx.Conj(spectrum[b])
+			}
+		}
+		fft(spectrum, true)
+		for i := range n {
+			out[f*hop+i] += real(spectrum[i]) * window[i]
+		}
+	}
+
+	// The first and last half windows have no overlapping neighbour and are
+	// left as they were, as is the tail that doesn't fill a window.
+	denoised := &Recording{Samples: make([]int16, len(rec.Samples)), Channels: 1, SampleRate: rec.SampleRate, Truncated: rec.Truncated}
+	copy(denoised.Samples, rec.Samples)
+	for i := hop; i < frames*hop; i++ {
+		denoised.Samples[i] = clip(out[i])
+	}
+	return denoised
+}
+
+// AutoGain returns the recording amplified so that speech is at SpeechLevel,
+// by up to 30 dB; loud recordings are left as they are. Speech is taken to be
+// the loudest tenth of the recording.
+func (rec *Recording) AutoGain() *Recording {
+	window := max(rec.SampleRate*rec.Channels*30/1000, 1)
+	var levels []float64
+	for i := 0; i+window <= len(rec.Samples); i += window {
+		levels = append(levels, Level(rec.Samples[i:i+window]))
+	}
+	if len(levels) == 0 {
+		return rec
+	}
+	slices.Sort(levels)
+	speech := levels[len(levels)*9/10]
+	return rec.Amplify(max(min(SpeechLevel-speech, maxAutoGain), 0))
+}
+
+// Amplify returns the recording with its volume changed by db decibels.
+// Peaks that would clip are compressed instead.
+func (rec *Recording) Amplify(db float64) *Recording {
+	if db == 0 {
+		return rec
+	}
+	factor := math.Pow(10, db/20)
+	out := &Recording{Samples: make([]int16, len(rec.Samples)), Channels: rec.Channels, SampleRate: rec.SampleRate, Truncated: rec.Truncated}
+	for i, s := range rec.Samples {
+		out.Samples[i] = clip(limit(float64(s) * factor))
+	}
+	return out
+}
+
+// limit compresses a sample above limiterKnee so it never reaches full scale.
+func limit(s float64) float64 {
+	const full = 32767.0
+	knee := limiterKnee * full
+	magnitude := math.Abs(s)
+	if magnitude <= knee {
+		return s
+	}
+	magnitude = knee + (full-knee)*math.Tanh((magnitude-knee)/(full-knee))
+	return math.Copysign(magnitude, s)
+}
+
+// clip rounds s to a sample, clipping it to the 16-bit range.
+func clip(s float64) int16 {
+	return int16(max(min(math.Round(s), math.MaxInt16), math.MinInt16))
+}
+
+// fft transforms buf in place with the radix-2 Cooley-Tukey algorithm; its
+// length must be a power of two. The inverse transform is scaled by 1/n.
+func fft(buf []complex128, inverse bool) {
+	n := len(buf)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			buf[i], buf[j] = buf[j], buf[i]
+		}
+	}
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Rect(1, sign*2*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := range size / 2 {
+				even, odd := buf[start+k], buf[start+k+size/2]*w
+				buf[start+k], buf[start+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+	if inverse {
+		for i := range buf {
+			buf[i] /= complex(float64(n), 0)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package record
+
+import "io"
+
+// Encoder writes recordings in one audio format. Transcription backends choose
+// an encoder by the formats they accept, so supporting a backend with different
+// requirements never touches the capture code.
+type Encoder interface {
+	// Format is the name used in configuration, e.g. "flac".
+	Format() string
+	// Ext is the file extension uploads in this format should carry, including the dot.
+	Ext() string
+	Encode(w io.Writer, rec *Recording) error
+}
+
+// Encoders holds the available encoders by format name. Programs may register their own.
+var Encoders = map[string]Encoder{
+	"wav":  WAVEncoder{},
+	"flac": FLACEncoder{},
+	"opus": OpusEncoder{},
+}
+
+// WAVEncoder writes uncompressed 16-bit PCM, which every backend understands.
+type WAVEncoder struct{}
+
+func (WAVEncoder) Format() string { return "wav" }
+func (WAVEncoder) Ext() string    { return ".wav" }
+func (WAVEncoder) Encode(w io.Writer, rec *Recording) error {
+	return rec.WriteWAV(w)
+}
+
+// FLACEncoder writes lossless FLAC, about half the size of WAV for speech.
+type FLACEncoder struct{}
+
+func (FLACEncoder) Format() string { return "flac" }
+func (FLACEncoder) Ext() string    { return ".flac" }
+func (FLACEncoder) Encode(w io.Writer, rec *Recording) error {
+	return rec.WriteFLAC(w)
+}
+
+// OpusEncoder writes Ogg Opus, the smallest option; it needs opusenc on PATH.
+type OpusEncoder struct{}
+
+func (OpusEncoder) Format() string { return "opus" }
+func (OpusEncoder) Ext() string    { return ".ogg" }
+func (OpusEncoder) Encode(w io.Writer, rec *Recording) error {
+	return rec.WriteOpus(w)
+}
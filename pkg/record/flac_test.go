@@ -0,0 +1,260 @@
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// bitReader reads values most significant bit first, as FLAC stores them.
+type bitReader struct {
+	buf []byte
+	pos int // in bits
+}
+
+func (b *bitReader) read(n int) uint64 {
+	var v uint64
+	for ; n > 0; n-- {
+		if b.pos/8 >= len(b.buf) {
+			panic("read past the end of the stream")
+		}
+		v = v<<1 | uint64(b.buf[b.pos/8]>>(7-b.pos%8)&1)
+		b.pos++
+	}
+	return v
+}
+
+func (b *bitReader) readSigned(n int) int64 {
+	v := b.read(n)
+	return int64(v<<(64-n)) >> (64 - n)
+}
+
+func (b *bitReader) readRice(param int) int64 {
+	var q uint64
+	for b.read(1) == 0 {
+		q++
+	}
+	u := q<<param | b.read(param)
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (b *bitReader) readUTF8() uint64 {
+	lead := b.read(8)
+	if lead < 0x80 {
+		return lead
+	}
+	n := 0
+	for lead<<n&0x80 != 0 {
+		n++
+	}
+	v := lead & (1<<(7-n) - 1)
+	for i := 1; i < n; i++ {
+		v = v<<6 | b.read(8)&0x3f
+	}
+	return v
+}
+
+func (b *bitReader) align() {
+	b.pos = (b.pos + 7) / 8 * 8
+}
+
+// decodeFLAC decodes what WriteFLAC writes: a STREAMINFO block followed by
+// frames of fixed and verbatim subframes. It checks the CRCs and the frame
+// numbers on the way.
+func decodeFLAC(t *testing.T, data []byte) *Recording {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("fLaC")) {
+		t.Fatalf("stream starts with %q, want fLaC", data[:min(4, len(data))])
+	}
+	// A last metadata block of type STREAMINFO, which is 34 bytes.
+	if !bytes.Equal(data[4:8], []byte{0x80, 0, 0, 34}) {
+		t.Fatalf("metadata block header = %x, want a last STREAMINFO block", data[4:8])
+	}
+	info := &bitReader{buf: data[8:42]}
+	if minBlock, maxBlock := info.read(16), info.read(16); minBlock != flacBlockSize || maxBlock != flacBlockSize {
+		t.Errorf("block sizes = %d, %d; want %d", minBlock, maxBlock, flacBlockSize)
+	}
+	info.read(48) // frame sizes
+	rec := &Recording{SampleRate: int(info.read(20)), Channels: int(info.read(3)) + 1}
+	if bps := info.read(5) + 1; bps != 16 {
+		t.Errorf("bits per sample = %d, want 16", bps)
+	}
+	total := int(info.read(36))
+
+	r := &bitReader{buf: data[42:]}
+	for n := uint64(0); r.pos/8 < len(r.buf); n++ {
+		start := r.pos / 8
+		if sync := r.read(14); sync != 0x3ffe {
+			t.Fatalf("frame %d: sync code %#x", n, sync)
+		}
+		r.read(2)
+		if code := r.read(4); code != 0x7 {
+			t.Fatalf("frame %d: block size code %#x, want 16 bits after the header", n, code)
+		}
+		r.read(4)
+		if channels := int(r.read(4)) + 1; channels != rec.Channels {
+			t.Fatalf("frame %d: %d channels, want %d", n, channels, rec.Channels)
+		}
+		r.read(4)
+		if number := r.readUTF8(); number != n {
+			t.Fatalf("frame %d is numbered %d", n, number)
+		}
+		size := int(r.read(16)) + 1
+		header := r.buf[start : r.pos/8]
+		if crc := byte(r.read(8)); crc != crc8(header) {
+			t.Fatalf("frame %d: header CRC-8 %#x, want %#x", n, crc, crc8(header))
+		}
+
+		channels := make([][]int32, rec.Channels)
+		for ch := range channels {
+			channels[ch] = decodeSubframe(t, r, size)
+		}
+		r.align()
+		if crc := uint16(r.read(16)); crc != crc16(r.buf[start:r.pos/8-2]) {
+			t.Fatalf("frame %d: CRC-16 %#x, want %#x", n, crc, crc16(r.buf[start:r.pos/8-2]))
+		}
+		for i := 0; i < size; i++ {
+			for ch := range channels {
+				rec.Samples = append(rec.Samples, int16(channels[ch][i]))
+			}
+		}
+	}
+	if frames := len(rec.Samples) / rec.Channels; frames != total {
+		t.Errorf("decoded %d samples per channel, STREAMINFO says %d", frames, total)
+	}
+	return rec
+}
+
+// decodeSubframe decodes one channel of size samples.
+func decodeSubframe(t *testing.T, r *bitReader, size int) []int32 {
+	t.Helper()
+	if pad := r.read(1); pad != 0 {
+		t.Fatal("subframe padding bit set")
+	}
+	kind := r.read(6)
+	if wasted := r.read(1); wasted != 0 {
+		t.Fatal("subframe has wasted bits")
+	}
+	samples := make([]int32, size)
+	switch {
+	case kind == 0x01:
+		for i := range samples {
+			samples[i] = int32(r.readSigned(16))
+		}
+	case kind >= 0x08 && kind <= 0x08|maxFixedOrder:
+		order := int(kind & 0x07)
+		for i := 0; i < order; i++ {
+			samples[i] = int32(r.readSigned(16))
+		}
+		if method, partitions := r.read(2), r.read(4); method != 0 || partitions != 0 {
+			t.Fatalf("residual coding %d with partition order %d, want 0 and 0", method, partitions)
+		}
+		param := int(r.read(4))
+		x := func(i, k int) int64 { return int64(samples[i-k]) }
+		for i := order; i < size; i++ {
+			var prediction int64
+			switch order {
+			case 1:
+				prediction = x(i, 1)
+			case 2:
+				prediction = 2*x(i, 1) - x(i, 2)
+			case 3:
+				prediction = 3*x(i, 1) - 3*x(i, 2) + x(i, 3)
+			case 4:
+				prediction = 4*x(i, 1) - 6*x(i, 2) + 4*x(i, 3) - x(i, 4)
+			}
+			samples[i] = int32(prediction + r.readRice(param))
+		}
+	default:
+		t.Fatalf("unexpected subframe type %#x", kind)
+	}
+	return samples
+}
+
+func TestFLACRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tone := func(n int) []int16 {
+		s := make([]int16, n)
+		for i := range s {
+			s[i] = int16(12000*math.Sin(float64(i)/7) + float64(rng.Intn(200)-100))
+		}
+		return s
+	}
+	noise := func(n int) []int16 {
+		s := make([]int16, n)
+		for i := range s {
+			s[i] = int16(rng.Intn(1 << 16))
+		}
+		return s
+	}
+	extremes := make([]int16, 3*flacBlockSize)
+	for i := range extremes {
+		extremes[i] = math.MaxInt16
+		if i/5%2 == 0 {
+			extremes[i] = math.MinInt16
+		}
+	}
+
+	tests := []struct {
+		name string
+		rec  Recording
+	}{
+		{"speech", Recording{Samples: tone(3*flacBlockSize + 100), Channels: 1, SampleRate: 16000}},
+		{"silence", Recording{Samples: make([]int16, flacBlockSize), Channels: 1, SampleRate: 16000}},
+		{"noise", Recording{Samples: noise(flacBlockSize), Channels: 1, SampleRate: 16000}},
+		{"full scale", Recording{Samples: extremes, Channels: 1, SampleRate: 16000}},
+		{"stereo", Recording{Samples: tone(2 * 5000), Channels: 2, SampleRate: 48000}},
+		{"tiny", Recording{Samples: []int16{1, -2, 3}, Channels: 1, SampleRate: 16000}},
+		// Frame numbers from 128 on take more than a byte.
+		{"many frames", Recording{Samples: tone(130 * flacBlockSize), Channels: 1, SampleRate: 16000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.rec.WriteFLAC(&buf); err != nil {
+				t.Fatal(err)
+			}
+			got := decodeFLAC(t, buf.Bytes())
+			if got.SampleRate != tt.rec.SampleRate || got.Channels != tt.rec.Channels {
+				t.Errorf("decoded %d Hz, %d channels; want %d Hz, %d channels", got.SampleRate, got.Channels, tt.rec.SampleRate, tt.rec.Channels)
+			}
+			if len(got.Samples) != len(tt.rec.Samples) {
+				t.Fatalf("decoded %d samples, want %d", len(got.Samples), len(tt.rec.Samples))
+			}
+			for i := range got.Samples {
+				if got.Samples[i] != tt.rec.Samples[i] {
+					t.Fatalf("sample %d = %d, want %d", i, got.Samples[i], tt.rec.Samples[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFLACCRC(t *testing.T) {
+	// The check values of CRC-8 and CRC-16/UMTS, the variants FLAC uses.
+	check := []byte("123456789")
+	if got := crc8(check); got != 0xF4 {
+		t.Errorf("crc8 = %#x, want 0xf4", got)
+	}
+	if got := crc16(check); got != 0xFEE8 {
+		t.Errorf("crc16 = %#x, want 0xfee8", got)
+	}
+}
+
+func TestFLACSize(t *testing.T) {
+	rec := Recording{Samples: make([]int16, 16000), Channels: 1, SampleRate: 16000}
+	for i := range rec.Samples {
+		rec.Samples[i] = int16(8000 * math.Sin(float64(i)/10))
+	}
+	var buf bytes.Buffer
+	if err := rec.WriteFLAC(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// Speech, let alone a pure tone, must come out well under the size of
+	// the samples; the stream is verbatim otherwise.
+	if raw := binary.Size(rec.Samples); buf.Len() > raw/2 {
+		t.Errorf("encoded %d bytes of samples into %d bytes", raw, buf.Len())
+	}
+}
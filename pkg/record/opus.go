@@ -0,0 +1,35 @@
+package record
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// OpusBitrate is the bitrate in kbit/s used by WriteOpus. Speech stays
+// perfectly intelligible to recognizers well below it.
+const OpusBitrate = 24
+
+// WriteOpus encodes the recording as Ogg Opus. There is no pure Go Opus
+// encoder, so this pipes the audio through opusenc (from opus-tools), which
+// must be on PATH.
+func (rec *Recording) WriteOpus(w io.Writer) error {
+	path, err := exec.LookPath("opusenc")
+	if err != nil {
+		return fmt.Errorf("opus encoding needs opusenc (opus-tools) on PATH: %w", err)
+	}
+	var wav bytes.Buffer
+	if err := rec.WriteWAV(&wav); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(path, "--quiet", "--bitrate", fmt.Sprint(OpusBitrate), "-", "-")
+	cmd.Stdin = &wav
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("opusenc failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build cgo
+
+package record
+
+import "os"
+
+func init() {
+	// Replicate JACK_NO_START_SERVER=1
+	os.Setenv("JACK_NO_START_SERVER", "1")
+
+	// Silence the JACK and ALSA libraries, which print noisy diagnostics to
+	// stderr while PortAudio probes for devices.
+	silenceAudioLibraries()
+}
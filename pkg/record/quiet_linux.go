@@ -0,0 +1,60 @@
+//go:build linux && cgo
+
+package record
+
+/*
+#cgo LDFLAGS: -ldl
+
+#include <dlfcn.h>
+#include <stddef.h>
+
+// JACK error callback: does nothing
+static void jackErrorCallback(const char *msg) {}
+
+// ALSA error callback: does nothing
+static void alsaErrorCallback(const char *file, int line, const char *function, int err, const char *fmt, ...) {}
+
+// openLibrary loads the first of two names that exists. The handle is never
+// closed, so the library and its error handler stay in place for PortAudio,
+// which gets the same instance when it uses the library.
+static void *openLibrary(const char *soname, const char *name) {
+    void *lib = dlopen(soname, RTLD_NOW | RTLD_GLOBAL);
+    if (lib == NULL) {
+        lib = dlopen(name, RTLD_NOW | RTLD_GLOBAL);
+    }
+    return lib;
+}
+
+// Set the JACK error handler, if libjack is installed.
+static void setJackErrorHandler() {
+    void *lib = openLibrary("libjack.so.0", "libjack.so");
+    if (lib == NULL) {
+        return;
+    }
+    void (*setErrorFunction)(void (*)(const char *)) = dlsym(lib, "jack_set_error_function");
+    if (setErrorFunction != NULL) {
+        setErrorFunction(jackErrorCallback);
+    }
+}
+
+// Set the ALSA error handler, if libasound is installed.
+static void setAlsaErrorHandler() {
+    void *lib = openLibrary("libasound.so.2", "libasound.so");
+    if (lib == NULL) {
+        return;
+    }
+    int (*setHandler)(void (*)(const char *, int, const char *, int, const char *, ...)) = dlsym(lib, "snd_lib_error_set_handler");
+    if (setHandler != NULL) {
+        setHandler(alsaErrorCallback);
+    }
+}
+*/
+import "C"
+
+// silenceAudioLibraries installs do-nothing error handlers in JACK and ALSA.
+// The libraries are loaded at run time rather than linked, so building needs
+// neither installed, and a machine missing either just keeps its messages.
+func silenceAudioLibraries() {
+	C.setJackErrorHandler()
+	C.setAlsaErrorHandler()
+}
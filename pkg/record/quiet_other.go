@@ -0,0 +1,7 @@
+//go:build cgo && !linux
+
+package record
+
+// silenceAudioLibraries does nothing: JACK and ALSA only print their
+// diagnostics this way on Linux.
+func silenceAudioLibraries() {}
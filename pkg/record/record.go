@@ -0,0 +1,129 @@
+// Package record captures audio from the default input device and encodes it
+// for upload to a speech-to-text service.
+//
+// Capturing needs PortAudio and therefore cgo; without cgo the package still
+// provides Recording and the encoders, and audio can be captured by a separate
+// helper process, see cmd/bash-generator-capture.
+package record
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrNoInputDevice is returned when the system has no audio input device at
+// all, as in most containers and CI runners.
+var ErrNoInputDevice = errors.New("no microphone or other audio input device found")
+
+// Capture parameters used by Open.
+const (
+	DefaultChannels       = 1
+	DefaultSampleRate     = 44100
+	DefaultFramesPerChunk = 1024
+)
+
+// Device describes an audio input device.
+type Device struct {
+	Name    string `json:"name"`
+	HostAPI string `json:"host_api,omitempty"`
+	// Channels is the most channels it records at once.
+	Channels int `json:"channels"`
+	// SampleRate is the rate it records at unless asked for another.
+	SampleRate int `json:"sample_rate"`
+	// Default marks the device Open records from.
+	Default bool `json:"default,omitempty"`
+}
+
+// Options configure an input stream.
+type Options struct {
+	Channels       int
+	SampleRate     int
+	FramesPerChunk int
+	// Channel, if not zero, records only the input channel with that number,
+	// counting from 1, as on an audio interface with the microphone plugged
+	// into one of its inputs. The device is opened with at least that many
+	// channels, and recordings are mono.
+	Channel int
+	// MaxDuration stops a recording once it is this long, so a recorder left
+	// running doesn't grow without bound. Zero means no limit.
+	MaxDuration time.Duration
+}
+
+// MaxSamples returns how many samples MaxDuration allows, or 0 for no limit.
+func (o Options) MaxSamples() int {
+	if o.MaxDuration <= 0 {
+		return 0
+	}
+	frames := int(o.MaxDuration * time.Duration(o.SampleRate) / time.Second)
+	return max(frames, 1) * o.Channels
+}
+
+// DefaultOptions are the capture parameters used by Open.
+var DefaultOptions = Options{
+	Channels:       DefaultChannels,
+	SampleRate:     DefaultSampleRate,
+	FramesPerChunk: DefaultFramesPerChunk,
+}
+
+// LowPowerOptions trade latency for battery life in long-running listeners:
+// 16 kHz is all speech recognition needs, and larger chunks mean the capture
+// thread wakes up a quarter as often.
+var LowPowerOptions = Options{
+	Channels:       1,
+	SampleRate:     16000,
+	FramesPerChunk: 4096,
+}
+
+// Recording holds interleaved 16-bit PCM samples.
+type Recording struct {
+	Samples    []int16
+	Channels   int
+	SampleRate int
+	// Truncated is set when the recording stopped at Options.MaxDuration
+	// rather than when it was asked to.
+	Truncated bool
+}
+
+// Level returns the loudness of samples in dBFS, from -96 for silence up to 0.
+func Level(samples []int16) float64 {
+	if len(samples) == 0 {
+		return -96
+	}
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	rms := math.Sqrt(sum / float64(len(samples)))
+	return max(20*math.Log10(rms/32768), -96)
+}
+
+// speechFrame is the length of the frames SpeechDuration judges one by one,
+// short enough to leave out the gaps between words.
+const speechFrame = 30 * time.Millisecond
+
+// SpeechDuration returns how much of the recording is louder than level, in
+// dBFS: a simple voice activity detector, judging speechFrame at a time, to
+// tell a recording of someone speaking from one of silence or a click.
+func (rec *Recording) SpeechDuration(level float64) time.Duration {
+	if rec.SampleRate == 0 || rec.Channels == 0 {
+		return 0
+	}
+	frame := max(int(speechFrame.Seconds()*float64(rec.SampleRate)), 1) * rec.Channels
+	var frames int
+	for i := 0; i+frame <= len(rec.Samples); i += frame {
+		if Level(rec.Samples[i:i+frame]) > level {
+			frames++
+		}
+	}
+	return time.Duration(frames) * speechFrame
+}
+
+// Duration returns the length of the recording.
+func (rec *Recording) Duration() time.Duration {
+	if rec.SampleRate == 0 || rec.Channels == 0 {
+		return 0
+	}
+	frames := len(rec.Samples) / rec.Channels
+	return time.Duration(frames) * time.Second / time.Duration(rec.SampleRate)
+}
@@ -0,0 +1,110 @@
+package record
+
+// SpeechSampleRate is the rate speech recognition models work at internally;
+// anything above it only makes uploads bigger.
+const SpeechSampleRate = 16000
+
+// ForSpeech returns the recording mixed down to mono and resampled to
+// SpeechSampleRate. Recordings already in that format are returned as is.
+func (rec *Recording) ForSpeech() *Recording {
+	if rec.Channels == 1 && rec.SampleRate <= SpeechSampleRate {
+		return rec
+	}
+
+	frames := len(rec.Samples) / rec.Channels
+	mono := make([]int32, frames)
+	for i := range mono {
+		var sum int32
+		for ch := 0; ch < rec.Channels; ch++ {
+			sum += int32(rec.Samples[i*rec.Channels+ch])
+		}
+		mono[i] = sum / int32(rec.Channels)
+	}
+	if rec.SampleRate <= SpeechSampleRate {
+		out := &Recording{Samples: make([]int16, frames), Channels: 1, SampleRate: rec.SampleRate}
+		for i, s := range mono {
+			out.Samples[i] = int16(s)
+		}
+		return out
+	}
+
+	// Average the input samples that fall into each output sample. The box filter
+	// doubles as the low-pass that keeps frequencies above 8 kHz from aliasing.
+	step := float64(rec.SampleRate) / SpeechSampleRate
+	n := int(float64(frames) / step)
+	out := &Recording{Samples: make([]int16, n), Channels: 1, SampleRate: SpeechSampleRate}
+	for i := range out.Samples {
+		from := int(float64(i) * step)
+		to := min(int(float64(i+1)*step), frames)
+		var sum int64
+		for _, s := range mono[from:to] {
+			sum += int64(s)
+		}
+		if to > from {
+			out.Samples[i] = int16(sum / int64(to-from))
+		}
+	}
+	return out
+}
+
+// Resampler mixes audio down to mono and converts it to another sample rate
+// chunk by chunk, as it is recorded, carrying its position across chunks so
+// they join up without gaps.
+type Resampler struct {
+	channels int
+	// step is how many input frames one output frame spans.
+	step float64
+	// pending holds the mono input not yet consumed; pos is where the next
+	// output frame starts in it.
+	pending []int32
+	pos     float64
+}
+
+// NewResampler returns a resampler from audio with the given channels and
+// sample rate to mono audio at rate to.
+func NewResampler(channels, from, to int) *Resampler {
+	return &Resampler{channels: channels, step: float64(from) / float64(to)}
+}
+
+// Resample returns the output for the next chunk of interleaved input. Output
+// that depends on input still to come is held back until the next call.
+func (r *Resampler) Resample(chunk []int16) []int16 {
+	for i := 0; i+r.channels <= len(chunk); i += r.channels {
+		var sum int32
+		for ch := 0; ch < r.channels; ch++ {
+			sum += int32(chunk[i+ch])
+		}
+		r.pending = append(r.pending, sum/int32(r.channels))
+	}
+
+	var out []int16
+	for {
+		from := int(r.pos)
+		if r.step >= 1 {
+			// Average the input that falls into the output frame, as ForSpeech does.
+			to := int(r.pos + r.step)
+			if to > len(r.pending) || to == from {
+				break
+			}
+			var sum int64
+			for _, s := range r.pending[from:to] {
+				sum += int64(s)
+			}
+			out = append(out, int16(sum/int64(to-from)))
+		} else {
+			// Upsampling interpolates between neighbouring input frames.
+			if from+1 >= len(r.pending) {
+				break
+			}
+			frac := r.pos - float64(from)
+			s := float64(r.pending[from])*(1-frac) + float64(r.pending[from+1])*frac
+			out = append(out, int16(s))
+		}
+		r.pos += r.step
+	}
+
+	consumed := min(int(r.pos), len(r.pending))
+	r.pending = append(r.pending[:0], r.pending[consumed:]...)
+	r.pos -= float64(consumed)
+	return out
+}
@@ -0,0 +1,139 @@
+package record
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// WriteWAV writes the recording to w as a 16-bit PCM WAV stream.
+func (rec *Recording) WriteWAV(w io.Writer) error {
+	dataSize := uint32(2 * len(rec.Samples))
+	blockAlign := uint16(2 * rec.Channels)
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'}, 36 + dataSize, [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16),
+		uint16(1), // PCM
+		uint16(rec.Channels),
+		uint32(rec.SampleRate),
+		uint32(rec.SampleRate) * uint32(blockAlign), // bytes per second
+		blockAlign,
+		uint16(16), // bits per sample
+		[4]byte{'d', 'a', 't', 'a'}, dataSize,
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, v := range header {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	if err := binary.Write(bw, binary.LittleEndian, rec.Samples); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// WriteWAVFile writes the recording to filename as a 16-bit PCM WAV file.
+// A new file is only readable by the user, as recordings may be private.
+func (rec *Recording) WriteWAVFile(filename string) error {
+	outFile, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	if err := rec.WriteWAV(outFile); err != nil {
+		return err
+	}
+	return outFile.Close()
+}
+
+// ReadWAV reads a 16-bit PCM WAV stream, as written by WriteWAV and most
+// recorders. Chunks other than the format and the samples are skipped.
+func ReadWAV(r io.Reader) (*Recording, error) {
+	br := bufio.NewReader(r)
+	var riff struct {
+		ID   [4]byte
+		Size uint32
+		Form [4]byte
+	}
+	if err := binary.Read(br, binary.LittleEndian, &riff); err != nil {
+		return nil, fmt.Errorf("not a WAV file: %w", err)
+	}
+	if string(riff.ID[:]) != "RIFF" || string(riff.Form[:]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+
+	var rec *Recording
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(br, binary.LittleEndian, &chunk); err != nil {
+			return nil, fmt.Errorf("invalid WAV file: %w", err)
+		}
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			var format struct {
+				Tag           uint16
+				Channels      uint16
+				SampleRate    uint32
+				ByteRate      uint32
+				BlockAlign    uint16
+				BitsPerSample uint16
+			}
+			if chunk.Size < 16 {
+				return nil, errors.New("invalid WAV file: short format chunk")
+			}
+			if err := binary.Read(br, binary.LittleEndian, &format); err != nil {
+				return nil, fmt.Errorf("invalid WAV file: %w", err)
+			}
+			// 0xFFFE is WAVE_FORMAT_EXTENSIBLE, which also holds plain PCM.
+			if format.Tag != 1 && format.Tag != 0xFFFE || format.BitsPerSample != 16 || format.Channels == 0 {
+				return nil, fmt.Errorf("unsupported WAV encoding (format %#x, %d bits); only 16-bit PCM can be read", format.Tag, format.BitsPerSample)
+			}
+			rec = &Recording{Channels: int(format.Channels), SampleRate: int(format.SampleRate)}
+			if _, err := br.Discard(int(chunk.Size - 16 + chunk.Size%2)); err != nil {
+				return nil, fmt.Errorf("invalid WAV file: %w", err)
+			}
+		case "data":
+			if rec == nil {
+				return nil, errors.New("invalid WAV file: samples before the format")
+			}
+			// Recorders that stream set the size to 0 or the maximum, so read to the end then.
+			var data io.Reader = io.LimitReader(br, int64(chunk.Size))
+			if chunk.Size == 0 || chunk.Size == 0xFFFFFFFF {
+				data = br
+			}
+			buf, err := io.ReadAll(data)
+			if err != nil {
+				return nil, err
+			}
+			rec.Samples = make([]int16, len(buf)/2)
+			for i := range rec.Samples {
+				rec.Samples[i] = int16(binary.LittleEndian.Uint16(buf[2*i:]))
+			}
+			rec.Samples = rec.Samples[:len(rec.Samples)-len(rec.Samples)%rec.Channels]
+			return rec, nil
+		default:
+			if _, err := br.Discard(int(chunk.Size + chunk.Size%2)); err != nil {
+				return nil, fmt.Errorf("invalid WAV file: %w", err)
+			}
+		}
+	}
+}
+
+// ReadWAVFile reads the 16-bit PCM WAV file at filename.
+func ReadWAVFile(filename string) (*Recording, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadWAV(f)
+}
@@ -0,0 +1,106 @@
+// Package safety flags generated commands that could cause irreversible damage
+// so callers can ask for explicit confirmation before running them.
+package safety
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Level is how risky a command is considered to be.
+type Level int
+
+const (
+	// Safe commands can be run after the usual confirmation.
+	Safe Level = iota
+	// Caution commands modify the system in ways that are usually recoverable.
+	Caution
+	// Dangerous commands can destroy data or make the system unusable.
+	Dangerous
+)
+
+func (l Level) String() string {
+	switch l {
+	case Caution:
+		return "caution"
+	case Dangerous:
+		return "dangerous"
+	default:
+		return "safe"
+	}
+}
+
+// Verdict is the result of checking a command.
+type Verdict struct {
+	Level   Level
+	Reasons []string
+}
+
+type rule struct {
+	level  Level
+	re     *regexp.Regexp
+	reason string
+}
+
+var rules = []rule{
+	{Dangerous, regexp.MustCompile(`\brm\s+(-[a-zA-Z]*\s+)*(-[a-zA-Z]*[rR][a-zA-Z]*|--recursive)\b.*\s["']?(/|/\*|~|~/|\$HOME|\.)["']?(\s|$)`), "recursively deletes a root, home or current directory"},
+	{Dangerous, regexp.MustCompile(`--no-preserve-root`), "disables rm's protection of /"},
+	{Dangerous, regexp.MustCompile(`\bmkfs(\.\w+)?\b`), "formats a filesystem"},
+	{Dangerous, regexp.MustCompile(`\bdd\b.*\bof=/dev/`), "writes directly to a block device"},
+	{Dangerous, regexp.MustCompile(`>\s*/dev/(sd|nvme|hd|vd|mmcblk)`), "overwrites a block device"},
+	{Dangerous, regexp.MustCompile(`:\(\)\s*\{\s*:\|:&\s*\};:`), "is a fork bomb"},
+	{Dangerous, regexp.MustCompile(`\b(wipefs|shred)\b`), "irreversibly erases data"},
+	{Dangerous, regexp.MustCompile(`\bchmod\s+(-[a-zA-Z]*R[a-zA-Z]*\s+)\S*\s+/(\s|$)`), "changes permissions of the whole filesystem"},
+	{Dangerous, regexp.MustCompile(`\bchown\s+(-[a-zA-Z]*R[a-zA-Z]*\s+)\S*\s+/(\s|$)`), "changes ownership of the whole filesystem"},
+	{Dangerous, regexp.MustCompile(`\b(curl|wget)\b[^|]*\|\s*(sudo\s+)?(ba|z)?sh\b`), "pipes a downloaded script into a shell"},
+	{Caution, regexp.MustCompile(`\brm\b|\bfind\b.*\s-delete\b`), "deletes files"},
+	{Caution, regexp.MustCompile(`\bsudo\b`), "runs with root privileges"},
+	{Caution, regexp.MustCompile(`\b(shutdown|reboot|poweroff|halt)\b`), "shuts down or restarts the machine"},
+	{Caution, regexp.MustCompile(`\bkill(all)?\b|\bpkill\b`), "terminates processes"},
+	{Caution, regexp.MustCompile(`\bgit\s+(push\s+.*(--force|-f)\b|reset\s+--hard|clean\s+-[a-zA-Z]*f)`), "discards git history or working tree changes"},
+	{Caution, regexp.MustCompile(`(^|[^>])>\s*[^>&\s]`), "overwrites a file"},
+	{Caution, regexp.MustCompile(`\b(truncate|mv)\b`), "moves or truncates files"},
+}
+
+// devNull matches redirections to /dev/null, which never overwrite anything.
+var devNull = regexp.MustCompile(`[0-9&]?>>?\s*/dev/null`)
+
+// Check classifies command. The rules are heuristics over the command text;
+// a Safe verdict is not a guarantee.
+func Check(command string) Verdict {
+	var v Verdict
+	command = devNull.ReplaceAllString(strings.TrimSpace(command), "")
+	for _, r := range rules {
+		if !r.re.MatchString(command) {
+			continue
+		}
+		if r.level > v.Level {
+			v.Level = r.level
+		}
+		v.Reasons = append(v.Reasons, r.reason)
+	}
+	return v
+}
+
+// ParseLevel parses the name of a level, as returned by Level.String.
+func ParseLevel(name string) (Level, bool) {
+	for _, l := range []Level{Safe, Caution, Dangerous} {
+		if l.String() == name {
+			return l, true
+		}
+	}
+	return Safe, false
+}
+
+// Raise adds a second opinion, such as the model's own, to the verdict. It
+// can only make the verdict stricter.
+func (v Verdict) Raise(level Level, reason string) Verdict {
+	if level == Safe {
+		return v
+	}
+	if level > v.Level {
+		v.Level = level
+	}
+	v.Reasons = append(v.Reasons[:len(v.Reasons):len(v.Reasons)], reason)
+	return v
+}
@@ -0,0 +1,84 @@
+// Package speech turns text into spoken audio using an OpenAI-compatible
+// speech endpoint.
+package speech
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Defaults for the OpenAI speech API.
+const (
+	DefaultURL   = "https://api.openai.com/v1/audio/speech"
+	DefaultModel = "gpt-4o-mini-tts"
+	DefaultVoice = "alloy"
+)
+
+// Client sends text to a speech endpoint.
+type Client struct {
+	// URL is the full URL of the speech endpoint.
+	URL string
+	// Model and Voice are sent as the "model" and "voice" fields.
+	Model string
+	Voice string
+	// Header is added to every request, typically carrying the Authorization or api-key header.
+	Header http.Header
+	// HTTPClient is used to send requests; http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client for the OpenAI API authenticated with apiKey.
+func NewClient(apiKey string) *Client {
+	return &Client{
+		URL:    DefaultURL,
+		Model:  DefaultModel,
+		Voice:  DefaultVoice,
+		Header: http.Header{"Authorization": {"Bearer " + apiKey}},
+	}
+}
+
+type speechRequest struct {
+	Model          string `json:"model"`
+	Input          string `json:"input"`
+	Voice          string `json:"voice"`
+	ResponseFormat string `json:"response_format"`
+}
+
+// Speak returns text spoken, as WAV audio, which every player can play
+// without decoding anything first.
+func (c *Client) Speak(ctx context.Context, text string) ([]byte, error) {
+	body, err := json.Marshal(speechRequest{Model: c.Model, Input: text, Voice: c.Voice, ResponseFormat: "wav"})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.Header {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("non-200 status code: %d - %s", resp.StatusCode, string(responseBody))
+	}
+	return io.ReadAll(resp.Body)
+}
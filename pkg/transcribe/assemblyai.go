@@ -0,0 +1,88 @@
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Defaults for AssemblyAI's API.
+const (
+	DefaultAssemblyAIURL   = "https://api.assemblyai.com/v2"
+	DefaultAssemblyAIModel = "universal"
+)
+
+// assemblyAIPollInterval is how often a transcript is checked on. Short
+// recordings are done within a second or two.
+const assemblyAIPollInterval = 300 * time.Millisecond
+
+type assemblyAIRequest struct {
+	AudioURL          string   `json:"audio_url"`
+	SpeechModel       string   `json:"speech_model,omitempty"`
+	LanguageCode      string   `json:"language_code,omitempty"`
+	LanguageDetection bool     `json:"language_detection,omitempty"`
+	KeytermsPrompt    []string `json:"keyterms_prompt,omitempty"`
+}
+
+type assemblyAITranscript struct {
+	ID         string  `json:"id"`
+	Status     string  `json:"status"`
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence"`
+	Error      string  `json:"error"`
+}
+
+// transcribeAssemblyAI uploads audio, asks for it to be transcribed, and
+// waits for the transcript. AssemblyAI works out the format by itself.
+func (c *Client) transcribeAssemblyAI(ctx context.Context, audio []byte) (*Result, error) {
+	base := strings.TrimRight(c.URL, "/")
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+	}
+	if err := c.send(ctx, "POST", base+"/upload", "application/octet-stream", bytes.NewReader(audio), &upload); err != nil {
+		return nil, err
+	}
+
+	payload := assemblyAIRequest{
+		AudioURL:          upload.UploadURL,
+		SpeechModel:       c.Model,
+		LanguageCode:      c.Language,
+		LanguageDetection: c.Language == "",
+		KeytermsPrompt:    c.terms(),
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var t assemblyAITranscript
+	if err := c.send(ctx, "POST", base+"/transcript", "application/json", bytes.NewReader(body), &t); err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(assemblyAIPollInterval)
+	defer ticker.Stop()
+	for {
+		switch t.Status {
+		case "completed":
+			return &Result{Text: t.Text, Confidence: t.Confidence, HasConfidence: true}, nil
+		case "error":
+			return nil, fmt.Errorf("AssemblyAI failed to transcribe the audio: %s", t.Error)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+		if t.ID == "" {
+			return nil, errors.New("AssemblyAI returned a transcript without an ID")
+		}
+		if err := c.send(ctx, "GET", base+"/transcript/"+url.PathEscape(t.ID), "", nil, &t); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Defaults for Deepgram's pre-recorded audio API.
+const (
+	DefaultDeepgramURL   = "https://api.deepgram.com/v1/listen"
+	DefaultDeepgramModel = "nova-3"
+)
+
+type deepgramResponse struct {
+	Results struct {
+		Channels []struct {
+			Alternatives []struct {
+				Transcript string  `json:"transcript"`
+				Confidence float64 `json:"confidence"`
+			} `json:"alternatives"`
+		} `json:"channels"`
+	} `json:"results"`
+}
+
+// transcribeDeepgram sends audio as the body of the request, with the
+// settings in the query. Nova-3 models take the prompt's words as key terms,
+// older ones as keywords.
+func (c *Client) transcribeDeepgram(ctx context.Context, audio []byte, filename string) (*Result, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("model", c.Model)
+	q.Set("smart_format", "true")
+	if c.Language != "" {
+		q.Set("language", c.Language)
+	} else {
+		q.Set("detect_language", "true")
+	}
+	terms := "keywords"
+	if strings.HasPrefix(c.Model, "nova-3") {
+		terms = "keyterm"
+	}
+	for _, t := range c.terms() {
+		q.Add(terms, t)
+	}
+	u.RawQuery = q.Encode()
+
+	var resp deepgramResponse
+	if err := c.send(ctx, "POST", u.String(), audioType(filename), bytes.NewReader(audio), &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Results.Channels) == 0 || len(resp.Results.Channels[0].Alternatives) == 0 {
+		return &Result{}, nil
+	}
+	alt := resp.Results.Channels[0].Alternatives[0]
+	return &Result{Text: alt.Transcript, Confidence: alt.Confidence, HasConfidence: true}, nil
+}
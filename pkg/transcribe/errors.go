@@ -0,0 +1,50 @@
+package transcribe
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// StatusError is returned when the endpoint answers with a status other than
+// 200 OK, so callers can tell rate limits and server errors from other failures.
+type StatusError struct {
+	StatusCode int
+	// Message is the error message from the response body: error.message as
+	// OpenAI-compatible servers and Google put it, error as AssemblyAI does,
+	// err_msg as Deepgram does, or else the body itself.
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("non-200 status code: %d - %s", e.StatusCode, e.Message)
+}
+
+// RateLimited reports whether the request was turned away for going over a rate limit or quota.
+func (e *StatusError) RateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// newStatusError returns the error for a response with status code and body.
+func newStatusError(code int, body []byte) *StatusError {
+	var r struct {
+		Error  json.RawMessage `json:"error"`
+		ErrMsg string          `json:"err_msg"`
+	}
+	if err := json.Unmarshal(body, &r); err == nil {
+		var nested struct {
+			Message string `json:"message"`
+		}
+		var plain string
+		switch {
+		case json.Unmarshal(r.Error, &nested) == nil && nested.Message != "":
+			return &StatusError{StatusCode: code, Message: nested.Message}
+		case json.Unmarshal(r.Error, &plain) == nil && plain != "":
+			return &StatusError{StatusCode: code, Message: plain}
+		case r.ErrMsg != "":
+			return &StatusError{StatusCode: code, Message: r.ErrMsg}
+		}
+	}
+	return &StatusError{StatusCode: code, Message: strings.TrimSpace(string(body))}
+}
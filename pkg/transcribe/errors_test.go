@@ -0,0 +1,110 @@
+package transcribe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider Provider
+		status   int
+		header   http.Header
+		body     string
+		// message is the StatusError's message; empty if the error isn't one.
+		message     string
+		rateLimited bool
+	}{
+		{
+			name:    "openai error",
+			status:  http.StatusBadRequest,
+			body:    `{"error": {"message": "Invalid file format.", "type": "invalid_request_error"}}`,
+			message: "Invalid file format.",
+		},
+		{
+			name:     "google error",
+			provider: Google,
+			status:   http.StatusBadRequest,
+			body:     `{"error": {"code": 400, "message": "Sample rate mismatch", "status": "INVALID_ARGUMENT"}}`,
+			message:  "Sample rate mismatch",
+		},
+		{
+			name:     "assemblyai error",
+			provider: AssemblyAI,
+			status:   http.StatusUnauthorized,
+			body:     `{"error": "Authentication error, API token missing/invalid"}`,
+			message:  "Authentication error, API token missing/invalid",
+		},
+		{
+			name:     "deepgram error",
+			provider: Deepgram,
+			status:   http.StatusBadRequest,
+			body:     `{"err_code": "Bad Request", "err_msg": "Bad Request: failed to process audio: corrupt or unsupported data"}`,
+			message:  "Bad Request: failed to process audio: corrupt or unsupported data",
+		},
+		{
+			name:        "rate limited",
+			status:      http.StatusTooManyRequests,
+			header:      http.Header{"Retry-After": {"20"}},
+			body:        `{"error": {"message": "Rate limit reached for whisper-1"}}`,
+			message:     "Rate limit reached for whisper-1",
+			rateLimited: true,
+		},
+		{
+			name:    "not json",
+			status:  http.StatusServiceUnavailable,
+			body:    "upstream connect error\n",
+			message: "upstream connect error",
+		},
+		{
+			name:    "empty error",
+			status:  http.StatusInternalServerError,
+			body:    `{"error": ""}`,
+			message: `{"error": ""}`,
+		},
+		{
+			name:   "truncated answer",
+			status: http.StatusOK,
+			body:   `{"text": "list the`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for key, values := range tt.header {
+					w.Header()[key] = values
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+			c := &Client{Provider: tt.provider, URL: srv.URL, Model: "test-model"}
+			_, err := c.TranscribeResult(context.Background(), strings.NewReader(audio), "recording.flac")
+			if err == nil {
+				t.Fatal("TranscribeResult succeeded")
+			}
+			var status *StatusError
+			if !errors.As(err, &status) {
+				if tt.message != "" {
+					t.Fatalf("TranscribeResult error = %v, want a StatusError", err)
+				}
+				if !strings.Contains(err.Error(), "failed to decode") {
+					t.Errorf("TranscribeResult error = %v, want a decoding error", err)
+				}
+				return
+			}
+			if tt.message == "" {
+				t.Fatalf("TranscribeResult error = %v, want a decoding error", err)
+			}
+			if status.StatusCode != tt.status || status.Message != tt.message || status.RateLimited() != tt.rateLimited {
+				t.Errorf("StatusError = %+v (rate limited %v), want %d %q (rate limited %v)", *status, status.RateLimited(), tt.status, tt.message, tt.rateLimited)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+// Defaults for Google Cloud Speech-to-Text.
+const (
+	DefaultGoogleURL      = "https://speech.googleapis.com/v1/speech:recognize"
+	DefaultGoogleModel    = "latest_short"
+	DefaultGoogleLanguage = "en-US"
+	// GoogleMaxUploadSize keeps requests, where the audio is base64
+	// encoded, under the 10 MB Google accepts.
+	GoogleMaxUploadSize = 7_000_000
+)
+
+// GoogleFormats are the audio formats Google reads the sample rate of from
+// the audio itself.
+var GoogleFormats = []string{"flac", "wav"}
+
+// googleEncodings are what Google calls the formats in GoogleFormats.
+var googleEncodings = map[string]string{
+	".flac": "FLAC",
+	".wav":  "LINEAR16",
+}
+
+type googleRequest struct {
+	Config struct {
+		Encoding                   string                `json:"encoding,omitempty"`
+		LanguageCode               string                `json:"languageCode"`
+		Model                      string                `json:"model,omitempty"`
+		EnableAutomaticPunctuation bool                  `json:"enableAutomaticPunctuation"`
+		SpeechContexts             []googleSpeechContext `json:"speechContexts,omitempty"`
+	} `json:"config"`
+	Audio struct {
+		Content []byte `json:"content"`
+	} `json:"audio"`
+}
+
+// googleSpeechContext lists phrases the audio is likely to contain.
+type googleSpeechContext struct {
+	Phrases []string `json:"phrases"`
+}
+
+type googleResponse struct {
+	Results []struct {
+		Alternatives []struct {
+			Transcript string  `json:"transcript"`
+			Confidence float64 `json:"confidence"`
+		} `json:"alternatives"`
+	} `json:"results"`
+}
+
+// transcribeGoogle sends audio inline to the synchronous recognize method,
+// which takes up to a minute of it. Google doesn't detect the language, so it
+// is DefaultGoogleLanguage unless set.
+func (c *Client) transcribeGoogle(ctx context.Context, audio []byte, filename string) (*Result, error) {
+	var payload googleRequest
+	payload.Config.Encoding = googleEncodings[strings.ToLower(filepath.Ext(filename))]
+	payload.Config.LanguageCode = c.Language
+	if payload.Config.LanguageCode == "" {
+		payload.Config.LanguageCode = DefaultGoogleLanguage
+	}
+	payload.Config.Model = c.Model
+	payload.Config.EnableAutomaticPunctuation = true
+	if terms := c.terms(); len(terms) > 0 {
+		payload.Config.SpeechContexts = []googleSpeechContext{{Phrases: terms}}
+	}
+	payload.Audio.Content = audio
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp googleResponse
+	if err := c.send(ctx, "POST", c.URL, "application/json", bytes.NewReader(body), &resp); err != nil {
+		return nil, err
+	}
+	// Each result is a stretch of speech of its own, and is as sure as the
+	// least sure of them.
+	var parts []string
+	res := &Result{}
+	for _, r := range resp.Results {
+		if len(r.Alternatives) > 0 {
+			alt := r.Alternatives[0]
+			parts = append(parts, strings.TrimSpace(alt.Transcript))
+			if !res.HasConfidence || alt.Confidence < res.Confidence {
+				res.Confidence, res.HasConfidence = alt.Confidence, true
+			}
+		}
+	}
+	res.Text = strings.Join(parts, " ")
+	return res, nil
+}
@@ -0,0 +1,318 @@
+package transcribe
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Defaults for OpenAI's Realtime API in transcription mode.
+const (
+	DefaultRealtimeURL   = "wss://api.openai.com/v1/realtime?intent=transcription"
+	DefaultRealtimeModel = "gpt-4o-mini-transcribe"
+)
+
+// RealtimeSampleRate is the sample rate of the 16-bit mono PCM audio the
+// Realtime API takes.
+const RealtimeSampleRate = 24000
+
+// Realtime transcribes speech while it is being recorded, over a WebSocket
+// session with an endpoint that speaks OpenAI's Realtime API. The server
+// transcribes each stretch of speech as soon as the speaker pauses, so little
+// is left to do once the recording stops.
+type Realtime struct {
+	// URL is the ws:// or wss:// URL of the Realtime endpoint.
+	URL   string
+	Model string
+	// Prompt and Language work as they do for Client.
+	Prompt   string
+	Language string
+	// Header is sent with the opening handshake, typically carrying the
+	// Authorization or api-key header.
+	Header http.Header
+	// Proxy picks the proxy to connect through, like http.Transport.Proxy,
+	// e.g. http.ProxyFromEnvironment; none if nil. Only http:// proxies can
+	// be used for WebSocket connections.
+	Proxy func(*http.Request) (*url.URL, error)
+	// DialContext opens the TCP connection, to the endpoint or the proxy,
+	// like http.Transport.DialContext; a net.Dialer's if nil.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Session is a transcription in progress. Audio is sent in the background, so
+// Append never blocks the recording.
+type Session struct {
+	cancel context.CancelFunc
+	// done is closed once the connection is closed.
+	done chan struct{}
+	// wake tells the sender there is audio or a commit to send; changed tells
+	// Finish the state has changed.
+	wake, changed chan struct{}
+
+	mu    sync.Mutex
+	queue []byte
+	// finishing is set by Finish; the sender then commits the rest of the
+	// audio and sets committed. The server answers with committedAck.
+	finishing, committed, committedAck bool
+	// items are the stretches of speech the server transcribes, in order.
+	items []*realtimeItem
+	err   error
+}
+
+type realtimeItem struct {
+	id        string
+	text      string
+	completed bool
+}
+
+// realtimeEvent is the part of a server event the session needs.
+type realtimeEvent struct {
+	Type       string `json:"type"`
+	ItemID     string `json:"item_id"`
+	Delta      string `json:"delta"`
+	Transcript string `json:"transcript"`
+	Error      *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Start opens a session. It returns at once; the connection is made in the
+// background, and a failure to connect is returned by Finish.
+func (r *Realtime) Start(ctx context.Context) *Session {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Session{
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+		changed: make(chan struct{}, 1),
+	}
+	go s.run(ctx, r)
+	return s
+}
+
+// Append queues samples, 16-bit mono PCM at RealtimeSampleRate, to be sent.
+func (s *Session) Append(samples []int16) {
+	s.mu.Lock()
+	for _, v := range samples {
+		s.queue = binary.LittleEndian.AppendUint16(s.queue, uint16(v))
+	}
+	s.mu.Unlock()
+	signal(s.wake)
+}
+
+// Text returns what has been transcribed so far, including the stretch of
+// speech being transcribed right now.
+func (s *Session) Text() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.textLocked()
+}
+
+func (s *Session) textLocked() string {
+	var parts []string
+	for _, it := range s.items {
+		if t := strings.TrimSpace(it.text); t != "" {
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Finish sends the rest of the audio, waits until all of it is transcribed,
+// closes the session and returns the transcript.
+func (s *Session) Finish(ctx context.Context) (string, error) {
+	defer s.Close()
+	s.mu.Lock()
+	s.finishing = true
+	s.mu.Unlock()
+	signal(s.wake)
+
+	for {
+		s.mu.Lock()
+		err, finished := s.err, s.committedAck
+		for _, it := range s.items {
+			finished = finished && it.completed
+		}
+		text := s.textLocked()
+		s.mu.Unlock()
+		switch {
+		case err != nil:
+			return "", err
+		case finished:
+			return text, nil
+		}
+		select {
+		case <-s.changed:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// Close ends the session, without waiting for transcripts still to come.
+func (s *Session) Close() {
+	s.cancel()
+	<-s.done
+}
+
+// fail records the first error; later ones are usually its consequences.
+func (s *Session) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+	signal(s.changed)
+}
+
+func (s *Session) run(ctx context.Context, r *Realtime) {
+	defer close(s.done)
+	conn, err := dialWebSocket(ctx, r.URL, r.Header, r.Proxy, r.DialContext)
+	if err != nil {
+		s.fail(fmt.Errorf("failed to connect to %s: %w", r.URL, err))
+		return
+	}
+	// Closing the connection also ends the reader below.
+	defer conn.Close()
+	context.AfterFunc(ctx, func() { conn.Close() })
+
+	transcription := map[string]string{"model": r.Model}
+	if r.Prompt != "" {
+		transcription["prompt"] = r.Prompt
+	}
+	if r.Language != "" {
+		transcription["language"] = r.Language
+	}
+	update := map[string]any{
+		"type": "session.update",
+		"session": map[string]any{
+			"type": "transcription",
+			"audio": map[string]any{
+				"input": map[string]any{
+					"format":        map[string]any{"type": "audio/pcm", "rate": RealtimeSampleRate},
+					"transcription": transcription,
+					// The server commits each stretch of speech when the speaker pauses.
+					"turn_detection": map[string]string{"type": "server_vad"},
+				},
+			},
+		},
+	}
+	if err := s.send(conn, update); err != nil {
+		s.fail(err)
+		return
+	}
+
+	go s.read(conn)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		}
+		s.mu.Lock()
+		audio := s.queue
+		s.queue = nil
+		commit := s.finishing && !s.committed
+		s.mu.Unlock()
+
+		if len(audio) > 0 {
+			if err := s.send(conn, map[string]string{"type": "input_audio_buffer.append", "audio": base64.StdEncoding.EncodeToString(audio)}); err != nil {
+				s.fail(err)
+				return
+			}
+		}
+		if commit {
+			s.mu.Lock()
+			s.committed = true
+			s.mu.Unlock()
+			if err := s.send(conn, map[string]string{"type": "input_audio_buffer.commit"}); err != nil {
+				s.fail(err)
+				return
+			}
+		}
+	}
+}
+
+func (s *Session) send(conn *wsConn, event any) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return conn.WriteText(data)
+}
+
+// read handles server events until the connection is closed.
+func (s *Session) read(conn *wsConn) {
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			s.fail(fmt.Errorf("the transcription session ended: %w", err))
+			return
+		}
+		var ev realtimeEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			continue
+		}
+		s.mu.Lock()
+		switch ev.Type {
+		case "input_audio_buffer.committed":
+			s.item(ev.ItemID)
+			if s.committed {
+				s.committedAck = true
+			}
+		case "conversation.item.input_audio_transcription.delta":
+			if it := s.item(ev.ItemID); !it.completed {
+				it.text += ev.Delta
+			}
+		case "conversation.item.input_audio_transcription.completed":
+			it := s.item(ev.ItemID)
+			it.text, it.completed = ev.Transcript, true
+		case "conversation.item.input_audio_transcription.failed", "error":
+			// Committing after the server has committed everything is not
+			// a failure; there was just nothing left.
+			if ev.Error != nil && ev.Error.Code == "input_audio_buffer_commit_empty" && s.committed {
+				s.committedAck = true
+			} else if s.err == nil {
+				s.err = realtimeError(ev)
+			}
+		}
+		s.mu.Unlock()
+		signal(s.changed)
+	}
+}
+
+// item returns the item with the given ID, adding it if it is new.
+func (s *Session) item(id string) *realtimeItem {
+	for _, it := range s.items {
+		if it.id == id {
+			return it
+		}
+	}
+	it := &realtimeItem{id: id}
+	s.items = append(s.items, it)
+	return it
+}
+
+func realtimeError(ev realtimeEvent) error {
+	if ev.Error == nil || ev.Error.Message == "" {
+		return errors.New("transcription failed")
+	}
+	return fmt.Errorf("transcription failed: %s", ev.Error.Message)
+}
+
+// signal wakes whoever waits on c, unless it is already due to wake.
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
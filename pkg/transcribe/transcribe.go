@@ -0,0 +1,355 @@
+// Package transcribe converts recorded speech to text using an
+// OpenAI-compatible audio transcription endpoint, the APIs of Deepgram,
+// AssemblyAI or Google Speech-to-Text, or a self-hosted whisper-asr-webservice.
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Provider is a speech-to-text API.
+type Provider string
+
+// Providers.
+const (
+	OpenAI     Provider = "openai"
+	Deepgram   Provider = "deepgram"
+	AssemblyAI Provider = "assemblyai"
+	Google     Provider = "google"
+	// WhisperASR is whisper-asr-webservice, which runs Whisper on its own
+	// server with faster-whisper or whisperX; the model is picked there.
+	WhisperASR Provider = "whisper-asr"
+)
+
+// Defaults for the OpenAI transcription API.
+const (
+	DefaultURL   = "https://api.openai.com/v1/audio/transcriptions"
+	DefaultModel = "whisper-1"
+)
+
+// DefaultTranslationURL is OpenAI's endpoint that transcribes speech in any
+// language into English. It takes the same requests as the transcription
+// endpoint, except for the language field.
+const DefaultTranslationURL = "https://api.openai.com/v1/audio/translations"
+
+// OpenAIMaxUploadSize is the largest audio file the OpenAI API accepts.
+const OpenAIMaxUploadSize = 25_000_000
+
+// DefaultFormats are the audio formats OpenAI-compatible endpoints accept, most preferred first.
+var DefaultFormats = []string{"flac", "opus", "wav"}
+
+// DefaultModelFor returns the model used with provider when none is configured.
+func DefaultModelFor(provider Provider) string {
+	switch provider {
+	case Deepgram:
+		return DefaultDeepgramModel
+	case AssemblyAI:
+		return DefaultAssemblyAIModel
+	case Google:
+		return DefaultGoogleModel
+	default:
+		return DefaultModel
+	}
+}
+
+// DefaultURLFor returns the URL of provider's API: its transcription
+// endpoint, or for AssemblyAI its base URL.
+func DefaultURLFor(provider Provider) string {
+	switch provider {
+	case Deepgram:
+		return DefaultDeepgramURL
+	case AssemblyAI:
+		return DefaultAssemblyAIURL
+	case Google:
+		return DefaultGoogleURL
+	default:
+		return DefaultURL
+	}
+}
+
+// Client sends audio to a transcription endpoint.
+type Client struct {
+	// Provider selects the API; OpenAI if empty.
+	Provider Provider
+	// URL is the full URL of the transcription endpoint, or of the
+	// translation endpoint to get English text whatever the spoken language.
+	// For AssemblyAI it is the base URL of the API, and for WhisperASR the
+	// URL of its /asr endpoint, with task=translate for English text.
+	URL string
+	// Model is sent as the "model" form field.
+	Model string
+	// Prompt, if set, is sent as the "prompt" form field. Whisper treats it as
+	// preceding text, so listing expected words makes them easier to recognize.
+	// The other providers take the comma separated words in it as terms to
+	// listen for.
+	Prompt string
+	// Language, if set, is sent as the "language" form field: the ISO-639-1
+	// code of the spoken language, which otherwise is detected from the audio.
+	// Translation endpoints don't take it.
+	Language string
+	// Formats lists the audio formats the endpoint accepts, most preferred
+	// first; DefaultFormats if empty.
+	Formats []string
+	// MaxUploadSize, if set, rejects larger audio before it is uploaded,
+	// rather than leaving it to the server to fail the request.
+	MaxUploadSize int64
+	// Header is added to every request, typically carrying the Authorization or api-key header.
+	Header http.Header
+	// HTTPClient is used to send requests; http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// Confidence asks for how sure the provider is of the transcript, which
+	// TranscribeResult reports. From OpenAI-compatible endpoints this takes
+	// verbose_json from Whisper models and token logprobs from the others.
+	Confidence bool
+}
+
+// Result is a transcript along with how sure the provider is of it.
+type Result struct {
+	Text string
+	// Confidence is between 0 and 1, and only set if HasConfidence: not
+	// every provider or model reports one.
+	Confidence    float64
+	HasConfidence bool
+}
+
+// AcceptedFormats returns the audio formats the endpoint accepts, most preferred first.
+func (c *Client) AcceptedFormats() []string {
+	if len(c.Formats) > 0 {
+		return c.Formats
+	}
+	if c.Provider == Google {
+		return GoogleFormats
+	}
+	return DefaultFormats
+}
+
+// NewClient returns a client for the OpenAI API authenticated with apiKey.
+func NewClient(apiKey string) *Client {
+	return &Client{
+		URL:           DefaultURL,
+		Model:         DefaultModel,
+		MaxUploadSize: OpenAIMaxUploadSize,
+		Header:        http.Header{"Authorization": {"Bearer " + apiKey}},
+	}
+}
+
+// transcriptionResponse is a partial structure for the Whisper transcription
+// response. Segments come with verbose_json, Logprobs with include[]=logprobs.
+type transcriptionResponse struct {
+	Text     string `json:"text"`
+	Segments []struct {
+		Start        float64 `json:"start"`
+		End          float64 `json:"end"`
+		AvgLogprob   float64 `json:"avg_logprob"`
+		NoSpeechProb float64 `json:"no_speech_prob"`
+	} `json:"segments"`
+	Logprobs []struct {
+		Logprob float64 `json:"logprob"`
+	} `json:"logprobs"`
+}
+
+// confidence works out how sure the model is of the transcript: from the
+// segments, the probability of their tokens weighted by how long they are and
+// by how likely they are to be speech at all; from the logprobs, the mean
+// probability of a token.
+func (t *transcriptionResponse) confidence() (float64, bool) {
+	if len(t.Segments) > 0 {
+		var sum, total float64
+		for _, s := range t.Segments {
+			d := max(s.End-s.Start, 0.01)
+			sum += d * math.Exp(s.AvgLogprob) * (1 - s.NoSpeechProb)
+			total += d
+		}
+		return sum / total, true
+	}
+	if len(t.Logprobs) > 0 {
+		var sum float64
+		for _, l := range t.Logprobs {
+			sum += l.Logprob
+		}
+		return math.Exp(sum / float64(len(t.Logprobs))), true
+	}
+	return 0, false
+}
+
+// TranscribeFile uploads the audio file at path and returns its transcript.
+func (c *Client) TranscribeFile(ctx context.Context, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return c.Transcribe(ctx, file, filepath.Base(path))
+}
+
+// Transcribe uploads the audio read from r and returns its transcript. The
+// extension of filename tells the server which format the audio is in.
+func (c *Client) Transcribe(ctx context.Context, r io.Reader, filename string) (string, error) {
+	res, err := c.TranscribeResult(ctx, r, filename)
+	if err != nil {
+		return "", err
+	}
+	return res.Text, nil
+}
+
+// TranscribeResult is Transcribe, also reporting how sure the provider is of
+// the transcript if Confidence is set and the provider says.
+func (c *Client) TranscribeResult(ctx context.Context, r io.Reader, filename string) (*Result, error) {
+	audio, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if size := int64(len(audio)); c.MaxUploadSize > 0 && size > c.MaxUploadSize {
+		return nil, fmt.Errorf("audio is %.1f MB, more than the %.0f MB the transcription endpoint accepts", float64(size)/1e6, float64(c.MaxUploadSize)/1e6)
+	}
+	switch c.Provider {
+	case "", OpenAI:
+		return c.transcribeOpenAI(ctx, audio, filename)
+	case Deepgram:
+		return c.transcribeDeepgram(ctx, audio, filename)
+	case AssemblyAI:
+		return c.transcribeAssemblyAI(ctx, audio)
+	case Google:
+		return c.transcribeGoogle(ctx, audio, filename)
+	case WhisperASR:
+		return c.transcribeWhisperASR(ctx, audio, filename)
+	default:
+		return nil, fmt.Errorf("unknown transcription provider %q", c.Provider)
+	}
+}
+
+// transcribeOpenAI sends audio as a multipart form to an OpenAI-compatible endpoint.
+func (c *Client) transcribeOpenAI(ctx context.Context, audio []byte, filename string) (*Result, error) {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+
+	fw, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(audio); err != nil {
+		return nil, err
+	}
+
+	if err := w.WriteField("model", c.Model); err != nil {
+		return nil, err
+	}
+	if c.Prompt != "" {
+		if err := w.WriteField("prompt", c.Prompt); err != nil {
+			return nil, err
+		}
+	}
+	if c.Language != "" {
+		if err := w.WriteField("language", c.Language); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Confidence {
+		// Whisper models, and the local servers that run them, score their
+		// segments; the GPT transcription models only their tokens.
+		field, value := "response_format", "verbose_json"
+		if strings.HasPrefix(c.Model, "gpt-") {
+			field, value = "include[]", "logprobs"
+		}
+		if err := w.WriteField(field, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	var transcription transcriptionResponse
+	if err := c.send(ctx, "POST", c.URL, w.FormDataContentType(), &b, &transcription); err != nil {
+		return nil, err
+	}
+	res := &Result{Text: transcription.Text}
+	res.Confidence, res.HasConfidence = transcription.confidence()
+	return res, nil
+}
+
+// send makes a request with the client's headers and decodes the JSON
+// response into out.
+func (c *Client) send(ctx context.Context, method, url, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	for key, values := range c.Header {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return newStatusError(resp.StatusCode, responseBody)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode the transcription: %w", err)
+	}
+	return nil
+}
+
+// terms returns the words listed in the prompt, for the providers that take
+// them as a list.
+func (c *Client) terms() []string {
+	var terms []string
+	for _, t := range strings.Split(c.Prompt, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// audioTypes are the MIME types of the audio formats, by file extension.
+var audioTypes = map[string]string{
+	".flac": "audio/flac",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".mp3":  "audio/mpeg",
+	".mpga": "audio/mpeg",
+	".mpeg": "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".mp4":  "audio/mp4",
+	".webm": "audio/webm",
+}
+
+// audioType returns the MIME type of the audio in filename, by its extension.
+func audioType(filename string) string {
+	if t, ok := audioTypes[strings.ToLower(filepath.Ext(filename))]; ok {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,200 @@
+package transcribe
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// audio stands in for a recording; the servers only check it arrives intact.
+const audio = "fLaC fake audio"
+
+func TestTranscribeResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		client Client
+		// path is added to the server's URL to make the client's.
+		path    string
+		handler func(t *testing.T, w http.ResponseWriter, r *http.Request)
+		want    Result
+	}{
+		{
+			name:   "openai",
+			client: Client{Provider: OpenAI, Model: "whisper-1", Prompt: "kubectl, grep", Language: "en"},
+			path:   "/v1/audio/transcriptions",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				checkForm(t, r, "file", map[string]string{"model": "whisper-1", "prompt": "kubectl, grep", "language": "en"})
+				io.WriteString(w, `{"text": "list the pods"}`)
+			},
+			want: Result{Text: "list the pods"},
+		},
+		{
+			name:   "openai with confidence",
+			client: Client{Provider: OpenAI, Model: "whisper-1", Confidence: true},
+			path:   "/v1/audio/transcriptions",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				checkForm(t, r, "file", map[string]string{"response_format": "verbose_json"})
+				io.WriteString(w, `{"text": "list the pods", "segments": [{"start": 0, "end": 2, "avg_logprob": 0, "no_speech_prob": 0}]}`)
+			},
+			want: Result{Text: "list the pods", Confidence: 1, HasConfidence: true},
+		},
+		{
+			name:   "deepgram",
+			client: Client{Provider: Deepgram, Model: "nova-3", Prompt: "kubectl, grep"},
+			path:   "/v1/listen",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				q := r.URL.Query()
+				if q.Get("model") != "nova-3" || q.Get("detect_language") != "true" || strings.Join(q["keyterm"], ",") != "kubectl,grep" {
+					t.Errorf("query = %s", r.URL.RawQuery)
+				}
+				checkBody(t, r)
+				io.WriteString(w, `{"results": {"channels": [{"alternatives": [{"transcript": "list the pods", "confidence": 0.9}]}]}}`)
+			},
+			want: Result{Text: "list the pods", Confidence: 0.9, HasConfidence: true},
+		},
+		{
+			name:   "deepgram without speech",
+			client: Client{Provider: Deepgram, Model: "nova-2", Language: "de"},
+			path:   "/v1/listen",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				if q := r.URL.Query(); q.Get("language") != "de" || q.Has("detect_language") {
+					t.Errorf("query = %s", r.URL.RawQuery)
+				}
+				io.WriteString(w, `{"results": {"channels": []}}`)
+			},
+			want: Result{},
+		},
+		{
+			name:   "assemblyai",
+			client: Client{Provider: AssemblyAI, Model: "universal", Prompt: "kubectl"},
+			path:   "/v2",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v2/upload":
+					checkBody(t, r)
+					io.WriteString(w, `{"upload_url": "https://cdn.example/audio"}`)
+				case "/v2/transcript":
+					var req assemblyAIRequest
+					json.NewDecoder(r.Body).Decode(&req)
+					if req.AudioURL != "https://cdn.example/audio" || req.SpeechModel != "universal" || !req.LanguageDetection || len(req.KeytermsPrompt) != 1 {
+						t.Errorf("transcript request = %+v", req)
+					}
+					io.WriteString(w, `{"id": "t1", "status": "queued"}`)
+				case "/v2/transcript/t1":
+					io.WriteString(w, `{"id": "t1", "status": "completed", "text": "list the pods", "confidence": 0.8}`)
+				default:
+					t.Errorf("unexpected request to %s", r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			},
+			want: Result{Text: "list the pods", Confidence: 0.8, HasConfidence: true},
+		},
+		{
+			name:   "google",
+			client: Client{Provider: Google, Model: "latest_short", Prompt: "kubectl"},
+			path:   "/v1/speech:recognize",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				var req googleRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatal(err)
+				}
+				if string(req.Audio.Content) != audio || req.Config.Encoding != "FLAC" || req.Config.LanguageCode != DefaultGoogleLanguage || req.Config.Model != "latest_short" {
+					t.Errorf("recognize request = %+v", req.Config)
+				}
+				io.WriteString(w, `{"results": [{"alternatives": [{"transcript": "list the", "confidence": 0.9}]}, {"alternatives": [{"transcript": " pods", "confidence": 0.7}]}]}`)
+			},
+			want: Result{Text: "list the pods", Confidence: 0.7, HasConfidence: true},
+		},
+		{
+			name:   "whisper-asr",
+			client: Client{Provider: WhisperASR, Prompt: "kubectl", Language: "en"},
+			path:   "/asr",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				q := r.URL.Query()
+				if q.Get("task") != "transcribe" || q.Get("output") != "json" || q.Get("language") != "en" || q.Get("initial_prompt") != "kubectl" {
+					t.Errorf("query = %s", r.URL.RawQuery)
+				}
+				checkForm(t, r, "audio_file", nil)
+				io.WriteString(w, `{"text": "list the pods", "segments": [{"start": 0, "end": 1, "avg_logprob": 0, "no_speech_prob": 0.5}]}`)
+			},
+			want: Result{Text: "list the pods", Confidence: 0.5, HasConfidence: true},
+		},
+		{
+			name:   "whisper-asr without scores",
+			client: Client{Provider: WhisperASR},
+			path:   "/asr?task=translate",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				if task := r.URL.Query().Get("task"); task != "translate" {
+					t.Errorf("task = %q, want translate", task)
+				}
+				io.WriteString(w, `{"text": "list the pods", "segments": [{"start": 0, "end": 1}]}`)
+			},
+			want: Result{Text: "list the pods"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Bearer key" {
+					t.Errorf("Authorization = %q", got)
+				}
+				tt.handler(t, w, r)
+			}))
+			defer srv.Close()
+			c := tt.client
+			c.URL = srv.URL + tt.path
+			c.Header = http.Header{"Authorization": {"Bearer key"}}
+			res, err := c.TranscribeResult(context.Background(), strings.NewReader(audio), "recording.flac")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *res != tt.want {
+				t.Errorf("TranscribeResult = %+v, want %+v", *res, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranscribeResultTooLarge(t *testing.T) {
+	c := Client{URL: "http://127.0.0.1:1/", MaxUploadSize: 4}
+	if _, err := c.TranscribeResult(context.Background(), strings.NewReader(audio), "recording.flac"); err == nil {
+		t.Error("TranscribeResult of audio over MaxUploadSize succeeded")
+	}
+}
+
+// checkForm checks r is a multipart form with the audio in file and the
+// given fields.
+func checkForm(t *testing.T, r *http.Request, file string, fields map[string]string) {
+	t.Helper()
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	f, _, err := r.FormFile(file)
+	if err != nil {
+		t.Fatalf("no %s in the form: %v", file, err)
+	}
+	defer f.Close()
+	if data, _ := io.ReadAll(f); string(data) != audio {
+		t.Errorf("%s = %q, want %q", file, data, audio)
+	}
+	for name, want := range fields {
+		if got := r.FormValue(name); got != want {
+			t.Errorf("form field %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// checkBody checks the audio is the body of r.
+func checkBody(t *testing.T, r *http.Request) {
+	t.Helper()
+	if data, _ := io.ReadAll(r.Body); string(data) != audio {
+		t.Errorf("body = %q, want %q", data, audio)
+	}
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "audio/") && ct != "application/octet-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
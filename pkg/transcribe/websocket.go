@@ -0,0 +1,313 @@
+package transcribe
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// WebSocket opcodes, RFC 6455 section 5.2.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// wsMaxMessage bounds the size of a message read from the server. Realtime
+// events are small; only a broken or hostile server sends more.
+const wsMaxMessage = 4 << 20
+
+// wsConn is the client end of a WebSocket connection: just enough of RFC 6455
+// for JSON events, without extensions or subprotocols.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	writeMu sync.Mutex
+}
+
+// dialWebSocket opens a WebSocket connection to the ws:// or wss:// URL,
+// sending header with the opening handshake, through the proxy that proxy
+// picks, if any. The connection is opened with dial, or a net.Dialer if nil.
+func dialWebSocket(ctx context.Context, rawURL string, header http.Header, proxy func(*http.Request) (*url.URL, error),
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)) (*wsConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	port := u.Port()
+	switch u.Scheme {
+	case "ws":
+		if port == "" {
+			port = "80"
+		}
+	case "wss":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported WebSocket URL %s: expected ws:// or wss://", rawURL)
+	}
+
+	addr := net.JoinHostPort(u.Hostname(), port)
+	var proxyURL *url.URL
+	if proxy != nil {
+		// The proxy is chosen as for the HTTP request the handshake is.
+		target := *u
+		target.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+		if proxyURL, err = proxy(&http.Request{URL: &target}); err != nil {
+			return nil, err
+		}
+	}
+	dialAddr := addr
+	if proxyURL != nil {
+		if proxyURL.Scheme != "http" {
+			return nil, fmt.Errorf("unsupported proxy %s for WebSocket connections: only http:// proxies are", proxyURL.Redacted())
+		}
+		dialAddr = proxyURL.Host
+		if proxyURL.Port() == "" {
+			dialAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
+		}
+	}
+
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, "tcp", dialAddr)
+	if err != nil {
+		return nil, err
+	}
+	// Abort the handshake when ctx is done.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if proxyURL != nil {
+		if err := connectTunnel(conn, addr, proxyURL); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if u.Scheme == "wss" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header.Clone(),
+	}
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		conn.Close()
+		return nil, fmt.Errorf("the server refused the WebSocket connection: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	sum := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		conn.Close()
+		return nil, errors.New("the server answered the WebSocket handshake wrongly")
+	}
+	if ctx.Err() != nil {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	return &wsConn{conn: conn, r: r}, nil
+}
+
+// connectTunnel asks the HTTP proxy at the other end of conn to connect it to
+// addr, with the credentials in the proxy's URL if it has any.
+func connectTunnel(conn net.Conn, addr string, proxy *url.URL) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := proxy.User; user != nil {
+		password, _ := user.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)))
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	// The server only speaks once the TLS or WebSocket handshake starts, so
+	// nothing past the response is read here.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the proxy %s refused to connect to %s: %s", proxy.Redacted(), addr, resp.Status)
+	}
+	return nil
+}
+
+// writeFrame sends a single, final frame. Frames from clients must be masked.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = 0x80 | byte(n)
+	case n <= 0xFFFF:
+		header[1] = 0x80 | 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 0x80 | 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	header = append(header, mask[:]...)
+	masked := make([]byte, len(payload))
+	for i, b := range payload {
+		masked[i] = b ^ mask[i%4]
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(append(header, masked...))
+	return err
+}
+
+// WriteText sends a text message.
+func (c *wsConn) WriteText(data []byte) error {
+	return c.writeFrame(wsText, data)
+}
+
+// ReadMessage returns the next text or binary message, answering pings on the
+// way. It returns io.EOF once the server closes the connection.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	// started is set once the first frame of a fragmented message is read.
+	started := false
+	for {
+		var head [2]byte
+		if _, err := io.ReadFull(c.r, head[:]); err != nil {
+			return nil, err
+		}
+		fin, opcode := head[0]&0x80 != 0, head[0]&0x0F
+		// The RSV bits mean something only to extensions, and none were
+		// negotiated.
+		if head[0]&0x70 != 0 {
+			return nil, errors.New("WebSocket frame with reserved bits set")
+		}
+		n := uint64(head[1] & 0x7F)
+		switch n {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+				return nil, err
+			}
+			n = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+				return nil, err
+			}
+			n = binary.BigEndian.Uint64(ext[:])
+		}
+		// Control frames come whole and small, so they can be answered in
+		// the middle of a fragmented message.
+		if opcode&0x8 != 0 && (!fin || n > 125) {
+			return nil, fmt.Errorf("malformed WebSocket control frame %#x", opcode)
+		}
+		var mask []byte
+		if head[1]&0x80 != 0 {
+			mask = make([]byte, 4)
+			if _, err := io.ReadFull(c.r, mask); err != nil {
+				return nil, err
+			}
+		}
+		if n > wsMaxMessage || uint64(len(message))+n > wsMaxMessage {
+			return nil, fmt.Errorf("WebSocket message larger than %d bytes", wsMaxMessage)
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(c.r, payload); err != nil {
+			return nil, err
+		}
+		if mask != nil {
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+		}
+
+		switch opcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+		case wsPong:
+		case wsClose:
+			c.writeFrame(wsClose, payload)
+			return nil, io.EOF
+		case wsText, wsBinary, wsContinuation:
+			if started != (opcode == wsContinuation) {
+				return nil, errors.New("WebSocket message fragmented out of order")
+			}
+			started = true
+			message = append(message, payload...)
+			if fin {
+				return message, nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown WebSocket opcode %#x", opcode)
+		}
+	}
+}
+
+// Close says goodbye to the server and closes the connection.
+func (c *wsConn) Close() error {
+	// 1000 is a normal closure.
+	c.writeFrame(wsClose, []byte{0x03, 0xE8})
+	return c.conn.Close()
+}
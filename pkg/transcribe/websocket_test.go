@@ -0,0 +1,297 @@
+package transcribe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsAccept returns the Sec-WebSocket-Accept a server answers key with.
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// wsServer starts a WebSocket server that answers the handshake with accept,
+// given the client's key, and then hands the connection to serve. It is
+// closed, and serve waited for, when the test ends.
+func wsServer(t *testing.T, accept func(key string) string, serve func(t *testing.T, rw *bufio.ReadWriter)) string {
+	t.Helper()
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		if r.Header.Get("Upgrade") != "websocket" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+			t.Errorf("handshake headers = %v", r.Header)
+		}
+		key := r.Header.Get("Sec-WebSocket-Key")
+		if nonce, err := base64.StdEncoding.DecodeString(key); err != nil || len(nonce) != 16 {
+			t.Errorf("Sec-WebSocket-Key = %q, want 16 random bytes", key)
+		}
+		w.Header().Set("Upgrade", "websocket")
+		w.Header().Set("Connection", "Upgrade")
+		w.Header().Set("Sec-WebSocket-Accept", accept(key))
+		w.WriteHeader(http.StatusSwitchingProtocols)
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if serve != nil {
+			serve(t, rw)
+		}
+	}))
+	t.Cleanup(func() {
+		srv.Close()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Error("the server didn't finish")
+		}
+	})
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// writeServerFrame sends a frame with the first byte head, unmasked as frames
+// from servers are.
+func writeServerFrame(t *testing.T, rw *bufio.ReadWriter, head byte, payload []byte) {
+	t.Helper()
+	frame := []byte{head}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = binary.BigEndian.AppendUint16(append(frame, 126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 127), uint64(n))
+	}
+	rw.Write(append(frame, payload...))
+	if err := rw.Flush(); err != nil {
+		t.Error(err)
+	}
+}
+
+// readClientFrame reads a frame from the client, which must be final and
+// masked, and returns its opcode and unmasked payload.
+func readClientFrame(t *testing.T, rw *bufio.ReadWriter) (byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(rw, head[:]); err != nil {
+		t.Errorf("reading a frame: %v", err)
+		return 0, nil
+	}
+	if head[0]&0x80 == 0 || head[1]&0x80 == 0 {
+		t.Errorf("frame header %#x %#x isn't final and masked", head[0], head[1])
+	}
+	n := int(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(rw, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(rw, ext[:])
+		n = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	var mask [4]byte
+	io.ReadFull(rw, mask[:])
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(rw, payload); err != nil {
+		t.Errorf("reading a frame: %v", err)
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return head[0] & 0x0F, payload
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept func(key string) string
+		ok     bool
+	}{
+		{"accepted", wsAccept, true},
+		{"wrong accept", func(key string) string { return wsAccept(key + "x") }, false},
+		{"no accept", func(string) string { return "" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := wsServer(t, tt.accept, nil)
+			c, err := dialWebSocket(context.Background(), url, nil, nil, nil)
+			if (err == nil) != tt.ok {
+				t.Fatalf("dialWebSocket = %v, want success %v", err, tt.ok)
+			}
+			if c != nil {
+				c.conn.Close()
+			}
+		})
+	}
+}
+
+func TestWebSocketWrite(t *testing.T) {
+	long := strings.Repeat("x", 70000)
+	url := wsServer(t, wsAccept, func(t *testing.T, rw *bufio.ReadWriter) {
+		for _, want := range []string{`{"type":"ping"}`, long} {
+			if opcode, payload := readClientFrame(t, rw); opcode != wsText || string(payload) != want {
+				t.Errorf("got frame %#x of %d bytes, want text of %d bytes", opcode, len(payload), len(want))
+			}
+		}
+		if opcode, payload := readClientFrame(t, rw); opcode != wsClose || !bytes.Equal(payload, []byte{0x03, 0xE8}) {
+			t.Errorf("got frame %#x %x, want a normal close", opcode, payload)
+		}
+	})
+	c, err := dialWebSocket(context.Background(), url, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{`{"type":"ping"}`, long} {
+		if err := c.WriteText([]byte(text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Close()
+}
+
+func TestWebSocketRead(t *testing.T) {
+	const fin = 0x80
+	tests := []struct {
+		name  string
+		serve func(t *testing.T, rw *bufio.ReadWriter)
+		want  []string
+		// err is part of the error that ends the messages; io.EOF if empty.
+		err string
+	}{
+		{
+			name: "messages",
+			serve: func(t *testing.T, rw *bufio.ReadWriter) {
+				writeServerFrame(t, rw, fin|wsText, []byte("one"))
+				writeServerFrame(t, rw, fin|wsBinary, bytes.Repeat([]byte("b"), 300))
+				writeServerFrame(t, rw, fin|wsClose, []byte{0x03, 0xE8})
+				if opcode, _ := readClientFrame(t, rw); opcode != wsClose {
+					t.Errorf("the close was answered with %#x", opcode)
+				}
+			},
+			want: []string{"one", strings.Repeat("b", 300)},
+		},
+		{
+			name: "fragmented with a ping",
+			serve: func(t *testing.T, rw *bufio.ReadWriter) {
+				writeServerFrame(t, rw, wsText, []byte("hel"))
+				writeServerFrame(t, rw, fin|wsPing, []byte("are you there"))
+				writeServerFrame(t, rw, wsContinuation, []byte("l"))
+				writeServerFrame(t, rw, fin|wsContinuation, []byte("o"))
+				if opcode, payload := readClientFrame(t, rw); opcode != wsPong || string(payload) != "are you there" {
+					t.Errorf("the ping was answered with %#x %q, want a pong", opcode, payload)
+				}
+				writeServerFrame(t, rw, fin|wsClose, nil)
+				readClientFrame(t, rw)
+			},
+			want: []string{"hello"},
+		},
+		{
+			name: "largest message",
+			serve: func(t *testing.T, rw *bufio.ReadWriter) {
+				writeServerFrame(t, rw, wsText, make([]byte, wsMaxMessage/2))
+				writeServerFrame(t, rw, fin|wsContinuation, make([]byte, wsMaxMessage/2))
+				writeServerFrame(t, rw, fin|wsClose, nil)
+				readClientFrame(t, rw)
+			},
+			want: []string{string(make([]byte, wsMaxMessage))},
+		},
+		{
+			name: "frame too large",
+			serve: func(t *testing.T, rw *bufio.ReadWriter) {
+				// Only the header is needed: the client must not wait for the rest.
+				rw.Write(binary.BigEndian.AppendUint64([]byte{fin | wsText, 127}, wsMaxMessage+1))
+				rw.Flush()
+			},
+			err: "larger than",
+		},
+		{
+			name: "fragments too large",
+			serve: func(t *testing.T, rw *bufio.ReadWriter) {
+				writeServerFrame(t, rw, wsText, make([]byte, wsMaxMessage))
+				writeServerFrame(t, rw, fin|wsContinuation, []byte("x"))
+			},
+			err: "larger than",
+		},
+		{
+			name: "reserved bits",
+			serve: func(t *testing.T, rw *bufio.ReadWriter) {
+				writeServerFrame(t, rw, fin|0x40|wsText, []byte("compressed"))
+			},
+			err: "reserved bits",
+		},
+		{
+			name: "fragmented ping",
+			serve: func(t *testing.T, rw *bufio.ReadWriter) {
+				writeServerFrame(t, rw, wsPing, []byte("are you"))
+			},
+			err: "control frame",
+		},
+		{
+			name: "long ping",
+			serve: func(t *testing.T, rw *bufio.ReadWriter) {
+				writeServerFrame(t, rw, fin|wsPing, make([]byte, 126))
+			},
+			err: "control frame",
+		},
+		{
+			name: "continuation first",
+			serve: func(t *testing.T, rw *bufio.ReadWriter) {
+				writeServerFrame(t, rw, fin|wsContinuation, []byte("lo"))
+			},
+			err: "out of order",
+		},
+		{
+			name: "new message before the last ends",
+			serve: func(t *testing.T, rw *bufio.ReadWriter) {
+				writeServerFrame(t, rw, wsText, []byte("hel"))
+				writeServerFrame(t, rw, fin|wsText, []byte("lo"))
+			},
+			err: "out of order",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := wsServer(t, wsAccept, tt.serve)
+			c, err := dialWebSocket(context.Background(), url, nil, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.conn.Close()
+			var got []string
+			for {
+				message, err := c.ReadMessage()
+				if err != nil {
+					if tt.err == "" && !errors.Is(err, io.EOF) || tt.err != "" && !strings.Contains(err.Error(), tt.err) {
+						t.Errorf("ReadMessage = %v, want an error with %q", err, tt.err)
+					}
+					break
+				}
+				got = append(got, string(message))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("read %d messages, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("message %d is %d bytes %.20q, want %d bytes %.20q", i, len(got[i]), got[i], len(tt.want[i]), tt.want[i])
+				}
+			}
+		})
+	}
+}
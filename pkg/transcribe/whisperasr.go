@@ -0,0 +1,59 @@
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/url"
+)
+
+// transcribeWhisperASR sends audio as a multipart form to the /asr endpoint
+// of whisper-asr-webservice, with the settings in the query. It answers like
+// Whisper's verbose_json, with segments scored by the faster-whisper engine;
+// whisperX doesn't score them, so its transcripts come without a confidence.
+func (c *Client) transcribeWhisperASR(ctx context.Context, audio []byte, filename string) (*Result, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	if q.Get("task") == "" {
+		q.Set("task", "transcribe")
+	}
+	q.Set("output", "json")
+	q.Set("encode", "true")
+	if c.Language != "" {
+		q.Set("language", c.Language)
+	}
+	if c.Prompt != "" {
+		q.Set("initial_prompt", c.Prompt)
+	}
+	u.RawQuery = q.Encode()
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	fw, err := w.CreateFormFile("audio_file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(audio); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	var transcription transcriptionResponse
+	if err := c.send(ctx, "POST", u.String(), w.FormDataContentType(), &b, &transcription); err != nil {
+		return nil, err
+	}
+	res := &Result{Text: transcription.Text}
+	scored := false
+	for _, s := range transcription.Segments {
+		scored = scored || s.AvgLogprob != 0 || s.NoSpeechProb != 0
+	}
+	if scored {
+		res.Confidence, res.HasConfidence = transcription.confidence()
+	}
+	return res, nil
+}